@@ -0,0 +1,229 @@
+package api_keys
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	errs "person-service/errors"
+	db "person-service/internal/db/generated"
+	"person-service/logging"
+	"person-service/middleware"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+// maxOwnerLength bounds the size of the owner of a key
+const maxOwnerLength = 255
+
+// namePattern restricts key names to the identities used in KV_NAMESPACE_GRANTS
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,62}$`)
+
+// IssueKeyRequest represents the request body for issuing an API key
+type IssueKeyRequest struct {
+	Name      string     `json:"name"`
+	Owner     string     `json:"owner"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// APIKeysHandler handles the admin API that issues, lists and revokes API keys
+type APIKeysHandler struct {
+	queries *db.Queries
+}
+
+// NewAPIKeysHandler creates a new instance of APIKeysHandler
+func NewAPIKeysHandler(queries *db.Queries) *APIKeysHandler {
+	return &APIKeysHandler{
+		queries: queries,
+	}
+}
+
+// IssueKey handles POST /admin/api-keys - issues a new API key. The key itself is
+// only returned in this response; the database keeps its SHA-256 hash.
+func (h *APIKeysHandler) IssueKey(c echo.Context) error {
+	var req IssueKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Invalid request body",
+			ErrorCode: errs.ErrInvalidAPIKeyRequest,
+		})
+	}
+
+	scopes, err := validateIssueRequest(req, time.Now())
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   err.Error(),
+			ErrorCode: errs.ErrInvalidAPIKeyRequest,
+		})
+	}
+
+	var expiresAt pgtype.Timestamptz
+	if req.ExpiresAt != nil {
+		expiresAt = pgtype.Timestamptz{Time: *req.ExpiresAt, Valid: true}
+	}
+
+	// Use request context for trace propagation
+	ctx := c.Request().Context()
+
+	apiKey := "person-service-key-" + uuid.NewString()
+	key, err := h.queries.CreateAPIKey(ctx, db.CreateAPIKeyParams{
+		Name:      req.Name,
+		Owner:     req.Owner,
+		KeyHash:   middleware.HashAPIKey(apiKey),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.JSON(http.StatusConflict, errs.ErrorResponse{
+			Message:   "An active API key named \"" + req.Name + "\" already exists",
+			ErrorCode: errs.ErrAPIKeyNameConflict,
+		})
+	}
+	if err != nil {
+		logging.ErrorContext(ctx, "Failed to issue API key", "error", err)
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to issue API key",
+			ErrorCode: errs.ErrFailedIssueAPIKey,
+		})
+	}
+
+	logging.InfoContext(ctx, "API key issued",
+		"api_key", key.Name,
+		"owner", key.Owner,
+		"scopes", strings.Join(key.Scopes, ","),
+		"issued_by", middleware.APIKeyIdentity(c))
+
+	response := keyResponse(key)
+	response["key"] = apiKey
+	return c.JSON(http.StatusCreated, response)
+}
+
+// ListKeys handles GET /admin/api-keys - lists API keys without their hashes.
+// Revoked keys are included with include_revoked=true.
+func (h *APIKeysHandler) ListKeys(c echo.Context) error {
+	includeRevoked := false
+	if raw := c.QueryParam("include_revoked"); raw != "" {
+		var err error
+		includeRevoked, err = strconv.ParseBool(raw)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+				Message:   "Query parameter \"include_revoked\" must be true or false",
+				ErrorCode: errs.ErrInvalidAPIKeyRequest,
+			})
+		}
+	}
+
+	// Use request context for trace propagation
+	ctx := c.Request().Context()
+
+	keys, err := h.queries.ListAPIKeys(ctx, includeRevoked)
+	if err != nil {
+		logging.ErrorContext(ctx, "Failed to list API keys", "error", err)
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to list API keys",
+			ErrorCode: errs.ErrFailedListAPIKeys,
+		})
+	}
+
+	response := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		response = append(response, keyResponse(key))
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"api_keys": response,
+	})
+}
+
+// RevokeKey handles DELETE /admin/api-keys/:id - revokes an API key, which is
+// rejected from then on. Its name can be reused by a new key.
+func (h *APIKeysHandler) RevokeKey(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, errs.ErrorResponse{
+			Message:   "API key not found",
+			ErrorCode: errs.ErrAPIKeyNotFound,
+		})
+	}
+
+	// Use request context for trace propagation
+	ctx := c.Request().Context()
+
+	key, err := h.queries.RevokeAPIKey(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.JSON(http.StatusNotFound, errs.ErrorResponse{
+			Message:   "API key not found",
+			ErrorCode: errs.ErrAPIKeyNotFound,
+		})
+	}
+	if err != nil {
+		logging.ErrorContext(ctx, "Failed to revoke API key", "error", err)
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to revoke API key",
+			ErrorCode: errs.ErrFailedRevokeAPIKey,
+		})
+	}
+
+	logging.InfoContext(ctx, "API key revoked",
+		"api_key", key.Name,
+		"revoked_by", middleware.APIKeyIdentity(c))
+
+	return c.JSON(http.StatusOK, keyResponse(key))
+}
+
+// validateIssueRequest checks an issue request and returns its scopes sorted and deduplicated
+func validateIssueRequest(req IssueKeyRequest, now time.Time) ([]string, error) {
+	if !namePattern.MatchString(req.Name) {
+		return nil, errors.New("Field \"name\" must be 1-63 lowercase letters, digits, '_', '.' or '-'")
+	}
+	if req.Name == middleware.APIKeyIdentityBlue || req.Name == middleware.APIKeyIdentityGreen {
+		return nil, fmt.Errorf("Name %q is reserved for the environment API keys", req.Name)
+	}
+	if strings.TrimSpace(req.Owner) == "" || len(req.Owner) > maxOwnerLength {
+		return nil, fmt.Errorf("Field \"owner\" is required and must be at most %d characters", maxOwnerLength)
+	}
+	if len(req.Scopes) == 0 {
+		return nil, errors.New("Field \"scopes\" must list at least one scope")
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(middleware.Scopes, scope) {
+			return nil, fmt.Errorf("Unknown scope %q, expected one of %s", scope, strings.Join(middleware.Scopes, ", "))
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return nil, errors.New("Field \"expires_at\" must be in the future")
+	}
+
+	scopes := slices.Clone(req.Scopes)
+	slices.Sort(scopes)
+	return slices.Compact(scopes), nil
+}
+
+// keyResponse builds the JSON response of an API key, leaving out its hash
+func keyResponse(key db.ApiKey) map[string]interface{} {
+	response := map[string]interface{}{
+		"id":         key.ID,
+		"name":       key.Name,
+		"owner":      key.Owner,
+		"scopes":     key.Scopes,
+		"created_at": key.CreatedAt.Time,
+	}
+	if key.ExpiresAt.Valid {
+		response["expires_at"] = key.ExpiresAt.Time
+	}
+	if key.LastUsedAt.Valid {
+		response["last_used_at"] = key.LastUsedAt.Time
+	}
+	if key.RevokedAt.Valid {
+		response["revoked_at"] = key.RevokedAt.Time
+	}
+	return response
+}
@@ -0,0 +1,183 @@
+package api_keys
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	db "person-service/internal/db/generated"
+	"person-service/internal/testdb"
+	"person-service/middleware"
+)
+
+var pool *pgxpool.Pool
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+	var err error
+	pool, err = testdb.GetPool(ctx)
+	if err != nil {
+		log.Fatalf("Failed to get pool: %v", err)
+	}
+	if err := testdb.RunMigrations(ctx, pool); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	os.Exit(m.Run())
+}
+
+func newIssueContext(body string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/admin/api-keys", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	return e.NewContext(req, rec), rec
+}
+
+func newRevokeContext(id string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodDelete, "/admin/api-keys/"+id, nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(id)
+	return c, rec
+}
+
+func TestValidateIssueRequest(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	future := now.Add(time.Hour)
+	past := now.Add(-time.Hour)
+
+	scopes, err := validateIssueRequest(IssueKeyRequest{
+		Name:   "billing-sync",
+		Owner:  "billing team",
+		Scopes: []string{"kv", "attributes:read", "kv"},
+	}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"attributes:read", "kv"}, scopes)
+
+	tests := []struct {
+		name    string
+		req     IssueKeyRequest
+		message string
+	}{
+		{"invalid name", IssueKeyRequest{Name: "Billing Sync", Owner: "o", Scopes: []string{"kv"}}, "Field \"name\""},
+		{"reserved name", IssueKeyRequest{Name: "blue", Owner: "o", Scopes: []string{"kv"}}, "reserved"},
+		{"missing owner", IssueKeyRequest{Name: "n", Owner: " ", Scopes: []string{"kv"}}, "Field \"owner\""},
+		{"no scopes", IssueKeyRequest{Name: "n", Owner: "o"}, "at least one scope"},
+		{"unknown scope", IssueKeyRequest{Name: "n", Owner: "o", Scopes: []string{"kv:write"}}, "Unknown scope \"kv:write\""},
+		{"expired", IssueKeyRequest{Name: "n", Owner: "o", Scopes: []string{"kv"}, ExpiresAt: &past}, "in the future"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := validateIssueRequest(tt.req, now)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.message)
+			}
+		})
+	}
+
+	_, err = validateIssueRequest(IssueKeyRequest{Name: "n", Owner: "o", Scopes: []string{"kv"}, ExpiresAt: &future}, now)
+	assert.NoError(t, err)
+}
+
+func TestIssueKey_InvalidRequest(t *testing.T) {
+	handler := NewAPIKeysHandler(db.New(pool))
+
+	for _, body := range []string{
+		`{"name":`,
+		`{"name":"n","owner":"o","scopes":["superuser"]}`,
+	} {
+		c, rec := newIssueContext(body)
+		assert.NoError(t, handler.IssueKey(c))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+		assert.Contains(t, rec.Body.String(), "API_006_INVALID_API_KEY_REQUEST", body)
+	}
+}
+
+// TestIssueKey_Lifecycle tests issuing, verifying, listing and revoking a key
+func TestIssueKey_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	queries := db.New(pool)
+	handler := NewAPIKeysHandler(queries)
+
+	c, rec := newIssueContext(`{"name":"billing","owner":"billing team","scopes":["kv","attributes:read"]}`)
+	assert.NoError(t, handler.IssueKey(c))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var issued struct {
+		ID     int64    `json:"id"`
+		Key    string   `json:"key"`
+		Scopes []string `json:"scopes"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &issued))
+	assert.True(t, strings.HasPrefix(issued.Key, "person-service-key-"))
+	assert.Equal(t, []string{"attributes:read", "kv"}, issued.Scopes)
+	assert.NotContains(t, rec.Body.String(), "key_hash")
+
+	// Only the hash is stored, and it authenticates the key
+	stored, err := queries.GetAPIKeyByHash(ctx, middleware.HashAPIKey(issued.Key))
+	assert.NoError(t, err)
+	assert.Equal(t, "billing", stored.Name)
+	assert.NotEqual(t, issued.Key, stored.KeyHash)
+
+	// A second active key cannot take the same name
+	c, rec = newIssueContext(`{"name":"billing","owner":"someone else","scopes":["kv"]}`)
+	assert.NoError(t, handler.IssueKey(c))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "API_205_API_KEY_NAME_CONFLICT")
+
+	e := echo.New()
+	rec = httptest.NewRecorder()
+	assert.NoError(t, handler.ListKeys(e.NewContext(httptest.NewRequest(http.MethodGet, "/admin/api-keys", nil), rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"name":"billing"`)
+	assert.NotContains(t, rec.Body.String(), issued.Key)
+
+	c, rec = newRevokeContext(strconv.FormatInt(issued.ID, 10))
+	assert.NoError(t, handler.RevokeKey(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"revoked_at"`)
+
+	_, err = queries.GetAPIKeyByHash(ctx, middleware.HashAPIKey(issued.Key))
+	assert.Error(t, err)
+
+	// Revoked keys are listed only on request
+	rec = httptest.NewRecorder()
+	assert.NoError(t, handler.ListKeys(e.NewContext(httptest.NewRequest(http.MethodGet, "/admin/api-keys", nil), rec)))
+	assert.JSONEq(t, `{"api_keys":[]}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	assert.NoError(t, handler.ListKeys(e.NewContext(httptest.NewRequest(http.MethodGet, "/admin/api-keys?include_revoked=true", nil), rec)))
+	assert.Contains(t, rec.Body.String(), `"name":"billing"`)
+
+	// The name is free again once revoked
+	c, rec = newIssueContext(`{"name":"billing","owner":"billing team","scopes":["kv"]}`)
+	assert.NoError(t, handler.IssueKey(c))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+}
+
+func TestRevokeKey_NotFound(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	handler := NewAPIKeysHandler(db.New(pool))
+
+	for _, id := range []string{"42", "abc"} {
+		c, rec := newRevokeContext(id)
+		assert.NoError(t, handler.RevokeKey(c))
+		assert.Equal(t, http.StatusNotFound, rec.Code, id)
+		assert.Contains(t, rec.Body.String(), "API_101_API_KEY_NOT_FOUND", id)
+	}
+}
@@ -9,17 +9,25 @@ type ErrorResponse struct {
 // Error codes for Person Attributes endpoints
 const (
 	// Validation errors (1000-1099)
-	ErrInvalidPersonID          = "PA_001_INVALID_PERSON_ID"
-	ErrInvalidAttributeID       = "PA_002_INVALID_ATTRIBUTE_ID"
-	ErrInvalidRequestBody       = "PA_003_INVALID_REQUEST_BODY"
-	ErrMissingRequiredFieldKey  = "PA_004_MISSING_KEY"
-	ErrMissingRequiredFieldMeta = "PA_005_MISSING_META"
+	ErrInvalidPersonID           = "PA_001_INVALID_PERSON_ID"
+	ErrInvalidAttributeID        = "PA_002_INVALID_ATTRIBUTE_ID"
+	ErrInvalidRequestBody        = "PA_003_INVALID_REQUEST_BODY"
+	ErrMissingRequiredFieldKey   = "PA_004_MISSING_KEY"
+	ErrMissingRequiredFieldMeta  = "PA_005_MISSING_META"
 	ErrInvalidAttributeIDFormat  = "PA_006_INVALID_ATTRIBUTE_ID_FORMAT"
 	ErrMissingRequiredFieldValue = "PA_007_MISSING_VALUE"
+	ErrInvalidExportOptions      = "PA_008_INVALID_EXPORT_OPTIONS"
+	ErrInvalidMergeRequest       = "PA_009_INVALID_MERGE_REQUEST"
+	ErrInvalidIdentifier         = "PA_010_INVALID_IDENTIFIER"
+	ErrInvalidCallerPolicy       = "PA_011_INVALID_CALLER_POLICY"
+	ErrInvalidAttributePolicy    = "PA_012_INVALID_ATTRIBUTE_POLICY"
 
 	// Resource not found errors (1100-1199)
-	ErrPersonNotFound    = "PA_101_PERSON_NOT_FOUND"
-	ErrAttributeNotFound = "PA_102_ATTRIBUTE_NOT_FOUND"
+	ErrPersonNotFound       = "PA_101_PERSON_NOT_FOUND"
+	ErrAttributeNotFound    = "PA_102_ATTRIBUTE_NOT_FOUND"
+	ErrErasureNotFound      = "PA_103_ERASURE_NOT_FOUND"
+	ErrSourcePersonNotFound = "PA_104_SOURCE_PERSON_NOT_FOUND"
+	ErrIdentifierNotFound   = "PA_105_IDENTIFIER_NOT_FOUND"
 
 	// Database operation errors (1200-1299)
 	ErrFailedVerifyPerson        = "PA_201_FAILED_VERIFY_PERSON"
@@ -31,34 +39,104 @@ const (
 	ErrFailedDeleteAttribute     = "PA_207_FAILED_DELETE_ATTRIBUTE"
 	ErrFailedUpdateAttributeKey  = "PA_208_FAILED_UPDATE_KEY"
 	ErrVersionConflict           = "PA_209_VERSION_CONFLICT"
+	ErrFailedRetrieveImages      = "PA_210_FAILED_RETRIEVE_IMAGES"
+	ErrFailedRetrieveAuditLog    = "PA_211_FAILED_RETRIEVE_AUDIT_LOG"
+	ErrFailedErasePerson         = "PA_212_FAILED_ERASE_PERSON"
+	ErrFailedRetrieveErasure     = "PA_213_FAILED_RETRIEVE_ERASURE"
+	ErrFailedMergePersons        = "PA_214_FAILED_MERGE_PERSONS"
+	ErrIdentifierConflict        = "PA_215_IDENTIFIER_CONFLICT"
+	ErrFailedAttachIdentifier    = "PA_216_FAILED_ATTACH_IDENTIFIER"
+	ErrFailedRetrieveIdentifiers = "PA_217_FAILED_RETRIEVE_IDENTIFIERS"
+	ErrFailedDetachIdentifier    = "PA_218_FAILED_DETACH_IDENTIFIER"
 
 	// Audit logging errors (1300-1399)
-	ErrFailedAuditLog = "PA_301_FAILED_AUDIT_LOG"
+	ErrFailedAuditLog  = "PA_301_FAILED_AUDIT_LOG"
+	ErrCallerMismatch  = "PA_302_CALLER_MISMATCH"
+	ErrAttributeDenied = "PA_303_ATTRIBUTE_DENIED"
 )
 
 // Error codes for Key-Value endpoints
 const (
 	// Validation errors (2000-2099)
-	ErrKVInvalidRequestBody = "KV_001_INVALID_REQUEST_BODY"
-	ErrKVMissingKeyOrValue  = "KV_002_MISSING_KEY_OR_VALUE"
-	ErrKVMissingKeyParam    = "KV_003_MISSING_KEY_PARAM"
+	ErrKVInvalidRequestBody         = "KV_001_INVALID_REQUEST_BODY"
+	ErrKVMissingKeyOrValue          = "KV_002_MISSING_KEY_OR_VALUE"
+	ErrKVMissingKeyParam            = "KV_003_MISSING_KEY_PARAM"
+	ErrKVInvalidTTL                 = "KV_004_INVALID_TTL"
+	ErrKVInvalidReaperConfig        = "KV_005_INVALID_REAPER_CONFIG"
+	ErrKVInvalidCondition           = "KV_006_INVALID_CONDITION"
+	ErrKVInvalidListParams          = "KV_007_INVALID_LIST_PARAMS"
+	ErrKVInvalidWatchParams         = "KV_008_INVALID_WATCH_PARAMS"
+	ErrKVInvalidNamespace           = "KV_009_INVALID_NAMESPACE"
+	ErrKVInvalidNamespaceGrants     = "KV_010_INVALID_NAMESPACE_GRANTS"
+	ErrKVInvalidIncrement           = "KV_011_INVALID_INCREMENT"
+	ErrKVInvalidTransaction         = "KV_012_INVALID_TRANSACTION"
+	ErrKVInvalidEncryptedNamespaces = "KV_013_INVALID_ENCRYPTED_NAMESPACES"
+	ErrKVEncryptedIncrement         = "KV_014_ENCRYPTED_INCREMENT"
+	ErrKVInvalidValueLimits         = "KV_015_INVALID_VALUE_LIMITS"
+	ErrKVValueTooLarge              = "KV_016_VALUE_TOO_LARGE"
+	ErrKVInvalidSnapshot            = "KV_017_INVALID_SNAPSHOT"
+	ErrKVInvalidImportParams        = "KV_018_INVALID_IMPORT_PARAMS"
+	ErrKVSnapshotTooLarge           = "KV_019_SNAPSHOT_TOO_LARGE"
 
 	// Resource not found errors (2100-2199)
 	ErrKVKeyNotFound = "KV_101_KEY_NOT_FOUND"
 
 	// Database operation errors (2200-2299)
-	ErrKVFailedSetValue      = "KV_201_FAILED_SET_VALUE"
-	ErrKVFailedRetrieveValue = "KV_202_FAILED_RETRIEVE_VALUE"
-	ErrKVFailedDeleteValue   = "KV_203_FAILED_DELETE_VALUE"
+	ErrKVFailedSetValue          = "KV_201_FAILED_SET_VALUE"
+	ErrKVFailedRetrieveValue     = "KV_202_FAILED_RETRIEVE_VALUE"
+	ErrKVFailedDeleteValue       = "KV_203_FAILED_DELETE_VALUE"
+	ErrKVFailedReapExpired       = "KV_204_FAILED_REAP_EXPIRED"
+	ErrKVVersionConflict         = "KV_205_VERSION_CONFLICT"
+	ErrKVKeyExists               = "KV_206_KEY_EXISTS"
+	ErrKVPreconditionFailed      = "KV_207_PRECONDITION_FAILED"
+	ErrKVFailedListKeys          = "KV_208_FAILED_LIST_KEYS"
+	ErrKVWatchUnavailable        = "KV_209_WATCH_UNAVAILABLE"
+	ErrKVWatchConnectionFailed   = "KV_210_WATCH_CONNECTION_FAILED"
+	ErrKVValueNotInteger         = "KV_211_VALUE_NOT_INTEGER"
+	ErrKVCounterOutOfRange       = "KV_212_COUNTER_OUT_OF_RANGE"
+	ErrKVFailedTransaction       = "KV_213_FAILED_TRANSACTION"
+	ErrKVTransactionsUnavailable = "KV_214_TRANSACTIONS_UNAVAILABLE"
+	ErrKVFailedExport            = "KV_215_FAILED_EXPORT"
+	ErrKVFailedImport            = "KV_216_FAILED_IMPORT"
+
+	// Authorization errors (2300-2399)
+	ErrKVNamespaceForbidden = "KV_301_NAMESPACE_FORBIDDEN"
+	ErrKVNamespaceReadOnly  = "KV_302_NAMESPACE_READ_ONLY"
 )
 
-// Error codes for API Key middleware
+// Error codes for API Key middleware and API key management
 const (
-	// Authentication errors (3000-3099)
-	ErrMissingAPIKey        = "API_001_MISSING_API_KEY"
-	ErrInvalidAPIKeyFormat  = "API_002_INVALID_API_KEY_FORMAT"
-	ErrAPIKeysNotConfigured = "API_003_KEYS_NOT_CONFIGURED"
-	ErrInvalidAPIKey        = "API_004_INVALID_API_KEY"
+	// Authentication and validation errors (3000-3099)
+	ErrMissingAPIKey           = "API_001_MISSING_API_KEY"
+	ErrInvalidAPIKeyFormat     = "API_002_INVALID_API_KEY_FORMAT"
+	ErrAPIKeysNotConfigured    = "API_003_KEYS_NOT_CONFIGURED"
+	ErrInvalidAPIKey           = "API_004_INVALID_API_KEY"
+	ErrAPIKeyExpired           = "API_005_API_KEY_EXPIRED"
+	ErrInvalidAPIKeyRequest    = "API_006_INVALID_API_KEY_REQUEST"
+	ErrInvalidBearerToken      = "API_007_INVALID_BEARER_TOKEN"
+	ErrBearerTokenExpired      = "API_008_BEARER_TOKEN_EXPIRED"
+	ErrInvalidJWTConfig        = "API_009_INVALID_JWT_CONFIG"
+	ErrFailedLoadJWKS          = "API_010_FAILED_LOAD_JWKS"
+	ErrInvalidSignature        = "API_011_INVALID_SIGNATURE"
+	ErrSignatureExpired        = "API_012_SIGNATURE_EXPIRED"
+	ErrReplayedNonce           = "API_013_REPLAYED_NONCE"
+	ErrInvalidSigningConfig    = "API_014_INVALID_SIGNING_CONFIG"
+	ErrInvalidClientCert       = "API_015_INVALID_CLIENT_CERTIFICATE"
+	ErrInvalidClientCertConfig = "API_016_INVALID_CLIENT_CERT_CONFIG"
+	ErrSignedBodyTooLarge      = "API_017_SIGNED_BODY_TOO_LARGE"
+
+	// Resource not found errors (3100-3199)
+	ErrAPIKeyNotFound = "API_101_API_KEY_NOT_FOUND"
+
+	// Database operation errors (3200-3299)
+	ErrFailedVerifyAPIKey = "API_201_FAILED_VERIFY_API_KEY"
+	ErrFailedIssueAPIKey  = "API_202_FAILED_ISSUE_API_KEY"
+	ErrFailedListAPIKeys  = "API_203_FAILED_LIST_API_KEYS"
+	ErrFailedRevokeAPIKey = "API_204_FAILED_REVOKE_API_KEY"
+	ErrAPIKeyNameConflict = "API_205_API_KEY_NAME_CONFLICT"
+
+	// Authorization errors (3300-3399)
+	ErrInsufficientScope = "API_301_INSUFFICIENT_SCOPE"
 )
 
 // Error codes for Health Check
@@ -78,3 +156,43 @@ const (
 	ErrFailedStartServer    = "DB_006_FAILED_START_SERVER"
 	ErrFailedShutdownServer = "DB_007_FAILED_SHUTDOWN_SERVER"
 )
+
+// Error codes for Retention
+const (
+	// Retention errors (6000-6099)
+	ErrInvalidRetentionConfig = "RT_001_INVALID_CONFIG"
+	ErrRetentionRunFailed     = "RT_201_RUN_FAILED"
+)
+
+// Error codes for TLS
+const (
+	// TLS errors (7000-7099)
+	ErrInvalidTLSConfig        = "TLS_001_INVALID_CONFIG"
+	ErrFailedLoadCertificate   = "TLS_002_FAILED_LOAD_CERTIFICATE"
+	ErrFailedReloadCertificate = "TLS_201_FAILED_RELOAD_CERTIFICATE"
+)
+
+// Error codes for Rate Limiting
+const (
+	// Rate limit errors (8000-8099)
+	ErrInvalidRateLimitConfig = "RL_001_INVALID_CONFIG"
+	ErrRateLimitStoreFailed   = "RL_201_STORE_FAILED"
+	ErrRateLimitExceeded      = "RL_301_RATE_LIMIT_EXCEEDED"
+)
+
+// Error codes for Tracing
+const (
+	// Tracing errors (9000-9099)
+	ErrInvalidTracingConfig      = "TR_001_INVALID_CONFIG"
+	ErrFailedCreateTraceExporter = "TR_002_FAILED_CREATE_EXPORTER"
+	ErrTraceExportFailed         = "TR_201_EXPORT_FAILED"
+)
+
+// Error codes for Logging
+const (
+	// Logging errors (10000-10099)
+	ErrInvalidAccessLogConfig = "LOG_001_INVALID_ACCESS_LOG_CONFIG"
+	ErrInvalidLogConfig       = "LOG_002_INVALID_CONFIG"
+	ErrInvalidLogLevel        = "LOG_003_INVALID_LEVEL"
+	ErrFailedOpenLogOutput    = "LOG_201_FAILED_OPEN_OUTPUT"
+)
@@ -0,0 +1,60 @@
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"person-service/integration/testutil"
+
+	"github.com/cucumber/godog"
+)
+
+func registerAPIKeySteps(sc *godog.ScenarioContext, tc *TestContext) {
+	sc.Step(`^I save the issued API key$`, func() error {
+		var issued struct {
+			ID  int64  `json:"id"`
+			Key string `json:"key"`
+		}
+		if err := json.Unmarshal(tc.Response.Body.Bytes(), &issued); err != nil {
+			return fmt.Errorf("response is not an issued API key: %w", err)
+		}
+		if issued.Key == "" {
+			return fmt.Errorf("response has no key, body: %s", tc.Response.Body.String())
+		}
+		tc.IssuedAPIKey = issued.Key
+		tc.IssuedAPIKeyID = issued.ID
+		return nil
+	})
+
+	sc.Step(`^I revoke the issued API key$`, func() error {
+		tc.Response = tc.Server.DELETE("/admin/api-keys/"+strconv.FormatInt(tc.IssuedAPIKeyID, 10), testutil.WithAPIKey())
+		if tc.Response.Code != 200 {
+			return fmt.Errorf("expected status 200 but got %d, body: %s", tc.Response.Code, tc.Response.Body.String())
+		}
+		return nil
+	})
+
+	sc.Step(`^I send a (GET|DELETE) request to "([^"]*)" with the issued API key$`, func(method, path string) error {
+		tc.Response = tc.Server.Request(method, path, nil, testutil.WithCustomAPIKey(tc.IssuedAPIKey))
+		return nil
+	})
+
+	sc.Step(`^I send a PUT request to "/admin/log-level" with body:$`, func(body *godog.DocString) error {
+		var jsonBody map[string]interface{}
+		if err := json.Unmarshal([]byte(body.Content), &jsonBody); err != nil {
+			return fmt.Errorf("invalid JSON in docstring: %w", err)
+		}
+		tc.Response = tc.Server.PUT("/admin/log-level", jsonBody, testutil.WithAPIKey())
+		return nil
+	})
+
+	sc.Step(`^I send a POST request to "([^"]*)" with the issued API key with body:$`, func(path string, body *godog.DocString) error {
+		var jsonBody map[string]interface{}
+		if err := json.Unmarshal([]byte(body.Content), &jsonBody); err != nil {
+			return fmt.Errorf("invalid JSON in docstring: %w", err)
+		}
+		tc.Response = tc.Server.POST(path, jsonBody, testutil.WithCustomAPIKey(tc.IssuedAPIKey))
+		return nil
+	})
+}
@@ -0,0 +1,93 @@
+Feature: API Key Management
+  As an administrator
+  I want to issue, list and revoke scoped API keys
+  So that each client only gets the access it needs
+
+  Background:
+    Given the service is running
+      And I have a valid API key
+
+  Scenario: Issued key only has its scopes
+    Given a key-value pair exists with key "greeting" and value "hello"
+    When I send a POST request to "/admin/api-keys" with body:
+      """
+      {"name": "reports", "owner": "reporting team", "scopes": ["kv"]}
+      """
+    Then the response status should be 201
+      And the response should contain field "name" with value "reports"
+      And I save the issued API key
+    When I send a GET request to "/api/key-value/greeting" with the issued API key
+    Then the response status should be 200
+      And the response should contain field "value" with value "hello"
+    When I send a GET request to "/persons/resolve?system=crm&externalId=1" with the issued API key
+    Then the response status should be 403
+      And the response should contain "error_code" with value "API_301_INSUFFICIENT_SCOPE"
+
+  Scenario: Only admin keys manage keys
+    When I send a POST request to "/admin/api-keys" with body:
+      """
+      {"name": "reports", "owner": "reporting team", "scopes": ["kv", "attributes:read"]}
+      """
+    Then the response status should be 201
+      And I save the issued API key
+    When I send a POST request to "/admin/api-keys" with the issued API key with body:
+      """
+      {"name": "escalated", "owner": "reporting team", "scopes": ["admin"]}
+      """
+    Then the response status should be 403
+      And the response should contain "error_code" with value "API_301_INSUFFICIENT_SCOPE"
+
+  Scenario: Revoked key is rejected
+    When I send a POST request to "/admin/api-keys" with body:
+      """
+      {"name": "reports", "owner": "reporting team", "scopes": ["kv"]}
+      """
+    Then the response status should be 201
+      And I save the issued API key
+    When I revoke the issued API key
+      And I send a GET request to "/api/key-value/greeting" with the issued API key
+    Then the response status should be 401
+      And the response should contain "error_code" with value "API_004_INVALID_API_KEY"
+
+  Scenario: Only admin keys change the log level
+    When I send a PUT request to "/admin/log-level" with body:
+      """
+      {"level": "debug"}
+      """
+    Then the response status should be 200
+      And the response should contain "level" with value "DEBUG"
+    When I send a PUT request to "/admin/log-level" with body:
+      """
+      {"level": "info"}
+      """
+    Then the response status should be 200
+      And the response should contain "level" with value "INFO"
+    When I send a POST request to "/admin/api-keys" with body:
+      """
+      {"name": "reports", "owner": "reporting team", "scopes": ["kv"]}
+      """
+    Then the response status should be 201
+      And I save the issued API key
+    When I send a GET request to "/admin/log-level" with the issued API key
+    Then the response status should be 403
+      And the response should contain "error_code" with value "API_301_INSUFFICIENT_SCOPE"
+
+  Scenario: Erasure and merge need the persons:erase scope
+    When I send a POST request to "/admin/api-keys" with body:
+      """
+      {"name": "editor", "owner": "crm team", "scopes": ["attributes:read", "attributes:write"]}
+      """
+    Then the response status should be 201
+      And I save the issued API key
+    When I send a POST request to "/persons/123e4567-e89b-12d3-a456-426614174000/erasure" with the issued API key with body:
+      """
+      {"meta": {"caller": "editor", "reason": "erasure request", "traceId": "erase-scope-1"}}
+      """
+    Then the response status should be 403
+      And the response should contain "error_code" with value "API_301_INSUFFICIENT_SCOPE"
+    When I send a POST request to "/persons/123e4567-e89b-12d3-a456-426614174000/merge" with the issued API key with body:
+      """
+      {"sourcePersonId": "123e4567-e89b-12d3-a456-426614174001", "meta": {"caller": "editor", "reason": "duplicate", "traceId": "merge-scope-1"}}
+      """
+    Then the response status should be 403
+      And the response should contain "error_code" with value "API_301_INSUFFICIENT_SCOPE"
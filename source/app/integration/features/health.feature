@@ -31,3 +31,15 @@ Feature: Health Check Integration Tests
     Then the response status should be 200
     And the request should complete within timeout
 
+  Scenario: Metrics endpoint counts requests by route and status
+    When I send a GET request to "/health"
+    And I send a GET request to "/metrics"
+    Then the response status should be 200
+    And the metrics should contain a line starting with 'person_service_http_requests_total{method="GET",route="/health",status="200"}'
+    And the metrics should contain a line starting with 'person_service_http_request_duration_seconds_bucket{method="GET",route="/health",status="200"'
+
+  Scenario: Health endpoint continues the W3C trace of the caller
+    When I send a GET request to "/health" with traceparent "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+    Then the response status should be 200
+    And the response header "X-Trace-ID" should be "4bf92f3577b34da6a3ce929d0e0e4736"
+    And the response header "traceparent" should start with "00-4bf92f3577b34da6a3ce929d0e0e4736-"
@@ -218,3 +218,203 @@ Feature: Key Value integration tests
     Then the response status should be 200
     When I send a GET request to "/api/key-value/lifecycle-key"
     Then the response status should be 404
+
+  Scenario: Create key-value with a TTL
+    When I send a POST request to "/api/key-value" with body:
+      """
+      {"key": "ttl-key", "value": "ttl-value", "ttl_seconds": 300}
+      """
+    Then the response status should be 201
+      And the response should contain field "expires_at"
+      And the response should contain field "ttl_seconds"
+    When I send a GET request to "/api/key-value/ttl-key"
+    Then the response status should be 200
+      And the response should contain field "ttl_seconds"
+
+  Scenario: Invalid TTL
+    When I send a POST request to "/api/key-value" with body:
+      """
+      {"key": "ttl-key", "value": "ttl-value", "ttl_seconds": 0}
+      """
+    Then the response status should be 400
+      And the error message should contain "ttl_seconds"
+
+  Scenario: Compare-and-swap on a key version
+    When I send a POST request to "/api/key-value" with body:
+      """
+      {"key": "cas-key", "value": "v1", "if_absent": true}
+      """
+    Then the response status should be 201
+      And the response should contain field "version"
+    When I send a POST request to "/api/key-value" with body:
+      """
+      {"key": "cas-key", "value": "v2", "if_absent": true}
+      """
+    Then the response status should be 409
+    When I send a POST request to "/api/key-value" with body:
+      """
+      {"key": "cas-key", "value": "v2", "if_version": 1}
+      """
+    Then the response status should be 200
+    When I send a POST request to "/api/key-value" with body:
+      """
+      {"key": "cas-key", "value": "v3", "if_version": 1}
+      """
+    Then the response status should be 409
+      And the error message should contain "Version conflict"
+
+  Scenario: List keys by prefix
+    Given a key-value pair exists with key "feature/alpha" and value "on"
+      And a key-value pair exists with key "feature/beta" and value "off"
+      And a key-value pair exists with key "config/gamma" and value "1"
+    When I send a GET request to "/api/key-value?prefix=feature/&limit=1"
+    Then the response status should be 200
+      And the response should contain field "next_cursor"
+    When I send a GET request to "/api/key-value/_count?prefix=feature/"
+    Then the response status should be 200
+      And the response should contain field "count"
+
+  Scenario: Key-value requests require an API key
+    When I send a GET request to "/api/key-value/any-key" without an API key
+    Then the response status should be 401
+
+  Scenario: Namespaces isolate keys
+    When I send a POST request to "/api/key-value" in namespace "team-blue" with the blue API key with body:
+      """
+      {"key": "ns-key", "value": "blue-value"}
+      """
+    Then the response status should be 201
+      And the response should contain field "namespace" with value "team-blue"
+    When I send a GET request to "/api/key-value/ns-key" in namespace "team-blue" with the green API key
+    Then the response status should be 200
+      And the response should contain field "value" with value "blue-value"
+    When I send a GET request to "/api/key-value/ns-key"
+    Then the response status should be 404
+
+  Scenario: Read-only namespace rejects writes
+    When I send a POST request to "/api/key-value" in namespace "team-blue" with the green API key with body:
+      """
+      {"key": "ns-key", "value": "green-value"}
+      """
+    Then the response status should be 403
+      And the error message should contain "only read"
+    When I send a DELETE request to "/api/key-value/ns-key" in namespace "team-blue" with the green API key
+    Then the response status should be 403
+
+  Scenario: Namespace not granted to the API key
+    When I send a GET request to "/api/key-value/ns-key" in namespace "team-red" with the blue API key
+    Then the response status should be 403
+      And the error message should contain "no access"
+
+  Scenario: Increment and decrement a counter
+    When I send a POST request to "/api/key-value/_incr" with body:
+      """
+      {"key": "counter-key", "delta": 5}
+      """
+    Then the response status should be 201
+      And the response should contain field "value" with value "5"
+    When I send a POST request to "/api/key-value/_incr" with body:
+      """
+      {"key": "counter-key", "delta": -2}
+      """
+    Then the response status should be 200
+      And the response should contain field "value" with value "3"
+
+  Scenario: Increment a non-integer value
+    Given a key-value pair exists with key "text-key" and value "hello"
+    When I send a POST request to "/api/key-value/_incr" with body:
+      """
+      {"key": "text-key"}
+      """
+    Then the response status should be 409
+      And the error message should contain "not an integer"
+
+  Scenario: Transaction is applied atomically
+    Given a key-value pair exists with key "txn-state" and value "pending"
+    When I send a POST request to "/api/key-value/_txn" with body:
+      """
+      {"operations": [
+        {"op": "set", "key": "txn-owner", "value": "worker"},
+        {"op": "check", "key": "txn-state", "if_version": 5}
+      ]}
+      """
+    Then the response status should be 409
+      And the key "txn-owner" should not exist in the database
+    When I send a POST request to "/api/key-value/_txn" with body:
+      """
+      {"operations": [
+        {"op": "set", "key": "txn-owner", "value": "worker"},
+        {"op": "set", "key": "txn-state", "value": "running", "if_version": 1}
+      ]}
+      """
+    Then the response status should be 200
+      And the response should contain field "operations"
+      And the key "txn-owner" should exist in the database
+
+  Scenario: Encrypted value is decrypted transparently
+    When I send a POST request to "/api/key-value" with body:
+      """
+      {"key": "secret-key", "value": "s3cret", "encrypted": true}
+      """
+    Then the response status should be 201
+      And the response should contain field "encrypted" with value "true"
+      And the key "secret-key" should be stored encrypted in the database
+    When I send a GET request to "/api/key-value/secret-key"
+    Then the response status should be 200
+      And the response should contain field "value" with value "s3cret"
+
+  Scenario: Encrypted namespace encrypts every value
+    When I send a POST request to "/api/key-value" in namespace "secrets" with the blue API key with body:
+      """
+      {"key": "db-password", "value": "hunter2"}
+      """
+    Then the response status should be 201
+      And the key "db-password" should be stored encrypted in the database
+    When I send a GET request to "/api/key-value/db-password" in namespace "secrets" with the blue API key
+    Then the response status should be 200
+      And the response should contain field "value" with value "hunter2"
+
+  Scenario: Binary value keeps its content type
+    When I send a PUT request to "/api/key-value/ca-cert" with content type "application/x-pem-file" and body:
+      """
+      -----BEGIN CERTIFICATE-----
+      MIIB
+      -----END CERTIFICATE-----
+      """
+    Then the response status should be 201
+      And the response should contain field "content_type" with value "application/x-pem-file"
+    When I send a GET request to "/api/key-value/ca-cert"
+    Then the response status should be 200
+      And the response content type should be "application/x-pem-file"
+      And the response body should be:
+      """
+      -----BEGIN CERTIFICATE-----
+      MIIB
+      -----END CERTIFICATE-----
+      """
+
+  Scenario: Export keys as a JSON Lines snapshot
+    Given a key-value pair exists with key "cfg/name" and value "person-service"
+      And a key-value pair exists with key "other" and value "skipped"
+    When I send a GET request to "/api/key-value/_export?prefix=cfg/"
+    Then the response status should be 200
+      And the response content type should be "application/x-ndjson"
+      And the response body should contain "cfg/name"
+      And the response body should contain "person-service"
+
+  Scenario: Replace import with dry run reports differences without writing
+    Given a key-value pair exists with key "cfg/old" and value "stale"
+    When I send a POST request to "/api/key-value/_import?mode=replace&prefix=cfg/&dry_run=true" with snapshot:
+      """
+      {"key": "cfg/new", "value": "fresh"}
+      """
+    Then the response status should be 200
+      And the key "cfg/old" should exist in the database
+      And the key "cfg/new" should not exist in the database
+    When I send a POST request to "/api/key-value/_import?mode=replace&prefix=cfg/" with snapshot:
+      """
+      {"key": "cfg/new", "value": "fresh"}
+      """
+    Then the response status should be 200
+      And the key "cfg/old" should not exist in the database
+      And the key "cfg/new" should exist in the database
@@ -381,6 +381,7 @@ Feature: Person Attributes Management
     Then the response status should be 201
     And an audit record should be created for traceId "201e8400-e29b-41d4-a716-446655440015"
     And the audit record should contain caller "user123" and reason "add audited"
+    And the audit record should have principal "blue"
 
   # Idempotency Verification
 
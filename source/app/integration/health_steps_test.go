@@ -1,6 +1,8 @@
 package integration
 
 import (
+	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,6 +19,39 @@ func registerHealthSteps(sc *godog.ScenarioContext, tc *TestContext) {
 		return nil
 	})
 
+	sc.Step(`^I send a GET request to "/metrics"$`, func() error {
+		tc.Response = tc.Server.GET("/metrics", nil)
+		return nil
+	})
+
+	sc.Step(`^I send a GET request to "/health" with traceparent "([^"]*)"$`, func(traceparent string) error {
+		tc.Response = tc.Server.GET("/health", map[string]string{"traceparent": traceparent})
+		return nil
+	})
+
+	sc.Step(`^the response header "([^"]*)" should be "([^"]*)"$`, func(header, expected string) error {
+		if actual := tc.Response.Header().Get(header); actual != expected {
+			return fmt.Errorf("expected header %s to be %s, got %s", header, expected, actual)
+		}
+		return nil
+	})
+
+	sc.Step(`^the response header "([^"]*)" should start with "([^"]*)"$`, func(header, prefix string) error {
+		if actual := tc.Response.Header().Get(header); !strings.HasPrefix(actual, prefix) {
+			return fmt.Errorf("expected header %s to start with %s, got %s", header, prefix, actual)
+		}
+		return nil
+	})
+
+	sc.Step(`^the metrics should contain a line starting with '([^']*)'$`, func(prefix string) error {
+		for _, line := range strings.Split(tc.Response.Body.String(), "\n") {
+			if strings.HasPrefix(line, prefix) {
+				return nil
+			}
+		}
+		return fmt.Errorf("no metric starts with %s", prefix)
+	})
+
 	sc.Step(`^I send (\d+) concurrent GET requests to "([^"]*)"$`, func(count int, path string) error {
 		concurrentResponses = make([]int, 0, count)
 		var wg sync.WaitGroup
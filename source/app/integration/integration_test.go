@@ -33,6 +33,9 @@ type TestContext struct {
 	// Store method and path for deferred requests
 	LastMethod string
 	LastPath   string
+	// Store the API key issued through the admin API
+	IssuedAPIKey   string
+	IssuedAPIKeyID int64
 }
 
 func TestFeatures(t *testing.T) {
@@ -86,11 +89,14 @@ func InitializeScenario(sc *godog.ScenarioContext) {
 		tc.LastTraceID = ""
 		tc.JSONResponse = nil
 		tc.ArrayResponse = nil
+		tc.IssuedAPIKey = ""
+		tc.IssuedAPIKeyID = 0
 
 		return ctx, nil
 	})
 
 	// Register step definitions
+	registerAPIKeySteps(sc, tc)
 	registerHealthSteps(sc, tc)
 	registerKeyValueSteps(sc, tc)
 	registerPersonAttributesSteps(sc, tc)
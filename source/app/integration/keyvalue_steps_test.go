@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
@@ -56,7 +57,7 @@ func registerKeyValueSteps(sc *godog.ScenarioContext, tc *TestContext) {
 			"key":   key,
 			"value": value,
 		}
-		tc.Response = tc.Server.POST("/api/key-value", body, nil)
+		tc.Response = tc.Server.POST("/api/key-value", body, testutil.WithAPIKey())
 		return nil
 	})
 
@@ -117,13 +118,13 @@ func registerKeyValueSteps(sc *godog.ScenarioContext, tc *TestContext) {
 	})
 
 	// Request steps - specific to key-value API paths
-	sc.Step(`^I send a GET request to "/api/key-value/([^"]*)"$`, func(key string) error {
-		tc.Response = tc.Server.GET("/api/key-value/"+key, nil)
+	sc.Step(`^I send a GET request to "/api/key-value([^"]*)"$`, func(path string) error {
+		tc.Response = tc.Server.GET("/api/key-value"+path, testutil.WithAPIKey())
 		return nil
 	})
 
 	sc.Step(`^I send a DELETE request to "/api/key-value/([^"]*)"$`, func(key string) error {
-		tc.Response = tc.Server.DELETE("/api/key-value/"+key, nil)
+		tc.Response = tc.Server.DELETE("/api/key-value/"+key, testutil.WithAPIKey())
 		return nil
 	})
 
@@ -132,12 +133,46 @@ func registerKeyValueSteps(sc *godog.ScenarioContext, tc *TestContext) {
 		if err := json.Unmarshal([]byte(body.Content), &jsonBody); err != nil {
 			return fmt.Errorf("invalid JSON in docstring: %w", err)
 		}
-		tc.Response = tc.Server.POST(path, jsonBody, nil)
+		tc.Response = tc.Server.POST(path, jsonBody, testutil.WithAPIKey())
 		return nil
 	})
 
 	sc.Step(`^I send a POST request to "/api/key-value" with invalid JSON$`, func() error {
-		tc.Response = tc.Server.POSTRaw("/api/key-value", "{invalid json", nil)
+		tc.Response = tc.Server.POSTRaw("/api/key-value", "{invalid json", testutil.WithAPIKey())
+		return nil
+	})
+
+	sc.Step(`^I send a PUT request to "(/api/key-value/[^"]*)" with content type "([^"]*)" and body:$`, func(path, contentType string, body *godog.DocString) error {
+		headers := testutil.WithAPIKey()
+		headers["Content-Type"] = contentType
+		tc.Response = tc.Server.RequestRaw(http.MethodPut, path, body.Content, headers)
+		return nil
+	})
+
+	sc.Step(`^I send a POST request to "(/api/key-value/_import[^"]*)" with snapshot:$`, func(path string, snapshot *godog.DocString) error {
+		headers := testutil.WithAPIKey()
+		headers["Content-Type"] = "application/x-ndjson"
+		tc.Response = tc.Server.RequestRaw(http.MethodPost, path, snapshot.Content, headers)
+		return nil
+	})
+
+	// Namespace steps - requests made with a given API key in a given namespace
+	sc.Step(`^I send a (GET|DELETE) request to "(/api/key-value[^"]*)" in namespace "([^"]*)" with the (blue|green) API key$`, func(method, path, namespace, apiKey string) error {
+		tc.Response = tc.Server.Request(method, path, nil, keyValueHeaders(apiKey, namespace))
+		return nil
+	})
+
+	sc.Step(`^I send a POST request to "/api/key-value" in namespace "([^"]*)" with the (blue|green) API key with body:$`, func(namespace, apiKey string, body *godog.DocString) error {
+		var jsonBody map[string]interface{}
+		if err := json.Unmarshal([]byte(body.Content), &jsonBody); err != nil {
+			return fmt.Errorf("invalid JSON in docstring: %w", err)
+		}
+		tc.Response = tc.Server.POST("/api/key-value", jsonBody, keyValueHeaders(apiKey, namespace))
+		return nil
+	})
+
+	sc.Step(`^I send a GET request to "(/api/key-value[^"]*)" without an API key$`, func(path string) error {
+		tc.Response = tc.Server.GET(path, nil)
 		return nil
 	})
 
@@ -276,6 +311,31 @@ func registerKeyValueSteps(sc *godog.ScenarioContext, tc *TestContext) {
 		return nil
 	})
 
+	sc.Step(`^the response body should be:$`, func(expected *godog.DocString) error {
+		if actual := tc.Response.Body.String(); actual != expected.Content {
+			return fmt.Errorf("expected body %q but got %q", expected.Content, actual)
+		}
+		return nil
+	})
+
+	sc.Step(`^the response body should contain "([^"]*)"$`, func(expected string) error {
+		if !strings.Contains(tc.Response.Body.String(), expected) {
+			return fmt.Errorf("expected body to contain %q but got %q", expected, tc.Response.Body.String())
+		}
+		return nil
+	})
+
+	sc.Step(`^the key "([^"]*)" should be stored encrypted in the database$`, func(key string) error {
+		encrypted, err := testutil.KeyValueStoredEncrypted(context.Background(), tc.Pool, key)
+		if err != nil {
+			return err
+		}
+		if !encrypted {
+			return fmt.Errorf("expected key %q to be stored encrypted, but it is not", key)
+		}
+		return nil
+	})
+
 	sc.Step(`^the error message should contain "([^"]*)"$`, func(expected string) error {
 		var result map[string]interface{}
 		if err := json.Unmarshal(tc.Response.Body.Bytes(), &result); err != nil {
@@ -305,3 +365,14 @@ func registerKeyValueSteps(sc *godog.ScenarioContext, tc *TestContext) {
 		return nil
 	})
 }
+
+// keyValueHeaders returns the headers of a key-value request made with the
+// blue or green API key in a namespace
+func keyValueHeaders(apiKey, namespace string) map[string]string {
+	headers := testutil.WithAPIKey()
+	if apiKey == "green" {
+		headers = testutil.WithGreenAPIKey()
+	}
+	headers["x-kv-namespace"] = namespace
+	return headers
+}
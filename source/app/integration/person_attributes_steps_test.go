@@ -695,6 +695,17 @@ func registerPersonAttributesSteps(sc *godog.ScenarioContext, tc *TestContext) {
 		return nil
 	})
 
+	sc.Step(`^the audit record should have principal "([^"]*)"$`, func(expectedPrincipal string) error {
+		name, _, err := testutil.GetRequestLogPrincipal(context.Background(), tc.Pool, tc.LastTraceID)
+		if err != nil {
+			return err
+		}
+		if name != expectedPrincipal {
+			return fmt.Errorf("expected principal %s but got %s", expectedPrincipal, name)
+		}
+		return nil
+	})
+
 	// Idempotency
 	sc.Step(`^I send the same POST request again with traceId "([^"]*)"$`, func(traceID string) error {
 		body := map[string]interface{}{
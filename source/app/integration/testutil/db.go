@@ -26,7 +26,7 @@ func RunMigrations(ctx context.Context, pool *pgxpool.Pool) error {
 // Uses TRUNCATE with CASCADE to handle foreign key constraints.
 func TruncateTables(ctx context.Context, pool *pgxpool.Pool) error {
 	_, err := pool.Exec(ctx, `
-		TRUNCATE TABLE person_attributes, person_images, request_log, person, key_value RESTART IDENTITY CASCADE
+		TRUNCATE TABLE person_attributes, person_images, request_log, person, key_value, person_erasure, person_merge, person_identifiers, api_keys, rate_limit_buckets RESTART IDENTITY CASCADE
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to truncate tables: %w", err)
@@ -128,6 +128,19 @@ func GetRequestLog(ctx context.Context, pool *pgxpool.Pool, traceID, encKey stri
 	return caller, reason, nil
 }
 
+// GetRequestLogPrincipal returns the authenticated principal of an audit log entry by trace ID
+func GetRequestLogPrincipal(ctx context.Context, pool *pgxpool.Pool, traceID string) (name, owner string, err error) {
+	err = pool.QueryRow(ctx, `
+		SELECT COALESCE(principal_name, ''), COALESCE(principal_owner, '')
+		FROM request_log
+		WHERE trace_id = $1
+	`, traceID).Scan(&name, &owner)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get request log principal: %w", err)
+	}
+	return name, owner, nil
+}
+
 // CountRequestLogs returns the number of request log entries for a trace ID
 func CountRequestLogs(ctx context.Context, pool *pgxpool.Pool, traceID string) (int, error) {
 	var count int
@@ -160,3 +173,15 @@ func KeyValueExists(ctx context.Context, pool *pgxpool.Pool, key string) (bool,
 	}
 	return exists, nil
 }
+
+// KeyValueStoredEncrypted checks that a key's value is stored encrypted and not in plaintext
+func KeyValueStoredEncrypted(ctx context.Context, pool *pgxpool.Pool, key string) (bool, error) {
+	var encrypted bool
+	err := pool.QueryRow(ctx, `
+		SELECT encrypted_value IS NOT NULL AND value = '' FROM key_value WHERE key = $1
+	`, key).Scan(&encrypted)
+	if err != nil {
+		return false, fmt.Errorf("failed to check key encryption: %w", err)
+	}
+	return encrypted, nil
+}
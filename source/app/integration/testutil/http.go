@@ -2,6 +2,7 @@ package testutil
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -10,10 +11,18 @@ import (
 
 	db "person-service/internal/db/generated"
 
+	api_keys "person-service/api_keys"
 	health "person-service/healthcheck"
 	key_value "person-service/key_value"
+	"person-service/logging"
+	"person-service/metrics"
 	"person-service/middleware"
 	person_attributes "person-service/person_attributes"
+	person_erasure "person-service/person_erasure"
+	person_export "person-service/person_export"
+	person_identifiers "person-service/person_identifiers"
+	person_merge "person-service/person_merge"
+	"person-service/ratelimit"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/labstack/echo/v4"
@@ -26,6 +35,12 @@ const (
 	TestAPIKeyBlue = "person-service-key-11111111-2222-3333-4444-555555555555"
 	// TestAPIKeyGreen is a valid API key for tests (green)
 	TestAPIKeyGreen = "person-service-key-aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"
+	// TestKVNamespaceGrants gives both keys the default namespace, and one
+	// namespace of their own that the other key may only read. Keys issued
+	// with the name "reports" may read the default namespace.
+	TestKVNamespaceGrants = "blue=default:rw,team-blue:rw,team-green:ro,secrets:rw;green=default:rw,team-green:rw,team-blue:ro;reports=default:ro"
+	// TestKVEncryptedNamespaces stores every value of the secrets namespace encrypted
+	TestKVEncryptedNamespaces = "secrets"
 )
 
 // TestServer wraps an Echo instance configured for testing
@@ -41,33 +56,161 @@ func NewTestServer(pool *pgxpool.Pool) *TestServer {
 	os.Setenv("ENCRYPTION_KEY_1", TestEncryptionKey)
 	os.Setenv("PERSON_API_KEY_BLUE", TestAPIKeyBlue)
 	os.Setenv("PERSON_API_KEY_GREEN", TestAPIKeyGreen)
+	os.Setenv("KV_NAMESPACE_GRANTS", TestKVNamespaceGrants)
+	os.Setenv("KV_ENCRYPTED_NAMESPACES", TestKVEncryptedNamespaces)
 
 	queries := db.New(pool)
 	e := echo.New()
 	e.HideBanner = true
 	e.HidePort = true
+	e.Use(middleware.TraceMiddleware())
+	e.Use(metrics.Middleware())
+	e.JSONSerializer = metrics.JSONSerializer{JSONSerializer: e.JSONSerializer}
+	accessLogConfig, err := middleware.LoadAccessLogConfig()
+	if err != nil {
+		panic(err)
+	}
+	e.Use(middleware.AccessLog(accessLogConfig))
 
 	// Setup handlers
 	healthHandler := health.NewHealthCheckHandler(queries)
-	keyValueHandler := key_value.NewKeyValueHandler(queries)
-	personAttributesHandler := person_attributes.NewPersonAttributesHandler(queries)
+	keyValueWatcher := key_value.NewWatcher(pool)
+	encryptedNamespaces, err := key_value.LoadEncryptedNamespaces()
+	if err != nil {
+		panic(err)
+	}
+	valueLimits, err := key_value.LoadValueLimits()
+	if err != nil {
+		panic(err)
+	}
+	keyValueHandler := key_value.NewKeyValueHandler(queries).
+		WithWatcher(keyValueWatcher).
+		WithPool(pool).
+		WithEncryptedNamespaces(encryptedNamespaces).
+		WithValueLimits(valueLimits)
+	strictCaller, err := person_attributes.LoadStrictCaller()
+	if err != nil {
+		panic(err)
+	}
+	attributePolicy, err := person_attributes.LoadPolicy()
+	if err != nil {
+		panic(err)
+	}
+	personAttributesHandler := person_attributes.NewPersonAttributesHandler(queries).
+		WithStrictCaller(strictCaller).
+		WithPolicy(attributePolicy)
+	personExportHandler := person_export.NewPersonExportHandler(queries).
+		WithPolicy(attributePolicy)
+	personErasureHandler := person_erasure.NewPersonErasureHandler(pool).
+		WithStrictCaller(strictCaller)
+	personMergeHandler := person_merge.NewPersonMergeHandler(pool).
+		WithStrictCaller(strictCaller).
+		WithPolicy(attributePolicy)
+	personIdentifiersHandler := person_identifiers.NewPersonIdentifiersHandler(queries).
+		WithStrictCaller(strictCaller)
+	apiKeysHandler := api_keys.NewAPIKeysHandler(queries)
+	jwtConfig, err := middleware.LoadJWTConfig()
+	if err != nil {
+		panic(err)
+	}
+	var jwtVerifier *middleware.JWTVerifier
+	if jwtConfig != nil {
+		jwtVerifier, err = middleware.NewJWTVerifier(context.Background(), *jwtConfig)
+		if err != nil {
+			panic(err)
+		}
+	}
+	signatureVerifier, err := middleware.LoadSignatureVerifier()
+	if err != nil {
+		panic(err)
+	}
+	clientCertAuthenticator, err := middleware.LoadClientCertAuthenticator()
+	if err != nil {
+		panic(err)
+	}
+	auth := middleware.AuthMiddleware(middleware.Authenticators{
+		APIKeys:     queries,
+		JWT:         jwtVerifier,
+		Signatures:  signatureVerifier,
+		ClientCerts: clientCertAuthenticator,
+	})
+	rateLimitConfig, err := ratelimit.LoadConfig()
+	if err != nil {
+		panic(err)
+	}
+	var rateLimiter *ratelimit.Limiter
+	if rateLimitConfig.Enabled() {
+		var store ratelimit.Store = ratelimit.NewMemoryStore()
+		if rateLimitConfig.Store == ratelimit.StorePostgres {
+			store = ratelimit.NewPostgresStore(queries)
+		}
+		rateLimiter = ratelimit.NewLimiter(rateLimitConfig, store)
+	}
+	rateLimit := ratelimit.Middleware(rateLimiter)
+
+	// The watcher lives as long as the test process
+	keyValueWatcher.Start(context.Background())
 
 	// Setup routes (same as main.go)
 	e.GET("/health", healthHandler.Check)
+	e.GET("/metrics", metrics.Handler())
 
-	// Key-value API routes
-	e.POST("/api/key-value", keyValueHandler.SetValue)
-	e.GET("/api/key-value/:key", keyValueHandler.GetValue)
-	e.DELETE("/api/key-value/:key", keyValueHandler.DeleteValue)
+	// Key-value API routes - protected with AuthMiddleware and namespace grants
+	namespaceGrants, err := key_value.LoadGrants()
+	if err != nil {
+		panic(err)
+	}
+	keyValueGroup := e.Group("/api/key-value",
+		auth,
+		rateLimit,
+		middleware.RequireScope(middleware.ScopeKV),
+		key_value.NamespaceMiddleware(namespaceGrants))
+	keyValueGroup.GET("", keyValueHandler.ListValues)
+	keyValueGroup.GET("/_count", keyValueHandler.CountValues)
+	keyValueGroup.GET("/_watch", keyValueHandler.WatchValues)
+	keyValueGroup.GET("/_export", keyValueHandler.Export)
+	keyValueGroup.POST("", keyValueHandler.SetValue)
+	keyValueGroup.POST("/_incr", keyValueHandler.IncrementValue)
+	keyValueGroup.POST("/_txn", keyValueHandler.Txn)
+	keyValueGroup.POST("/_import", keyValueHandler.Import)
+	keyValueGroup.GET("/:key", keyValueHandler.GetValue)
+	keyValueGroup.PUT("/:key", keyValueHandler.PutValue)
+	keyValueGroup.DELETE("/:key", keyValueHandler.DeleteValue)
 
-	// Person attributes API routes - protected with API key middleware
-	personAttributesGroup := e.Group("/persons", middleware.APIKeyMiddleware())
+	// Person attributes API routes - protected with AuthMiddleware, reads need the
+	// attributes:read scope and writes the attributes:write scope
+	personAttributesGroup := e.Group("/persons",
+		auth,
+		rateLimit,
+		middleware.RequireMethodScope(middleware.ScopeAttributesRead, middleware.ScopeAttributesWrite))
+	// Reads of a merged person are redirected to the surviving person
+	redirectMerged := person_merge.RedirectMerged(queries)
 	personAttributesGroup.POST("/:personId/attributes", personAttributesHandler.CreateAttribute)
 	personAttributesGroup.PUT("/:personId/attributes", personAttributesHandler.CreateAttribute)
-	personAttributesGroup.GET("/:personId/attributes", personAttributesHandler.GetAllAttributes)
-	personAttributesGroup.GET("/:personId/attributes/:attributeId", personAttributesHandler.GetAttribute)
+	personAttributesGroup.GET("/:personId/attributes", personAttributesHandler.GetAllAttributes, redirectMerged)
+	personAttributesGroup.GET("/:personId/attributes/:attributeId", personAttributesHandler.GetAttribute, redirectMerged)
 	personAttributesGroup.PUT("/:personId/attributes/:attributeId", personAttributesHandler.UpdateAttribute)
 	personAttributesGroup.DELETE("/:personId/attributes/:attributeId", personAttributesHandler.DeleteAttribute)
+	personAttributesGroup.GET("/:personId/export", personExportHandler.Export, redirectMerged)
+	// Erasure and merge destroy data, so they also need the persons:erase scope
+	requireErase := middleware.RequireScope(middleware.ScopePersonsErase)
+	personAttributesGroup.POST("/:personId/erasure", personErasureHandler.ErasePerson, requireErase)
+	personAttributesGroup.GET("/:personId/erasure", personErasureHandler.GetErasure)
+	personAttributesGroup.POST("/:personId/merge", personMergeHandler.MergePerson, requireErase)
+	personAttributesGroup.POST("/:personId/identifiers", personIdentifiersHandler.AttachIdentifier)
+	personAttributesGroup.GET("/:personId/identifiers", personIdentifiersHandler.ListIdentifiers, redirectMerged)
+	personAttributesGroup.DELETE("/:personId/identifiers/:identifierId", personIdentifiersHandler.DetachIdentifier)
+	personAttributesGroup.GET("/resolve", personIdentifiersHandler.ResolveIdentifier)
+
+	// API key management routes - need an API key with the admin scope
+	adminGroup := e.Group("/admin/api-keys", auth, rateLimit, middleware.RequireScope(middleware.ScopeAdmin))
+	adminGroup.POST("", apiKeysHandler.IssueKey)
+	adminGroup.GET("", apiKeysHandler.ListKeys)
+	adminGroup.DELETE("/:id", apiKeysHandler.RevokeKey)
+	logLevelHandler := logging.NewLevelHandler()
+	logLevelGroup := e.Group("/admin/log-level", auth, rateLimit, middleware.RequireScope(middleware.ScopeAdmin))
+	logLevelGroup.GET("", logLevelHandler.GetLevel)
+	logLevelGroup.PUT("", logLevelHandler.SetLevel)
 
 	return &TestServer{
 		Echo:    e,
@@ -8,11 +8,31 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type ApiKey struct {
+	ID         int64
+	Name       string
+	Owner      string
+	KeyHash    string
+	Scopes     []string
+	ExpiresAt  pgtype.Timestamptz
+	LastUsedAt pgtype.Timestamptz
+	CreatedAt  pgtype.Timestamptz
+	RevokedAt  pgtype.Timestamptz
+}
+
 type KeyValue struct {
-	Key       string
-	Value     string
-	CreatedAt pgtype.Timestamptz
-	UpdatedAt pgtype.Timestamptz
+	Key            string
+	Value          string
+	CreatedAt      pgtype.Timestamptz
+	UpdatedAt      pgtype.Timestamptz
+	ExpiresAt      pgtype.Timestamptz
+	Version        int64
+	Namespace      string
+	EncryptedValue []byte
+	KeyVersion     pgtype.Int8
+	ContentType    pgtype.Text
+	BinaryValue    []byte
+	Size           pgtype.Int8
 }
 
 type Person struct {
@@ -34,6 +54,26 @@ type PersonAttribute struct {
 	UpdatedAt      pgtype.Timestamptz
 }
 
+type PersonErasure struct {
+	ID                   int64
+	PersonID             pgtype.UUID
+	RequestedBy          string
+	Reason               string
+	TraceID              pgtype.Text
+	AttributesRemoved    int64
+	ImagesRemoved        int64
+	AuditEntriesRedacted int64
+	ErasedAt             pgtype.Timestamptz
+}
+
+type PersonIdentifier struct {
+	ID         int64
+	PersonID   pgtype.UUID
+	System     string
+	ExternalID string
+	CreatedAt  pgtype.Timestamptz
+}
+
 type PersonImage struct {
 	ID                 int64
 	PersonID           pgtype.UUID
@@ -49,6 +89,28 @@ type PersonImage struct {
 	UpdatedAt          pgtype.Timestamptz
 }
 
+type PersonMerge struct {
+	ID                int64
+	SourcePersonID    pgtype.UUID
+	TargetPersonID    pgtype.UUID
+	Strategy          string
+	MergedBy          string
+	Reason            string
+	TraceID           pgtype.Text
+	AttributesMoved   int64
+	AttributesDropped int64
+	ImagesMoved       int64
+	ImagesDropped     int64
+	MergedAt          pgtype.Timestamptz
+}
+
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	Allowed   bool
+	UpdatedAt pgtype.Timestamptz
+}
+
 type RequestLog struct {
 	ID                    int64
 	TraceID               string
@@ -58,4 +120,8 @@ type RequestLog struct {
 	EncryptedResponseBody []byte
 	KeyVersion            int64
 	CreatedAt             pgtype.Timestamptz
+	PersonID              pgtype.UUID
+	RedactedAt            pgtype.Timestamptz
+	PrincipalName         pgtype.Text
+	PrincipalOwner        pgtype.Text
 }
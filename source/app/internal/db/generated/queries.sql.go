@@ -18,6 +18,37 @@ type BulkCreatePersonAttributesParams struct {
 	KeyVersion     int64
 }
 
+const attachPersonIdentifier = `-- name: AttachPersonIdentifier :one
+
+INSERT INTO person_identifiers (person_id, system, external_id)
+VALUES ($1, $2, $3)
+ON CONFLICT (system, external_id) DO NOTHING
+RETURNING id, person_id, system, external_id, created_at
+`
+
+type AttachPersonIdentifierParams struct {
+	PersonID   pgtype.UUID
+	System     string
+	ExternalID string
+}
+
+// ============================================================================
+// PERSON IDENTIFIER OPERATIONS
+// ============================================================================
+// Attach an external identifier to a person (returns no row if the identifier is already taken)
+func (q *Queries) AttachPersonIdentifier(ctx context.Context, arg AttachPersonIdentifierParams) (PersonIdentifier, error) {
+	row := q.db.QueryRow(ctx, attachPersonIdentifier, arg.PersonID, arg.System, arg.ExternalID)
+	var i PersonIdentifier
+	err := row.Scan(
+		&i.ID,
+		&i.PersonID,
+		&i.System,
+		&i.ExternalID,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const checkTraceIdExists = `-- name: CheckTraceIdExists :one
 SELECT EXISTS(SELECT 1 FROM request_log WHERE trace_id = $1)
 `
@@ -30,6 +61,26 @@ func (q *Queries) CheckTraceIdExists(ctx context.Context, traceID string) (bool,
 	return exists, err
 }
 
+const countKeyValues = `-- name: CountKeyValues :one
+SELECT COUNT(*) FROM key_value
+WHERE namespace = $1
+    AND starts_with(key, $2)
+    AND (expires_at IS NULL OR expires_at > now())
+`
+
+type CountKeyValuesParams struct {
+	Namespace string
+	Prefix    string
+}
+
+// Count live keys of a namespace starting with prefix
+func (q *Queries) CountKeyValues(ctx context.Context, arg CountKeyValuesParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countKeyValues, arg.Namespace, arg.Prefix)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const countPersonAttributes = `-- name: CountPersonAttributes :one
 SELECT COUNT(*) FROM person_attributes WHERE person_id = $1
 `
@@ -54,6 +105,78 @@ func (q *Queries) CountPersonImages(ctx context.Context, personID pgtype.UUID) (
 	return count, err
 }
 
+const countPurgeablePersons = `-- name: CountPurgeablePersons :one
+
+SELECT COUNT(*) FROM person
+WHERE deleted_at IS NOT NULL AND deleted_at < $1
+`
+
+// ============================================================================
+// RETENTION OPERATIONS
+// ============================================================================
+// Count soft-deleted persons whose deleted_at is older than the cutoff
+func (q *Queries) CountPurgeablePersons(ctx context.Context, cutoff pgtype.Timestamptz) (int64, error) {
+	row := q.db.QueryRow(ctx, countPurgeablePersons, cutoff)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countPurgeableRequestLogs = `-- name: CountPurgeableRequestLogs :one
+SELECT COUNT(*) FROM request_log WHERE created_at < $1
+`
+
+// Count audit entries created before the cutoff
+func (q *Queries) CountPurgeableRequestLogs(ctx context.Context, cutoff pgtype.Timestamptz) (int64, error) {
+	row := q.db.QueryRow(ctx, countPurgeableRequestLogs, cutoff)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createAPIKey = `-- name: CreateAPIKey :one
+
+INSERT INTO api_keys (name, owner, key_hash, scopes, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (name) WHERE revoked_at IS NULL DO NOTHING
+RETURNING id, name, owner, key_hash, scopes, expires_at, last_used_at, created_at, revoked_at
+`
+
+type CreateAPIKeyParams struct {
+	Name      string
+	Owner     string
+	KeyHash   string
+	Scopes    []string
+	ExpiresAt pgtype.Timestamptz
+}
+
+// ============================================================================
+// API KEY OPERATIONS
+// ============================================================================
+// Issue an API key (returns no row if an active key already has the name)
+func (q *Queries) CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (ApiKey, error) {
+	row := q.db.QueryRow(ctx, createAPIKey,
+		arg.Name,
+		arg.Owner,
+		arg.KeyHash,
+		arg.Scopes,
+		arg.ExpiresAt,
+	)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Owner,
+		&i.KeyHash,
+		&i.Scopes,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.CreatedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
 const createOrUpdatePersonAttribute = `-- name: CreateOrUpdatePersonAttribute :one
 
 INSERT INTO person_attributes (
@@ -264,6 +387,60 @@ func (q *Queries) DeleteAllPersonImages(ctx context.Context, personID pgtype.UUI
 	return err
 }
 
+const deleteExpiredKeyValues = `-- name: DeleteExpiredKeyValues :execrows
+DELETE FROM key_value
+WHERE (namespace, key) IN (
+    SELECT namespace, key FROM key_value
+    WHERE expires_at <= now()
+    ORDER BY expires_at
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+AND expires_at <= now()
+`
+
+// Delete up to batch_size expired keys. Rows locked by a concurrent write are
+// skipped, and expiry is checked again as such a write may have extended the TTL.
+func (q *Queries) DeleteExpiredKeyValues(ctx context.Context, batchSize int32) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredKeyValues, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteIdleRateLimitBuckets = `-- name: DeleteIdleRateLimitBuckets :execrows
+DELETE FROM rate_limit_buckets WHERE updated_at < $1
+`
+
+// Delete buckets not used since the cutoff, which have refilled completely
+func (q *Queries) DeleteIdleRateLimitBuckets(ctx context.Context, cutoff pgtype.Timestamptz) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteIdleRateLimitBuckets, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteLiveValue = `-- name: DeleteLiveValue :one
+DELETE FROM key_value WHERE namespace = $1 AND key = $2
+RETURNING (expires_at IS NULL OR expires_at > now())::boolean AS live
+`
+
+type DeleteLiveValueParams struct {
+	Namespace string
+	Key       string
+}
+
+// Delete a key and return whether it was live; an expired key is deleted too.
+// Returns no rows when the key does not exist.
+func (q *Queries) DeleteLiveValue(ctx context.Context, arg DeleteLiveValueParams) (bool, error) {
+	row := q.db.QueryRow(ctx, deleteLiveValue, arg.Namespace, arg.Key)
+	var live bool
+	err := row.Scan(&live)
+	return live, err
+}
+
 const deletePersonAttribute = `-- name: DeletePersonAttribute :exec
 DELETE FROM person_attributes
 WHERE person_id = $1 AND attribute_key = $2
@@ -280,6 +457,45 @@ func (q *Queries) DeletePersonAttribute(ctx context.Context, arg DeletePersonAtt
 	return err
 }
 
+const deletePersonAttributesByIds = `-- name: DeletePersonAttributesByIds :execrows
+DELETE FROM person_attributes
+WHERE id = ANY($1::bigint[])
+`
+
+// Delete person attributes by ID
+func (q *Queries) DeletePersonAttributesByIds(ctx context.Context, ids []int64) (int64, error) {
+	result, err := q.db.Exec(ctx, deletePersonAttributesByIds, ids)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deletePersonIdentifier = `-- name: DeletePersonIdentifier :one
+DELETE FROM person_identifiers
+WHERE id = $1 AND person_id = $2
+RETURNING id, person_id, system, external_id, created_at
+`
+
+type DeletePersonIdentifierParams struct {
+	ID       int64
+	PersonID pgtype.UUID
+}
+
+// Detach an identifier from a person and return it
+func (q *Queries) DeletePersonIdentifier(ctx context.Context, arg DeletePersonIdentifierParams) (PersonIdentifier, error) {
+	row := q.db.QueryRow(ctx, deletePersonIdentifier, arg.ID, arg.PersonID)
+	var i PersonIdentifier
+	err := row.Scan(
+		&i.ID,
+		&i.PersonID,
+		&i.System,
+		&i.ExternalID,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const deletePersonImage = `-- name: DeletePersonImage :exec
 DELETE FROM person_images
 WHERE person_id = $1 AND attribute_key = $2
@@ -296,16 +512,155 @@ func (q *Queries) DeletePersonImage(ctx context.Context, arg DeletePersonImagePa
 	return err
 }
 
+const deletePersonImagesByIds = `-- name: DeletePersonImagesByIds :execrows
+DELETE FROM person_images
+WHERE id = ANY($1::bigint[])
+`
+
+// Delete person images by ID
+func (q *Queries) DeletePersonImagesByIds(ctx context.Context, ids []int64) (int64, error) {
+	result, err := q.db.Exec(ctx, deletePersonImagesByIds, ids)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const deleteValue = `-- name: DeleteValue :exec
-DELETE FROM key_value WHERE key = $1
+DELETE FROM key_value WHERE namespace = $1 AND key = $2
 `
 
-// Delete a value by key
-func (q *Queries) DeleteValue(ctx context.Context, key string) error {
-	_, err := q.db.Exec(ctx, deleteValue, key)
+type DeleteValueParams struct {
+	Namespace string
+	Key       string
+}
+
+// Delete a value by namespace and key
+func (q *Queries) DeleteValue(ctx context.Context, arg DeleteValueParams) error {
+	_, err := q.db.Exec(ctx, deleteValue, arg.Namespace, arg.Key)
 	return err
 }
 
+const deleteValueWithVersion = `-- name: DeleteValueWithVersion :execrows
+DELETE FROM key_value
+WHERE namespace = $1
+    AND key = $2
+    AND version = $3
+    AND (expires_at IS NULL OR expires_at > now())
+`
+
+type DeleteValueWithVersionParams struct {
+	Namespace       string
+	Key             string
+	ExpectedVersion int64
+}
+
+// Delete a key only if it is at the expected version
+func (q *Queries) DeleteValueWithVersion(ctx context.Context, arg DeleteValueWithVersionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteValueWithVersion, arg.Namespace, arg.Key, arg.ExpectedVersion)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const exportKeyValues = `-- name: ExportKeyValues :many
+SELECT key,
+    CASE WHEN content_type IS NULL
+        THEN COALESCE(pgp_sym_decrypt(encrypted_value, $1), value)
+        ELSE '' END::text AS plain_value,
+    CASE WHEN content_type IS NOT NULL
+        THEN COALESCE(pgp_sym_decrypt_bytea(encrypted_value, $1), binary_value)
+        END::bytea AS plain_data,
+    content_type,
+    encrypted_value IS NOT NULL AS encrypted,
+    expires_at
+FROM key_value
+WHERE namespace = $2
+    AND starts_with(key, $3)
+    AND key > $4
+    AND (expires_at IS NULL OR expires_at > now())
+ORDER BY key
+LIMIT $5
+`
+
+type ExportKeyValuesParams struct {
+	EncKey    string
+	Namespace string
+	Prefix    string
+	AfterKey  string
+	RowLimit  int32
+}
+
+type ExportKeyValuesRow struct {
+	Key         string
+	PlainValue  string
+	PlainData   []byte
+	ContentType pgtype.Text
+	Encrypted   bool
+	ExpiresAt   pgtype.Timestamptz
+}
+
+// List live keys of a namespace starting with prefix after the cursor key, with their
+// values decrypted, for snapshots. plain_value is a text value and plain_data a binary value.
+func (q *Queries) ExportKeyValues(ctx context.Context, arg ExportKeyValuesParams) ([]ExportKeyValuesRow, error) {
+	rows, err := q.db.Query(ctx, exportKeyValues,
+		arg.EncKey,
+		arg.Namespace,
+		arg.Prefix,
+		arg.AfterKey,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ExportKeyValuesRow{}
+	for rows.Next() {
+		var i ExportKeyValuesRow
+		if err := rows.Scan(
+			&i.Key,
+			&i.PlainValue,
+			&i.PlainData,
+			&i.ContentType,
+			&i.Encrypted,
+			&i.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAPIKeyByHash = `-- name: GetAPIKeyByHash :one
+SELECT id, name, owner, key_hash, scopes, expires_at, last_used_at, created_at, revoked_at
+FROM api_keys
+WHERE key_hash = $1 AND revoked_at IS NULL
+LIMIT 1
+`
+
+// Get an active (not revoked) API key by the hash of the key
+func (q *Queries) GetAPIKeyByHash(ctx context.Context, keyHash string) (ApiKey, error) {
+	row := q.db.QueryRow(ctx, getAPIKeyByHash, keyHash)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Owner,
+		&i.KeyHash,
+		&i.Scopes,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.CreatedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
 const getAllPersonAttributes = `-- name: GetAllPersonAttributes :many
 SELECT
     id,
@@ -368,18 +723,50 @@ func (q *Queries) GetAllPersonAttributes(ctx context.Context, arg GetAllPersonAt
 }
 
 const getKeyValue = `-- name: GetKeyValue :one
-SELECT key, value, created_at, updated_at FROM key_value WHERE key = $1 LIMIT 1
+SELECT key_value.key, key_value.value, key_value.created_at, key_value.updated_at, key_value.expires_at, key_value.version, key_value.namespace, key_value.encrypted_value, key_value.key_version, key_value.content_type, key_value.binary_value, key_value.size,
+    CASE WHEN content_type IS NULL
+        THEN COALESCE(pgp_sym_decrypt(encrypted_value, $1), value)
+        ELSE '' END::text AS plain_value,
+    CASE WHEN content_type IS NOT NULL
+        THEN COALESCE(pgp_sym_decrypt_bytea(encrypted_value, $1), binary_value)
+        END::bytea AS plain_data
+FROM key_value
+WHERE namespace = $2 AND key = $3 AND (expires_at IS NULL OR expires_at > now())
+LIMIT 1
 `
 
-// Retrieve the full key-value record by key
-func (q *Queries) GetKeyValue(ctx context.Context, key string) (KeyValue, error) {
-	row := q.db.QueryRow(ctx, getKeyValue, key)
-	var i KeyValue
+type GetKeyValueParams struct {
+	EncKey    string
+	Namespace string
+	Key       string
+}
+
+type GetKeyValueRow struct {
+	KeyValue   KeyValue
+	PlainValue string
+	PlainData  []byte
+}
+
+// Retrieve the full key-value record by namespace and key, ignoring expired keys.
+// plain_value is a text value and plain_data a binary value, decrypted when stored encrypted.
+func (q *Queries) GetKeyValue(ctx context.Context, arg GetKeyValueParams) (GetKeyValueRow, error) {
+	row := q.db.QueryRow(ctx, getKeyValue, arg.EncKey, arg.Namespace, arg.Key)
+	var i GetKeyValueRow
 	err := row.Scan(
-		&i.Key,
-		&i.Value,
-		&i.CreatedAt,
-		&i.UpdatedAt,
+		&i.KeyValue.Key,
+		&i.KeyValue.Value,
+		&i.KeyValue.CreatedAt,
+		&i.KeyValue.UpdatedAt,
+		&i.KeyValue.ExpiresAt,
+		&i.KeyValue.Version,
+		&i.KeyValue.Namespace,
+		&i.KeyValue.EncryptedValue,
+		&i.KeyValue.KeyVersion,
+		&i.KeyValue.ContentType,
+		&i.KeyValue.BinaryValue,
+		&i.KeyValue.Size,
+		&i.PlainValue,
+		&i.PlainData,
 	)
 	return i, err
 }
@@ -537,6 +924,83 @@ func (q *Queries) GetPersonById(ctx context.Context, id pgtype.UUID) (Person, er
 	return i, err
 }
 
+const getPersonByIdForUpdate = `-- name: GetPersonByIdForUpdate :one
+
+SELECT id, client_id, created_at, updated_at, deleted_at
+FROM person
+WHERE id = $1
+LIMIT 1
+FOR UPDATE
+`
+
+// ============================================================================
+// PERSON ERASURE OPERATIONS
+// ============================================================================
+// Get and lock a person by internal UUID, including soft-deleted persons
+func (q *Queries) GetPersonByIdForUpdate(ctx context.Context, id pgtype.UUID) (Person, error) {
+	row := q.db.QueryRow(ctx, getPersonByIdForUpdate, id)
+	var i Person
+	err := row.Scan(
+		&i.ID,
+		&i.ClientID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getPersonErasure = `-- name: GetPersonErasure :one
+SELECT id, person_id, requested_by, reason, trace_id, attributes_removed, images_removed, audit_entries_redacted, erased_at
+FROM person_erasure
+WHERE person_id = $1
+LIMIT 1
+`
+
+// Get the erasure tombstone for a person
+func (q *Queries) GetPersonErasure(ctx context.Context, personID pgtype.UUID) (PersonErasure, error) {
+	row := q.db.QueryRow(ctx, getPersonErasure, personID)
+	var i PersonErasure
+	err := row.Scan(
+		&i.ID,
+		&i.PersonID,
+		&i.RequestedBy,
+		&i.Reason,
+		&i.TraceID,
+		&i.AttributesRemoved,
+		&i.ImagesRemoved,
+		&i.AuditEntriesRedacted,
+		&i.ErasedAt,
+	)
+	return i, err
+}
+
+const getPersonIdentifier = `-- name: GetPersonIdentifier :one
+SELECT id, person_id, system, external_id, created_at
+FROM person_identifiers
+WHERE system = $1 AND external_id = $2
+LIMIT 1
+`
+
+type GetPersonIdentifierParams struct {
+	System     string
+	ExternalID string
+}
+
+// Get an identifier by system and external ID
+func (q *Queries) GetPersonIdentifier(ctx context.Context, arg GetPersonIdentifierParams) (PersonIdentifier, error) {
+	row := q.db.QueryRow(ctx, getPersonIdentifier, arg.System, arg.ExternalID)
+	var i PersonIdentifier
+	err := row.Scan(
+		&i.ID,
+		&i.PersonID,
+		&i.System,
+		&i.ExternalID,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const getPersonImage = `-- name: GetPersonImage :one
 SELECT 
     id,
@@ -655,6 +1119,34 @@ func (q *Queries) GetPersonImageMetadata(ctx context.Context, arg GetPersonImage
 	return i, err
 }
 
+const getPersonMergeBySourceId = `-- name: GetPersonMergeBySourceId :one
+SELECT id, source_person_id, target_person_id, strategy, merged_by, reason, trace_id, attributes_moved, attributes_dropped, images_moved, images_dropped, merged_at
+FROM person_merge
+WHERE source_person_id = $1
+LIMIT 1
+`
+
+// Get the merge record of a merged (source) person
+func (q *Queries) GetPersonMergeBySourceId(ctx context.Context, sourcePersonID pgtype.UUID) (PersonMerge, error) {
+	row := q.db.QueryRow(ctx, getPersonMergeBySourceId, sourcePersonID)
+	var i PersonMerge
+	err := row.Scan(
+		&i.ID,
+		&i.SourcePersonID,
+		&i.TargetPersonID,
+		&i.Strategy,
+		&i.MergedBy,
+		&i.Reason,
+		&i.TraceID,
+		&i.AttributesMoved,
+		&i.AttributesDropped,
+		&i.ImagesMoved,
+		&i.ImagesDropped,
+		&i.MergedAt,
+	)
+	return i, err
+}
+
 const getPersonWithAttributes = `-- name: GetPersonWithAttributes :one
 
 SELECT 
@@ -690,6 +1182,8 @@ SELECT
     id,
     trace_id,
     caller_info,
+    principal_name,
+    principal_owner,
     reason,
     pgp_sym_decrypt(encrypted_request_body, $1) AS request_body,
     pgp_sym_decrypt(encrypted_response_body, $1) AS response_body,
@@ -706,14 +1200,16 @@ type GetRequestLogByTraceIdParams struct {
 }
 
 type GetRequestLogByTraceIdRow struct {
-	ID           int64
-	TraceID      string
-	CallerInfo   string
-	Reason       string
-	RequestBody  string
-	ResponseBody string
-	KeyVersion   int64
-	CreatedAt    pgtype.Timestamptz
+	ID             int64
+	TraceID        string
+	CallerInfo     string
+	PrincipalName  pgtype.Text
+	PrincipalOwner pgtype.Text
+	Reason         string
+	RequestBody    string
+	ResponseBody   string
+	KeyVersion     int64
+	CreatedAt      pgtype.Timestamptz
 }
 
 // Retrieve request log by trace_id with decrypted data
@@ -724,6 +1220,8 @@ func (q *Queries) GetRequestLogByTraceId(ctx context.Context, arg GetRequestLogB
 		&i.ID,
 		&i.TraceID,
 		&i.CallerInfo,
+		&i.PrincipalName,
+		&i.PrincipalOwner,
 		&i.Reason,
 		&i.RequestBody,
 		&i.ResponseBody,
@@ -734,12 +1232,24 @@ func (q *Queries) GetRequestLogByTraceId(ctx context.Context, arg GetRequestLogB
 }
 
 const getValue = `-- name: GetValue :one
-SELECT value FROM key_value WHERE key = $1 LIMIT 1
+SELECT CASE WHEN content_type IS NULL
+    THEN COALESCE(pgp_sym_decrypt(encrypted_value, $1), value)
+    ELSE '' END::text AS value
+FROM key_value
+WHERE namespace = $2 AND key = $3 AND (expires_at IS NULL OR expires_at > now())
+LIMIT 1
 `
 
-// Retrieve a value by key
-func (q *Queries) GetValue(ctx context.Context, key string) (string, error) {
-	row := q.db.QueryRow(ctx, getValue, key)
+type GetValueParams struct {
+	EncKey    string
+	Namespace string
+	Key       string
+}
+
+// Retrieve a text value by namespace and key, decrypted when stored encrypted, ignoring expired keys.
+// Binary values read as empty.
+func (q *Queries) GetValue(ctx context.Context, arg GetValueParams) (string, error) {
+	row := q.db.QueryRow(ctx, getValue, arg.EncKey, arg.Namespace, arg.Key)
 	var value string
 	err := row.Scan(&value)
 	return value, err
@@ -765,29 +1275,221 @@ func (q *Queries) HealthCheck(ctx context.Context) error {
 	return err
 }
 
-const insertRequestLog = `-- name: InsertRequestLog :one
+const incrementValue = `-- name: IncrementValue :one
+INSERT INTO key_value (namespace, key, value, expires_at)
+VALUES ($1, $2, $3::bigint::text, now() + $4::bigint * interval '1 second')
+ON CONFLICT (namespace, key) DO UPDATE SET
+    value = CASE WHEN key_value.expires_at <= now() THEN EXCLUDED.value
+        ELSE (key_value.value::bigint + $3::bigint)::text END,
+    encrypted_value = NULL,
+    key_version = NULL,
+    content_type = NULL,
+    binary_value = NULL,
+    size = NULL,
+    expires_at = CASE WHEN key_value.expires_at <= now() THEN EXCLUDED.expires_at ELSE key_value.expires_at END,
+    created_at = CASE WHEN key_value.expires_at <= now() THEN CURRENT_TIMESTAMP ELSE key_value.created_at END,
+    version = CASE WHEN key_value.expires_at <= now() THEN 1 ELSE key_value.version + 1 END,
+    updated_at = CURRENT_TIMESTAMP
+WHERE key_value.expires_at <= now() OR key_value.value ~ '^-?[0-9]+$'
+RETURNING key, value, created_at, updated_at, expires_at, version, namespace, encrypted_value, key_version, content_type, binary_value, size
+`
 
-INSERT INTO request_log (
-    trace_id, 
-    caller_info,
-    reason, 
-    encrypted_request_body, 
-    encrypted_response_body, 
-    key_version
+type IncrementValueParams struct {
+	Namespace  string
+	Key        string
+	Delta      int64
+	TtlSeconds pgtype.Int8
+}
+
+// Add delta to an integer value. A missing or expired key is created with
+// value delta and ttl_seconds; an existing key keeps its TTL.
+// Returns no rows when the current value is not an integer, which includes encrypted and binary values.
+func (q *Queries) IncrementValue(ctx context.Context, arg IncrementValueParams) (KeyValue, error) {
+	row := q.db.QueryRow(ctx, incrementValue,
+		arg.Namespace,
+		arg.Key,
+		arg.Delta,
+		arg.TtlSeconds,
+	)
+	var i KeyValue
+	err := row.Scan(
+		&i.Key,
+		&i.Value,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.Version,
+		&i.Namespace,
+		&i.EncryptedValue,
+		&i.KeyVersion,
+		&i.ContentType,
+		&i.BinaryValue,
+		&i.Size,
+	)
+	return i, err
+}
+
+const insertPersonErasure = `-- name: InsertPersonErasure :one
+INSERT INTO person_erasure (
+    person_id,
+    requested_by,
+    reason,
+    trace_id,
+    attributes_removed,
+    images_removed,
+    audit_entries_redacted
 ) VALUES (
-    $1, 
+    $1,
     $2,
-    $3, 
-    pgp_sym_encrypt($4, $5), 
-    pgp_sym_encrypt($6, $5), 
+    $3,
+    $4,
+    $5,
+    $6,
     $7
-) RETURNING id, trace_id, created_at
+)
+RETURNING id, person_id, requested_by, reason, trace_id, attributes_removed, images_removed, audit_entries_redacted, erased_at
 `
 
-type InsertRequestLogParams struct {
+type InsertPersonErasureParams struct {
+	PersonID             pgtype.UUID
+	RequestedBy          string
+	Reason               string
+	TraceID              pgtype.Text
+	AttributesRemoved    int64
+	ImagesRemoved        int64
+	AuditEntriesRedacted int64
+}
+
+// Record a tombstone proving a person's data was erased
+func (q *Queries) InsertPersonErasure(ctx context.Context, arg InsertPersonErasureParams) (PersonErasure, error) {
+	row := q.db.QueryRow(ctx, insertPersonErasure,
+		arg.PersonID,
+		arg.RequestedBy,
+		arg.Reason,
+		arg.TraceID,
+		arg.AttributesRemoved,
+		arg.ImagesRemoved,
+		arg.AuditEntriesRedacted,
+	)
+	var i PersonErasure
+	err := row.Scan(
+		&i.ID,
+		&i.PersonID,
+		&i.RequestedBy,
+		&i.Reason,
+		&i.TraceID,
+		&i.AttributesRemoved,
+		&i.ImagesRemoved,
+		&i.AuditEntriesRedacted,
+		&i.ErasedAt,
+	)
+	return i, err
+}
+
+const insertPersonMerge = `-- name: InsertPersonMerge :one
+INSERT INTO person_merge (
+    source_person_id,
+    target_person_id,
+    strategy,
+    merged_by,
+    reason,
+    trace_id,
+    attributes_moved,
+    attributes_dropped,
+    images_moved,
+    images_dropped
+) VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10
+)
+RETURNING id, source_person_id, target_person_id, strategy, merged_by, reason, trace_id, attributes_moved, attributes_dropped, images_moved, images_dropped, merged_at
+`
+
+type InsertPersonMergeParams struct {
+	SourcePersonID    pgtype.UUID
+	TargetPersonID    pgtype.UUID
+	Strategy          string
+	MergedBy          string
+	Reason            string
+	TraceID           pgtype.Text
+	AttributesMoved   int64
+	AttributesDropped int64
+	ImagesMoved       int64
+	ImagesDropped     int64
+}
+
+// Record that a source person was merged into a target person
+func (q *Queries) InsertPersonMerge(ctx context.Context, arg InsertPersonMergeParams) (PersonMerge, error) {
+	row := q.db.QueryRow(ctx, insertPersonMerge,
+		arg.SourcePersonID,
+		arg.TargetPersonID,
+		arg.Strategy,
+		arg.MergedBy,
+		arg.Reason,
+		arg.TraceID,
+		arg.AttributesMoved,
+		arg.AttributesDropped,
+		arg.ImagesMoved,
+		arg.ImagesDropped,
+	)
+	var i PersonMerge
+	err := row.Scan(
+		&i.ID,
+		&i.SourcePersonID,
+		&i.TargetPersonID,
+		&i.Strategy,
+		&i.MergedBy,
+		&i.Reason,
+		&i.TraceID,
+		&i.AttributesMoved,
+		&i.AttributesDropped,
+		&i.ImagesMoved,
+		&i.ImagesDropped,
+		&i.MergedAt,
+	)
+	return i, err
+}
+
+const insertRequestLog = `-- name: InsertRequestLog :one
+
+INSERT INTO request_log (
+    trace_id, 
+    caller_info,
+    reason, 
+    person_id,
+    principal_name,
+    principal_owner,
+    encrypted_request_body, 
+    encrypted_response_body, 
+    key_version
+) VALUES (
+    $1, 
+    $2,
+    $3, 
+    $4,
+    $5,
+    $6,
+    pgp_sym_encrypt($7, $8), 
+    pgp_sym_encrypt($9, $8), 
+    $10
+) RETURNING id, trace_id, created_at
+`
+
+type InsertRequestLogParams struct {
 	TraceID               string
 	CallerInfo            string
 	Reason                string
+	PersonID              pgtype.UUID
+	PrincipalName         pgtype.Text
+	PrincipalOwner        pgtype.Text
 	EncryptedRequestBody  string
 	EncKey                string
 	EncryptedResponseBody string
@@ -803,12 +1505,15 @@ type InsertRequestLogRow struct {
 // ============================================================================
 // REQUEST LOG OPERATIONS
 // ============================================================================
-// Insert a new request log entry with encrypted data
+// Insert a new request log entry with encrypted data and the authenticated principal, if any
 func (q *Queries) InsertRequestLog(ctx context.Context, arg InsertRequestLogParams) (InsertRequestLogRow, error) {
 	row := q.db.QueryRow(ctx, insertRequestLog,
 		arg.TraceID,
 		arg.CallerInfo,
 		arg.Reason,
+		arg.PersonID,
+		arg.PrincipalName,
+		arg.PrincipalOwner,
 		arg.EncryptedRequestBody,
 		arg.EncKey,
 		arg.EncryptedResponseBody,
@@ -819,6 +1524,117 @@ func (q *Queries) InsertRequestLog(ctx context.Context, arg InsertRequestLogPara
 	return i, err
 }
 
+const insertValueIfAbsent = `-- name: InsertValueIfAbsent :one
+INSERT INTO key_value (namespace, key, value, encrypted_value, key_version, content_type, binary_value, size, expires_at)
+VALUES (
+    $1,
+    $2,
+    CASE WHEN $3::text IS NULL THEN $4::text ELSE '' END,
+    CASE WHEN $5::text IS NULL
+        THEN pgp_sym_encrypt($4::text, $3::text)
+        ELSE pgp_sym_encrypt_bytea($6::bytea, $3::text) END,
+    $7,
+    $5::text,
+    CASE WHEN $3::text IS NULL THEN $6::bytea END,
+    octet_length($6::bytea),
+    now() + $8::bigint * interval '1 second'
+)
+ON CONFLICT (namespace, key) DO UPDATE SET
+    value = EXCLUDED.value,
+    encrypted_value = EXCLUDED.encrypted_value,
+    key_version = EXCLUDED.key_version,
+    content_type = EXCLUDED.content_type,
+    binary_value = EXCLUDED.binary_value,
+    size = EXCLUDED.size,
+    expires_at = EXCLUDED.expires_at,
+    created_at = CURRENT_TIMESTAMP,
+    updated_at = CURRENT_TIMESTAMP,
+    version = 1
+WHERE key_value.expires_at <= now()
+RETURNING key, value, created_at, updated_at, expires_at, version, namespace, encrypted_value, key_version, content_type, binary_value, size
+`
+
+type InsertValueIfAbsentParams struct {
+	Namespace   string
+	Key         string
+	EncKey      pgtype.Text
+	Value       string
+	ContentType pgtype.Text
+	Data        []byte
+	KeyVersion  pgtype.Int8
+	TtlSeconds  pgtype.Int8
+}
+
+// Create a key only if it does not exist (expired keys count as missing).
+// Returns no rows when the key already exists. With an enc_key the value is stored encrypted,
+// with a content_type data is stored as a binary value.
+func (q *Queries) InsertValueIfAbsent(ctx context.Context, arg InsertValueIfAbsentParams) (KeyValue, error) {
+	row := q.db.QueryRow(ctx, insertValueIfAbsent,
+		arg.Namespace,
+		arg.Key,
+		arg.EncKey,
+		arg.Value,
+		arg.ContentType,
+		arg.Data,
+		arg.KeyVersion,
+		arg.TtlSeconds,
+	)
+	var i KeyValue
+	err := row.Scan(
+		&i.Key,
+		&i.Value,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.Version,
+		&i.Namespace,
+		&i.EncryptedValue,
+		&i.KeyVersion,
+		&i.ContentType,
+		&i.BinaryValue,
+		&i.Size,
+	)
+	return i, err
+}
+
+const listAPIKeys = `-- name: ListAPIKeys :many
+SELECT id, name, owner, key_hash, scopes, expires_at, last_used_at, created_at, revoked_at
+FROM api_keys
+WHERE revoked_at IS NULL OR $1::boolean
+ORDER BY name, id
+`
+
+// List API keys, revoked keys only when asked for
+func (q *Queries) ListAPIKeys(ctx context.Context, includeRevoked bool) ([]ApiKey, error) {
+	rows, err := q.db.Query(ctx, listAPIKeys, includeRevoked)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ApiKey{}
+	for rows.Next() {
+		var i ApiKey
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Owner,
+			&i.KeyHash,
+			&i.Scopes,
+			&i.ExpiresAt,
+			&i.LastUsedAt,
+			&i.CreatedAt,
+			&i.RevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listAttributeKeys = `-- name: ListAttributeKeys :many
 SELECT DISTINCT attribute_key
 FROM person_attributes
@@ -846,6 +1662,147 @@ func (q *Queries) ListAttributeKeys(ctx context.Context) ([]string, error) {
 	return items, nil
 }
 
+const listKeyValues = `-- name: ListKeyValues :many
+SELECT key_value.key, key_value.value, key_value.created_at, key_value.updated_at, key_value.expires_at, key_value.version, key_value.namespace, key_value.encrypted_value, key_value.key_version, key_value.content_type, key_value.binary_value, key_value.size,
+    CASE WHEN content_type IS NULL
+        THEN COALESCE(pgp_sym_decrypt(encrypted_value, $1), value)
+        ELSE '' END::text AS plain_value
+FROM key_value
+WHERE namespace = $2
+    AND starts_with(key, $3)
+    AND key > $4
+    AND (expires_at IS NULL OR expires_at > now())
+ORDER BY key
+LIMIT $5
+`
+
+type ListKeyValuesParams struct {
+	EncKey    string
+	Namespace string
+	Prefix    string
+	AfterKey  string
+	RowLimit  int32
+}
+
+type ListKeyValuesRow struct {
+	KeyValue   KeyValue
+	PlainValue string
+}
+
+// List live keys of a namespace starting with prefix, in key order after the cursor key (keyset pagination).
+// plain_value is a text value, decrypted when stored encrypted; binary values read as empty.
+func (q *Queries) ListKeyValues(ctx context.Context, arg ListKeyValuesParams) ([]ListKeyValuesRow, error) {
+	rows, err := q.db.Query(ctx, listKeyValues,
+		arg.EncKey,
+		arg.Namespace,
+		arg.Prefix,
+		arg.AfterKey,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListKeyValuesRow{}
+	for rows.Next() {
+		var i ListKeyValuesRow
+		if err := rows.Scan(
+			&i.KeyValue.Key,
+			&i.KeyValue.Value,
+			&i.KeyValue.CreatedAt,
+			&i.KeyValue.UpdatedAt,
+			&i.KeyValue.ExpiresAt,
+			&i.KeyValue.Version,
+			&i.KeyValue.Namespace,
+			&i.KeyValue.EncryptedValue,
+			&i.KeyValue.KeyVersion,
+			&i.KeyValue.ContentType,
+			&i.KeyValue.BinaryValue,
+			&i.KeyValue.Size,
+			&i.PlainValue,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPersonAttributeKeys = `-- name: ListPersonAttributeKeys :many
+
+SELECT id, attribute_key, updated_at
+FROM person_attributes
+WHERE person_id = $1
+ORDER BY attribute_key
+`
+
+type ListPersonAttributeKeysRow struct {
+	ID           int64
+	AttributeKey string
+	UpdatedAt    pgtype.Timestamptz
+}
+
+// ============================================================================
+// PERSON MERGE OPERATIONS
+// ============================================================================
+// List attribute keys and timestamps for a person (without decrypting)
+func (q *Queries) ListPersonAttributeKeys(ctx context.Context, personID pgtype.UUID) ([]ListPersonAttributeKeysRow, error) {
+	rows, err := q.db.Query(ctx, listPersonAttributeKeys, personID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListPersonAttributeKeysRow{}
+	for rows.Next() {
+		var i ListPersonAttributeKeysRow
+		if err := rows.Scan(&i.ID, &i.AttributeKey, &i.UpdatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPersonIdentifiers = `-- name: ListPersonIdentifiers :many
+SELECT id, person_id, system, external_id, created_at
+FROM person_identifiers
+WHERE person_id = $1
+ORDER BY system, external_id
+`
+
+// List all identifiers of a person
+func (q *Queries) ListPersonIdentifiers(ctx context.Context, personID pgtype.UUID) ([]PersonIdentifier, error) {
+	rows, err := q.db.Query(ctx, listPersonIdentifiers, personID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []PersonIdentifier{}
+	for rows.Next() {
+		var i PersonIdentifier
+		if err := rows.Scan(
+			&i.ID,
+			&i.PersonID,
+			&i.System,
+			&i.ExternalID,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listPersonImages = `-- name: ListPersonImages :many
 SELECT 
     id,
@@ -1021,6 +1978,356 @@ func (q *Queries) ListPersons(ctx context.Context, arg ListPersonsParams) ([]Per
 	return items, nil
 }
 
+const listRequestLogsByPersonId = `-- name: ListRequestLogsByPersonId :many
+SELECT
+    id,
+    trace_id,
+    caller_info,
+    principal_name,
+    principal_owner,
+    reason,
+    COALESCE(pgp_sym_decrypt(encrypted_request_body, $1), '') AS request_body,
+    COALESCE(pgp_sym_decrypt(encrypted_response_body, $1), '') AS response_body,
+    key_version,
+    created_at
+FROM request_log
+WHERE person_id = $2
+ORDER BY created_at, id
+`
+
+type ListRequestLogsByPersonIdParams struct {
+	EncKey   string
+	PersonID pgtype.UUID
+}
+
+type ListRequestLogsByPersonIdRow struct {
+	ID             int64
+	TraceID        string
+	CallerInfo     string
+	PrincipalName  pgtype.Text
+	PrincipalOwner pgtype.Text
+	Reason         string
+	RequestBody    string
+	ResponseBody   string
+	KeyVersion     int64
+	CreatedAt      pgtype.Timestamptz
+}
+
+// List decrypted request log entries that reference a person (oldest first)
+func (q *Queries) ListRequestLogsByPersonId(ctx context.Context, arg ListRequestLogsByPersonIdParams) ([]ListRequestLogsByPersonIdRow, error) {
+	rows, err := q.db.Query(ctx, listRequestLogsByPersonId, arg.EncKey, arg.PersonID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListRequestLogsByPersonIdRow{}
+	for rows.Next() {
+		var i ListRequestLogsByPersonIdRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.TraceID,
+			&i.CallerInfo,
+			&i.PrincipalName,
+			&i.PrincipalOwner,
+			&i.Reason,
+			&i.RequestBody,
+			&i.ResponseBody,
+			&i.KeyVersion,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockKey = `-- name: LockKey :exec
+SELECT pg_advisory_xact_lock(hashtext($1::text || '/' || $2::text))
+`
+
+type LockKeyParams struct {
+	Namespace string
+	Key       string
+}
+
+// Take a transaction-scoped advisory lock on a key, whether or not it exists, so
+// transactions touching the same keys run one after the other. Taken in key order.
+func (q *Queries) LockKey(ctx context.Context, arg LockKeyParams) error {
+	_, err := q.db.Exec(ctx, lockKey, arg.Namespace, arg.Key)
+	return err
+}
+
+const lockKeyValues = `-- name: LockKeyValues :exec
+SELECT key FROM key_value
+WHERE namespace = $1 AND key = ANY($2::text[])
+ORDER BY key
+FOR UPDATE
+`
+
+type LockKeyValuesParams struct {
+	Namespace string
+	Keys      []string
+}
+
+// Lock the existing rows of keys in key order, so writes outside a transaction
+// wait for it too. Keys without a row are only covered by LockKey.
+func (q *Queries) LockKeyValues(ctx context.Context, arg LockKeyValuesParams) error {
+	_, err := q.db.Exec(ctx, lockKeyValues, arg.Namespace, arg.Keys)
+	return err
+}
+
+const movePersonAttributes = `-- name: MovePersonAttributes :execrows
+UPDATE person_attributes
+SET person_id = $1
+WHERE person_id = $2
+`
+
+type MovePersonAttributesParams struct {
+	TargetPersonID pgtype.UUID
+	SourcePersonID pgtype.UUID
+}
+
+// Reassign all attributes of the source person to the target person
+func (q *Queries) MovePersonAttributes(ctx context.Context, arg MovePersonAttributesParams) (int64, error) {
+	result, err := q.db.Exec(ctx, movePersonAttributes, arg.TargetPersonID, arg.SourcePersonID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const movePersonIdentifiers = `-- name: MovePersonIdentifiers :execrows
+UPDATE person_identifiers
+SET person_id = $1
+WHERE person_id = $2
+`
+
+type MovePersonIdentifiersParams struct {
+	TargetPersonID pgtype.UUID
+	SourcePersonID pgtype.UUID
+}
+
+// Reassign all identifiers of the source person to the target person
+func (q *Queries) MovePersonIdentifiers(ctx context.Context, arg MovePersonIdentifiersParams) (int64, error) {
+	result, err := q.db.Exec(ctx, movePersonIdentifiers, arg.TargetPersonID, arg.SourcePersonID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const movePersonImages = `-- name: MovePersonImages :execrows
+UPDATE person_images
+SET person_id = $1
+WHERE person_id = $2
+`
+
+type MovePersonImagesParams struct {
+	TargetPersonID pgtype.UUID
+	SourcePersonID pgtype.UUID
+}
+
+// Reassign all images of the source person to the target person
+func (q *Queries) MovePersonImages(ctx context.Context, arg MovePersonImagesParams) (int64, error) {
+	result, err := q.db.Exec(ctx, movePersonImages, arg.TargetPersonID, arg.SourcePersonID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const movePersonRequestLogs = `-- name: MovePersonRequestLogs :execrows
+UPDATE request_log
+SET person_id = $1
+WHERE person_id = $2
+`
+
+type MovePersonRequestLogsParams struct {
+	TargetPersonID pgtype.UUID
+	SourcePersonID pgtype.UUID
+}
+
+// Reassign the audit entries of the source person to the target person, so exports
+// and erasures of the target cover them
+func (q *Queries) MovePersonRequestLogs(ctx context.Context, arg MovePersonRequestLogsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, movePersonRequestLogs, arg.TargetPersonID, arg.SourcePersonID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const purgeRequestLogs = `-- name: PurgeRequestLogs :execrows
+DELETE FROM request_log
+WHERE id IN (
+    SELECT id FROM request_log
+    WHERE created_at < $1
+    ORDER BY id
+    LIMIT $2
+)
+`
+
+type PurgeRequestLogsParams struct {
+	Cutoff    pgtype.Timestamptz
+	BatchSize int32
+}
+
+// Delete a batch of audit entries created before the cutoff
+func (q *Queries) PurgeRequestLogs(ctx context.Context, arg PurgeRequestLogsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeRequestLogs, arg.Cutoff, arg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const purgeSoftDeletedPersons = `-- name: PurgeSoftDeletedPersons :one
+WITH purged AS (
+    DELETE FROM person
+    WHERE id IN (
+        SELECT id FROM person
+        WHERE deleted_at IS NOT NULL AND deleted_at < $1
+        ORDER BY deleted_at
+        LIMIT $2
+        FOR UPDATE SKIP LOCKED
+    )
+    -- A person restored since the batch was selected is kept
+    AND deleted_at IS NOT NULL AND deleted_at < $1
+    RETURNING id
+), redacted AS (
+    UPDATE request_log
+    SET encrypted_request_body = NULL,
+        encrypted_response_body = NULL,
+        redacted_at = CURRENT_TIMESTAMP
+    WHERE person_id IN (SELECT id FROM purged) AND redacted_at IS NULL
+    RETURNING id
+)
+SELECT
+    (SELECT COUNT(*) FROM purged) AS persons_purged,
+    (SELECT COUNT(*) FROM redacted) AS audit_entries_redacted
+`
+
+type PurgeSoftDeletedPersonsParams struct {
+	Cutoff    pgtype.Timestamptz
+	BatchSize int32
+}
+
+type PurgeSoftDeletedPersonsRow struct {
+	PersonsPurged        int64
+	AuditEntriesRedacted int64
+}
+
+// Hard delete a batch of soft-deleted persons older than the cutoff and redact their audit payloads
+func (q *Queries) PurgeSoftDeletedPersons(ctx context.Context, arg PurgeSoftDeletedPersonsParams) (PurgeSoftDeletedPersonsRow, error) {
+	row := q.db.QueryRow(ctx, purgeSoftDeletedPersons, arg.Cutoff, arg.BatchSize)
+	var i PurgeSoftDeletedPersonsRow
+	err := row.Scan(&i.PersonsPurged, &i.AuditEntriesRedacted)
+	return i, err
+}
+
+const redactRequestLogsByPersonId = `-- name: RedactRequestLogsByPersonId :execrows
+UPDATE request_log
+SET encrypted_request_body = NULL,
+    encrypted_response_body = NULL,
+    redacted_at = CURRENT_TIMESTAMP
+WHERE person_id = $1 AND redacted_at IS NULL
+`
+
+// Remove the encrypted payloads of all audit entries that reference a person.
+// Entries written before person_id was recorded (migration 000002) cannot be
+// matched: their bodies are encrypted with the application key and do not name
+// the person, so they are left for audit log retention to delete.
+func (q *Queries) RedactRequestLogsByPersonId(ctx context.Context, personID pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, redactRequestLogsByPersonId, personID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const refundRateLimitToken = `-- name: RefundRateLimitToken :exec
+UPDATE rate_limit_buckets
+SET tokens = LEAST($1::float8, tokens + 1)
+WHERE key = $2
+`
+
+type RefundRateLimitTokenParams struct {
+	Capacity float64
+	Key      string
+}
+
+// Give back a token taken from a bucket, without going over its capacity
+func (q *Queries) RefundRateLimitToken(ctx context.Context, arg RefundRateLimitTokenParams) error {
+	_, err := q.db.Exec(ctx, refundRateLimitToken, arg.Capacity, arg.Key)
+	return err
+}
+
+const repointPersonMerges = `-- name: RepointPersonMerges :exec
+UPDATE person_merge
+SET target_person_id = $1
+WHERE target_person_id = $2
+`
+
+type RepointPersonMergesParams struct {
+	NewTargetPersonID pgtype.UUID
+	OldTargetPersonID pgtype.UUID
+}
+
+// Point earlier merges into the source person at the new target so redirects take a single hop
+func (q *Queries) RepointPersonMerges(ctx context.Context, arg RepointPersonMergesParams) error {
+	_, err := q.db.Exec(ctx, repointPersonMerges, arg.NewTargetPersonID, arg.OldTargetPersonID)
+	return err
+}
+
+const resolvePersonIdentifier = `-- name: ResolvePersonIdentifier :one
+SELECT
+    p.id,
+    p.client_id,
+    p.created_at,
+    p.updated_at,
+    pi.system,
+    pi.external_id
+FROM person_identifiers pi
+JOIN person p ON p.id = pi.person_id
+WHERE pi.system = $1
+    AND pi.external_id = $2
+    AND p.deleted_at IS NULL
+LIMIT 1
+`
+
+type ResolvePersonIdentifierParams struct {
+	System     string
+	ExternalID string
+}
+
+type ResolvePersonIdentifierRow struct {
+	ID         pgtype.UUID
+	ClientID   string
+	CreatedAt  pgtype.Timestamptz
+	UpdatedAt  pgtype.Timestamptz
+	System     string
+	ExternalID string
+}
+
+// Resolve an active person by system and external ID
+func (q *Queries) ResolvePersonIdentifier(ctx context.Context, arg ResolvePersonIdentifierParams) (ResolvePersonIdentifierRow, error) {
+	row := q.db.QueryRow(ctx, resolvePersonIdentifier, arg.System, arg.ExternalID)
+	var i ResolvePersonIdentifierRow
+	err := row.Scan(
+		&i.ID,
+		&i.ClientID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.System,
+		&i.ExternalID,
+	)
+	return i, err
+}
+
 const restorePerson = `-- name: RestorePerson :exec
 UPDATE person
 SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP
@@ -1033,6 +2340,31 @@ func (q *Queries) RestorePerson(ctx context.Context, id pgtype.UUID) error {
 	return err
 }
 
+const revokeAPIKey = `-- name: RevokeAPIKey :one
+UPDATE api_keys
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND revoked_at IS NULL
+RETURNING id, name, owner, key_hash, scopes, expires_at, last_used_at, created_at, revoked_at
+`
+
+// Revoke an active API key (returns no row if it does not exist or is already revoked)
+func (q *Queries) RevokeAPIKey(ctx context.Context, id int64) (ApiKey, error) {
+	row := q.db.QueryRow(ctx, revokeAPIKey, id)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Owner,
+		&i.KeyHash,
+		&i.Scopes,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.CreatedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
 const searchPersonsByAttribute = `-- name: SearchPersonsByAttribute :many
 SELECT DISTINCT
     p.id,
@@ -1085,20 +2417,87 @@ func (q *Queries) SearchPersonsByAttribute(ctx context.Context, arg SearchPerson
 	return items, nil
 }
 
-const setValue = `-- name: SetValue :exec
-INSERT INTO key_value (key, value) VALUES ($1, $2)
-ON CONFLICT (key) DO UPDATE SET value = $2
+const setValue = `-- name: SetValue :one
+INSERT INTO key_value (namespace, key, value, encrypted_value, key_version, content_type, binary_value, size, expires_at)
+VALUES (
+    $1,
+    $2,
+    CASE WHEN $3::text IS NULL THEN $4::text ELSE '' END,
+    CASE WHEN $5::text IS NULL
+        THEN pgp_sym_encrypt($4::text, $3::text)
+        ELSE pgp_sym_encrypt_bytea($6::bytea, $3::text) END,
+    $7,
+    $5::text,
+    CASE WHEN $3::text IS NULL THEN $6::bytea END,
+    octet_length($6::bytea),
+    now() + $8::bigint * interval '1 second'
+)
+ON CONFLICT (namespace, key) DO UPDATE SET
+    value = CASE WHEN EXCLUDED.encrypted_value IS NULL AND key_value.encrypted_value IS NOT NULL AND (key_value.expires_at IS NULL OR key_value.expires_at > now()) THEN '' ELSE EXCLUDED.value END,
+    encrypted_value = CASE WHEN EXCLUDED.encrypted_value IS NULL AND key_value.encrypted_value IS NOT NULL AND (key_value.expires_at IS NULL OR key_value.expires_at > now())
+        THEN CASE WHEN $5::text IS NULL
+            THEN pgp_sym_encrypt($4::text, $9::text)
+            ELSE pgp_sym_encrypt_bytea($6::bytea, $9::text) END
+        ELSE EXCLUDED.encrypted_value END,
+    key_version = CASE WHEN EXCLUDED.encrypted_value IS NULL AND key_value.encrypted_value IS NOT NULL AND (key_value.expires_at IS NULL OR key_value.expires_at > now()) THEN $10::bigint ELSE EXCLUDED.key_version END,
+    content_type = EXCLUDED.content_type,
+    binary_value = CASE WHEN EXCLUDED.encrypted_value IS NULL AND key_value.encrypted_value IS NOT NULL AND (key_value.expires_at IS NULL OR key_value.expires_at > now()) THEN NULL ELSE EXCLUDED.binary_value END,
+    size = EXCLUDED.size,
+    expires_at = EXCLUDED.expires_at,
+    created_at = CASE WHEN key_value.expires_at <= now() THEN CURRENT_TIMESTAMP ELSE key_value.created_at END,
+    version = CASE WHEN key_value.expires_at <= now() THEN 1 ELSE key_value.version + 1 END,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING key, value, created_at, updated_at, expires_at, version, namespace, encrypted_value, key_version, content_type, binary_value, size
 `
 
 type SetValueParams struct {
-	Key   string
-	Value string
-}
-
-// Set a value by key
-func (q *Queries) SetValue(ctx context.Context, arg SetValueParams) error {
-	_, err := q.db.Exec(ctx, setValue, arg.Key, arg.Value)
-	return err
+	Namespace      string
+	Key            string
+	EncKey         pgtype.Text
+	Value          string
+	ContentType    pgtype.Text
+	Data           []byte
+	KeyVersion     pgtype.Int8
+	TtlSeconds     pgtype.Int8
+	KeepKey        string
+	KeepKeyVersion int64
+}
+
+// Set a value by key and return the record. A NULL ttl_seconds removes any
+// previous TTL. An expired key that has not been reaped yet is recreated, so
+// a returned version of 1 means the key was created by this write.
+// With an enc_key the value is stored encrypted and value is left empty.
+// A live key stored encrypted stays encrypted, with keep_key, whatever the enc_key.
+// With a content_type, data is stored as a binary value instead of value.
+func (q *Queries) SetValue(ctx context.Context, arg SetValueParams) (KeyValue, error) {
+	row := q.db.QueryRow(ctx, setValue,
+		arg.Namespace,
+		arg.Key,
+		arg.EncKey,
+		arg.Value,
+		arg.ContentType,
+		arg.Data,
+		arg.KeyVersion,
+		arg.TtlSeconds,
+		arg.KeepKey,
+		arg.KeepKeyVersion,
+	)
+	var i KeyValue
+	err := row.Scan(
+		&i.Key,
+		&i.Value,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.Version,
+		&i.Namespace,
+		&i.EncryptedValue,
+		&i.KeyVersion,
+		&i.ContentType,
+		&i.BinaryValue,
+		&i.Size,
+	)
+	return i, err
 }
 
 const softDeletePerson = `-- name: SoftDeletePerson :exec
@@ -1113,6 +2512,49 @@ func (q *Queries) SoftDeletePerson(ctx context.Context, id pgtype.UUID) error {
 	return err
 }
 
+const takeRateLimitToken = `-- name: TakeRateLimitToken :one
+INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+VALUES ($1, $2::float8 - 1, true, CURRENT_TIMESTAMP)
+ON CONFLICT (key) DO UPDATE SET
+    tokens = LEAST($2::float8, b.tokens + GREATEST(EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - b.updated_at)::float8, 0) * $3::float8)
+        - CASE WHEN LEAST($2::float8, b.tokens + GREATEST(EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - b.updated_at)::float8, 0) * $3::float8) >= 1 THEN 1 ELSE 0 END,
+    allowed = LEAST($2::float8, b.tokens + GREATEST(EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - b.updated_at)::float8, 0) * $3::float8) >= 1,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING tokens, allowed
+`
+
+type TakeRateLimitTokenParams struct {
+	Key        string
+	Capacity   float64
+	RefillRate float64
+}
+
+type TakeRateLimitTokenRow struct {
+	Tokens  float64
+	Allowed bool
+}
+
+// Refill a token bucket for the time since its last update and take a token if a whole one is left
+func (q *Queries) TakeRateLimitToken(ctx context.Context, arg TakeRateLimitTokenParams) (TakeRateLimitTokenRow, error) {
+	row := q.db.QueryRow(ctx, takeRateLimitToken, arg.Key, arg.Capacity, arg.RefillRate)
+	var i TakeRateLimitTokenRow
+	err := row.Scan(&i.Tokens, &i.Allowed)
+	return i, err
+}
+
+const touchAPIKey = `-- name: TouchAPIKey :exec
+UPDATE api_keys
+SET last_used_at = CURRENT_TIMESTAMP
+WHERE id = $1
+    AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - interval '1 minute')
+`
+
+// Record that an API key was used, at most once a minute to limit writes
+func (q *Queries) TouchAPIKey(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, touchAPIKey, id)
+	return err
+}
+
 const updatePersonAttributeWithVersion = `-- name: UpdatePersonAttributeWithVersion :one
 UPDATE person_attributes
 SET
@@ -1184,3 +2626,74 @@ func (q *Queries) UpdatePersonClientId(ctx context.Context, arg UpdatePersonClie
 	_, err := q.db.Exec(ctx, updatePersonClientId, arg.NewClientID, arg.ID)
 	return err
 }
+
+const updateValueWithVersion = `-- name: UpdateValueWithVersion :one
+UPDATE key_value
+SET
+    value = CASE WHEN $1::text IS NULL AND encrypted_value IS NULL THEN $2::text ELSE '' END,
+    encrypted_value = CASE WHEN $3::text IS NULL
+        THEN pgp_sym_encrypt($2::text, COALESCE($1::text, CASE WHEN encrypted_value IS NOT NULL THEN $4::text END))
+        ELSE pgp_sym_encrypt_bytea($5::bytea, COALESCE($1::text, CASE WHEN encrypted_value IS NOT NULL THEN $4::text END)) END,
+    key_version = CASE WHEN $1::text IS NULL AND encrypted_value IS NOT NULL THEN $6::bigint ELSE $7 END,
+    content_type = $3::text,
+    binary_value = CASE WHEN $1::text IS NULL AND encrypted_value IS NULL THEN $5::bytea END,
+    size = octet_length($5::bytea),
+    expires_at = now() + $8::bigint * interval '1 second',
+    version = version + 1,
+    updated_at = CURRENT_TIMESTAMP
+WHERE namespace = $9
+    AND key = $10
+    AND version = $11
+    AND (expires_at IS NULL OR expires_at > now())
+RETURNING key, value, created_at, updated_at, expires_at, version, namespace, encrypted_value, key_version, content_type, binary_value, size
+`
+
+type UpdateValueWithVersionParams struct {
+	EncKey          pgtype.Text
+	Value           string
+	ContentType     pgtype.Text
+	KeepKey         string
+	Data            []byte
+	KeepKeyVersion  int64
+	KeyVersion      pgtype.Int8
+	TtlSeconds      pgtype.Int8
+	Namespace       string
+	Key             string
+	ExpectedVersion int64
+}
+
+// Update a key with optimistic locking (version check).
+// Returns no rows when the key is missing, expired or at another version.
+// With an enc_key the value is stored encrypted, with a content_type data is stored as a binary value.
+// A key stored encrypted stays encrypted, with keep_key, whatever the enc_key.
+func (q *Queries) UpdateValueWithVersion(ctx context.Context, arg UpdateValueWithVersionParams) (KeyValue, error) {
+	row := q.db.QueryRow(ctx, updateValueWithVersion,
+		arg.EncKey,
+		arg.Value,
+		arg.ContentType,
+		arg.KeepKey,
+		arg.Data,
+		arg.KeepKeyVersion,
+		arg.KeyVersion,
+		arg.TtlSeconds,
+		arg.Namespace,
+		arg.Key,
+		arg.ExpectedVersion,
+	)
+	var i KeyValue
+	err := row.Scan(
+		&i.Key,
+		&i.Value,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.Version,
+		&i.Namespace,
+		&i.EncryptedValue,
+		&i.KeyVersion,
+		&i.ContentType,
+		&i.BinaryValue,
+		&i.Size,
+	)
+	return i, err
+}
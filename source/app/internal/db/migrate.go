@@ -17,7 +17,8 @@ var migrationsFS embed.FS
 
 // RunMigrations applies all pending database migrations.
 // It uses the embedded migration files and the provided connection pool.
-func RunMigrations(ctx context.Context, pool *pgxpool.Pool, databaseURL string) error {
+// It returns the schema version and whether the last migration failed halfway.
+func RunMigrations(ctx context.Context, pool *pgxpool.Pool, databaseURL string) (uint, bool, error) {
 	logger := logging.LoggerFromContext(ctx)
 	logger.Info("Starting database migrations")
 
@@ -25,7 +26,7 @@ func RunMigrations(ctx context.Context, pool *pgxpool.Pool, databaseURL string)
 	source, err := iofs.New(migrationsFS, "migrations")
 	if err != nil {
 		logger.Error("Failed to create migration source", "error", err)
-		return err
+		return 0, false, err
 	}
 
 	// Create migrate instance
@@ -33,25 +34,24 @@ func RunMigrations(ctx context.Context, pool *pgxpool.Pool, databaseURL string)
 	m, err := migrate.NewWithSourceInstance("iofs", source, databaseURL)
 	if err != nil {
 		logger.Error("Failed to create migrate instance", "error", err)
-		return err
+		return 0, false, err
 	}
 	defer m.Close()
 
 	// Run migrations
 	err = m.Up()
-	if err != nil {
-		if errors.Is(err, migrate.ErrNoChange) {
-			logger.Info("Database schema is up to date, no migrations needed")
-			return nil
-		}
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
 		logger.Error("Migration failed", "error", err)
-		return err
+		return 0, false, err
 	}
+	upToDate := errors.Is(err, migrate.ErrNoChange)
 
 	// Get current version after migration
 	version, dirty, err := m.Version()
 	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
 		logger.Warn("Could not get migration version", "error", err)
+	} else if upToDate {
+		logger.Info("Database schema is up to date, no migrations needed", "version", version)
 	} else {
 		logger.Info("Database migrations completed successfully",
 			"version", version,
@@ -59,5 +59,5 @@ func RunMigrations(ctx context.Context, pool *pgxpool.Pool, databaseURL string)
 		)
 	}
 
-	return nil
+	return version, dirty, nil
 }
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_request_log_person_id;
+
+ALTER TABLE request_log DROP COLUMN IF EXISTS person_id;
@@ -0,0 +1,7 @@
+set lock_timeout = '1s';
+set statement_timeout = '5s';
+
+-- Link audit entries to the person they concern (used for subject-access exports)
+ALTER TABLE request_log ADD COLUMN IF NOT EXISTS person_id UUID;
+
+CREATE INDEX IF NOT EXISTS idx_request_log_person_id ON request_log(person_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS person_erasure;
+
+ALTER TABLE request_log DROP COLUMN IF EXISTS redacted_at;
@@ -0,0 +1,19 @@
+set lock_timeout = '1s';
+set statement_timeout = '5s';
+
+-- Mark audit entries whose payloads were redacted by a right-to-erasure request
+ALTER TABLE request_log ADD COLUMN IF NOT EXISTS redacted_at timestamptz;
+
+-- Tombstones proving that a person's data was erased.
+-- No foreign key: the person row itself is deleted as part of the erasure.
+CREATE TABLE IF NOT EXISTS person_erasure (
+    id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    person_id UUID UNIQUE NOT NULL,
+    requested_by text NOT NULL,
+    reason text NOT NULL,
+    trace_id text,
+    attributes_removed bigint NOT NULL,
+    images_removed bigint NOT NULL,
+    audit_entries_redacted bigint NOT NULL,
+    erased_at timestamptz DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_request_log_created_at;
+DROP INDEX IF EXISTS idx_person_deleted_at;
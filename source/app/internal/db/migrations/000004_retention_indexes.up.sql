@@ -0,0 +1,6 @@
+set lock_timeout = '1s';
+set statement_timeout = '5s';
+
+-- Support the retention purge of soft-deleted persons and old audit entries
+CREATE INDEX IF NOT EXISTS idx_person_deleted_at ON person(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_request_log_created_at ON request_log(created_at);
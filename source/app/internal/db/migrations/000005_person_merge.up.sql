@@ -0,0 +1,22 @@
+set lock_timeout = '1s';
+set statement_timeout = '5s';
+
+-- Records of duplicate persons merged into a surviving person.
+-- The source person is soft-deleted and reads of its ID are redirected to the target.
+-- No foreign keys: the record outlives retention purges and erasures of either person.
+CREATE TABLE IF NOT EXISTS person_merge (
+    id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    source_person_id UUID UNIQUE NOT NULL,
+    target_person_id UUID NOT NULL,
+    strategy text NOT NULL,
+    merged_by text NOT NULL,
+    reason text NOT NULL,
+    trace_id text,
+    attributes_moved bigint NOT NULL,
+    attributes_dropped bigint NOT NULL,
+    images_moved bigint NOT NULL,
+    images_dropped bigint NOT NULL,
+    merged_at timestamptz DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_person_merge_target_person_id ON person_merge(target_person_id);
@@ -0,0 +1,15 @@
+set lock_timeout = '1s';
+set statement_timeout = '5s';
+
+-- Identifiers of a person in other client systems (CRM, billing, identity, ...).
+-- An external ID belongs to at most one person within a system.
+CREATE TABLE IF NOT EXISTS person_identifiers (
+    id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    person_id UUID NOT NULL REFERENCES person(id) ON DELETE CASCADE,
+    system citext NOT NULL,
+    external_id text NOT NULL,
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(system, external_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_person_identifiers_person_id ON person_identifiers(person_id);
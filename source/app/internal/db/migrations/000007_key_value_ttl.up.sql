@@ -0,0 +1,8 @@
+set lock_timeout = '1s';
+set statement_timeout = '5s';
+
+-- Optional expiry of a key. NULL means the key never expires.
+ALTER TABLE key_value ADD COLUMN IF NOT EXISTS expires_at timestamptz;
+
+-- Only keys with a TTL are scanned by the reaper
+CREATE INDEX IF NOT EXISTS idx_key_value_expires_at ON key_value(expires_at) WHERE expires_at IS NOT NULL;
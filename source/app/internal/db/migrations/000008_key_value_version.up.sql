@@ -0,0 +1,6 @@
+set lock_timeout = '1s';
+set statement_timeout = '5s';
+
+-- Version of a key, incremented on every write and used for compare-and-swap.
+-- A key that is recreated after it expired starts again at 1.
+ALTER TABLE key_value ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1;
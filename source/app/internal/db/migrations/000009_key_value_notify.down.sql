@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS key_value_notify ON key_value;
+DROP FUNCTION IF EXISTS notify_key_value_change();
@@ -0,0 +1,36 @@
+set lock_timeout = '1s';
+set statement_timeout = '5s';
+
+-- Publish every write to key_value on the key_value_changes channel so
+-- watchers can block until a key changes instead of polling.
+CREATE OR REPLACE FUNCTION notify_key_value_change() RETURNS trigger AS $$
+DECLARE
+    changed key_value%ROWTYPE;
+    payload text;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed := OLD;
+    ELSE
+        changed := NEW;
+    END IF;
+
+    payload := json_build_object(
+        'key', changed.key,
+        'version', changed.version,
+        'op', CASE WHEN TG_OP = 'DELETE' THEN 'delete' ELSE 'set' END
+    )::text;
+
+    -- NOTIFY payloads are limited to 8000 bytes: ask listeners to re-read instead
+    IF octet_length(payload) > 7900 THEN
+        payload := json_build_object('op', 'resync')::text;
+    END IF;
+
+    PERFORM pg_notify('key_value_changes', payload);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS key_value_notify ON key_value;
+CREATE TRIGGER key_value_notify
+AFTER INSERT OR UPDATE OR DELETE ON key_value
+FOR EACH ROW EXECUTE FUNCTION notify_key_value_change();
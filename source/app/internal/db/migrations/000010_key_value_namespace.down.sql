@@ -0,0 +1,32 @@
+-- Only the default namespace fits the single-namespace primary key
+DELETE FROM key_value WHERE namespace <> 'default';
+ALTER TABLE key_value DROP CONSTRAINT key_value_pkey;
+ALTER TABLE key_value ADD PRIMARY KEY (key);
+ALTER TABLE key_value DROP COLUMN IF EXISTS namespace;
+
+CREATE OR REPLACE FUNCTION notify_key_value_change() RETURNS trigger AS $$
+DECLARE
+    changed key_value%ROWTYPE;
+    payload text;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed := OLD;
+    ELSE
+        changed := NEW;
+    END IF;
+
+    payload := json_build_object(
+        'key', changed.key,
+        'version', changed.version,
+        'op', CASE WHEN TG_OP = 'DELETE' THEN 'delete' ELSE 'set' END
+    )::text;
+
+    -- NOTIFY payloads are limited to 8000 bytes: ask listeners to re-read instead
+    IF octet_length(payload) > 7900 THEN
+        payload := json_build_object('op', 'resync')::text;
+    END IF;
+
+    PERFORM pg_notify('key_value_changes', payload);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
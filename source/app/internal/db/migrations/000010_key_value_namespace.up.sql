@@ -0,0 +1,36 @@
+set lock_timeout = '1s';
+set statement_timeout = '5s';
+
+-- Keys are isolated per namespace. Existing keys move to the default namespace.
+ALTER TABLE key_value ADD COLUMN IF NOT EXISTS namespace text NOT NULL DEFAULT 'default';
+ALTER TABLE key_value DROP CONSTRAINT key_value_pkey;
+ALTER TABLE key_value ADD PRIMARY KEY (namespace, key);
+
+-- Watchers match changes on namespace and key
+CREATE OR REPLACE FUNCTION notify_key_value_change() RETURNS trigger AS $$
+DECLARE
+    changed key_value%ROWTYPE;
+    payload text;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed := OLD;
+    ELSE
+        changed := NEW;
+    END IF;
+
+    payload := json_build_object(
+        'namespace', changed.namespace,
+        'key', changed.key,
+        'version', changed.version,
+        'op', CASE WHEN TG_OP = 'DELETE' THEN 'delete' ELSE 'set' END
+    )::text;
+
+    -- NOTIFY payloads are limited to 8000 bytes: ask listeners to re-read instead
+    IF octet_length(payload) > 7900 THEN
+        payload := json_build_object('op', 'resync')::text;
+    END IF;
+
+    PERFORM pg_notify('key_value_changes', payload);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
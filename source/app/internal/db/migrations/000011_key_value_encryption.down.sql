@@ -0,0 +1,4 @@
+-- Encrypted values cannot be kept without their column
+DELETE FROM key_value WHERE encrypted_value IS NOT NULL;
+ALTER TABLE key_value DROP COLUMN IF EXISTS key_version;
+ALTER TABLE key_value DROP COLUMN IF EXISTS encrypted_value;
@@ -0,0 +1,7 @@
+set lock_timeout = '1s';
+set statement_timeout = '5s';
+
+-- Values can be stored encrypted with pgp_sym_encrypt, like person attributes.
+-- value is empty for encrypted rows.
+ALTER TABLE key_value ADD COLUMN IF NOT EXISTS encrypted_value bytea;
+ALTER TABLE key_value ADD COLUMN IF NOT EXISTS key_version bigint;
@@ -0,0 +1,5 @@
+-- Binary values cannot be kept without their columns
+DELETE FROM key_value WHERE content_type IS NOT NULL;
+ALTER TABLE key_value DROP COLUMN IF EXISTS size;
+ALTER TABLE key_value DROP COLUMN IF EXISTS binary_value;
+ALTER TABLE key_value DROP COLUMN IF EXISTS content_type;
@@ -0,0 +1,8 @@
+set lock_timeout = '1s';
+set statement_timeout = '5s';
+
+-- Binary values are stored as bytea with their content type.
+-- value is empty for binary rows; encrypted binary values use encrypted_value.
+ALTER TABLE key_value ADD COLUMN IF NOT EXISTS content_type text;
+ALTER TABLE key_value ADD COLUMN IF NOT EXISTS binary_value bytea;
+ALTER TABLE key_value ADD COLUMN IF NOT EXISTS size bigint;
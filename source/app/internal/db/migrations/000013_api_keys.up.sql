@@ -0,0 +1,18 @@
+set lock_timeout = '1s';
+set statement_timeout = '5s';
+
+-- API keys issued through the admin API. Only the SHA-256 hash of a key is stored;
+-- a name can be reused once the key holding it was revoked.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    name text NOT NULL,
+    owner text NOT NULL,
+    key_hash text NOT NULL UNIQUE,
+    scopes text[] NOT NULL,
+    expires_at timestamptz,
+    last_used_at timestamptz,
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP,
+    revoked_at timestamptz
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_active_name ON api_keys(name) WHERE revoked_at IS NULL;
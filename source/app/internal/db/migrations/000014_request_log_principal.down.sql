@@ -0,0 +1,2 @@
+ALTER TABLE request_log DROP COLUMN IF EXISTS principal_owner;
+ALTER TABLE request_log DROP COLUMN IF EXISTS principal_name;
@@ -0,0 +1,7 @@
+set lock_timeout = '1s';
+set statement_timeout = '5s';
+
+-- Authenticated principal (API key name and owner) of an audited request, next to
+-- the self-reported caller_info. NULL for entries written before it was recorded.
+ALTER TABLE request_log ADD COLUMN IF NOT EXISTS principal_name text;
+ALTER TABLE request_log ADD COLUMN IF NOT EXISTS principal_owner text;
@@ -0,0 +1,13 @@
+set lock_timeout = '1s';
+set statement_timeout = '5s';
+
+-- Token buckets of the Postgres-backed rate limiter, shared by every instance.
+-- allowed records whether the last request taken from the bucket got a token.
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    key text PRIMARY KEY,
+    tokens double precision NOT NULL,
+    allowed boolean NOT NULL,
+    updated_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_updated_at ON rate_limit_buckets(updated_at);
@@ -3,32 +3,244 @@
 SELECT 1;
 
 -- name: GetValue :one
--- Retrieve a value by key
-SELECT value FROM key_value WHERE key = sqlc.arg(key) LIMIT 1;
+-- Retrieve a text value by namespace and key, decrypted when stored encrypted, ignoring expired keys.
+-- Binary values read as empty.
+SELECT CASE WHEN content_type IS NULL
+    THEN COALESCE(pgp_sym_decrypt(encrypted_value, sqlc.arg(enc_key)), value)
+    ELSE '' END::text AS value
+FROM key_value
+WHERE namespace = sqlc.arg(namespace) AND key = sqlc.arg(key) AND (expires_at IS NULL OR expires_at > now())
+LIMIT 1;
 
 -- name: GetKeyValue :one
--- Retrieve the full key-value record by key
-SELECT key, value, created_at, updated_at FROM key_value WHERE key = sqlc.arg(key) LIMIT 1;
+-- Retrieve the full key-value record by namespace and key, ignoring expired keys.
+-- plain_value is a text value and plain_data a binary value, decrypted when stored encrypted.
+SELECT sqlc.embed(key_value),
+    CASE WHEN content_type IS NULL
+        THEN COALESCE(pgp_sym_decrypt(encrypted_value, sqlc.arg(enc_key)), value)
+        ELSE '' END::text AS plain_value,
+    CASE WHEN content_type IS NOT NULL
+        THEN COALESCE(pgp_sym_decrypt_bytea(encrypted_value, sqlc.arg(enc_key)), binary_value)
+        END::bytea AS plain_data
+FROM key_value
+WHERE namespace = sqlc.arg(namespace) AND key = sqlc.arg(key) AND (expires_at IS NULL OR expires_at > now())
+LIMIT 1;
 
--- name: SetValue :exec
--- Set a value by key
-INSERT INTO key_value (key, value) VALUES (sqlc.arg(key), sqlc.arg(value))
-ON CONFLICT (key) DO UPDATE SET value = sqlc.arg(value);
+-- name: SetValue :one
+-- Set a value by key and return the record. A NULL ttl_seconds removes any
+-- previous TTL. An expired key that has not been reaped yet is recreated, so
+-- a returned version of 1 means the key was created by this write.
+-- With an enc_key the value is stored encrypted and value is left empty.
+-- A live key stored encrypted stays encrypted, with keep_key, whatever the enc_key.
+-- With a content_type, data is stored as a binary value instead of value.
+INSERT INTO key_value (namespace, key, value, encrypted_value, key_version, content_type, binary_value, size, expires_at)
+VALUES (
+    sqlc.arg(namespace),
+    sqlc.arg(key),
+    CASE WHEN sqlc.narg(enc_key)::text IS NULL THEN sqlc.arg(value)::text ELSE '' END,
+    CASE WHEN sqlc.narg(content_type)::text IS NULL
+        THEN pgp_sym_encrypt(sqlc.arg(value)::text, sqlc.narg(enc_key)::text)
+        ELSE pgp_sym_encrypt_bytea(sqlc.narg(data)::bytea, sqlc.narg(enc_key)::text) END,
+    sqlc.narg(key_version),
+    sqlc.narg(content_type)::text,
+    CASE WHEN sqlc.narg(enc_key)::text IS NULL THEN sqlc.narg(data)::bytea END,
+    octet_length(sqlc.narg(data)::bytea),
+    now() + sqlc.narg(ttl_seconds)::bigint * interval '1 second'
+)
+ON CONFLICT (namespace, key) DO UPDATE SET
+    value = CASE WHEN EXCLUDED.encrypted_value IS NULL AND key_value.encrypted_value IS NOT NULL AND (key_value.expires_at IS NULL OR key_value.expires_at > now()) THEN '' ELSE EXCLUDED.value END,
+    encrypted_value = CASE WHEN EXCLUDED.encrypted_value IS NULL AND key_value.encrypted_value IS NOT NULL AND (key_value.expires_at IS NULL OR key_value.expires_at > now())
+        THEN CASE WHEN sqlc.narg(content_type)::text IS NULL
+            THEN pgp_sym_encrypt(sqlc.arg(value)::text, sqlc.arg(keep_key)::text)
+            ELSE pgp_sym_encrypt_bytea(sqlc.narg(data)::bytea, sqlc.arg(keep_key)::text) END
+        ELSE EXCLUDED.encrypted_value END,
+    key_version = CASE WHEN EXCLUDED.encrypted_value IS NULL AND key_value.encrypted_value IS NOT NULL AND (key_value.expires_at IS NULL OR key_value.expires_at > now()) THEN sqlc.arg(keep_key_version)::bigint ELSE EXCLUDED.key_version END,
+    content_type = EXCLUDED.content_type,
+    binary_value = CASE WHEN EXCLUDED.encrypted_value IS NULL AND key_value.encrypted_value IS NOT NULL AND (key_value.expires_at IS NULL OR key_value.expires_at > now()) THEN NULL ELSE EXCLUDED.binary_value END,
+    size = EXCLUDED.size,
+    expires_at = EXCLUDED.expires_at,
+    created_at = CASE WHEN key_value.expires_at <= now() THEN CURRENT_TIMESTAMP ELSE key_value.created_at END,
+    version = CASE WHEN key_value.expires_at <= now() THEN 1 ELSE key_value.version + 1 END,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING key, value, created_at, updated_at, expires_at, version, namespace, encrypted_value, key_version, content_type, binary_value, size;
+
+-- name: InsertValueIfAbsent :one
+-- Create a key only if it does not exist (expired keys count as missing).
+-- Returns no rows when the key already exists. With an enc_key the value is stored encrypted,
+-- with a content_type data is stored as a binary value.
+INSERT INTO key_value (namespace, key, value, encrypted_value, key_version, content_type, binary_value, size, expires_at)
+VALUES (
+    sqlc.arg(namespace),
+    sqlc.arg(key),
+    CASE WHEN sqlc.narg(enc_key)::text IS NULL THEN sqlc.arg(value)::text ELSE '' END,
+    CASE WHEN sqlc.narg(content_type)::text IS NULL
+        THEN pgp_sym_encrypt(sqlc.arg(value)::text, sqlc.narg(enc_key)::text)
+        ELSE pgp_sym_encrypt_bytea(sqlc.narg(data)::bytea, sqlc.narg(enc_key)::text) END,
+    sqlc.narg(key_version),
+    sqlc.narg(content_type)::text,
+    CASE WHEN sqlc.narg(enc_key)::text IS NULL THEN sqlc.narg(data)::bytea END,
+    octet_length(sqlc.narg(data)::bytea),
+    now() + sqlc.narg(ttl_seconds)::bigint * interval '1 second'
+)
+ON CONFLICT (namespace, key) DO UPDATE SET
+    value = EXCLUDED.value,
+    encrypted_value = EXCLUDED.encrypted_value,
+    key_version = EXCLUDED.key_version,
+    content_type = EXCLUDED.content_type,
+    binary_value = EXCLUDED.binary_value,
+    size = EXCLUDED.size,
+    expires_at = EXCLUDED.expires_at,
+    created_at = CURRENT_TIMESTAMP,
+    updated_at = CURRENT_TIMESTAMP,
+    version = 1
+WHERE key_value.expires_at <= now()
+RETURNING key, value, created_at, updated_at, expires_at, version, namespace, encrypted_value, key_version, content_type, binary_value, size;
+
+-- name: UpdateValueWithVersion :one
+-- Update a key with optimistic locking (version check).
+-- Returns no rows when the key is missing, expired or at another version.
+-- With an enc_key the value is stored encrypted, with a content_type data is stored as a binary value.
+-- A key stored encrypted stays encrypted, with keep_key, whatever the enc_key.
+UPDATE key_value
+SET
+    value = CASE WHEN sqlc.narg(enc_key)::text IS NULL AND encrypted_value IS NULL THEN sqlc.arg(value)::text ELSE '' END,
+    encrypted_value = CASE WHEN sqlc.narg(content_type)::text IS NULL
+        THEN pgp_sym_encrypt(sqlc.arg(value)::text, COALESCE(sqlc.narg(enc_key)::text, CASE WHEN encrypted_value IS NOT NULL THEN sqlc.arg(keep_key)::text END))
+        ELSE pgp_sym_encrypt_bytea(sqlc.narg(data)::bytea, COALESCE(sqlc.narg(enc_key)::text, CASE WHEN encrypted_value IS NOT NULL THEN sqlc.arg(keep_key)::text END)) END,
+    key_version = CASE WHEN sqlc.narg(enc_key)::text IS NULL AND encrypted_value IS NOT NULL THEN sqlc.arg(keep_key_version)::bigint ELSE sqlc.narg(key_version) END,
+    content_type = sqlc.narg(content_type)::text,
+    binary_value = CASE WHEN sqlc.narg(enc_key)::text IS NULL AND encrypted_value IS NULL THEN sqlc.narg(data)::bytea END,
+    size = octet_length(sqlc.narg(data)::bytea),
+    expires_at = now() + sqlc.narg(ttl_seconds)::bigint * interval '1 second',
+    version = version + 1,
+    updated_at = CURRENT_TIMESTAMP
+WHERE namespace = sqlc.arg(namespace)
+    AND key = sqlc.arg(key)
+    AND version = sqlc.arg(expected_version)
+    AND (expires_at IS NULL OR expires_at > now())
+RETURNING key, value, created_at, updated_at, expires_at, version, namespace, encrypted_value, key_version, content_type, binary_value, size;
+
+-- name: ListKeyValues :many
+-- List live keys of a namespace starting with prefix, in key order after the cursor key (keyset pagination).
+-- plain_value is a text value, decrypted when stored encrypted; binary values read as empty.
+SELECT sqlc.embed(key_value),
+    CASE WHEN content_type IS NULL
+        THEN COALESCE(pgp_sym_decrypt(encrypted_value, sqlc.arg(enc_key)), value)
+        ELSE '' END::text AS plain_value
+FROM key_value
+WHERE namespace = sqlc.arg(namespace)
+    AND starts_with(key, sqlc.arg(prefix))
+    AND key > sqlc.arg(after_key)
+    AND (expires_at IS NULL OR expires_at > now())
+ORDER BY key
+LIMIT sqlc.arg(row_limit);
+
+-- name: ExportKeyValues :many
+-- List live keys of a namespace starting with prefix after the cursor key, with their
+-- values decrypted, for snapshots. plain_value is a text value and plain_data a binary value.
+SELECT key,
+    CASE WHEN content_type IS NULL
+        THEN COALESCE(pgp_sym_decrypt(encrypted_value, sqlc.arg(enc_key)), value)
+        ELSE '' END::text AS plain_value,
+    CASE WHEN content_type IS NOT NULL
+        THEN COALESCE(pgp_sym_decrypt_bytea(encrypted_value, sqlc.arg(enc_key)), binary_value)
+        END::bytea AS plain_data,
+    content_type,
+    encrypted_value IS NOT NULL AS encrypted,
+    expires_at
+FROM key_value
+WHERE namespace = sqlc.arg(namespace)
+    AND starts_with(key, sqlc.arg(prefix))
+    AND key > sqlc.arg(after_key)
+    AND (expires_at IS NULL OR expires_at > now())
+ORDER BY key
+LIMIT sqlc.arg(row_limit);
+
+-- name: CountKeyValues :one
+-- Count live keys of a namespace starting with prefix
+SELECT COUNT(*) FROM key_value
+WHERE namespace = sqlc.arg(namespace)
+    AND starts_with(key, sqlc.arg(prefix))
+    AND (expires_at IS NULL OR expires_at > now());
 
 -- name: DeleteValue :exec
--- Delete a value by key
-DELETE FROM key_value WHERE key = sqlc.arg(key);
+-- Delete a value by namespace and key
+DELETE FROM key_value WHERE namespace = sqlc.arg(namespace) AND key = sqlc.arg(key);
+
+-- name: DeleteLiveValue :one
+-- Delete a key and return whether it was live; an expired key is deleted too.
+-- Returns no rows when the key does not exist.
+DELETE FROM key_value WHERE namespace = sqlc.arg(namespace) AND key = sqlc.arg(key)
+RETURNING (expires_at IS NULL OR expires_at > now())::boolean AS live;
+
+-- name: DeleteValueWithVersion :execrows
+-- Delete a key only if it is at the expected version
+DELETE FROM key_value
+WHERE namespace = sqlc.arg(namespace)
+    AND key = sqlc.arg(key)
+    AND version = sqlc.arg(expected_version)
+    AND (expires_at IS NULL OR expires_at > now());
+
+-- name: IncrementValue :one
+-- Add delta to an integer value. A missing or expired key is created with
+-- value delta and ttl_seconds; an existing key keeps its TTL.
+-- Returns no rows when the current value is not an integer, which includes encrypted and binary values.
+INSERT INTO key_value (namespace, key, value, expires_at)
+VALUES (sqlc.arg(namespace), sqlc.arg(key), sqlc.arg(delta)::bigint::text, now() + sqlc.narg(ttl_seconds)::bigint * interval '1 second')
+ON CONFLICT (namespace, key) DO UPDATE SET
+    value = CASE WHEN key_value.expires_at <= now() THEN EXCLUDED.value
+        ELSE (key_value.value::bigint + sqlc.arg(delta)::bigint)::text END,
+    encrypted_value = NULL,
+    key_version = NULL,
+    content_type = NULL,
+    binary_value = NULL,
+    size = NULL,
+    expires_at = CASE WHEN key_value.expires_at <= now() THEN EXCLUDED.expires_at ELSE key_value.expires_at END,
+    created_at = CASE WHEN key_value.expires_at <= now() THEN CURRENT_TIMESTAMP ELSE key_value.created_at END,
+    version = CASE WHEN key_value.expires_at <= now() THEN 1 ELSE key_value.version + 1 END,
+    updated_at = CURRENT_TIMESTAMP
+WHERE key_value.expires_at <= now() OR key_value.value ~ '^-?[0-9]+$'
+RETURNING key, value, created_at, updated_at, expires_at, version, namespace, encrypted_value, key_version, content_type, binary_value, size;
+
+-- name: LockKey :exec
+-- Take a transaction-scoped advisory lock on a key, whether or not it exists, so
+-- transactions touching the same keys run one after the other. Taken in key order.
+SELECT pg_advisory_xact_lock(hashtext(sqlc.arg(namespace)::text || '/' || sqlc.arg(key)::text));
+
+-- name: LockKeyValues :exec
+-- Lock the existing rows of keys in key order, so writes outside a transaction
+-- wait for it too. Keys without a row are only covered by LockKey.
+SELECT key FROM key_value
+WHERE namespace = sqlc.arg(namespace) AND key = ANY(sqlc.arg(keys)::text[])
+ORDER BY key
+FOR UPDATE;
+
+-- name: DeleteExpiredKeyValues :execrows
+-- Delete up to batch_size expired keys. Rows locked by a concurrent write are
+-- skipped, and expiry is checked again as such a write may have extended the TTL.
+DELETE FROM key_value
+WHERE (namespace, key) IN (
+    SELECT namespace, key FROM key_value
+    WHERE expires_at <= now()
+    ORDER BY expires_at
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE SKIP LOCKED
+)
+AND expires_at <= now();
 
 -- ============================================================================
 -- REQUEST LOG OPERATIONS
 -- ============================================================================
 
 -- name: InsertRequestLog :one
--- Insert a new request log entry with encrypted data
+-- Insert a new request log entry with encrypted data and the authenticated principal, if any
 INSERT INTO request_log (
     trace_id, 
     caller_info,
     reason, 
+    person_id,
+    principal_name,
+    principal_owner,
     encrypted_request_body, 
     encrypted_response_body, 
     key_version
@@ -36,6 +248,9 @@ INSERT INTO request_log (
     sqlc.arg(trace_id), 
     sqlc.arg(caller_info),
     sqlc.arg(reason), 
+    sqlc.arg(person_id),
+    sqlc.narg(principal_name),
+    sqlc.narg(principal_owner),
     pgp_sym_encrypt(sqlc.arg(encrypted_request_body), sqlc.arg(enc_key)), 
     pgp_sym_encrypt(sqlc.arg(encrypted_response_body), sqlc.arg(enc_key)), 
     sqlc.arg(key_version)
@@ -47,6 +262,8 @@ SELECT
     id,
     trace_id,
     caller_info,
+    principal_name,
+    principal_owner,
     reason,
     pgp_sym_decrypt(encrypted_request_body, sqlc.arg(enc_key)) AS request_body,
     pgp_sym_decrypt(encrypted_response_body, sqlc.arg(enc_key)) AS response_body,
@@ -56,6 +273,23 @@ FROM request_log
 WHERE trace_id = sqlc.arg(trace_id)
 LIMIT 1;
 
+-- name: ListRequestLogsByPersonId :many
+-- List decrypted request log entries that reference a person (oldest first)
+SELECT
+    id,
+    trace_id,
+    caller_info,
+    principal_name,
+    principal_owner,
+    reason,
+    COALESCE(pgp_sym_decrypt(encrypted_request_body, sqlc.arg(enc_key)), '') AS request_body,
+    COALESCE(pgp_sym_decrypt(encrypted_response_body, sqlc.arg(enc_key)), '') AS response_body,
+    key_version,
+    created_at
+FROM request_log
+WHERE person_id = sqlc.arg(person_id)
+ORDER BY created_at, id;
+
 -- name: CheckTraceIdExists :one
 -- Check if a trace_id already exists (for idempotency)
 SELECT EXISTS(SELECT 1 FROM request_log WHERE trace_id = sqlc.arg(trace_id));
@@ -345,6 +579,303 @@ WHERE person_id = sqlc.arg(person_id);
 -- Count images for a person
 SELECT COUNT(*) FROM person_images WHERE person_id = sqlc.arg(person_id);
 
+-- ============================================================================
+-- PERSON IDENTIFIER OPERATIONS
+-- ============================================================================
+
+-- name: AttachPersonIdentifier :one
+-- Attach an external identifier to a person (returns no row if the identifier is already taken)
+INSERT INTO person_identifiers (person_id, system, external_id)
+VALUES (sqlc.arg(person_id), sqlc.arg(system), sqlc.arg(external_id))
+ON CONFLICT (system, external_id) DO NOTHING
+RETURNING id, person_id, system, external_id, created_at;
+
+-- name: GetPersonIdentifier :one
+-- Get an identifier by system and external ID
+SELECT id, person_id, system, external_id, created_at
+FROM person_identifiers
+WHERE system = sqlc.arg(system) AND external_id = sqlc.arg(external_id)
+LIMIT 1;
+
+-- name: ListPersonIdentifiers :many
+-- List all identifiers of a person
+SELECT id, person_id, system, external_id, created_at
+FROM person_identifiers
+WHERE person_id = sqlc.arg(person_id)
+ORDER BY system, external_id;
+
+-- name: DeletePersonIdentifier :one
+-- Detach an identifier from a person and return it
+DELETE FROM person_identifiers
+WHERE id = sqlc.arg(id) AND person_id = sqlc.arg(person_id)
+RETURNING id, person_id, system, external_id, created_at;
+
+-- name: ResolvePersonIdentifier :one
+-- Resolve an active person by system and external ID
+SELECT
+    p.id,
+    p.client_id,
+    p.created_at,
+    p.updated_at,
+    pi.system,
+    pi.external_id
+FROM person_identifiers pi
+JOIN person p ON p.id = pi.person_id
+WHERE pi.system = sqlc.arg(system)
+    AND pi.external_id = sqlc.arg(external_id)
+    AND p.deleted_at IS NULL
+LIMIT 1;
+
+-- name: MovePersonIdentifiers :execrows
+-- Reassign all identifiers of the source person to the target person
+UPDATE person_identifiers
+SET person_id = sqlc.arg(target_person_id)
+WHERE person_id = sqlc.arg(source_person_id);
+
+-- name: MovePersonRequestLogs :execrows
+-- Reassign the audit entries of the source person to the target person, so exports
+-- and erasures of the target cover them
+UPDATE request_log
+SET person_id = sqlc.arg(target_person_id)
+WHERE person_id = sqlc.arg(source_person_id);
+
+-- ============================================================================
+-- API KEY OPERATIONS
+-- ============================================================================
+
+-- name: CreateAPIKey :one
+-- Issue an API key (returns no row if an active key already has the name)
+INSERT INTO api_keys (name, owner, key_hash, scopes, expires_at)
+VALUES (sqlc.arg(name), sqlc.arg(owner), sqlc.arg(key_hash), sqlc.arg(scopes), sqlc.narg(expires_at))
+ON CONFLICT (name) WHERE revoked_at IS NULL DO NOTHING
+RETURNING id, name, owner, key_hash, scopes, expires_at, last_used_at, created_at, revoked_at;
+
+-- name: GetAPIKeyByHash :one
+-- Get an active (not revoked) API key by the hash of the key
+SELECT id, name, owner, key_hash, scopes, expires_at, last_used_at, created_at, revoked_at
+FROM api_keys
+WHERE key_hash = sqlc.arg(key_hash) AND revoked_at IS NULL
+LIMIT 1;
+
+-- name: ListAPIKeys :many
+-- List API keys, revoked keys only when asked for
+SELECT id, name, owner, key_hash, scopes, expires_at, last_used_at, created_at, revoked_at
+FROM api_keys
+WHERE revoked_at IS NULL OR sqlc.arg(include_revoked)::boolean
+ORDER BY name, id;
+
+-- name: RevokeAPIKey :one
+-- Revoke an active API key (returns no row if it does not exist or is already revoked)
+UPDATE api_keys
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE id = sqlc.arg(id) AND revoked_at IS NULL
+RETURNING id, name, owner, key_hash, scopes, expires_at, last_used_at, created_at, revoked_at;
+
+-- name: TouchAPIKey :exec
+-- Record that an API key was used, at most once a minute to limit writes
+UPDATE api_keys
+SET last_used_at = CURRENT_TIMESTAMP
+WHERE id = sqlc.arg(id)
+    AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - interval '1 minute');
+
+-- ============================================================================
+-- RATE LIMIT OPERATIONS
+-- ============================================================================
+
+-- name: TakeRateLimitToken :one
+-- Refill a token bucket for the time since its last update and take a token if a whole one is left
+INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+VALUES (sqlc.arg(key), sqlc.arg(capacity)::float8 - 1, true, CURRENT_TIMESTAMP)
+ON CONFLICT (key) DO UPDATE SET
+    tokens = LEAST(sqlc.arg(capacity)::float8, b.tokens + GREATEST(EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - b.updated_at)::float8, 0) * sqlc.arg(refill_rate)::float8)
+        - CASE WHEN LEAST(sqlc.arg(capacity)::float8, b.tokens + GREATEST(EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - b.updated_at)::float8, 0) * sqlc.arg(refill_rate)::float8) >= 1 THEN 1 ELSE 0 END,
+    allowed = LEAST(sqlc.arg(capacity)::float8, b.tokens + GREATEST(EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - b.updated_at)::float8, 0) * sqlc.arg(refill_rate)::float8) >= 1,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING tokens, allowed;
+
+-- name: RefundRateLimitToken :exec
+-- Give back a token taken from a bucket, without going over its capacity
+UPDATE rate_limit_buckets
+SET tokens = LEAST(sqlc.arg(capacity)::float8, tokens + 1)
+WHERE key = sqlc.arg(key);
+
+-- name: DeleteIdleRateLimitBuckets :execrows
+-- Delete buckets not used since the cutoff, which have refilled completely
+DELETE FROM rate_limit_buckets WHERE updated_at < sqlc.arg(cutoff);
+
+-- ============================================================================
+-- PERSON ERASURE OPERATIONS
+-- ============================================================================
+
+-- name: GetPersonByIdForUpdate :one
+-- Get and lock a person by internal UUID, including soft-deleted persons
+SELECT id, client_id, created_at, updated_at, deleted_at
+FROM person
+WHERE id = sqlc.arg(id)
+LIMIT 1
+FOR UPDATE;
+
+-- name: RedactRequestLogsByPersonId :execrows
+-- Remove the encrypted payloads of all audit entries that reference a person.
+-- Entries written before person_id was recorded (migration 000002) cannot be
+-- matched: their bodies are encrypted with the application key and do not name
+-- the person, so they are left for audit log retention to delete.
+UPDATE request_log
+SET encrypted_request_body = NULL,
+    encrypted_response_body = NULL,
+    redacted_at = CURRENT_TIMESTAMP
+WHERE person_id = sqlc.arg(person_id) AND redacted_at IS NULL;
+
+-- name: InsertPersonErasure :one
+-- Record a tombstone proving a person's data was erased
+INSERT INTO person_erasure (
+    person_id,
+    requested_by,
+    reason,
+    trace_id,
+    attributes_removed,
+    images_removed,
+    audit_entries_redacted
+) VALUES (
+    sqlc.arg(person_id),
+    sqlc.arg(requested_by),
+    sqlc.arg(reason),
+    sqlc.narg(trace_id),
+    sqlc.arg(attributes_removed),
+    sqlc.arg(images_removed),
+    sqlc.arg(audit_entries_redacted)
+)
+RETURNING id, person_id, requested_by, reason, trace_id, attributes_removed, images_removed, audit_entries_redacted, erased_at;
+
+-- name: GetPersonErasure :one
+-- Get the erasure tombstone for a person
+SELECT id, person_id, requested_by, reason, trace_id, attributes_removed, images_removed, audit_entries_redacted, erased_at
+FROM person_erasure
+WHERE person_id = sqlc.arg(person_id)
+LIMIT 1;
+
+-- ============================================================================
+-- PERSON MERGE OPERATIONS
+-- ============================================================================
+
+-- name: ListPersonAttributeKeys :many
+-- List attribute keys and timestamps for a person (without decrypting)
+SELECT id, attribute_key, updated_at
+FROM person_attributes
+WHERE person_id = sqlc.arg(person_id)
+ORDER BY attribute_key;
+
+-- name: DeletePersonAttributesByIds :execrows
+-- Delete person attributes by ID
+DELETE FROM person_attributes
+WHERE id = ANY(sqlc.arg(ids)::bigint[]);
+
+-- name: DeletePersonImagesByIds :execrows
+-- Delete person images by ID
+DELETE FROM person_images
+WHERE id = ANY(sqlc.arg(ids)::bigint[]);
+
+-- name: MovePersonAttributes :execrows
+-- Reassign all attributes of the source person to the target person
+UPDATE person_attributes
+SET person_id = sqlc.arg(target_person_id)
+WHERE person_id = sqlc.arg(source_person_id);
+
+-- name: MovePersonImages :execrows
+-- Reassign all images of the source person to the target person
+UPDATE person_images
+SET person_id = sqlc.arg(target_person_id)
+WHERE person_id = sqlc.arg(source_person_id);
+
+-- name: InsertPersonMerge :one
+-- Record that a source person was merged into a target person
+INSERT INTO person_merge (
+    source_person_id,
+    target_person_id,
+    strategy,
+    merged_by,
+    reason,
+    trace_id,
+    attributes_moved,
+    attributes_dropped,
+    images_moved,
+    images_dropped
+) VALUES (
+    sqlc.arg(source_person_id),
+    sqlc.arg(target_person_id),
+    sqlc.arg(strategy),
+    sqlc.arg(merged_by),
+    sqlc.arg(reason),
+    sqlc.narg(trace_id),
+    sqlc.arg(attributes_moved),
+    sqlc.arg(attributes_dropped),
+    sqlc.arg(images_moved),
+    sqlc.arg(images_dropped)
+)
+RETURNING id, source_person_id, target_person_id, strategy, merged_by, reason, trace_id, attributes_moved, attributes_dropped, images_moved, images_dropped, merged_at;
+
+-- name: GetPersonMergeBySourceId :one
+-- Get the merge record of a merged (source) person
+SELECT id, source_person_id, target_person_id, strategy, merged_by, reason, trace_id, attributes_moved, attributes_dropped, images_moved, images_dropped, merged_at
+FROM person_merge
+WHERE source_person_id = sqlc.arg(source_person_id)
+LIMIT 1;
+
+-- name: RepointPersonMerges :exec
+-- Point earlier merges into the source person at the new target so redirects take a single hop
+UPDATE person_merge
+SET target_person_id = sqlc.arg(new_target_person_id)
+WHERE target_person_id = sqlc.arg(old_target_person_id);
+
+-- ============================================================================
+-- RETENTION OPERATIONS
+-- ============================================================================
+
+-- name: CountPurgeablePersons :one
+-- Count soft-deleted persons whose deleted_at is older than the cutoff
+SELECT COUNT(*) FROM person
+WHERE deleted_at IS NOT NULL AND deleted_at < sqlc.arg(cutoff);
+
+-- name: PurgeSoftDeletedPersons :one
+-- Hard delete a batch of soft-deleted persons older than the cutoff and redact their audit payloads
+WITH purged AS (
+    DELETE FROM person
+    WHERE id IN (
+        SELECT id FROM person
+        WHERE deleted_at IS NOT NULL AND deleted_at < sqlc.arg(cutoff)
+        ORDER BY deleted_at
+        LIMIT sqlc.arg(batch_size)
+        FOR UPDATE SKIP LOCKED
+    )
+    -- A person restored since the batch was selected is kept
+    AND deleted_at IS NOT NULL AND deleted_at < sqlc.arg(cutoff)
+    RETURNING id
+), redacted AS (
+    UPDATE request_log
+    SET encrypted_request_body = NULL,
+        encrypted_response_body = NULL,
+        redacted_at = CURRENT_TIMESTAMP
+    WHERE person_id IN (SELECT id FROM purged) AND redacted_at IS NULL
+    RETURNING id
+)
+SELECT
+    (SELECT COUNT(*) FROM purged) AS persons_purged,
+    (SELECT COUNT(*) FROM redacted) AS audit_entries_redacted;
+
+-- name: CountPurgeableRequestLogs :one
+-- Count audit entries created before the cutoff
+SELECT COUNT(*) FROM request_log WHERE created_at < sqlc.arg(cutoff);
+
+-- name: PurgeRequestLogs :execrows
+-- Delete a batch of audit entries created before the cutoff
+DELETE FROM request_log
+WHERE id IN (
+    SELECT id FROM request_log
+    WHERE created_at < sqlc.arg(cutoff)
+    ORDER BY id
+    LIMIT sqlc.arg(batch_size)
+);
+
 -- ============================================================================
 -- COMBINED OPERATIONS
 -- ============================================================================
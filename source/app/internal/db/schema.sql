@@ -4,12 +4,56 @@ CREATE EXTENSION IF NOT EXISTS citext;
 
 -- create Key Value table
 CREATE TABLE IF NOT EXISTS key_value (
-    key text PRIMARY KEY,
+    key text NOT NULL,
     value text NOT NULL,
     created_at timestamptz DEFAULT CURRENT_TIMESTAMP,
-    updated_at timestamptz DEFAULT CURRENT_TIMESTAMP
+    updated_at timestamptz DEFAULT CURRENT_TIMESTAMP,
+    expires_at timestamptz,
+    version bigint NOT NULL DEFAULT 1,
+    namespace text NOT NULL DEFAULT 'default',
+    encrypted_value bytea, -- pgp_sym_encrypt of the value when stored encrypted, value is then empty
+    key_version bigint, -- encryption key version of encrypted_value
+    content_type text, -- content type of a binary value, NULL for text values
+    binary_value bytea, -- binary value when not encrypted, value is then empty
+    size bigint, -- size in bytes of a binary value
+    PRIMARY KEY (namespace, key)
 );
 
+CREATE INDEX idx_key_value_expires_at ON key_value(expires_at) WHERE expires_at IS NOT NULL;
+
+-- Publish every write to key_value on the key_value_changes channel
+CREATE OR REPLACE FUNCTION notify_key_value_change() RETURNS trigger AS $$
+DECLARE
+    changed key_value%ROWTYPE;
+    payload text;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed := OLD;
+    ELSE
+        changed := NEW;
+    END IF;
+
+    payload := json_build_object(
+        'namespace', changed.namespace,
+        'key', changed.key,
+        'version', changed.version,
+        'op', CASE WHEN TG_OP = 'DELETE' THEN 'delete' ELSE 'set' END
+    )::text;
+
+    -- NOTIFY payloads are limited to 8000 bytes: ask listeners to re-read instead
+    IF octet_length(payload) > 7900 THEN
+        payload := json_build_object('op', 'resync')::text;
+    END IF;
+
+    PERFORM pg_notify('key_value_changes', payload);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER key_value_notify
+AFTER INSERT OR UPDATE OR DELETE ON key_value
+FOR EACH ROW EXECUTE FUNCTION notify_key_value_change();
+
 -- Request log table for idempotency with encryption
 CREATE TABLE IF NOT EXISTS request_log (
     id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
@@ -19,10 +63,16 @@ CREATE TABLE IF NOT EXISTS request_log (
     encrypted_request_body BYTEA, -- encrypted using pgp_sym_encrypt
     encrypted_response_body BYTEA, -- encrypted using pgp_sym_encrypt
     key_version bigint NOT NULL,
-    created_at timestamptz DEFAULT CURRENT_TIMESTAMP
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP,
+    person_id UUID, -- person the entry refers to, if any; NULL for entries written before migration 000002
+    redacted_at timestamptz, -- set when payloads were redacted by an erasure
+    principal_name text, -- name of the API key that authenticated the request
+    principal_owner text -- owner of that API key (NULL for the environment keys)
 );
 
 CREATE INDEX idx_request_log_trace_id ON request_log(trace_id);
+CREATE INDEX idx_request_log_person_id ON request_log(person_id);
+CREATE INDEX idx_request_log_created_at ON request_log(created_at);
 
 -- Person table - stores person data
 CREATE TABLE IF NOT EXISTS person (
@@ -34,6 +84,7 @@ CREATE TABLE IF NOT EXISTS person (
 );
 
 CREATE INDEX idx_person_client_id ON person(client_id);
+CREATE INDEX idx_person_deleted_at ON person(deleted_at) WHERE deleted_at IS NOT NULL;
 
 -- Person attributes table - one-to-many with person
 CREATE TABLE IF NOT EXISTS person_attributes (
@@ -70,3 +121,71 @@ CREATE TABLE IF NOT EXISTS person_images (
 
 CREATE INDEX idx_person_images_person_id ON person_images(person_id);
 CREATE INDEX idx_person_images_type ON person_images(image_type);
+
+-- Person erasure tombstones - proof that a person's data was erased
+CREATE TABLE IF NOT EXISTS person_erasure (
+    id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    person_id UUID UNIQUE NOT NULL, -- no foreign key, the person row is deleted
+    requested_by text NOT NULL,
+    reason text NOT NULL,
+    trace_id text,
+    attributes_removed bigint NOT NULL,
+    images_removed bigint NOT NULL,
+    audit_entries_redacted bigint NOT NULL,
+    erased_at timestamptz DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Person merge records - source persons merged into a surviving target
+CREATE TABLE IF NOT EXISTS person_merge (
+    id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    source_person_id UUID UNIQUE NOT NULL, -- soft-deleted duplicate, no foreign key
+    target_person_id UUID NOT NULL, -- surviving person, no foreign key
+    strategy text NOT NULL, -- default conflict strategy
+    merged_by text NOT NULL,
+    reason text NOT NULL,
+    trace_id text,
+    attributes_moved bigint NOT NULL,
+    attributes_dropped bigint NOT NULL,
+    images_moved bigint NOT NULL,
+    images_dropped bigint NOT NULL,
+    merged_at timestamptz DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_person_merge_target_person_id ON person_merge(target_person_id);
+
+-- Person identifiers table - identifiers of a person in other client systems
+CREATE TABLE IF NOT EXISTS person_identifiers (
+    id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    person_id UUID NOT NULL REFERENCES person(id) ON DELETE CASCADE,
+    system citext NOT NULL, -- 'crm', 'billing', 'identity', etc.
+    external_id text NOT NULL, -- id of the person in that system
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(system, external_id) -- an external id belongs to one person per system
+);
+
+CREATE INDEX idx_person_identifiers_person_id ON person_identifiers(person_id);
+
+-- API keys table - keys issued through the admin API, stored as SHA-256 hashes
+CREATE TABLE IF NOT EXISTS api_keys (
+    id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    name text NOT NULL, -- identity of the key, e.g. in KV_NAMESPACE_GRANTS
+    owner text NOT NULL, -- team or person responsible for the key
+    key_hash text NOT NULL UNIQUE, -- hex encoded SHA-256 of the key
+    scopes text[] NOT NULL, -- 'attributes:read', 'attributes:write', 'persons:erase', 'images', 'kv', 'admin'
+    expires_at timestamptz,
+    last_used_at timestamptz,
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP,
+    revoked_at timestamptz
+);
+
+CREATE UNIQUE INDEX idx_api_keys_active_name ON api_keys(name) WHERE revoked_at IS NULL;
+
+-- Rate limit buckets table - token buckets shared by all instances when RATE_LIMIT_STORE=postgres
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    key text PRIMARY KEY, -- caller identity, optionally with the limited route
+    tokens double precision NOT NULL, -- tokens left after the last request
+    allowed boolean NOT NULL, -- whether the last request got a token
+    updated_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_rate_limit_buckets_updated_at ON rate_limit_buckets(updated_at);
@@ -0,0 +1,28 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// QueryTracers runs several pgx query tracers on a connection, which only takes
+// one. Each tracer sees the context returned by the tracers before it, and
+// TraceQueryEnd runs them in reverse so a tracer that wraps the statement (a
+// span) ends after the tracers it wrapped.
+type QueryTracers []pgx.QueryTracer
+
+// TraceQueryStart calls TraceQueryStart of every tracer in order
+func (t QueryTracers) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	for _, tracer := range t {
+		ctx = tracer.TraceQueryStart(ctx, conn, data)
+	}
+	return ctx
+}
+
+// TraceQueryEnd calls TraceQueryEnd of every tracer in reverse order
+func (t QueryTracers) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	for i := len(t) - 1; i >= 0; i-- {
+		t[i].TraceQueryEnd(ctx, conn, data)
+	}
+}
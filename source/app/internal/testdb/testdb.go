@@ -112,7 +112,7 @@ func RunMigrations(ctx context.Context, pool *pgxpool.Pool) error {
 // Uses TRUNCATE with CASCADE to handle foreign key constraints.
 func TruncateTables(ctx context.Context, pool *pgxpool.Pool) error {
 	_, err := pool.Exec(ctx, `
-		TRUNCATE TABLE person_attributes, person_images, request_log, person, key_value RESTART IDENTITY CASCADE
+		TRUNCATE TABLE person_attributes, person_images, request_log, person, key_value, person_erasure, person_merge, person_identifiers, api_keys, rate_limit_buckets RESTART IDENTITY CASCADE
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to truncate tables: %w", err)
@@ -0,0 +1,195 @@
+package key_value
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	errs "person-service/errors"
+	db "person-service/internal/db/generated"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// defaultMaxValueBytes bounds values to 1 MiB unless configured otherwise
+	defaultMaxValueBytes = 1 << 20
+
+	// defaultMaxSnapshotBytes bounds imported snapshots to 64 MiB unless configured otherwise
+	defaultMaxSnapshotBytes = 64 << 20
+
+	// defaultContentType is stored for binary values sent without a Content-Type
+	defaultContentType = "application/octet-stream"
+)
+
+// ValueLimits bounds the size of stored values
+type ValueLimits struct {
+	// MaxBytes is the largest text or binary value accepted, in bytes
+	MaxBytes int64
+	// MaxSnapshotBytes is the largest snapshot body imported, in bytes
+	MaxSnapshotBytes int64
+}
+
+// LoadValueLimits reads the value limits from environment variables:
+//   - KV_MAX_VALUE_BYTES: largest value accepted in bytes (default 1048576)
+//   - KV_MAX_SNAPSHOT_BYTES: largest snapshot imported in bytes (default 67108864)
+func LoadValueLimits() (ValueLimits, error) {
+	limits := ValueLimits{MaxBytes: defaultMaxValueBytes, MaxSnapshotBytes: defaultMaxSnapshotBytes}
+
+	if raw := os.Getenv("KV_MAX_VALUE_BYTES"); raw != "" {
+		maxBytes, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || maxBytes <= 0 {
+			return ValueLimits{}, fmt.Errorf("invalid KV_MAX_VALUE_BYTES %q", raw)
+		}
+		limits.MaxBytes = maxBytes
+	}
+
+	if raw := os.Getenv("KV_MAX_SNAPSHOT_BYTES"); raw != "" {
+		maxBytes, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || maxBytes <= 0 {
+			return ValueLimits{}, fmt.Errorf("invalid KV_MAX_SNAPSHOT_BYTES %q", raw)
+		}
+		limits.MaxSnapshotBytes = maxBytes
+	}
+
+	return limits, nil
+}
+
+// PutValue handles PUT /api/key-value/:key - stores the raw request body as a binary
+// value along with its Content-Type. ttl_seconds, encrypted and if_version are query
+// parameters; If-Match and If-None-Match make the write conditional like SetValue.
+func (h *KeyValueHandler) PutValue(c echo.Context) error {
+	key := c.Param("key")
+	if key == "" {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Key parameter is required",
+			ErrorCode: errs.ErrKVMissingKeyParam,
+		})
+	}
+
+	var ttlSeconds *int64
+	if raw := c.QueryParam("ttl_seconds"); raw != "" {
+		seconds, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+				Message:   "Query parameter \"ttl_seconds\" must be a number",
+				ErrorCode: errs.ErrKVInvalidTTL,
+			})
+		}
+		ttlSeconds = &seconds
+	}
+	ttl, err := parseTTL(ttlSeconds)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   err.Error(),
+			ErrorCode: errs.ErrKVInvalidTTL,
+		})
+	}
+
+	encrypted := false
+	if raw := c.QueryParam("encrypted"); raw != "" {
+		encrypted, err = strconv.ParseBool(raw)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+				Message:   "Query parameter \"encrypted\" must be true or false",
+				ErrorCode: errs.ErrKVInvalidRequestBody,
+			})
+		}
+	}
+
+	var ifVersion *int64
+	if raw := c.QueryParam("if_version"); raw != "" {
+		version, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+				Message:   "Query parameter \"if_version\" must be a number",
+				ErrorCode: errs.ErrKVInvalidCondition,
+			})
+		}
+		ifVersion = &version
+	}
+	cond, err := parseCondition(ifVersion, false,
+		c.Request().Header.Get("If-Match"), c.Request().Header.Get("If-None-Match"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   err.Error(),
+			ErrorCode: errs.ErrKVInvalidCondition,
+		})
+	}
+
+	// Read at most one byte past the limit to detect larger bodies without buffering them
+	if c.Request().ContentLength > h.limits.MaxBytes {
+		return h.valueTooLarge(c)
+	}
+	data, err := io.ReadAll(io.LimitReader(c.Request().Body, h.limits.MaxBytes+1))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Invalid request body",
+			ErrorCode: errs.ErrKVInvalidRequestBody,
+		})
+	}
+	if int64(len(data)) > h.limits.MaxBytes {
+		return h.valueTooLarge(c)
+	}
+	if len(data) == 0 {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Value is required",
+			ErrorCode: errs.ErrKVMissingKeyOrValue,
+		})
+	}
+
+	contentType := c.Request().Header.Get(echo.HeaderContentType)
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+
+	// Use request context for trace propagation
+	ctx := c.Request().Context()
+
+	record, err := h.write(ctx, writeRequest{
+		namespace:   namespaceOf(c),
+		key:         key,
+		contentType: pgtype.Text{String: contentType, Valid: true},
+		data:        data,
+		encrypted:   encrypted,
+		ttl:         ttl,
+		cond:        cond,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return conditionFailed(c, cond)
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to set value",
+			ErrorCode: errs.ErrKVFailedSetValue,
+		})
+	}
+
+	c.Response().Header().Set("ETag", etag(record.Version))
+
+	// Return 201 Created for new keys (version 1), 200 OK for updates
+	if record.Version == 1 {
+		return c.JSON(http.StatusCreated, keyValueResponse(record, time.Now()))
+	}
+	return c.JSON(http.StatusOK, keyValueResponse(record, time.Now()))
+}
+
+// valueTooLarge responds to a value above the configured limit
+func (h *KeyValueHandler) valueTooLarge(c echo.Context) error {
+	return c.JSON(http.StatusRequestEntityTooLarge, errs.ErrorResponse{
+		Message:   fmt.Sprintf("Value must be at most %d bytes", h.limits.MaxBytes),
+		ErrorCode: errs.ErrKVValueTooLarge,
+	})
+}
+
+// respondBinary writes a binary value with its original content type
+func respondBinary(c echo.Context, record db.KeyValue) error {
+	c.Response().Header().Set("ETag", etag(record.Version))
+	return c.Blob(http.StatusOK, record.ContentType.String, record.BinaryValue)
+}
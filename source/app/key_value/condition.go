@@ -0,0 +1,74 @@
+package key_value
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// writeCondition is the precondition of a conditional write
+type writeCondition struct {
+	// version is the version the key must be at, nil when not checked
+	version *int64
+	// absent requires the key not to exist
+	absent bool
+	// fromHeader is set for If-Match / If-None-Match, which fail with 412 instead of 409
+	fromHeader bool
+}
+
+// parseCondition combines the body fields and HTTP headers of a write into a single condition.
+// At most one of them may be set.
+func parseCondition(ifVersion *int64, ifAbsent bool, ifMatch, ifNoneMatch string) (writeCondition, error) {
+	ifMatch = strings.TrimSpace(ifMatch)
+	ifNoneMatch = strings.TrimSpace(ifNoneMatch)
+
+	set := 0
+	for _, present := range []bool{ifVersion != nil, ifAbsent, ifMatch != "", ifNoneMatch != ""} {
+		if present {
+			set++
+		}
+	}
+	if set > 1 {
+		return writeCondition{}, errors.New("Only one of \"if_version\", \"if_absent\", If-Match and If-None-Match may be set")
+	}
+
+	switch {
+	case ifVersion != nil:
+		if *ifVersion < 1 {
+			return writeCondition{}, errors.New("Field \"if_version\" must be a positive version")
+		}
+		return writeCondition{version: ifVersion}, nil
+	case ifAbsent:
+		return writeCondition{absent: true}, nil
+	case ifMatch != "":
+		version, err := parseETag(ifMatch)
+		if err != nil {
+			return writeCondition{}, errors.New("If-Match must be the ETag of a key version")
+		}
+		return writeCondition{version: &version, fromHeader: true}, nil
+	case ifNoneMatch != "":
+		if ifNoneMatch != "*" {
+			return writeCondition{}, errors.New("If-None-Match only supports \"*\"")
+		}
+		return writeCondition{absent: true, fromHeader: true}, nil
+	}
+	return writeCondition{}, nil
+}
+
+// etag formats a key version as a strong ETag
+func etag(version int64) string {
+	return fmt.Sprintf("%q", strconv.FormatInt(version, 10))
+}
+
+// parseETag reads a version from a quoted ETag; a bare number is accepted as well
+func parseETag(value string) (int64, error) {
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+	version, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid ETag %q", value)
+	}
+	return version, nil
+}
@@ -0,0 +1,69 @@
+package key_value
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCondition(t *testing.T) {
+	three := int64(3)
+
+	cond, err := parseCondition(nil, false, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, writeCondition{}, cond)
+
+	cond, err = parseCondition(&three, false, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), *cond.version)
+	assert.False(t, cond.fromHeader)
+
+	cond, err = parseCondition(nil, true, "", "")
+	assert.NoError(t, err)
+	assert.True(t, cond.absent)
+	assert.False(t, cond.fromHeader)
+
+	cond, err = parseCondition(nil, false, `"7"`, "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), *cond.version)
+	assert.True(t, cond.fromHeader)
+
+	cond, err = parseCondition(nil, false, "", "*")
+	assert.NoError(t, err)
+	assert.True(t, cond.absent)
+	assert.True(t, cond.fromHeader)
+}
+
+func TestParseCondition_Invalid(t *testing.T) {
+	zero := int64(0)
+	one := int64(1)
+
+	tests := map[string]func() (writeCondition, error){
+		"zero version":       func() (writeCondition, error) { return parseCondition(&zero, false, "", "") },
+		"version and absent": func() (writeCondition, error) { return parseCondition(&one, true, "", "") },
+		"body and header":    func() (writeCondition, error) { return parseCondition(&one, false, `"1"`, "") },
+		"bad etag":           func() (writeCondition, error) { return parseCondition(nil, false, `"abc"`, "") },
+		"if-none-match tag":  func() (writeCondition, error) { return parseCondition(nil, false, "", `"1"`) },
+	}
+	for name, parse := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parse()
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestETag(t *testing.T) {
+	assert.Equal(t, `"42"`, etag(42))
+
+	version, err := parseETag(etag(42))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), version)
+
+	version, err = parseETag("5")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), version)
+
+	_, err = parseETag(`W/"5"`)
+	assert.Error(t, err)
+}
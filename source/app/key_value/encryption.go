@@ -0,0 +1,85 @@
+package key_value
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	db "person-service/internal/db/generated"
+	"person-service/metrics"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// encryption holds the keyring used for values stored encrypted at rest,
+// shared with person attributes: ENCRYPTION_KEY_1 at key version 1
+type encryption struct {
+	key        string
+	keyVersion int64
+	// namespaces store every value encrypted, whatever the request asks for
+	namespaces map[string]bool
+}
+
+func newEncryption() encryption {
+	key := os.Getenv("ENCRYPTION_KEY_1")
+	if key == "" {
+		key = "default-key-for-dev"
+	}
+
+	return encryption{
+		key:        key,
+		keyVersion: 1,
+	}
+}
+
+// required reports whether every value of namespace is stored encrypted
+func (e encryption) required(namespace string) bool {
+	return e.namespaces[namespace]
+}
+
+// writeParams returns the enc_key and key_version of a write: both are NULL
+// (plaintext) unless the request or the namespace asks for encryption
+func (e encryption) writeParams(namespace string, requested bool) (pgtype.Text, pgtype.Int8) {
+	if !requested && !e.required(namespace) {
+		return pgtype.Text{}, pgtype.Int8{}
+	}
+	return pgtype.Text{String: e.key, Valid: true}, pgtype.Int8{Int64: e.keyVersion, Valid: true}
+}
+
+// LoadEncryptedNamespaces reads KV_ENCRYPTED_NAMESPACES, a comma separated list
+// of namespaces whose values are always stored encrypted
+func LoadEncryptedNamespaces() (map[string]bool, error) {
+	namespaces := map[string]bool{}
+	for _, namespace := range strings.Split(os.Getenv("KV_ENCRYPTED_NAMESPACES"), ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace == "" {
+			continue
+		}
+		if !namespacePattern.MatchString(namespace) {
+			return nil, fmt.Errorf("invalid KV_ENCRYPTED_NAMESPACES: invalid namespace %q", namespace)
+		}
+		namespaces[namespace] = true
+	}
+	return namespaces, nil
+}
+
+// countCrypto counts the value of record for crypto_operations_total when it is
+// stored encrypted, as the statement that wrote or read it encrypted or decrypted it
+func countCrypto(operation string, record db.KeyValue) {
+	if record.EncryptedValue != nil {
+		metrics.CountCryptoOperations(operation, 1)
+	}
+}
+
+// decrypted returns record with the plaintext value read alongside it
+func decrypted(record db.KeyValue, plainValue string) db.KeyValue {
+	record.Value = plainValue
+	return record
+}
+
+// decryptedRow returns the record of a read key with its plaintext text or binary value
+func decryptedRow(row db.GetKeyValueRow) db.KeyValue {
+	record := decrypted(row.KeyValue, row.PlainValue)
+	record.BinaryValue = row.PlainData
+	return record
+}
@@ -0,0 +1,150 @@
+package key_value
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	db "person-service/internal/db/generated"
+	"person-service/internal/testdb"
+)
+
+func TestLoadEncryptedNamespaces(t *testing.T) {
+	os.Setenv("KV_ENCRYPTED_NAMESPACES", "secrets, billing,")
+	defer os.Unsetenv("KV_ENCRYPTED_NAMESPACES")
+
+	namespaces, err := LoadEncryptedNamespaces()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"secrets": true, "billing": true}, namespaces)
+}
+
+func TestLoadEncryptedNamespaces_Invalid(t *testing.T) {
+	os.Setenv("KV_ENCRYPTED_NAMESPACES", "secrets,Billing")
+	defer os.Unsetenv("KV_ENCRYPTED_NAMESPACES")
+
+	_, err := LoadEncryptedNamespaces()
+	assert.Error(t, err)
+}
+
+func TestEncryption_WriteParams(t *testing.T) {
+	enc := encryption{key: "k", keyVersion: 1, namespaces: map[string]bool{"secrets": true}}
+
+	encKey, keyVersion := enc.writeParams("default", false)
+	assert.False(t, encKey.Valid)
+	assert.False(t, keyVersion.Valid)
+
+	encKey, keyVersion = enc.writeParams("default", true)
+	assert.Equal(t, "k", encKey.String)
+	assert.Equal(t, int64(1), keyVersion.Int64)
+
+	encKey, _ = enc.writeParams("secrets", false)
+	assert.True(t, encKey.Valid)
+}
+
+// TestSetValue_Encrypted tests that an encrypted value is not stored in plaintext
+// and is decrypted transparently on reads
+func TestSetValue_Encrypted(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	handler := NewKeyValueHandler(db.New(pool))
+
+	c, rec := newSetValueContext(`{"key":"api-token","value":"s3cret","encrypted":true}`)
+	assert.NoError(t, handler.SetValue(c))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"value":"s3cret"`)
+	assert.Contains(t, rec.Body.String(), `"encrypted":true`)
+
+	var value string
+	var keyVersion int64
+	err := pool.QueryRow(ctx, `
+		SELECT value, key_version FROM key_value WHERE key = 'api-token' AND encrypted_value IS NOT NULL
+	`).Scan(&value, &keyVersion)
+	assert.NoError(t, err)
+	assert.Empty(t, value)
+	assert.Equal(t, int64(1), keyVersion)
+
+	c, rec = newGetValueContext("api-token")
+	assert.NoError(t, handler.GetValue(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"value":"s3cret"`)
+	assert.Contains(t, rec.Body.String(), `"encrypted":true`)
+
+	c, rec = newListContext("/api/key-value?include_values=true")
+	assert.NoError(t, handler.ListValues(c))
+	assert.Contains(t, rec.Body.String(), `"value":"s3cret"`)
+
+	// An overwrite without encrypted:true keeps the value encrypted
+	c, rec = newSetValueContext(`{"key":"api-token","value":"rotated"}`)
+	assert.NoError(t, handler.SetValue(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"value":"rotated"`)
+	assert.Contains(t, rec.Body.String(), `"encrypted":true`)
+
+	c, rec = newSetValueContext(`{"key":"api-token","value":"rotated-again","if_version":2}`)
+	assert.NoError(t, handler.SetValue(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"encrypted":true`)
+
+	var plaintext int
+	err = pool.QueryRow(ctx, `
+		SELECT count(*) FROM key_value WHERE key = 'api-token' AND (encrypted_value IS NULL OR value <> '')
+	`).Scan(&plaintext)
+	assert.NoError(t, err)
+	assert.Zero(t, plaintext)
+
+	c, rec = newGetValueContext("api-token")
+	assert.NoError(t, handler.GetValue(c))
+	assert.Contains(t, rec.Body.String(), `"value":"rotated-again"`)
+
+	// Once deleted, the key can be recreated in plaintext
+	_, err = pool.Exec(ctx, `DELETE FROM key_value WHERE key = 'api-token'`)
+	assert.NoError(t, err)
+	c, rec = newSetValueContext(`{"key":"api-token","value":"public"}`)
+	assert.NoError(t, handler.SetValue(c))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.NotContains(t, rec.Body.String(), `"encrypted"`)
+}
+
+// TestEncryptedNamespace tests that a namespace can require encryption for every value
+func TestEncryptedNamespace(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	handler := NewKeyValueHandler(db.New(pool)).WithEncryptedNamespaces(map[string]bool{"secrets": true})
+
+	c, rec := newSetValueContext(`{"key":"db-password","value":"hunter2"}`)
+	c.Set(echoNamespaceKey, "secrets")
+	assert.NoError(t, handler.SetValue(c))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"encrypted":true`)
+
+	c, rec = newGetValueContext("db-password")
+	c.Set(echoNamespaceKey, "secrets")
+	assert.NoError(t, handler.GetValue(c))
+	assert.Contains(t, rec.Body.String(), `"value":"hunter2"`)
+
+	// Counters would be stored in plaintext
+	c, rec = newPostContext("/api/key-value/_incr", `{"key":"hits"}`)
+	c.Set(echoNamespaceKey, "secrets")
+	assert.NoError(t, handler.IncrementValue(c))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "KV_014_ENCRYPTED_INCREMENT")
+}
+
+// TestIncrementValue_EncryptedValue tests that an encrypted value is not treated as a counter
+func TestIncrementValue_EncryptedValue(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	handler := NewKeyValueHandler(db.New(pool))
+
+	c, rec := newSetValueContext(`{"key":"pin","value":"1234","encrypted":true}`)
+	assert.NoError(t, handler.SetValue(c))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	c, rec = newPostContext("/api/key-value/_incr", `{"key":"pin"}`)
+	assert.NoError(t, handler.IncrementValue(c))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "KV_211_VALUE_NOT_INTEGER")
+}
@@ -1,33 +1,98 @@
 package key_value
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
 	errs "person-service/errors"
 	db "person-service/internal/db/generated"
+	"person-service/metrics"
+	"strconv"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/labstack/echo/v4"
 )
 
+// maxTTLSeconds bounds ttl_seconds to ten years
+const maxTTLSeconds = 10 * 365 * 24 * 60 * 60
+
+// numericValueOutOfRange is the SQLSTATE of an integer overflow
+const numericValueOutOfRange = "22003"
+
 // SetValueRequest represents the request body for setting a key-value pair
 type SetValueRequest struct {
 	Key   string `json:"key" validate:"required"`
 	Value string `json:"value" validate:"required"`
+	// TTLSeconds expires the key after the given number of seconds; nil keeps it forever
+	TTLSeconds *int64 `json:"ttl_seconds,omitempty"`
+	// IfVersion only writes when the key is currently at this version
+	IfVersion *int64 `json:"if_version,omitempty"`
+	// IfAbsent only writes when the key does not exist
+	IfAbsent bool `json:"if_absent,omitempty"`
+	// Encrypted stores the value encrypted at rest; reads decrypt it transparently.
+	// A key already stored encrypted stays encrypted whatever this says
+	Encrypted bool `json:"encrypted,omitempty"`
+}
+
+// IncrementRequest represents the request body for incrementing an integer value
+type IncrementRequest struct {
+	Key string `json:"key"`
+	// Delta is added to the value, negative to decrement; defaults to 1
+	Delta *int64 `json:"delta,omitempty"`
+	// TTLSeconds expires a key created by the increment; existing keys keep their TTL
+	TTLSeconds *int64 `json:"ttl_seconds,omitempty"`
 }
 
 // KeyValueHandler handles KeyValue
 type KeyValueHandler struct {
-	queries *db.Queries
+	queries    *db.Queries
+	watcher    *Watcher
+	pool       *pgxpool.Pool
+	encryption encryption
+	limits     ValueLimits
 }
 
 // KeyValueHandler creates a new instance of KeyValueHandler with injected queries
 func NewKeyValueHandler(queries *db.Queries) *KeyValueHandler {
 	return &KeyValueHandler{
-		queries: queries,
+		queries:    queries,
+		encryption: newEncryption(),
+		limits:     ValueLimits{MaxBytes: defaultMaxValueBytes, MaxSnapshotBytes: defaultMaxSnapshotBytes},
 	}
 }
 
+// WithWatcher enables watch requests, which are woken up by the watcher's notifications
+func (h *KeyValueHandler) WithWatcher(watcher *Watcher) *KeyValueHandler {
+	h.watcher = watcher
+	return h
+}
+
+// WithPool enables transactions, which need a connection of their own
+func (h *KeyValueHandler) WithPool(pool *pgxpool.Pool) *KeyValueHandler {
+	h.pool = pool
+	return h
+}
+
+// WithValueLimits bounds the size of stored values
+func (h *KeyValueHandler) WithValueLimits(limits ValueLimits) *KeyValueHandler {
+	h.limits = limits
+	return h
+}
+
+// WithEncryptedNamespaces stores every value of the given namespaces encrypted
+func (h *KeyValueHandler) WithEncryptedNamespaces(namespaces map[string]bool) *KeyValueHandler {
+	h.encryption.namespaces = namespaces
+	return h
+}
+
 // SetValue handles POST /api/key_value - sets or updates a key-value pair
 func (h *KeyValueHandler) SetValue(c echo.Context) error {
 	// Parse request body
@@ -46,20 +111,41 @@ func (h *KeyValueHandler) SetValue(c echo.Context) error {
 			ErrorCode: errs.ErrKVMissingKeyOrValue,
 		})
 	}
+	if int64(len(req.Value)) > h.limits.MaxBytes {
+		return h.valueTooLarge(c)
+	}
 
-	// Use request context for trace propagation
-	ctx := c.Request().Context()
+	ttl, err := parseTTL(req.TTLSeconds)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   err.Error(),
+			ErrorCode: errs.ErrKVInvalidTTL,
+		})
+	}
 
-	// Check if key already exists to determine response status code
-	_, err := h.queries.GetKeyValue(ctx, req.Key)
-	isNewKey := errors.Is(err, pgx.ErrNoRows)
+	cond, err := parseCondition(req.IfVersion, req.IfAbsent,
+		c.Request().Header.Get("If-Match"), c.Request().Header.Get("If-None-Match"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   err.Error(),
+			ErrorCode: errs.ErrKVInvalidCondition,
+		})
+	}
 
-	// Set value in database
-	err = h.queries.SetValue(ctx, db.SetValueParams{
-		Key:   req.Key,
-		Value: req.Value,
+	// Use request context for trace propagation
+	ctx := c.Request().Context()
+	record, err := h.write(ctx, writeRequest{
+		namespace: namespaceOf(c),
+		key:       req.Key,
+		value:     req.Value,
+		encrypted: req.Encrypted,
+		ttl:       ttl,
+		cond:      cond,
 	})
 
+	if errors.Is(err, pgx.ErrNoRows) {
+		return conditionFailed(c, cond)
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
 			Message:   "Failed to set value",
@@ -67,37 +153,165 @@ func (h *KeyValueHandler) SetValue(c echo.Context) error {
 		})
 	}
 
-	// Retrieve the full record with timestamps
-	record, err := h.queries.GetKeyValue(ctx, req.Key)
+	// Return success with the full key-value record
+	response := keyValueResponse(record, time.Now())
+	c.Response().Header().Set("ETag", etag(record.Version))
+
+	// Return 201 Created for new keys (version 1), 200 OK for updates
+	if record.Version == 1 {
+		return c.JSON(http.StatusCreated, response)
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// IncrementValue handles POST /api/key-value/_incr - atomically adds delta to an
+// integer value, creating the key with value delta when it does not exist
+func (h *KeyValueHandler) IncrementValue(c echo.Context) error {
+	var req IncrementRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Invalid request body",
+			ErrorCode: errs.ErrKVInvalidRequestBody,
+		})
+	}
+
+	if req.Key == "" {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Field \"key\" is required",
+			ErrorCode: errs.ErrKVInvalidIncrement,
+		})
+	}
+
+	delta := int64(1)
+	if req.Delta != nil {
+		delta = *req.Delta
+	}
+
+	ttl, err := parseTTL(req.TTLSeconds)
 	if err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   err.Error(),
+			ErrorCode: errs.ErrKVInvalidTTL,
+		})
+	}
+
+	// Counters are plaintext, so they cannot live in a namespace that encrypts every value
+	namespace := namespaceOf(c)
+	if h.encryption.required(namespace) {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Namespace \"" + namespace + "\" stores values encrypted and cannot hold counters",
+			ErrorCode: errs.ErrKVEncryptedIncrement,
+		})
+	}
+
+	// Use request context for trace propagation
+	ctx := c.Request().Context()
+
+	// The read and the write happen in one statement, so concurrent increments are not lost
+	record, err := h.queries.IncrementValue(ctx, db.IncrementValueParams{
+		Namespace:  namespace,
+		Key:        req.Key,
+		Delta:      delta,
+		TtlSeconds: ttl,
+	})
+
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return c.JSON(http.StatusConflict, errs.ErrorResponse{
+			Message:   "Value of key is not an integer",
+			ErrorCode: errs.ErrKVValueNotInteger,
+		})
+	case errors.As(err, &pgErr) && pgErr.Code == numericValueOutOfRange:
+		return c.JSON(http.StatusConflict, errs.ErrorResponse{
+			Message:   "Value of key would overflow a 64-bit integer",
+			ErrorCode: errs.ErrKVCounterOutOfRange,
+		})
+	case err != nil:
 		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
-			Message:   "Failed to retrieve value",
-			ErrorCode: errs.ErrKVFailedRetrieveValue,
+			Message:   "Failed to set value",
+			ErrorCode: errs.ErrKVFailedSetValue,
 		})
 	}
 
-	// Return success with the full key-value record
-	response := map[string]interface{}{
-		"key":   record.Key,
-		"value": record.Value,
+	c.Response().Header().Set("ETag", etag(record.Version))
+
+	// Return 201 Created when the increment created the key
+	if record.Version == 1 {
+		return c.JSON(http.StatusCreated, keyValueResponse(record, time.Now()))
 	}
+	return c.JSON(http.StatusOK, keyValueResponse(record, time.Now()))
+}
 
-	// Add timestamps if they are valid
-	if record.CreatedAt.Valid {
-		response["created_at"] = record.CreatedAt.Time
+// Txn handles POST /api/key-value/_txn - applies set, delete and check operations
+// in order within one database transaction. When the condition of an operation
+// does not hold nothing is applied and the failing operation is reported.
+func (h *KeyValueHandler) Txn(c echo.Context) error {
+	if h.pool == nil {
+		return c.JSON(http.StatusServiceUnavailable, errs.ErrorResponse{
+			Message:   "Transactions are not available",
+			ErrorCode: errs.ErrKVTransactionsUnavailable,
+		})
 	}
-	if record.UpdatedAt.Valid {
-		response["updated_at"] = record.UpdatedAt.Time
+
+	var req TxnRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Invalid request body",
+			ErrorCode: errs.ErrKVInvalidRequestBody,
+		})
 	}
 
-	// Return 201 Created for new keys, 200 OK for updates
-	if isNewKey {
-		return c.JSON(http.StatusCreated, response)
+	steps, err := parseTxn(req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   err.Error(),
+			ErrorCode: errs.ErrKVInvalidTransaction,
+		})
 	}
-	return c.JSON(http.StatusOK, response)
+
+	for _, step := range steps {
+		if int64(len(step.value)) > h.limits.MaxBytes {
+			return h.valueTooLarge(c)
+		}
+	}
+
+	// Use request context for trace propagation
+	ctx := c.Request().Context()
+	namespace := namespaceOf(c)
+
+	var results []map[string]interface{}
+	err = pgx.BeginFunc(ctx, h.pool, func(tx pgx.Tx) error {
+		var txErr error
+		results, txErr = applyTxn(ctx, h.queries.WithTx(tx), h.encryption, namespace, steps)
+		return txErr
+	})
+
+	var conflict *txnConflictError
+	if errors.As(err, &conflict) {
+		errorCode := errs.ErrKVVersionConflict
+		if conflict.step.cond.absent {
+			errorCode = errs.ErrKVKeyExists
+		}
+		return c.JSON(http.StatusConflict, errs.ErrorResponse{
+			Message:   "Transaction aborted: " + conflict.Error(),
+			ErrorCode: errorCode,
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to apply transaction",
+			ErrorCode: errs.ErrKVFailedTransaction,
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"operations": results,
+	})
 }
 
-// GetValue handles GET /api/key_value/:key - retrieves a value by key
+// GetValue handles GET /api/key_value/:key - retrieves a value by key.
+// With ?watch=true the request blocks until the key changes (see watchValue).
 func (h *KeyValueHandler) GetValue(c echo.Context) error {
 	key := c.Param("key")
 	if key == "" {
@@ -107,38 +321,143 @@ func (h *KeyValueHandler) GetValue(c echo.Context) error {
 		})
 	}
 
+	if watch, _ := strconv.ParseBool(c.QueryParam("watch")); watch {
+		return h.watchValue(c, key)
+	}
+
 	// Use request context for trace propagation
 	ctx := c.Request().Context()
-	record, err := h.queries.GetKeyValue(ctx, key)
+	row, err := h.queries.GetKeyValue(ctx, db.GetKeyValueParams{
+		EncKey:    h.encryption.key,
+		Namespace: namespaceOf(c),
+		Key:       key,
+	})
+	countCrypto(metrics.OperationDecrypt, row.KeyValue)
+
+	return respondValue(c, decryptedRow(row), err)
+}
 
+// watchValue answers GET /api/key_value/:key?watch=true&index=N&wait=30s.
+// It blocks until the version of the key differs from index (the next change
+// when index is omitted) or wait elapses, then responds like GetValue.
+// X-KV-Index carries the version to send as index next time, 0 for a missing key.
+func (h *KeyValueHandler) watchValue(c echo.Context, key string) error {
+	if h.watcher == nil {
+		return c.JSON(http.StatusServiceUnavailable, errs.ErrorResponse{
+			Message:   "Watch is not available",
+			ErrorCode: errs.ErrKVWatchUnavailable,
+		})
+	}
+
+	opts, err := parseWatchOptions(c.QueryParam("index"), c.QueryParam("wait"))
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return c.JSON(http.StatusNotFound, errs.ErrorResponse{
-				Message:   "Key not found",
-				ErrorCode: errs.ErrKVKeyNotFound,
-			})
-		}
-		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
-			Message:   "Failed to retrieve value",
-			ErrorCode: errs.ErrKVFailedRetrieveValue,
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   err.Error(),
+			ErrorCode: errs.ErrKVInvalidWatchParams,
 		})
 	}
 
-	// Return the full key-value record
-	response := map[string]interface{}{
-		"key":   record.Key,
-		"value": record.Value,
+	// Use request context for trace propagation
+	ctx := c.Request().Context()
+
+	// Subscribe before reading so a write between the read and the wait is not missed
+	params := db.GetKeyValueParams{
+		EncKey:    h.encryption.key,
+		Namespace: namespaceOf(c),
+		Key:       key,
 	}
+	sub := h.watcher.Subscribe(params.Namespace, key, false)
+	defer sub.Close()
 
-	// Add timestamps if they are valid
-	if record.CreatedAt.Valid {
-		response["created_at"] = record.CreatedAt.Time
+	read := func() (db.KeyValue, error) {
+		row, err := h.queries.GetKeyValue(ctx, params)
+		countCrypto(metrics.OperationDecrypt, row.KeyValue)
+		return decryptedRow(row), err
 	}
-	if record.UpdatedAt.Valid {
-		response["updated_at"] = record.UpdatedAt.Time
+
+	record, err := read()
+	index := versionOf(record, err)
+	if opts.index != nil {
+		index = *opts.index
 	}
 
-	return c.JSON(http.StatusOK, response)
+	// The request may outlive the server's write timeout
+	_ = http.NewResponseController(c.Response()).SetWriteDeadline(time.Now().Add(opts.wait + 10*time.Second))
+
+	timer := time.NewTimer(opts.wait)
+	defer timer.Stop()
+
+wait:
+	for versionOf(record, err) == index && (err == nil || errors.Is(err, pgx.ErrNoRows)) {
+		select {
+		case _, ok := <-sub.C():
+			if !ok {
+				// The watcher stopped: answer with the current state
+				break wait
+			}
+			record, err = read()
+		case <-timer.C:
+			break wait
+		case <-ctx.Done():
+			// Client went away
+			return nil
+		}
+	}
+
+	c.Response().Header().Set("X-KV-Index", strconv.FormatInt(versionOf(record, err), 10))
+	return respondValue(c, record, err)
+}
+
+// WatchValues handles GET /api/key-value/_watch?prefix= - streams the changes of
+// every key starting with prefix as server-sent events until the client disconnects
+func (h *KeyValueHandler) WatchValues(c echo.Context) error {
+	if h.watcher == nil {
+		return c.JSON(http.StatusServiceUnavailable, errs.ErrorResponse{
+			Message:   "Watch is not available",
+			ErrorCode: errs.ErrKVWatchUnavailable,
+		})
+	}
+
+	sub := h.watcher.Subscribe(namespaceOf(c), c.QueryParam("prefix"), true)
+	defer sub.Close()
+
+	// Streams are not bound by the server's write timeout
+	_ = http.NewResponseController(c.Response()).SetWriteDeadline(time.Time{})
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	heartbeat := time.NewTicker(watchHeartbeat)
+	defer heartbeat.Stop()
+
+	ctx := c.Request().Context()
+	for {
+		select {
+		case change, ok := <-sub.C():
+			if !ok {
+				return nil
+			}
+			if sub.Dropped() {
+				// Some changes were lost: the client should re-read the prefix
+				if err := writeEvent(res, Change{Op: OpResync}); err != nil {
+					return nil
+				}
+			}
+			if err := writeEvent(res, change); err != nil {
+				return nil
+			}
+		case <-heartbeat.C:
+			if _, err := res.Write([]byte(": keepalive\n\n")); err != nil {
+				return nil
+			}
+		case <-ctx.Done():
+			return nil
+		}
+		res.Flush()
+	}
 }
 
 // DeleteValue handles DELETE /api/key_value/:key - deletes a key-value pair
@@ -151,11 +470,233 @@ func (h *KeyValueHandler) DeleteValue(c echo.Context) error {
 		})
 	}
 
+	// A delete can be made conditional with If-Match or ?if_version=
+	var ifVersion *int64
+	if raw := c.QueryParam("if_version"); raw != "" {
+		version, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+				Message:   "Query parameter \"if_version\" must be a number",
+				ErrorCode: errs.ErrKVInvalidCondition,
+			})
+		}
+		ifVersion = &version
+	}
+	cond, err := parseCondition(ifVersion, false, c.Request().Header.Get("If-Match"), "")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   err.Error(),
+			ErrorCode: errs.ErrKVInvalidCondition,
+		})
+	}
+
+	// Use request context for trace propagation
+	ctx := c.Request().Context()
+	namespace := namespaceOf(c)
+
+	// Delete value from database; expired keys are reported as not found
+	found := true
+	if cond.version != nil {
+		var deleted int64
+		deleted, err = h.queries.DeleteValueWithVersion(ctx, db.DeleteValueWithVersionParams{
+			Namespace:       namespace,
+			Key:             key,
+			ExpectedVersion: *cond.version,
+		})
+		if err == nil && deleted == 0 {
+			// Only a failed delete reads the key, to tell a missing key from another version
+			var row db.GetKeyValueRow
+			row, err = h.queries.GetKeyValue(ctx, db.GetKeyValueParams{
+				EncKey:    h.encryption.key,
+				Namespace: namespace,
+				Key:       key,
+			})
+			countCrypto(metrics.OperationDecrypt, row.KeyValue)
+			if err == nil {
+				return conditionFailed(c, cond)
+			}
+		}
+	} else {
+		found, err = h.queries.DeleteLiveValue(ctx, db.DeleteLiveValueParams{
+			Namespace: namespace,
+			Key:       key,
+		})
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !found) {
+		return c.JSON(http.StatusNotFound, errs.ErrorResponse{
+			Message:   "Key not found",
+			ErrorCode: errs.ErrKVKeyNotFound,
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to delete value",
+			ErrorCode: errs.ErrKVFailedDeleteValue,
+		})
+	}
+
+	// Return success message
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Key deleted successfully",
+	})
+}
+
+// ListValues handles GET /api/key-value?prefix=&limit=&cursor=&include_values= - lists keys in key order.
+// Pages are fetched with keyset pagination: next_cursor is returned while more keys follow.
+func (h *KeyValueHandler) ListValues(c echo.Context) error {
+	opts, err := parseListOptions(c.QueryParam("prefix"), c.QueryParam("limit"),
+		c.QueryParam("cursor"), c.QueryParam("include_values"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   err.Error(),
+			ErrorCode: errs.ErrKVInvalidListParams,
+		})
+	}
+
 	// Use request context for trace propagation
 	ctx := c.Request().Context()
 
-	// Check if key exists before deleting
-	_, err := h.queries.GetKeyValue(ctx, key)
+	// Fetch one extra key to know whether another page follows
+	rows, err := h.queries.ListKeyValues(ctx, db.ListKeyValuesParams{
+		EncKey:    h.encryption.key,
+		Namespace: namespaceOf(c),
+		Prefix:    opts.prefix,
+		AfterKey:  opts.after,
+		RowLimit:  opts.limit + 1,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to list keys",
+			ErrorCode: errs.ErrKVFailedListKeys,
+		})
+	}
+
+	hasMore := len(rows) > int(opts.limit)
+	if hasMore {
+		rows = rows[:opts.limit]
+	}
+
+	now := time.Now()
+	keys := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		countCrypto(metrics.OperationDecrypt, row.KeyValue)
+		item := keyValueResponse(decrypted(row.KeyValue, row.PlainValue), now)
+		if !opts.includeValues {
+			delete(item, "value")
+		}
+		keys = append(keys, item)
+	}
+
+	response := map[string]interface{}{
+		"namespace": namespaceOf(c),
+		"prefix":    opts.prefix,
+		"keys":      keys,
+	}
+	if hasMore {
+		response["next_cursor"] = encodeCursor(rows[len(rows)-1].KeyValue.Key)
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// CountValues handles GET /api/key-value/_count?prefix= - counts keys starting with a prefix
+func (h *KeyValueHandler) CountValues(c echo.Context) error {
+	prefix := c.QueryParam("prefix")
+
+	// Use request context for trace propagation
+	ctx := c.Request().Context()
+
+	count, err := h.queries.CountKeyValues(ctx, db.CountKeyValuesParams{
+		Namespace: namespaceOf(c),
+		Prefix:    prefix,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to count keys",
+			ErrorCode: errs.ErrKVFailedListKeys,
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"namespace": namespaceOf(c),
+		"prefix":    prefix,
+		"count":     count,
+	})
+}
+
+// writeRequest is a validated write of a text value, or of a binary value when contentType is set
+type writeRequest struct {
+	namespace   string
+	key         string
+	value       string
+	contentType pgtype.Text
+	data        []byte
+	encrypted   bool
+	ttl         pgtype.Int8
+	cond        writeCondition
+}
+
+// write stores a value under its condition; pgx.ErrNoRows means the condition did not hold
+func (h *KeyValueHandler) write(ctx context.Context, w writeRequest) (db.KeyValue, error) {
+	record, err := writeValue(ctx, h.queries, h.encryption, w)
+	// An encrypted value is only stored encrypted
+	record.Value = w.value
+	return record, err
+}
+
+// writeValue runs the write in a single statement so concurrent writers cannot interleave
+func writeValue(ctx context.Context, queries *db.Queries, enc encryption, w writeRequest) (db.KeyValue, error) {
+	encKey, keyVersion := enc.writeParams(w.namespace, w.encrypted)
+
+	var record db.KeyValue
+	var err error
+	switch {
+	case w.cond.absent:
+		record, err = queries.InsertValueIfAbsent(ctx, db.InsertValueIfAbsentParams{
+			Namespace:   w.namespace,
+			Key:         w.key,
+			EncKey:      encKey,
+			Value:       w.value,
+			ContentType: w.contentType,
+			Data:        w.data,
+			KeyVersion:  keyVersion,
+			TtlSeconds:  w.ttl,
+		})
+	case w.cond.version != nil:
+		record, err = queries.UpdateValueWithVersion(ctx, db.UpdateValueWithVersionParams{
+			EncKey:          encKey,
+			Value:           w.value,
+			ContentType:     w.contentType,
+			Data:            w.data,
+			KeyVersion:      keyVersion,
+			TtlSeconds:      w.ttl,
+			KeepKey:         enc.key,
+			KeepKeyVersion:  enc.keyVersion,
+			Namespace:       w.namespace,
+			Key:             w.key,
+			ExpectedVersion: *w.cond.version,
+		})
+	default:
+		record, err = queries.SetValue(ctx, db.SetValueParams{
+			Namespace:      w.namespace,
+			Key:            w.key,
+			EncKey:         encKey,
+			Value:          w.value,
+			ContentType:    w.contentType,
+			Data:           w.data,
+			KeyVersion:     keyVersion,
+			TtlSeconds:     w.ttl,
+			KeepKey:        enc.key,
+			KeepKeyVersion: enc.keyVersion,
+		})
+	}
+	countCrypto(metrics.OperationEncrypt, record)
+	return record, err
+}
+
+// respondValue writes the result of reading a key: the record or binary value, 404 or 500
+func respondValue(c echo.Context, record db.KeyValue, err error) error {
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return c.JSON(http.StatusNotFound, errs.ErrorResponse{
@@ -169,18 +710,109 @@ func (h *KeyValueHandler) DeleteValue(c echo.Context) error {
 		})
 	}
 
-	// Delete value from database
-	err = h.queries.DeleteValue(ctx, key)
+	// Binary values are returned as they were stored
+	if record.ContentType.Valid {
+		return respondBinary(c, record)
+	}
+
+	// Return the full key-value record
+	c.Response().Header().Set("ETag", etag(record.Version))
+	return c.JSON(http.StatusOK, keyValueResponse(record, time.Now()))
+}
 
+// versionOf returns the version of a read key, 0 when it does not exist
+func versionOf(record db.KeyValue, err error) int64 {
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
-			Message:   "Failed to delete value",
-			ErrorCode: errs.ErrKVFailedDeleteValue,
-		})
+		return 0
 	}
+	return record.Version
+}
 
-	// Return success message
-	return c.JSON(http.StatusOK, map[string]interface{}{
-		"message": "Key deleted successfully",
+// writeEvent writes a change as a server-sent event named after its operation
+func writeEvent(w io.Writer, change Change) error {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", change.Op, data)
+	return err
+}
+
+// conditionFailed responds to a write whose condition did not hold:
+// 412 for HTTP preconditions, 409 for conditions in the request body
+func conditionFailed(c echo.Context, cond writeCondition) error {
+	if cond.fromHeader {
+		return c.JSON(http.StatusPreconditionFailed, errs.ErrorResponse{
+			Message:   "Precondition failed",
+			ErrorCode: errs.ErrKVPreconditionFailed,
+		})
+	}
+	if cond.absent {
+		return c.JSON(http.StatusConflict, errs.ErrorResponse{
+			Message:   "Key already exists",
+			ErrorCode: errs.ErrKVKeyExists,
+		})
+	}
+	return c.JSON(http.StatusConflict, errs.ErrorResponse{
+		Message:   "Version conflict: key has been modified by another request",
+		ErrorCode: errs.ErrKVVersionConflict,
 	})
 }
+
+// parseTTL validates the optional ttl_seconds of a request
+func parseTTL(ttlSeconds *int64) (pgtype.Int8, error) {
+	if ttlSeconds == nil {
+		return pgtype.Int8{}, nil
+	}
+	if *ttlSeconds <= 0 || *ttlSeconds > maxTTLSeconds {
+		return pgtype.Int8{}, errors.New("Field \"ttl_seconds\" must be between 1 and 315360000")
+	}
+	return pgtype.Int8{Int64: *ttlSeconds, Valid: true}, nil
+}
+
+// remainingTTL returns the whole seconds left before expiresAt, rounded up
+func remainingTTL(expiresAt, now time.Time) int64 {
+	remaining := expiresAt.Sub(now)
+	if remaining <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(remaining.Seconds()))
+}
+
+// keyValueResponse builds the JSON response for a key-value record
+func keyValueResponse(record db.KeyValue, now time.Time) map[string]interface{} {
+	response := map[string]interface{}{
+		"namespace": record.Namespace,
+		"key":       record.Key,
+		"value":     record.Value,
+		"version":   record.Version,
+	}
+
+	// Values stored encrypted are flagged; the value itself is returned decrypted
+	if len(record.EncryptedValue) > 0 {
+		response["encrypted"] = true
+	}
+
+	// Binary values are only returned by GET /api/key-value/:key
+	if record.ContentType.Valid {
+		delete(response, "value")
+		response["content_type"] = record.ContentType.String
+		response["size"] = record.Size.Int64
+	}
+
+	// Add timestamps if they are valid
+	if record.CreatedAt.Valid {
+		response["created_at"] = record.CreatedAt.Time
+	}
+	if record.UpdatedAt.Valid {
+		response["updated_at"] = record.UpdatedAt.Time
+	}
+
+	// Keys without a TTL never expire
+	if record.ExpiresAt.Valid {
+		response["expires_at"] = record.ExpiresAt.Time
+		response["ttl_seconds"] = remainingTTL(record.ExpiresAt.Time, now)
+	}
+
+	return response
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/labstack/echo/v4"
@@ -290,8 +291,8 @@ func TestDeleteValue_DatabaseError(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusInternalServerError, rec.Code)
-	// Now calls GetKeyValue first to check existence, so error message is "Failed to retrieve value"
-	assert.Contains(t, rec.Body.String(), "Failed to retrieve value")
+	// The key is deleted in a single statement, without reading it first
+	assert.Contains(t, rec.Body.String(), "Failed to delete value")
 }
 
 // TestSetValue_RetrieveErrorAfterSet tests the error path when GetKeyValue fails after SetValue succeeds
@@ -1061,3 +1062,462 @@ func TestDeleteValue_NotFound(t *testing.T) {
 	// Delete of nonexistent key should succeed (idempotent) or return 404
 	assert.True(t, rec.Code == http.StatusOK || rec.Code == http.StatusNotFound)
 }
+
+func newSetValueContext(body string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/api/key-value", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	return e.NewContext(req, rec), rec
+}
+
+func newGetValueContext(key string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/key-value/"+key, nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("key")
+	c.SetParamValues(key)
+	return c, rec
+}
+
+// TestSetValue_WithTTL tests that the remaining TTL is returned on set and get
+func TestSetValue_WithTTL(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+
+	handler := NewKeyValueHandler(db.New(pool))
+	c, rec := newSetValueContext(`{"key":"ttl-key","value":"ttl-value","ttl_seconds":60}`)
+	assert.NoError(t, handler.SetValue(c))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var response map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Contains(t, response, "expires_at")
+	assert.InDelta(t, 60, response["ttl_seconds"], 1)
+
+	c, rec = newGetValueContext("ttl-key")
+	assert.NoError(t, handler.GetValue(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.InDelta(t, 60, response["ttl_seconds"], 1)
+
+	// Setting the key again without a TTL makes it permanent
+	c, rec = newSetValueContext(`{"key":"ttl-key","value":"ttl-value"}`)
+	assert.NoError(t, handler.SetValue(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	response = map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.NotContains(t, response, "expires_at")
+	assert.NotContains(t, response, "ttl_seconds")
+}
+
+// TestSetValue_InvalidTTL tests rejection of non-positive and oversized TTLs
+func TestSetValue_InvalidTTL(t *testing.T) {
+	handler := NewKeyValueHandler(db.New(pool))
+	for _, ttl := range []string{"0", "-5", fmt.Sprint(maxTTLSeconds + 1)} {
+		c, rec := newSetValueContext(`{"key":"ttl-key","value":"ttl-value","ttl_seconds":` + ttl + `}`)
+		assert.NoError(t, handler.SetValue(c))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "KV_004_INVALID_TTL")
+	}
+}
+
+// TestExpiredKey_TreatedAsMissing tests that an expired key that has not been reaped is invisible
+func TestExpiredKey_TreatedAsMissing(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	_, err := pool.Exec(ctx, `
+		INSERT INTO key_value (key, value, created_at, expires_at)
+		VALUES ('expired-key', 'old-value', now() - interval '1 hour', now() - interval '1 second')
+	`)
+	assert.NoError(t, err)
+
+	handler := NewKeyValueHandler(db.New(pool))
+
+	c, rec := newGetValueContext("expired-key")
+	assert.NoError(t, handler.GetValue(c))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "KV_101_KEY_NOT_FOUND")
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodDelete, "/api/key-value/expired-key", nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetParamNames("key")
+	c.SetParamValues("expired-key")
+	assert.NoError(t, handler.DeleteValue(c))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// Setting an expired key recreates it
+	c, rec = newSetValueContext(`{"key":"expired-key","value":"new-value"}`)
+	assert.NoError(t, handler.SetValue(c))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var createdAt time.Time
+	assert.NoError(t, pool.QueryRow(ctx, `SELECT created_at FROM key_value WHERE key = 'expired-key'`).Scan(&createdAt))
+	assert.WithinDuration(t, time.Now(), createdAt, time.Minute)
+}
+
+func TestRemainingTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, int64(60), remainingTTL(now.Add(time.Minute), now))
+	assert.Equal(t, int64(1), remainingTTL(now.Add(100*time.Millisecond), now))
+	assert.Equal(t, int64(0), remainingTTL(now.Add(-time.Second), now))
+}
+
+// TestSetValue_Versioning tests that every write increments the version and sets the ETag
+func TestSetValue_Versioning(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+
+	handler := NewKeyValueHandler(db.New(pool))
+	for version := 1; version <= 3; version++ {
+		c, rec := newSetValueContext(`{"key":"versioned-key","value":"v"}`)
+		assert.NoError(t, handler.SetValue(c))
+		assert.Equal(t, fmt.Sprintf(`"%d"`, version), rec.Header().Get("ETag"))
+
+		var response map[string]interface{}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, float64(version), response["version"])
+	}
+
+	c, rec := newGetValueContext("versioned-key")
+	assert.NoError(t, handler.GetValue(c))
+	assert.Equal(t, `"3"`, rec.Header().Get("ETag"))
+}
+
+// TestSetValue_IfVersion tests compare-and-swap with the if_version body field
+func TestSetValue_IfVersion(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+
+	handler := NewKeyValueHandler(db.New(pool))
+
+	// A missing key never matches a version
+	c, rec := newSetValueContext(`{"key":"cas-key","value":"v1","if_version":1}`)
+	assert.NoError(t, handler.SetValue(c))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "KV_205_VERSION_CONFLICT")
+
+	c, rec = newSetValueContext(`{"key":"cas-key","value":"v1"}`)
+	assert.NoError(t, handler.SetValue(c))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	c, rec = newSetValueContext(`{"key":"cas-key","value":"v2","if_version":1}`)
+	assert.NoError(t, handler.SetValue(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+
+	// A stale version is rejected and the value is kept
+	c, rec = newSetValueContext(`{"key":"cas-key","value":"stale","if_version":1}`)
+	assert.NoError(t, handler.SetValue(c))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "KV_205_VERSION_CONFLICT")
+
+	value, err := testdb.GetKeyValueDirect(ctx, pool, "cas-key")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", value)
+}
+
+// TestSetValue_IfAbsent tests create-only writes with if_absent and If-None-Match
+func TestSetValue_IfAbsent(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+
+	handler := NewKeyValueHandler(db.New(pool))
+	c, rec := newSetValueContext(`{"key":"leader","value":"node-a","if_absent":true,"ttl_seconds":30}`)
+	assert.NoError(t, handler.SetValue(c))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	c, rec = newSetValueContext(`{"key":"leader","value":"node-b","if_absent":true}`)
+	assert.NoError(t, handler.SetValue(c))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "KV_206_KEY_EXISTS")
+
+	c, rec = newSetValueContext(`{"key":"leader","value":"node-b"}`)
+	c.Request().Header.Set("If-None-Match", "*")
+	assert.NoError(t, handler.SetValue(c))
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	assert.Contains(t, rec.Body.String(), "KV_207_PRECONDITION_FAILED")
+
+	// Once the lease has expired another node can take it
+	_, err := pool.Exec(ctx, `UPDATE key_value SET expires_at = now() - interval '1 second' WHERE key = 'leader'`)
+	assert.NoError(t, err)
+	c, rec = newSetValueContext(`{"key":"leader","value":"node-b","if_absent":true}`)
+	assert.NoError(t, handler.SetValue(c))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, `"1"`, rec.Header().Get("ETag"))
+}
+
+// TestSetValue_IfMatch tests compare-and-swap with the If-Match header
+func TestSetValue_IfMatch(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	assert.NoError(t, testdb.InsertKeyValueDirect(ctx, pool, "flag", "off"))
+
+	handler := NewKeyValueHandler(db.New(pool))
+	c, rec := newSetValueContext(`{"key":"flag","value":"on"}`)
+	c.Request().Header.Set("If-Match", `"2"`)
+	assert.NoError(t, handler.SetValue(c))
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	c, rec = newSetValueContext(`{"key":"flag","value":"on"}`)
+	c.Request().Header.Set("If-Match", `"1"`)
+	assert.NoError(t, handler.SetValue(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	c, rec = newSetValueContext(`{"key":"flag","value":"on","if_version":2}`)
+	c.Request().Header.Set("If-Match", `"2"`)
+	assert.NoError(t, handler.SetValue(c))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "KV_006_INVALID_CONDITION")
+}
+
+// TestConcurrentSetValue_IfVersion tests that only one of several concurrent CAS writes wins
+func TestConcurrentSetValue_IfVersion(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	assert.NoError(t, testdb.InsertKeyValueDirect(ctx, pool, "counter", "0"))
+
+	handler := NewKeyValueHandler(db.New(pool))
+	numGoroutines := 5
+	var wg sync.WaitGroup
+	results := make(chan int, numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			c, rec := newSetValueContext(fmt.Sprintf(`{"key":"counter","value":"%d","if_version":1}`, index))
+			handler.SetValue(c)
+			results <- rec.Code
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+
+	codes := map[int]int{}
+	for code := range results {
+		codes[code]++
+	}
+	assert.Equal(t, map[int]int{http.StatusOK: 1, http.StatusConflict: numGoroutines - 1}, codes)
+}
+
+// TestDeleteValue_IfVersion tests conditional deletes
+func TestDeleteValue_IfVersion(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	assert.NoError(t, testdb.InsertKeyValueDirect(ctx, pool, "lock", "node-a"))
+
+	handler := NewKeyValueHandler(db.New(pool))
+	deleteValue := func(target string, ifMatch string) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodDelete, target, nil)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("key")
+		c.SetParamValues("lock")
+		assert.NoError(t, handler.DeleteValue(c))
+		return rec
+	}
+
+	rec := deleteValue("/api/key-value/lock?if_version=2", "")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "KV_205_VERSION_CONFLICT")
+
+	rec = deleteValue("/api/key-value/lock", `"2"`)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	rec = deleteValue("/api/key-value/lock?if_version=abc", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "KV_006_INVALID_CONDITION")
+
+	rec = deleteValue("/api/key-value/lock", `"1"`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// A missing key is not found, whether or not the delete is conditional
+	rec = deleteValue("/api/key-value/lock?if_version=1", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "KV_101_KEY_NOT_FOUND")
+	rec = deleteValue("/api/key-value/lock", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func newListContext(target string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	rec := httptest.NewRecorder()
+	return e.NewContext(req, rec), rec
+}
+
+// TestListValues_Pagination tests prefix listing across pages
+func TestListValues_Pagination(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	for _, key := range []string{"feature/a", "feature/b", "feature/c", "other/a"} {
+		assert.NoError(t, testdb.InsertKeyValueDirect(ctx, pool, key, "value-"+key))
+	}
+	_, err := pool.Exec(ctx, `
+		INSERT INTO key_value (key, value, expires_at)
+		VALUES ('feature/expired', 'v', now() - interval '1 second')
+	`)
+	assert.NoError(t, err)
+
+	handler := NewKeyValueHandler(db.New(pool))
+	type page struct {
+		Keys       []map[string]interface{} `json:"keys"`
+		NextCursor string                   `json:"next_cursor"`
+	}
+
+	c, rec := newListContext("/api/key-value?prefix=feature/&limit=2")
+	assert.NoError(t, handler.ListValues(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var first page
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &first))
+	assert.Len(t, first.Keys, 2)
+	assert.Equal(t, "feature/a", first.Keys[0]["key"])
+	assert.NotContains(t, first.Keys[0], "value")
+	assert.NotEmpty(t, first.NextCursor)
+
+	c, rec = newListContext("/api/key-value?prefix=feature/&limit=2&include_values=true&cursor=" + first.NextCursor)
+	assert.NoError(t, handler.ListValues(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var second page
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &second))
+	assert.Len(t, second.Keys, 1)
+	assert.Equal(t, "feature/c", second.Keys[0]["key"])
+	assert.Equal(t, "value-feature/c", second.Keys[0]["value"])
+	assert.Empty(t, second.NextCursor)
+}
+
+// TestListValues_InvalidParams tests rejection of bad list parameters
+func TestListValues_InvalidParams(t *testing.T) {
+	handler := NewKeyValueHandler(db.New(pool))
+	c, rec := newListContext("/api/key-value?limit=5000")
+
+	assert.NoError(t, handler.ListValues(c))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "KV_007_INVALID_LIST_PARAMS")
+}
+
+// TestCountValues tests counting live keys under a prefix
+func TestCountValues(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	for _, key := range []string{"feature/a", "feature/b", "other/a"} {
+		assert.NoError(t, testdb.InsertKeyValueDirect(ctx, pool, key, "v"))
+	}
+
+	handler := NewKeyValueHandler(db.New(pool))
+	c, rec := newListContext("/api/key-value/_count?prefix=feature/")
+	assert.NoError(t, handler.CountValues(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, float64(2), response["count"])
+}
+
+func newPostContext(target, body string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	return e.NewContext(req, rec), rec
+}
+
+// TestIncrementValue tests creating, incrementing and decrementing a counter
+func TestIncrementValue(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	handler := NewKeyValueHandler(db.New(pool))
+
+	c, rec := newPostContext("/api/key-value/_incr", `{"key":"hits"}`)
+	assert.NoError(t, handler.IncrementValue(c))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"value":"1"`)
+
+	c, rec = newPostContext("/api/key-value/_incr", `{"key":"hits","delta":10}`)
+	assert.NoError(t, handler.IncrementValue(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"value":"11"`)
+	assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+
+	c, rec = newPostContext("/api/key-value/_incr", `{"key":"hits","delta":-20}`)
+	assert.NoError(t, handler.IncrementValue(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"value":"-9"`)
+}
+
+// TestIncrementValue_TTLOnlyOnCreate tests that an increment keeps the TTL of an existing key
+func TestIncrementValue_TTLOnlyOnCreate(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	handler := NewKeyValueHandler(db.New(pool))
+
+	c, rec := newPostContext("/api/key-value/_incr", `{"key":"window","ttl_seconds":60}`)
+	assert.NoError(t, handler.IncrementValue(c))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var created map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+
+	c, rec = newPostContext("/api/key-value/_incr", `{"key":"window","ttl_seconds":3600}`)
+	assert.NoError(t, handler.IncrementValue(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var incremented map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &incremented))
+	assert.Equal(t, created["expires_at"], incremented["expires_at"])
+}
+
+// TestIncrementValue_Errors tests non-integer values, overflow and validation
+func TestIncrementValue_Errors(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	assert.NoError(t, testdb.InsertKeyValueDirect(ctx, pool, "name", "alice"))
+	assert.NoError(t, testdb.InsertKeyValueDirect(ctx, pool, "big", "9223372036854775807"))
+	handler := NewKeyValueHandler(db.New(pool))
+
+	tests := []struct {
+		body      string
+		status    int
+		errorCode string
+	}{
+		{`{"key":"name"}`, http.StatusConflict, "KV_211_VALUE_NOT_INTEGER"},
+		{`{"key":"big"}`, http.StatusConflict, "KV_212_COUNTER_OUT_OF_RANGE"},
+		{`{"delta":1}`, http.StatusBadRequest, "KV_011_INVALID_INCREMENT"},
+		{`{"key":"hits","delta":1.5}`, http.StatusBadRequest, "KV_001_INVALID_REQUEST_BODY"},
+		{`{"key":"hits","ttl_seconds":0}`, http.StatusBadRequest, "KV_004_INVALID_TTL"},
+	}
+	for _, tt := range tests {
+		c, rec := newPostContext("/api/key-value/_incr", tt.body)
+		assert.NoError(t, handler.IncrementValue(c))
+		assert.Equal(t, tt.status, rec.Code, tt.body)
+		assert.Contains(t, rec.Body.String(), tt.errorCode, tt.body)
+	}
+}
+
+// TestConcurrentIncrementValue tests that concurrent increments are not lost
+func TestConcurrentIncrementValue(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	handler := NewKeyValueHandler(db.New(pool))
+
+	numGoroutines := 20
+	var wg sync.WaitGroup
+	for i := 0; i < numGoroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, _ := newPostContext("/api/key-value/_incr", `{"key":"concurrent-counter"}`)
+			handler.IncrementValue(c)
+		}()
+	}
+	wg.Wait()
+
+	value, err := testdb.GetKeyValueDirect(ctx, pool, "concurrent-counter")
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprint(numGoroutines), value)
+}
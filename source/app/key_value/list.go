@@ -0,0 +1,65 @@
+package key_value
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// listOptions are the query parameters of a key listing
+type listOptions struct {
+	prefix        string
+	after         string
+	limit         int32
+	includeValues bool
+}
+
+// parseListOptions validates the prefix, limit, cursor and include_values query parameters
+func parseListOptions(prefix, limit, cursor, includeValues string) (listOptions, error) {
+	opts := listOptions{prefix: prefix, limit: defaultListLimit}
+
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxListLimit {
+			return listOptions{}, errors.New("Query parameter \"limit\" must be between 1 and 1000")
+		}
+		opts.limit = int32(n)
+	}
+
+	if cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return listOptions{}, errors.New("Query parameter \"cursor\" is invalid")
+		}
+		opts.after = after
+	}
+
+	if includeValues != "" {
+		include, err := strconv.ParseBool(includeValues)
+		if err != nil {
+			return listOptions{}, errors.New("Query parameter \"include_values\" must be true or false")
+		}
+		opts.includeValues = include
+	}
+
+	return opts, nil
+}
+
+// encodeCursor turns the last key of a page into an opaque cursor
+func encodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+// decodeCursor returns the key a cursor points after
+func decodeCursor(cursor string) (string, error) {
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(key) == 0 {
+		return "", errors.New("invalid cursor")
+	}
+	return string(key), nil
+}
@@ -0,0 +1,45 @@
+package key_value
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseListOptions_Defaults(t *testing.T) {
+	opts, err := parseListOptions("feature/", "", "", "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, listOptions{prefix: "feature/", limit: defaultListLimit}, opts)
+}
+
+func TestParseListOptions(t *testing.T) {
+	opts, err := parseListOptions("", "10", encodeCursor("feature/b"), "true")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "feature/b", opts.after)
+	assert.Equal(t, int32(10), opts.limit)
+	assert.True(t, opts.includeValues)
+}
+
+func TestParseListOptions_Invalid(t *testing.T) {
+	tests := map[string][3]string{
+		"zero limit":     {"0", "", ""},
+		"limit too high": {"1001", "", ""},
+		"bad cursor":     {"", "!!", ""},
+		"bad include":    {"", "", "sometimes"},
+	}
+	for name, params := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseListOptions("", params[0], params[1], params[2])
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	key, err := decodeCursor(encodeCursor("config/db/host"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "config/db/host", key)
+}
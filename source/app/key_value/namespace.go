@@ -0,0 +1,155 @@
+package key_value
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	errs "person-service/errors"
+	"person-service/middleware"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// DefaultNamespace is used when a request does not name a namespace
+	DefaultNamespace = "default"
+
+	// NamespaceHeader selects the namespace of a key-value request
+	NamespaceHeader = "x-kv-namespace"
+
+	// echoNamespaceKey is the key used to store the resolved namespace in Echo context
+	echoNamespaceKey = "kv-namespace"
+)
+
+var namespacePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,62}$`)
+
+// Permission is the access an API key identity has to a namespace
+type Permission int
+
+const (
+	PermissionNone Permission = iota
+	PermissionRead
+	PermissionReadWrite
+)
+
+// Grants maps an API key identity to the permission it has on each namespace
+type Grants map[string]map[string]Permission
+
+// Permission returns the access identity has to namespace
+func (g Grants) Permission(identity, namespace string) Permission {
+	return g[identity][namespace]
+}
+
+// ParseGrants reads grants in the form
+//
+//	identity=namespace:rw,namespace:ro;identity=namespace:rw
+//
+// where rw allows reads and writes and ro only reads
+func ParseGrants(raw string) (Grants, error) {
+	grants := Grants{}
+	for _, entry := range strings.Split(raw, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		identity, namespaces, ok := strings.Cut(entry, "=")
+		identity = strings.TrimSpace(identity)
+		if !ok || identity == "" {
+			return nil, fmt.Errorf("grant %q must be identity=namespace:mode", entry)
+		}
+		if _, exists := grants[identity]; exists {
+			return nil, fmt.Errorf("identity %q is granted more than once", identity)
+		}
+
+		perms := map[string]Permission{}
+		for _, grant := range strings.Split(namespaces, ",") {
+			namespace, mode, _ := strings.Cut(strings.TrimSpace(grant), ":")
+			if !namespacePattern.MatchString(namespace) {
+				return nil, fmt.Errorf("invalid namespace %q for identity %q", namespace, identity)
+			}
+			switch mode {
+			case "rw":
+				perms[namespace] = PermissionReadWrite
+			case "ro":
+				perms[namespace] = PermissionRead
+			default:
+				return nil, fmt.Errorf("mode of namespace %q for identity %q must be rw or ro", namespace, identity)
+			}
+		}
+		grants[identity] = perms
+	}
+	return grants, nil
+}
+
+// LoadGrants reads the namespace grants from KV_NAMESPACE_GRANTS (see ParseGrants).
+// When it is unset both API keys may read and write the default namespace.
+func LoadGrants() (Grants, error) {
+	raw := os.Getenv("KV_NAMESPACE_GRANTS")
+	if strings.TrimSpace(raw) == "" {
+		return Grants{
+			middleware.APIKeyIdentityBlue:  {DefaultNamespace: PermissionReadWrite},
+			middleware.APIKeyIdentityGreen: {DefaultNamespace: PermissionReadWrite},
+		}, nil
+	}
+
+	grants, err := ParseGrants(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid KV_NAMESPACE_GRANTS: %w", err)
+	}
+	return grants, nil
+}
+
+// NamespaceMiddleware resolves the namespace of a request from the x-kv-namespace
+// header and checks that the caller's API key may access it: reads need ro or rw,
+// every other method needs rw. It must run after middleware.AuthMiddleware.
+func NamespaceMiddleware(grants Grants) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			namespace := c.Request().Header.Get(NamespaceHeader)
+			if namespace == "" {
+				namespace = DefaultNamespace
+			}
+			if !namespacePattern.MatchString(namespace) {
+				return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+					Message:   "Invalid namespace in header \"" + NamespaceHeader + "\"",
+					ErrorCode: errs.ErrKVInvalidNamespace,
+				})
+			}
+
+			required := PermissionReadWrite
+			if method := c.Request().Method; method == http.MethodGet || method == http.MethodHead {
+				required = PermissionRead
+			}
+
+			granted := grants.Permission(middleware.APIKeyIdentity(c), namespace)
+			if granted == PermissionNone {
+				return c.JSON(http.StatusForbidden, errs.ErrorResponse{
+					Message:   "API key has no access to namespace \"" + namespace + "\"",
+					ErrorCode: errs.ErrKVNamespaceForbidden,
+				})
+			}
+			if granted < required {
+				return c.JSON(http.StatusForbidden, errs.ErrorResponse{
+					Message:   "API key may only read namespace \"" + namespace + "\"",
+					ErrorCode: errs.ErrKVNamespaceReadOnly,
+				})
+			}
+
+			c.Set(echoNamespaceKey, namespace)
+			return next(c)
+		}
+	}
+}
+
+// namespaceOf returns the namespace resolved by NamespaceMiddleware,
+// or the default namespace when the middleware did not run
+func namespaceOf(c echo.Context) string {
+	if namespace, ok := c.Get(echoNamespaceKey).(string); ok {
+		return namespace
+	}
+	return DefaultNamespace
+}
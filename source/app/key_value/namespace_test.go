@@ -0,0 +1,142 @@
+package key_value
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	db "person-service/internal/db/generated"
+	"person-service/internal/testdb"
+	"person-service/middleware"
+)
+
+func TestParseGrants(t *testing.T) {
+	grants, err := ParseGrants("blue=orders:rw,shared:ro; green=billing:rw")
+	assert.NoError(t, err)
+	assert.Equal(t, PermissionReadWrite, grants.Permission("blue", "orders"))
+	assert.Equal(t, PermissionRead, grants.Permission("blue", "shared"))
+	assert.Equal(t, PermissionNone, grants.Permission("blue", "billing"))
+	assert.Equal(t, PermissionReadWrite, grants.Permission("green", "billing"))
+	assert.Equal(t, PermissionNone, grants.Permission("unknown", "orders"))
+}
+
+func TestParseGrants_Invalid(t *testing.T) {
+	for _, raw := range []string{
+		"orders:rw",
+		"=orders:rw",
+		"blue=orders",
+		"blue=orders:admin",
+		"blue=Orders:rw",
+		"blue=:rw",
+		"blue=orders:rw;blue=shared:ro",
+	} {
+		_, err := ParseGrants(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestLoadGrants_Default(t *testing.T) {
+	os.Unsetenv("KV_NAMESPACE_GRANTS")
+
+	grants, err := LoadGrants()
+	assert.NoError(t, err)
+	assert.Equal(t, PermissionReadWrite, grants.Permission(middleware.APIKeyIdentityBlue, DefaultNamespace))
+	assert.Equal(t, PermissionReadWrite, grants.Permission(middleware.APIKeyIdentityGreen, DefaultNamespace))
+	assert.Equal(t, PermissionNone, grants.Permission(middleware.APIKeyIdentityBlue, "orders"))
+}
+
+func TestLoadGrants_Invalid(t *testing.T) {
+	os.Setenv("KV_NAMESPACE_GRANTS", "blue=orders")
+	defer os.Unsetenv("KV_NAMESPACE_GRANTS")
+
+	_, err := LoadGrants()
+	assert.Error(t, err)
+}
+
+func TestNamespaceMiddleware(t *testing.T) {
+	grants := Grants{
+		middleware.APIKeyIdentityBlue: {"orders": PermissionReadWrite, "shared": PermissionRead},
+	}
+	handler := NamespaceMiddleware(grants)(func(c echo.Context) error {
+		return c.String(http.StatusOK, namespaceOf(c))
+	})
+
+	tests := []struct {
+		name      string
+		method    string
+		identity  string
+		namespace string
+		status    int
+		errorCode string
+	}{
+		{"read write namespace", http.MethodPost, middleware.APIKeyIdentityBlue, "orders", http.StatusOK, ""},
+		{"read only namespace read", http.MethodGet, middleware.APIKeyIdentityBlue, "shared", http.StatusOK, ""},
+		{"read only namespace write", http.MethodDelete, middleware.APIKeyIdentityBlue, "shared", http.StatusForbidden, "KV_302_NAMESPACE_READ_ONLY"},
+		{"namespace not granted", http.MethodGet, middleware.APIKeyIdentityBlue, "billing", http.StatusForbidden, "KV_301_NAMESPACE_FORBIDDEN"},
+		{"default namespace not granted", http.MethodGet, middleware.APIKeyIdentityBlue, "", http.StatusForbidden, "KV_301_NAMESPACE_FORBIDDEN"},
+		{"identity not granted", http.MethodGet, middleware.APIKeyIdentityGreen, "orders", http.StatusForbidden, "KV_301_NAMESPACE_FORBIDDEN"},
+		{"not authenticated", http.MethodGet, "", "orders", http.StatusForbidden, "KV_301_NAMESPACE_FORBIDDEN"},
+		{"invalid namespace", http.MethodGet, middleware.APIKeyIdentityBlue, "../orders", http.StatusBadRequest, "KV_009_INVALID_NAMESPACE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(tt.method, "/api/key-value", nil)
+			if tt.namespace != "" {
+				req.Header.Set(NamespaceHeader, tt.namespace)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			if tt.identity != "" {
+				c.Set(middleware.EchoAPIKeyIdentityKey, tt.identity)
+			}
+
+			assert.NoError(t, handler(c))
+			assert.Equal(t, tt.status, rec.Code)
+			if tt.errorCode != "" {
+				assert.Contains(t, rec.Body.String(), tt.errorCode)
+			} else {
+				assert.Equal(t, tt.namespace, rec.Body.String())
+			}
+		})
+	}
+}
+
+// TestNamespaces_AreIsolated tests that the same key is independent in two namespaces
+func TestNamespaces_AreIsolated(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	handler := NewKeyValueHandler(db.New(pool))
+
+	for _, namespace := range []string{"team-a", "team-b"} {
+		c, rec := newSetValueContext(`{"key":"shared-key","value":"value-` + namespace + `"}`)
+		c.Set(echoNamespaceKey, namespace)
+		assert.NoError(t, handler.SetValue(c))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	}
+
+	c, rec := newGetValueContext("shared-key")
+	c.Set(echoNamespaceKey, "team-a")
+	assert.NoError(t, handler.GetValue(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"value":"value-team-a"`)
+	assert.Contains(t, rec.Body.String(), `"namespace":"team-a"`)
+
+	// The default namespace does not see either key
+	c, rec = newGetValueContext("shared-key")
+	assert.NoError(t, handler.GetValue(c))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	c, rec = newListContext("/api/key-value?include_values=true")
+	c.Set(echoNamespaceKey, "team-b")
+	assert.NoError(t, handler.ListValues(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"value":"value-team-b"`)
+	assert.NotContains(t, rec.Body.String(), "value-team-a")
+}
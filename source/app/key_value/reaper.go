@@ -0,0 +1,120 @@
+package key_value
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	errs "person-service/errors"
+	db "person-service/internal/db/generated"
+	"person-service/logging"
+)
+
+const (
+	defaultReaperInterval  = 1 * time.Minute
+	defaultReaperBatchSize = 500
+)
+
+// ReaperConfig controls how often expired keys are deleted
+type ReaperConfig struct {
+	// Interval is the time between two reaper runs
+	Interval time.Duration
+	// BatchSize is the maximum number of keys deleted per statement
+	BatchSize int32
+}
+
+// LoadReaperConfig reads the reaper settings from environment variables:
+//   - KV_REAPER_INTERVAL: Go duration between runs (default 1m)
+//   - KV_REAPER_BATCH_SIZE: keys deleted per statement (default 500)
+func LoadReaperConfig() (ReaperConfig, error) {
+	cfg := ReaperConfig{
+		Interval:  defaultReaperInterval,
+		BatchSize: defaultReaperBatchSize,
+	}
+
+	if raw := os.Getenv("KV_REAPER_INTERVAL"); raw != "" {
+		interval, err := time.ParseDuration(raw)
+		if err != nil || interval <= 0 {
+			return ReaperConfig{}, fmt.Errorf("invalid KV_REAPER_INTERVAL %q", raw)
+		}
+		cfg.Interval = interval
+	}
+
+	if raw := os.Getenv("KV_REAPER_BATCH_SIZE"); raw != "" {
+		batchSize, err := strconv.Atoi(raw)
+		if err != nil || batchSize <= 0 || batchSize > math.MaxInt32 {
+			return ReaperConfig{}, fmt.Errorf("invalid KV_REAPER_BATCH_SIZE %q", raw)
+		}
+		cfg.BatchSize = int32(batchSize)
+	}
+
+	return cfg, nil
+}
+
+// Reaper deletes expired keys in the background.
+// Reads already ignore expired keys, so the reaper only reclaims storage.
+type Reaper struct {
+	queries *db.Queries
+	cfg     ReaperConfig
+
+	reaped atomic.Int64
+}
+
+// NewReaper creates a reaper for the given queries and settings
+func NewReaper(queries *db.Queries, cfg ReaperConfig) *Reaper {
+	return &Reaper{
+		queries: queries,
+		cfg:     cfg,
+	}
+}
+
+// Reap deletes every key that has expired, in batches, and returns how many were deleted
+func (r *Reaper) Reap(ctx context.Context) (int64, error) {
+	var total int64
+	for {
+		deleted, err := r.queries.DeleteExpiredKeyValues(ctx, r.cfg.BatchSize)
+		total += deleted
+		r.reaped.Add(deleted)
+		if err != nil {
+			return total, err
+		}
+		if deleted < int64(r.cfg.BatchSize) || ctx.Err() != nil {
+			return total, nil
+		}
+	}
+}
+
+// Reaped returns the number of expired keys deleted since the process started
+func (r *Reaper) Reaped() int64 {
+	return r.reaped.Load()
+}
+
+// Start runs the reaper immediately and then every configured interval until ctx is done
+func (r *Reaper) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(r.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			deleted, err := r.Reap(ctx)
+			if err != nil && ctx.Err() == nil {
+				logging.ErrorContext(ctx, "Failed to delete expired keys",
+					"error", err,
+					"deleted", deleted,
+					"error_code", errs.ErrKVFailedReapExpired)
+			} else if deleted > 0 {
+				logging.InfoContext(ctx, "Deleted expired keys", "deleted", deleted)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,74 @@
+package key_value
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	db "person-service/internal/db/generated"
+	"person-service/internal/testdb"
+)
+
+func TestReaper_DeletesExpiredKeysInBatches(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	_, err := pool.Exec(ctx, `
+		INSERT INTO key_value (key, value, expires_at)
+		SELECT 'expired-' || i, 'v', now() - interval '1 minute'
+		FROM generate_series(1, 5) AS i
+	`)
+	assert.NoError(t, err)
+	_, err = pool.Exec(ctx, `
+		INSERT INTO key_value (key, value, expires_at)
+		VALUES ('live-ttl', 'v', now() + interval '1 hour'), ('permanent', 'v', NULL)
+	`)
+	assert.NoError(t, err)
+
+	reaper := NewReaper(db.New(pool), ReaperConfig{Interval: time.Minute, BatchSize: 2})
+	deleted, err := reaper.Reap(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), deleted)
+	assert.Equal(t, int64(5), reaper.Reaped())
+
+	var remaining int
+	assert.NoError(t, pool.QueryRow(ctx, `SELECT COUNT(*) FROM key_value`).Scan(&remaining))
+	assert.Equal(t, 2, remaining)
+}
+
+func TestLoadReaperConfig(t *testing.T) {
+	t.Setenv("KV_REAPER_INTERVAL", "")
+	t.Setenv("KV_REAPER_BATCH_SIZE", "")
+
+	cfg, err := LoadReaperConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, defaultReaperInterval, cfg.Interval)
+	assert.Equal(t, int32(defaultReaperBatchSize), cfg.BatchSize)
+
+	t.Setenv("KV_REAPER_INTERVAL", "30s")
+	t.Setenv("KV_REAPER_BATCH_SIZE", "100")
+
+	cfg, err = LoadReaperConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, cfg.Interval)
+	assert.Equal(t, int32(100), cfg.BatchSize)
+}
+
+func TestLoadReaperConfig_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"KV_REAPER_INTERVAL":   "-1m",
+		"KV_REAPER_BATCH_SIZE": "zero",
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			_, err := LoadReaperConfig()
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), name)
+		})
+	}
+}
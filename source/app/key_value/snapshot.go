@@ -0,0 +1,470 @@
+package key_value
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	errs "person-service/errors"
+	db "person-service/internal/db/generated"
+	"person-service/logging"
+	"person-service/metrics"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+// Modes of a snapshot import
+const (
+	// ImportModeMerge writes the keys of the snapshot and keeps every other key
+	ImportModeMerge = "merge"
+	// ImportModeReplace also deletes the keys under the prefix that are not in the snapshot
+	ImportModeReplace = "replace"
+)
+
+const (
+	// exportBatchSize is the number of keys read per query while exporting
+	exportBatchSize = 500
+
+	// maxSnapshotEntries bounds the number of keys of an imported snapshot
+	maxSnapshotEntries = 10000
+
+	// snapshotContentType is the media type of JSON Lines snapshots
+	snapshotContentType = "application/x-ndjson"
+)
+
+// SnapshotEntry is one line of a JSON Lines snapshot. Text values are in value,
+// binary values in data (base64) along with their content_type. Values are exported
+// decrypted so a snapshot can be restored where another encryption key is in use;
+// encrypted asks the import to store the value encrypted again.
+type SnapshotEntry struct {
+	Key         string     `json:"key"`
+	Value       string     `json:"value,omitempty"`
+	ContentType string     `json:"content_type,omitempty"`
+	Data        []byte     `json:"data,omitempty"`
+	Encrypted   bool       `json:"encrypted,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// ImportResult lists the keys an import created, updated, left unchanged or deleted.
+// Entries that expired since the snapshot was taken are skipped.
+type ImportResult struct {
+	Created   []string `json:"created"`
+	Updated   []string `json:"updated"`
+	Unchanged []string `json:"unchanged"`
+	Deleted   []string `json:"deleted"`
+	Expired   []string `json:"expired"`
+}
+
+// Export handles GET /api/key-value/_export?prefix= - streams every live key of the
+// namespace starting with prefix as a JSON Lines snapshot, in key order
+func (h *KeyValueHandler) Export(c echo.Context) error {
+	prefix := c.QueryParam("prefix")
+	namespace := namespaceOf(c)
+
+	// Use request context for trace propagation
+	ctx := c.Request().Context()
+
+	res := c.Response()
+	export := func(queries *db.Queries) error {
+		encoder := json.NewEncoder(res)
+		return eachSnapshotPage(ctx, queries, h.encryption.key, namespace, prefix, func(rows []db.ExportKeyValuesRow) error {
+			// Headers are sent with the first page so a failing first read can still be reported
+			if !res.Committed {
+				res.Header().Set(echo.HeaderContentType, snapshotContentType)
+				res.Header().Set(echo.HeaderContentDisposition,
+					fmt.Sprintf("attachment; filename=%q", "key-value-"+namespace+".jsonl"))
+				res.Header().Set("Cache-Control", "no-store")
+				res.WriteHeader(http.StatusOK)
+			}
+			for _, row := range rows {
+				if err := encoder.Encode(snapshotEntry(row)); err != nil {
+					return err
+				}
+			}
+			res.Flush()
+			return nil
+		})
+	}
+
+	// Read all pages in one repeatable read transaction so the snapshot is consistent
+	var err error
+	if h.pool != nil {
+		err = pgx.BeginTxFunc(ctx, h.pool, pgx.TxOptions{
+			IsoLevel:   pgx.RepeatableRead,
+			AccessMode: pgx.ReadOnly,
+		}, func(tx pgx.Tx) error {
+			return export(h.queries.WithTx(tx))
+		})
+	} else {
+		err = export(h.queries)
+	}
+
+	if err != nil && !res.Committed {
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to export keys",
+			ErrorCode: errs.ErrKVFailedExport,
+		})
+	}
+	// The status line is already sent, so a failure can only be logged
+	if err != nil {
+		logging.ErrorContext(ctx, "Failed to stream key-value export",
+			"error", err,
+			"namespace", namespace,
+			"error_code", errs.ErrKVFailedExport)
+		return nil
+	}
+
+	// An empty snapshot has no page to send the headers with
+	if !res.Committed {
+		res.Header().Set(echo.HeaderContentType, snapshotContentType)
+		res.WriteHeader(http.StatusOK)
+	}
+	return nil
+}
+
+// Import handles POST /api/key-value/_import?mode=&prefix=&dry_run= - restores a JSON Lines
+// snapshot into the namespace in one transaction. mode is merge (default) or replace;
+// with dry_run=true nothing is written and the response only reports the differences.
+func (h *KeyValueHandler) Import(c echo.Context) error {
+	if h.pool == nil {
+		return c.JSON(http.StatusServiceUnavailable, errs.ErrorResponse{
+			Message:   "Transactions are not available",
+			ErrorCode: errs.ErrKVTransactionsUnavailable,
+		})
+	}
+
+	mode := c.QueryParam("mode")
+	if mode == "" {
+		mode = ImportModeMerge
+	}
+	if mode != ImportModeMerge && mode != ImportModeReplace {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   fmt.Sprintf("Query parameter \"mode\" must be %s or %s", ImportModeMerge, ImportModeReplace),
+			ErrorCode: errs.ErrKVInvalidImportParams,
+		})
+	}
+
+	dryRun := false
+	if raw := c.QueryParam("dry_run"); raw != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(raw)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+				Message:   "Query parameter \"dry_run\" must be true or false",
+				ErrorCode: errs.ErrKVInvalidImportParams,
+			})
+		}
+	}
+
+	prefix := c.QueryParam("prefix")
+	body := http.MaxBytesReader(c.Response(), c.Request().Body, h.limits.MaxSnapshotBytes)
+	entries, err := readSnapshot(body, prefix, h.limits.MaxBytes)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return c.JSON(http.StatusRequestEntityTooLarge, errs.ErrorResponse{
+			Message:   fmt.Sprintf("Snapshot must be at most %d bytes", tooLarge.Limit),
+			ErrorCode: errs.ErrKVSnapshotTooLarge,
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   err.Error(),
+			ErrorCode: errs.ErrKVInvalidSnapshot,
+		})
+	}
+
+	// Use request context for trace propagation
+	ctx := c.Request().Context()
+	namespace := namespaceOf(c)
+
+	var result ImportResult
+	err = pgx.BeginFunc(ctx, h.pool, func(tx pgx.Tx) error {
+		var txErr error
+		result, txErr = applySnapshot(ctx, h.queries.WithTx(tx), h.encryption, namespace, prefix, mode, entries, dryRun, time.Now())
+		return txErr
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to import keys",
+			ErrorCode: errs.ErrKVFailedImport,
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"namespace": namespace,
+		"prefix":    prefix,
+		"mode":      mode,
+		"dry_run":   dryRun,
+		"created":   result.Created,
+		"updated":   result.Updated,
+		"unchanged": result.Unchanged,
+		"deleted":   result.Deleted,
+		"expired":   result.Expired,
+	})
+}
+
+// eachSnapshotPage calls fn with every live key of namespace starting with prefix, page by page
+func eachSnapshotPage(ctx context.Context, queries *db.Queries, encKey, namespace, prefix string, fn func([]db.ExportKeyValuesRow) error) error {
+	after := ""
+	for {
+		rows, err := queries.ExportKeyValues(ctx, db.ExportKeyValuesParams{
+			EncKey:    encKey,
+			Namespace: namespace,
+			Prefix:    prefix,
+			AfterKey:  after,
+			RowLimit:  exportBatchSize,
+		})
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if row.Encrypted {
+				metrics.CountCryptoOperations(metrics.OperationDecrypt, 1)
+			}
+		}
+		if len(rows) > 0 {
+			if err := fn(rows); err != nil {
+				return err
+			}
+		}
+		if len(rows) < exportBatchSize {
+			return nil
+		}
+		after = rows[len(rows)-1].Key
+	}
+}
+
+// snapshotEntry converts an exported row to a snapshot line
+func snapshotEntry(row db.ExportKeyValuesRow) SnapshotEntry {
+	entry := SnapshotEntry{
+		Key:       row.Key,
+		Value:     row.PlainValue,
+		Encrypted: row.Encrypted,
+	}
+	if row.ContentType.Valid {
+		entry.ContentType = row.ContentType.String
+		entry.Data = row.PlainData
+	}
+	if row.ExpiresAt.Valid {
+		expiresAt := row.ExpiresAt.Time
+		entry.ExpiresAt = &expiresAt
+	}
+	return entry
+}
+
+// readErrorRecorder remembers the last error its reader returned besides io.EOF
+type readErrorRecorder struct {
+	io.Reader
+	err error
+}
+
+func (r *readErrorRecorder) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// readSnapshot parses and validates a JSON Lines snapshot. Blank lines are ignored.
+// An *http.MaxBytesError of r is returned as is.
+func readSnapshot(r io.Reader, prefix string, maxValueBytes int64) ([]SnapshotEntry, error) {
+	src := &readErrorRecorder{Reader: r}
+	entries, err := scanSnapshot(src, prefix, maxValueBytes)
+	// The line cut off at the limit fails to parse before the scanner reports the error
+	var tooLarge *http.MaxBytesError
+	if errors.As(src.err, &tooLarge) {
+		return nil, src.err
+	}
+	return entries, err
+}
+
+// scanSnapshot parses and validates the lines of a snapshot
+func scanSnapshot(r io.Reader, prefix string, maxValueBytes int64) ([]SnapshotEntry, error) {
+	// A line holds at most one base64 encoded value and its fields
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), base64.StdEncoding.EncodedLen(int(maxValueBytes))+64*1024)
+
+	var entries []SnapshotEntry
+	seen := map[string]bool{}
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+
+		var entry SnapshotEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return nil, fmt.Errorf("line %d: invalid JSON", line)
+		}
+		if err := validateSnapshotEntry(entry, prefix, maxValueBytes); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if seen[entry.Key] {
+			return nil, fmt.Errorf("line %d: key %q appears more than once", line, entry.Key)
+		}
+		if len(entries) == maxSnapshotEntries {
+			return nil, fmt.Errorf("Snapshot must contain at most %d keys", maxSnapshotEntries)
+		}
+		seen[entry.Key] = true
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, fmt.Errorf("line %d: line is too long", line+1)
+		}
+		return nil, errors.New("Failed to read snapshot")
+	}
+	return entries, nil
+}
+
+func validateSnapshotEntry(entry SnapshotEntry, prefix string, maxValueBytes int64) error {
+	if entry.Key == "" {
+		return errors.New("Field \"key\" is required")
+	}
+	if !strings.HasPrefix(entry.Key, prefix) {
+		return fmt.Errorf("key %q does not start with prefix %q", entry.Key, prefix)
+	}
+
+	size := len(entry.Value)
+	if entry.ContentType != "" {
+		if entry.Value != "" || len(entry.Data) == 0 {
+			return errors.New("Binary values need \"data\" and no \"value\"")
+		}
+		size = len(entry.Data)
+	} else if entry.Value == "" || len(entry.Data) > 0 {
+		return errors.New("Text values need \"value\"; \"data\" requires \"content_type\"")
+	}
+	if int64(size) > maxValueBytes {
+		return fmt.Errorf("value of key %q must be at most %d bytes", entry.Key, maxValueBytes)
+	}
+	return nil
+}
+
+// applySnapshot compares the snapshot with the keys of namespace starting with prefix and,
+// unless dryRun, writes what differs. In replace mode keys missing from the snapshot are deleted.
+// Must be called with transaction-bound queries.
+func applySnapshot(ctx context.Context, qtx *db.Queries, enc encryption, namespace, prefix, mode string, entries []SnapshotEntry, dryRun bool, now time.Time) (ImportResult, error) {
+	result := ImportResult{
+		Created:   []string{},
+		Updated:   []string{},
+		Unchanged: []string{},
+		Deleted:   []string{},
+		Expired:   []string{},
+	}
+
+	keys := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		keys = append(keys, entry.Key)
+	}
+	if err := qtx.LockKeyValues(ctx, db.LockKeyValuesParams{
+		Namespace: namespace,
+		Keys:      keys,
+	}); err != nil {
+		return ImportResult{}, err
+	}
+
+	var current []db.ExportKeyValuesRow
+	if err := eachSnapshotPage(ctx, qtx, enc.key, namespace, prefix, func(rows []db.ExportKeyValuesRow) error {
+		current = append(current, rows...)
+		return nil
+	}); err != nil {
+		return ImportResult{}, err
+	}
+	existing := make(map[string]db.ExportKeyValuesRow, len(current))
+	for _, row := range current {
+		existing[row.Key] = row
+	}
+
+	imported := map[string]bool{}
+	for _, entry := range entries {
+		if entry.ExpiresAt != nil && !entry.ExpiresAt.After(now) {
+			result.Expired = append(result.Expired, entry.Key)
+			continue
+		}
+		imported[entry.Key] = true
+
+		row, exists := existing[entry.Key]
+		switch {
+		case !exists:
+			result.Created = append(result.Created, entry.Key)
+		case sameEntry(row, entry, enc.required(namespace)):
+			result.Unchanged = append(result.Unchanged, entry.Key)
+			continue
+		default:
+			result.Updated = append(result.Updated, entry.Key)
+		}
+		if dryRun {
+			continue
+		}
+
+		w := writeRequest{
+			namespace: namespace,
+			key:       entry.Key,
+			value:     entry.Value,
+			encrypted: entry.Encrypted,
+		}
+		if entry.ContentType != "" {
+			w.contentType = pgtype.Text{String: entry.ContentType, Valid: true}
+			w.data = entry.Data
+		}
+		if entry.ExpiresAt != nil {
+			w.ttl = pgtype.Int8{Int64: remainingTTL(*entry.ExpiresAt, now), Valid: true}
+		}
+		if _, err := writeValue(ctx, qtx, enc, w); err != nil {
+			return ImportResult{}, err
+		}
+	}
+
+	if mode == ImportModeReplace {
+		for _, row := range current {
+			if imported[row.Key] {
+				continue
+			}
+			result.Deleted = append(result.Deleted, row.Key)
+			if dryRun {
+				continue
+			}
+			if err := qtx.DeleteValue(ctx, db.DeleteValueParams{
+				Namespace: namespace,
+				Key:       row.Key,
+			}); err != nil {
+				return ImportResult{}, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// expiryTolerance is how far the expiry of a stored key may be from the one of
+// a snapshot entry and still match it. Imports store the expiry as a TTL in whole
+// seconds counted from the database clock, so it only matches to a second or so.
+const expiryTolerance = 2 * time.Second
+
+// sameEntry reports whether a stored key already matches a snapshot entry
+func sameEntry(row db.ExportKeyValuesRow, entry SnapshotEntry, encryptionRequired bool) bool {
+	if row.ContentType.String != entry.ContentType || row.PlainValue != entry.Value || !bytes.Equal(row.PlainData, entry.Data) {
+		return false
+	}
+	if row.Encrypted != (entry.Encrypted || encryptionRequired) {
+		return false
+	}
+	if !row.ExpiresAt.Valid || entry.ExpiresAt == nil {
+		return !row.ExpiresAt.Valid && entry.ExpiresAt == nil
+	}
+	return row.ExpiresAt.Time.Sub(*entry.ExpiresAt).Abs() <= expiryTolerance
+}
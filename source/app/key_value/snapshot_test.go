@@ -0,0 +1,247 @@
+package key_value
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	db "person-service/internal/db/generated"
+	"person-service/internal/testdb"
+)
+
+func TestReadSnapshot(t *testing.T) {
+	snapshot := `{"key":"app/name","value":"person-service"}
+
+{"key":"app/logo","content_type":"image/png","data":"AP8Q","encrypted":true,"expires_at":"2030-01-01T00:00:00Z"}
+`
+	entries, err := readSnapshot(strings.NewReader(snapshot), "app/", 1024)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, "person-service", entries[0].Value)
+		assert.Equal(t, []byte{0x00, 0xff, 0x10}, entries[1].Data)
+		assert.True(t, entries[1].Encrypted)
+		assert.Equal(t, 2030, entries[1].ExpiresAt.Year())
+	}
+}
+
+func TestReadSnapshot_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		snapshot string
+		message  string
+	}{
+		{"invalid JSON", `{"key":`, "line 1: invalid JSON"},
+		{"missing key", `{"value":"v"}`, "line 1: Field \"key\" is required"},
+		{"outside prefix", `{"key":"other","value":"v"}`, "does not start with prefix"},
+		{"missing value", `{"key":"app/a"}`, "Text values need"},
+		{"data without content type", `{"key":"app/a","data":"AP8Q"}`, "Text values need"},
+		{"binary without data", `{"key":"app/a","content_type":"image/png"}`, "Binary values need"},
+		{"binary with value", `{"key":"app/a","content_type":"text/plain","value":"v","data":"AP8Q"}`, "Binary values need"},
+		{"value too large", `{"key":"app/a","value":"0123456789"}`, "at most 8 bytes"},
+		{"duplicate key", "{\"key\":\"app/a\",\"value\":\"1\"}\n{\"key\":\"app/a\",\"value\":\"2\"}", "line 2: key \"app/a\" appears more than once"},
+		{"line too long", `{"key":"app/a","value":"` + strings.Repeat("v", 70*1024) + `"}`, "line 1: line is too long"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readSnapshot(strings.NewReader(tt.snapshot), "app/", 8)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.message)
+			}
+		})
+	}
+}
+
+func TestReadSnapshot_BodyLimit(t *testing.T) {
+	snapshot := strings.Repeat(`{"key":"app/a","value":"v"}`+"\n", 4)
+	body := http.MaxBytesReader(httptest.NewRecorder(), io.NopCloser(strings.NewReader(snapshot)), 40)
+
+	_, err := readSnapshot(body, "app/", 1024)
+
+	var tooLarge *http.MaxBytesError
+	assert.ErrorAs(t, err, &tooLarge)
+}
+
+func TestSameEntry(t *testing.T) {
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	row := db.ExportKeyValuesRow{
+		Key:        "k",
+		PlainValue: "v",
+		ExpiresAt:  pgtype.Timestamptz{Time: expiresAt, Valid: true},
+	}
+
+	assert.True(t, sameEntry(row, SnapshotEntry{Key: "k", Value: "v", ExpiresAt: &expiresAt}, false))
+	assert.False(t, sameEntry(row, SnapshotEntry{Key: "k", Value: "w", ExpiresAt: &expiresAt}, false))
+	assert.False(t, sameEntry(row, SnapshotEntry{Key: "k", Value: "v"}, false))
+	assert.False(t, sameEntry(row, SnapshotEntry{Key: "k", Value: "v", ExpiresAt: &expiresAt, Encrypted: true}, false))
+	assert.False(t, sameEntry(row, SnapshotEntry{Key: "k", Value: "v", ExpiresAt: &expiresAt}, true))
+
+	// An imported expiry is rounded to a TTL in whole seconds, so it only matches to a second or so
+	rounded := expiresAt.Add(-1500 * time.Millisecond)
+	assert.True(t, sameEntry(row, SnapshotEntry{Key: "k", Value: "v", ExpiresAt: &rounded}, false))
+	later := expiresAt.Add(time.Minute)
+	assert.False(t, sameEntry(row, SnapshotEntry{Key: "k", Value: "v", ExpiresAt: &later}, false))
+}
+
+func newImportContext(target, body string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, snapshotContentType)
+	rec := httptest.NewRecorder()
+	return e.NewContext(req, rec), rec
+}
+
+func TestImport_InvalidParams(t *testing.T) {
+	handler := NewKeyValueHandler(db.New(pool)).WithPool(pool)
+
+	tests := []struct {
+		target    string
+		body      string
+		errorCode string
+	}{
+		{"/api/key-value/_import?mode=overwrite", "", "KV_018_INVALID_IMPORT_PARAMS"},
+		{"/api/key-value/_import?dry_run=maybe", "", "KV_018_INVALID_IMPORT_PARAMS"},
+		{"/api/key-value/_import", `{"key":""}`, "KV_017_INVALID_SNAPSHOT"},
+	}
+	for _, tt := range tests {
+		c, rec := newImportContext(tt.target, tt.body)
+		assert.NoError(t, handler.Import(c))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, tt.target)
+		assert.Contains(t, rec.Body.String(), tt.errorCode, tt.target)
+	}
+}
+
+// TestImport_SnapshotTooLarge tests that snapshots above the limit are rejected before they are parsed
+func TestImport_SnapshotTooLarge(t *testing.T) {
+	handler := NewKeyValueHandler(db.New(pool)).WithPool(pool).
+		WithValueLimits(ValueLimits{MaxBytes: 1024, MaxSnapshotBytes: 40})
+	c, rec := newImportContext("/api/key-value/_import", strings.Repeat(`{"key":"app/a","value":"v"}`+"\n", 4))
+
+	assert.NoError(t, handler.Import(c))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Contains(t, rec.Body.String(), "KV_019_SNAPSHOT_TOO_LARGE")
+}
+
+// TestExportImport_RoundTrip tests that an export restores the same keys into another namespace
+func TestExportImport_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	handler := NewKeyValueHandler(db.New(pool)).WithPool(pool)
+
+	for _, body := range []string{
+		`{"key":"app/name","value":"person-service"}`,
+		`{"key":"app/token","value":"s3cret","encrypted":true}`,
+		`{"key":"app/ttl","value":"short-lived","ttl_seconds":3600}`,
+		`{"key":"other/key","value":"not exported"}`,
+	} {
+		c, rec := newSetValueContext(body)
+		assert.NoError(t, handler.SetValue(c))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	}
+	c, rec := newPutContext("app/logo", "/api/key-value/app/logo", []byte{0x00, 0xff}, "image/png")
+	assert.NoError(t, handler.PutValue(c))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	c, rec = newListContext("/api/key-value/_export?prefix=app/")
+	assert.NoError(t, handler.Export(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, snapshotContentType, rec.Header().Get(echo.HeaderContentType))
+	snapshot := rec.Body.String()
+	lines := strings.Split(strings.TrimSpace(snapshot), "\n")
+	assert.Len(t, lines, 4)
+	assert.Contains(t, snapshot, `"value":"s3cret","encrypted":true`)
+	assert.NotContains(t, snapshot, "not exported")
+
+	// Restoring into an empty namespace creates every key
+	c, rec = newImportContext("/api/key-value/_import", snapshot)
+	c.Set(echoNamespaceKey, "restored")
+	assert.NoError(t, handler.Import(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var result ImportResult
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, []string{"app/logo", "app/name", "app/token", "app/ttl"}, result.Created)
+
+	c, rec = newGetValueContext("app/token")
+	c.Set(echoNamespaceKey, "restored")
+	assert.NoError(t, handler.GetValue(c))
+	assert.Contains(t, rec.Body.String(), `"value":"s3cret"`)
+	assert.Contains(t, rec.Body.String(), `"encrypted":true`)
+
+	c, rec = newGetValueContext("app/logo")
+	c.Set(echoNamespaceKey, "restored")
+	assert.NoError(t, handler.GetValue(c))
+	assert.Equal(t, []byte{0x00, 0xff}, rec.Body.Bytes())
+
+	// Importing the snapshot into the namespace it was taken from changes nothing
+	c, rec = newImportContext("/api/key-value/_import", snapshot)
+	assert.NoError(t, handler.Import(c))
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Len(t, result.Unchanged, 4)
+	assert.Empty(t, result.Updated)
+
+	// Importing it again where it was restored changes nothing either, the rounded TTL included
+	c, rec = newImportContext("/api/key-value/_import", snapshot)
+	c.Set(echoNamespaceKey, "restored")
+	assert.NoError(t, handler.Import(c))
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Len(t, result.Unchanged, 4)
+	assert.Empty(t, result.Updated)
+}
+
+// TestImport_ReplaceDryRun tests that a dry run reports the differences without writing
+func TestImport_ReplaceDryRun(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	assert.NoError(t, testdb.InsertKeyValueDirect(ctx, pool, "cfg/a", "old"))
+	assert.NoError(t, testdb.InsertKeyValueDirect(ctx, pool, "cfg/b", "same"))
+	assert.NoError(t, testdb.InsertKeyValueDirect(ctx, pool, "cfg/c", "stale"))
+	assert.NoError(t, testdb.InsertKeyValueDirect(ctx, pool, "keep", "outside prefix"))
+	handler := NewKeyValueHandler(db.New(pool)).WithPool(pool)
+
+	snapshot := `{"key":"cfg/a","value":"new"}
+{"key":"cfg/b","value":"same"}
+{"key":"cfg/d","value":"added"}
+{"key":"cfg/e","value":"gone","expires_at":"2020-01-01T00:00:00Z"}
+`
+	c, rec := newImportContext("/api/key-value/_import?mode=replace&prefix=cfg/&dry_run=true", snapshot)
+	assert.NoError(t, handler.Import(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var result ImportResult
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, ImportResult{
+		Created:   []string{"cfg/d"},
+		Updated:   []string{"cfg/a"},
+		Unchanged: []string{"cfg/b"},
+		Deleted:   []string{"cfg/c"},
+		Expired:   []string{"cfg/e"},
+	}, result)
+
+	c, rec = newGetValueContext("cfg/a")
+	assert.NoError(t, handler.GetValue(c))
+	assert.Contains(t, rec.Body.String(), `"value":"old"`)
+
+	c, rec = newImportContext("/api/key-value/_import?mode=replace&prefix=cfg/", snapshot)
+	assert.NoError(t, handler.Import(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	c, rec = newGetValueContext("cfg/a")
+	assert.NoError(t, handler.GetValue(c))
+	assert.Contains(t, rec.Body.String(), `"value":"new"`)
+
+	c, rec = newGetValueContext("cfg/c")
+	assert.NoError(t, handler.GetValue(c))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	c, rec = newGetValueContext("keep")
+	assert.NoError(t, handler.GetValue(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,233 @@
+package key_value
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	db "person-service/internal/db/generated"
+	"person-service/metrics"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Operations of a transaction
+const (
+	TxnOpSet    = "set"
+	TxnOpDelete = "delete"
+	// TxnOpCheck only verifies a condition, so later operations can depend on other keys
+	TxnOpCheck = "check"
+)
+
+// maxTxnOperations bounds the number of operations of a transaction
+const maxTxnOperations = 100
+
+// TxnOperation is one operation of a transaction
+type TxnOperation struct {
+	Op    string `json:"op"`
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	// TTLSeconds expires a key written by a set operation
+	TTLSeconds *int64 `json:"ttl_seconds,omitempty"`
+	// IfVersion requires the key to be at this version
+	IfVersion *int64 `json:"if_version,omitempty"`
+	// IfAbsent requires the key not to exist (set and check only)
+	IfAbsent bool `json:"if_absent,omitempty"`
+	// Encrypted stores the value of a set operation encrypted at rest
+	Encrypted bool `json:"encrypted,omitempty"`
+}
+
+// TxnRequest represents the request body of a transaction
+type TxnRequest struct {
+	Operations []TxnOperation `json:"operations"`
+}
+
+// txnStep is a validated transaction operation
+type txnStep struct {
+	op        string
+	key       string
+	value     string
+	ttl       pgtype.Int8
+	cond      writeCondition
+	encrypted bool
+}
+
+// parseTxn validates the operations of a transaction
+func parseTxn(req TxnRequest) ([]txnStep, error) {
+	if len(req.Operations) == 0 {
+		return nil, errors.New("Field \"operations\" must contain at least one operation")
+	}
+	if len(req.Operations) > maxTxnOperations {
+		return nil, fmt.Errorf("Field \"operations\" must contain at most %d operations", maxTxnOperations)
+	}
+
+	steps := make([]txnStep, 0, len(req.Operations))
+	for i, op := range req.Operations {
+		step, err := parseTxnOperation(op)
+		if err != nil {
+			return nil, fmt.Errorf("operations[%d]: %w", i, err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func parseTxnOperation(op TxnOperation) (txnStep, error) {
+	if op.Key == "" {
+		return txnStep{}, errors.New("Field \"key\" is required")
+	}
+
+	cond, err := parseCondition(op.IfVersion, op.IfAbsent, "", "")
+	if err != nil {
+		return txnStep{}, err
+	}
+	step := txnStep{op: op.Op, key: op.Key, value: op.Value, cond: cond, encrypted: op.Encrypted}
+
+	switch op.Op {
+	case TxnOpSet:
+		if op.Value == "" {
+			return txnStep{}, errors.New("Field \"value\" is required for set")
+		}
+		step.ttl, err = parseTTL(op.TTLSeconds)
+		if err != nil {
+			return txnStep{}, err
+		}
+	case TxnOpDelete, TxnOpCheck:
+		if op.Value != "" || op.TTLSeconds != nil || op.Encrypted {
+			return txnStep{}, fmt.Errorf("Fields \"value\", \"ttl_seconds\" and \"encrypted\" are not allowed for %s", op.Op)
+		}
+		if op.Op == TxnOpDelete && cond.absent {
+			return txnStep{}, errors.New("Field \"if_absent\" is not allowed for delete")
+		}
+		if op.Op == TxnOpCheck && cond.version == nil && !cond.absent {
+			return txnStep{}, errors.New("Operation \"check\" requires \"if_version\" or \"if_absent\"")
+		}
+	default:
+		return txnStep{}, fmt.Errorf("Field \"op\" must be %s, %s or %s", TxnOpSet, TxnOpDelete, TxnOpCheck)
+	}
+	return step, nil
+}
+
+// txnConflictError reports the operation whose condition did not hold
+type txnConflictError struct {
+	index int
+	step  txnStep
+}
+
+func (e *txnConflictError) Error() string {
+	if e.step.cond.absent {
+		return fmt.Sprintf("operations[%d]: key %q already exists", e.index, e.step.key)
+	}
+	return fmt.Sprintf("operations[%d]: key %q is not at version %d", e.index, e.step.key, *e.step.cond.version)
+}
+
+// applyTxn runs the steps of a transaction in order and returns one result per step.
+// It stops at the first condition that does not hold with a *txnConflictError.
+// Must be called with transaction-bound queries.
+func applyTxn(ctx context.Context, qtx *db.Queries, enc encryption, namespace string, steps []txnStep) ([]map[string]interface{}, error) {
+	// Keys are locked in order, so transactions touching the same keys cannot deadlock.
+	// The advisory locks also cover absent keys, which a check may rely on staying absent.
+	keys := txnKeys(steps)
+	for _, key := range keys {
+		if err := qtx.LockKey(ctx, db.LockKeyParams{Namespace: namespace, Key: key}); err != nil {
+			return nil, err
+		}
+	}
+	if err := qtx.LockKeyValues(ctx, db.LockKeyValuesParams{
+		Namespace: namespace,
+		Keys:      keys,
+	}); err != nil {
+		return nil, err
+	}
+
+	results := make([]map[string]interface{}, 0, len(steps))
+	for i, step := range steps {
+		result, ok, err := applyTxnStep(ctx, qtx, enc, namespace, step)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, &txnConflictError{index: i, step: step}
+		}
+		result["op"] = step.op
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// applyTxnStep runs one step; ok is false when its condition does not hold
+func applyTxnStep(ctx context.Context, qtx *db.Queries, enc encryption, namespace string, step txnStep) (map[string]interface{}, bool, error) {
+	switch step.op {
+	case TxnOpSet:
+		record, err := writeValue(ctx, qtx, enc, writeRequest{
+			namespace: namespace,
+			key:       step.key,
+			value:     step.value,
+			encrypted: step.encrypted,
+			ttl:       step.ttl,
+			cond:      step.cond,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		record.Value = step.value
+		return keyValueResponse(record, time.Now()), true, nil
+
+	case TxnOpDelete:
+		if step.cond.version != nil {
+			deleted, err := qtx.DeleteValueWithVersion(ctx, db.DeleteValueWithVersionParams{
+				Namespace:       namespace,
+				Key:             step.key,
+				ExpectedVersion: *step.cond.version,
+			})
+			if err != nil || deleted == 0 {
+				return nil, false, err
+			}
+		} else if err := qtx.DeleteValue(ctx, db.DeleteValueParams{
+			Namespace: namespace,
+			Key:       step.key,
+		}); err != nil {
+			return nil, false, err
+		}
+		return map[string]interface{}{"key": step.key}, true, nil
+
+	default: // TxnOpCheck
+		row, err := qtx.GetKeyValue(ctx, db.GetKeyValueParams{
+			EncKey:    enc.key,
+			Namespace: namespace,
+			Key:       step.key,
+		})
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, false, err
+		}
+		countCrypto(metrics.OperationDecrypt, row.KeyValue)
+		version := versionOf(row.KeyValue, err)
+		if step.cond.absent && version != 0 {
+			return nil, false, nil
+		}
+		if step.cond.version != nil && version != *step.cond.version {
+			return nil, false, nil
+		}
+		return map[string]interface{}{"key": step.key, "version": version}, true, nil
+	}
+}
+
+// txnKeys returns the distinct keys of the steps in key order
+func txnKeys(steps []txnStep) []string {
+	seen := map[string]bool{}
+	keys := make([]string, 0, len(steps))
+	for _, step := range steps {
+		if !seen[step.key] {
+			seen[step.key] = true
+			keys = append(keys, step.key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
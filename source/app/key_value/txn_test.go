@@ -0,0 +1,163 @@
+package key_value
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	db "person-service/internal/db/generated"
+	"person-service/internal/testdb"
+)
+
+func TestParseTxn(t *testing.T) {
+	version := int64(3)
+	steps, err := parseTxn(TxnRequest{Operations: []TxnOperation{
+		{Op: TxnOpCheck, Key: "state", IfVersion: &version},
+		{Op: TxnOpSet, Key: "state", Value: "running", IfVersion: &version},
+		{Op: TxnOpDelete, Key: "lock"},
+	}})
+	assert.NoError(t, err)
+	assert.Len(t, steps, 3)
+	assert.Equal(t, int64(3), *steps[0].cond.version)
+	assert.Equal(t, []string{"lock", "state"}, txnKeys(steps))
+}
+
+func TestParseTxn_Invalid(t *testing.T) {
+	ttl := int64(60)
+	zero := int64(0)
+	tests := []struct {
+		name       string
+		operations []TxnOperation
+		message    string
+	}{
+		{"no operations", nil, "at least one operation"},
+		{"too many operations", make([]TxnOperation, maxTxnOperations+1), "at most 100"},
+		{"unknown op", []TxnOperation{{Op: "incr", Key: "k"}}, "operations[0]: Field \"op\""},
+		{"missing key", []TxnOperation{{Op: TxnOpSet, Value: "v"}}, "\"key\" is required"},
+		{"set without value", []TxnOperation{{Op: TxnOpSet, Key: "k"}}, "\"value\" is required"},
+		{"invalid ttl", []TxnOperation{{Op: TxnOpSet, Key: "k", Value: "v", TTLSeconds: &zero}}, "ttl_seconds"},
+		{"delete with value", []TxnOperation{{Op: TxnOpDelete, Key: "k", Value: "v"}}, "not allowed for delete"},
+		{"delete with ttl", []TxnOperation{{Op: TxnOpDelete, Key: "k", TTLSeconds: &ttl}}, "not allowed for delete"},
+		{"check encrypted", []TxnOperation{{Op: TxnOpCheck, Key: "k", IfAbsent: true, Encrypted: true}}, "not allowed for check"},
+		{"delete if absent", []TxnOperation{{Op: TxnOpDelete, Key: "k", IfAbsent: true}}, "if_absent"},
+		{"check without condition", []TxnOperation{{Op: TxnOpCheck, Key: "k"}}, "requires"},
+		{"two conditions", []TxnOperation{{Op: TxnOpSet, Key: "k", Value: "v", IfVersion: &ttl, IfAbsent: true}}, "Only one"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTxn(TxnRequest{Operations: tt.operations})
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.message)
+			}
+		})
+	}
+}
+
+func TestTxn_Unavailable(t *testing.T) {
+	handler := NewKeyValueHandler(db.New(pool))
+	c, rec := newPostContext("/api/key-value/_txn", `{"operations":[{"op":"delete","key":"k"}]}`)
+
+	assert.NoError(t, handler.Txn(c))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), "KV_214_TRANSACTIONS_UNAVAILABLE")
+}
+
+// TestTxn_AppliesAllOperations tests a state transition guarded by a check
+func TestTxn_AppliesAllOperations(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	assert.NoError(t, testdb.InsertKeyValueDirect(ctx, pool, "job/state", "pending"))
+	assert.NoError(t, testdb.InsertKeyValueDirect(ctx, pool, "job/lock", "worker-1"))
+	handler := NewKeyValueHandler(db.New(pool)).WithPool(pool)
+
+	c, rec := newPostContext("/api/key-value/_txn", `{"operations":[
+		{"op":"check","key":"job/state","if_version":1},
+		{"op":"set","key":"job/state","value":"running","if_version":1},
+		{"op":"set","key":"job/owner","value":"worker-2","if_absent":true},
+		{"op":"delete","key":"job/lock"}
+	]}`)
+	assert.NoError(t, handler.Txn(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"op":"check"`)
+
+	value, err := testdb.GetKeyValueDirect(ctx, pool, "job/state")
+	assert.NoError(t, err)
+	assert.Equal(t, "running", value)
+	value, err = testdb.GetKeyValueDirect(ctx, pool, "job/owner")
+	assert.NoError(t, err)
+	assert.Equal(t, "worker-2", value)
+	_, err = testdb.GetKeyValueDirect(ctx, pool, "job/lock")
+	assert.Error(t, err)
+}
+
+// TestTxn_ConflictRollsBack tests that no operation is applied when a condition fails
+func TestTxn_ConflictRollsBack(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	assert.NoError(t, testdb.InsertKeyValueDirect(ctx, pool, "job/state", "pending"))
+	handler := NewKeyValueHandler(db.New(pool)).WithPool(pool)
+
+	c, rec := newPostContext("/api/key-value/_txn", `{"operations":[
+		{"op":"set","key":"job/owner","value":"worker-2"},
+		{"op":"check","key":"job/state","if_version":7}
+	]}`)
+	assert.NoError(t, handler.Txn(c))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "KV_205_VERSION_CONFLICT")
+	assert.Contains(t, rec.Body.String(), "operations[1]")
+
+	_, err := testdb.GetKeyValueDirect(ctx, pool, "job/owner")
+	assert.Error(t, err, "set before the failed check must be rolled back")
+
+	c, rec = newPostContext("/api/key-value/_txn", `{"operations":[
+		{"op":"check","key":"job/state","if_absent":true}
+	]}`)
+	assert.NoError(t, handler.Txn(c))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "KV_206_KEY_EXISTS")
+}
+
+// TestTxn_ConcurrentChecksOfAbsentKeys tests that two transactions each checking
+// that the key written by the other is absent cannot both commit
+func TestTxn_ConcurrentChecksOfAbsentKeys(t *testing.T) {
+	ctx := context.Background()
+	handler := NewKeyValueHandler(db.New(pool)).WithPool(pool)
+
+	for round := 0; round < 20; round++ {
+		assert.NoError(t, testdb.TruncateTables(ctx, pool))
+
+		bodies := []string{
+			`{"operations":[{"op":"check","key":"shift/bob","if_absent":true},{"op":"set","key":"shift/alice","value":"off"}]}`,
+			`{"operations":[{"op":"check","key":"shift/alice","if_absent":true},{"op":"set","key":"shift/bob","value":"off"}]}`,
+		}
+		codes := make(chan int, len(bodies))
+		var wg sync.WaitGroup
+		for _, body := range bodies {
+			wg.Add(1)
+			go func(body string) {
+				defer wg.Done()
+				c, rec := newPostContext("/api/key-value/_txn", body)
+				assert.NoError(t, handler.Txn(c))
+				codes <- rec.Code
+			}(body)
+		}
+		wg.Wait()
+		close(codes)
+
+		var committed, conflicts int
+		for code := range codes {
+			switch code {
+			case http.StatusOK:
+				committed++
+			case http.StatusConflict:
+				conflicts++
+			}
+		}
+		assert.Equal(t, 1, committed, "round %d", round)
+		assert.Equal(t, 1, conflicts, "round %d", round)
+	}
+}
@@ -0,0 +1,268 @@
+package key_value
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	errs "person-service/errors"
+	"person-service/logging"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ChangeChannel is the Postgres notification channel written by the key_value trigger
+const ChangeChannel = "key_value_changes"
+
+// Operations reported in a Change
+const (
+	OpSet    = "set"
+	OpDelete = "delete"
+	// OpResync means changes may have been missed and watchers should re-read
+	OpResync = "resync"
+)
+
+const (
+	subscriptionBuffer = 64
+	maxReconnectDelay  = 30 * time.Second
+	defaultWatchWait   = 30 * time.Second
+	maxWatchWait       = 5 * time.Minute
+	// watchHeartbeat keeps idle event streams open through proxies
+	watchHeartbeat = 15 * time.Second
+)
+
+// Change is a write to a key reported by the database
+type Change struct {
+	Namespace string `json:"namespace,omitempty"`
+	Key       string `json:"key,omitempty"`
+	Version   int64  `json:"version,omitempty"`
+	Op        string `json:"op"`
+}
+
+// parseChange decodes a notification payload of the key_value trigger
+func parseChange(payload string) (Change, error) {
+	var change Change
+	if err := json.Unmarshal([]byte(payload), &change); err != nil {
+		return Change{}, err
+	}
+	return change, nil
+}
+
+// Subscription receives the changes of a key or of every key below a prefix
+// within one namespace
+type Subscription struct {
+	namespace string
+	key       string
+	prefix    bool
+	ch        chan Change
+	dropped   atomic.Bool
+	watcher   *Watcher
+	closeOne  sync.Once
+}
+
+// C returns the channel changes are delivered on. It is closed when the
+// subscription or the watcher is closed.
+func (s *Subscription) C() <-chan Change {
+	return s.ch
+}
+
+// Dropped reports, and resets, whether changes were dropped because the
+// subscriber did not keep up
+func (s *Subscription) Dropped() bool {
+	return s.dropped.Swap(false)
+}
+
+// Close stops the subscription
+func (s *Subscription) Close() {
+	s.watcher.unsubscribe(s)
+}
+
+// matches reports whether a change concerns this subscription
+func (s *Subscription) matches(change Change) bool {
+	if change.Op == OpResync {
+		return true
+	}
+	if change.Namespace != s.namespace {
+		return false
+	}
+	if s.prefix {
+		return strings.HasPrefix(change.Key, s.key)
+	}
+	return change.Key == s.key
+}
+
+// Watcher listens for key_value notifications on a dedicated connection and
+// fans them out to subscribers
+type Watcher struct {
+	pool *pgxpool.Pool
+
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewWatcher creates a watcher that takes its connection from the pool
+func NewWatcher(pool *pgxpool.Pool) *Watcher {
+	return &Watcher{
+		pool: pool,
+		subs: map[*Subscription]struct{}{},
+	}
+}
+
+// Subscribe returns a subscription to a single key of a namespace, or to every
+// key of the namespace starting with key when prefix is set
+func (w *Watcher) Subscribe(namespace, key string, prefix bool) *Subscription {
+	sub := &Subscription{
+		namespace: namespace,
+		key:       key,
+		prefix:    prefix,
+		ch:        make(chan Change, subscriptionBuffer),
+		watcher:   w,
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		close(sub.ch)
+		return sub
+	}
+	w.subs[sub] = struct{}{}
+	return sub
+}
+
+func (w *Watcher) unsubscribe(sub *Subscription) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.subs[sub]; ok {
+		delete(w.subs, sub)
+		sub.closeOne.Do(func() { close(sub.ch) })
+	}
+}
+
+// publish delivers a change to every matching subscription without blocking
+func (w *Watcher) publish(change Change) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for sub := range w.subs {
+		if !sub.matches(change) {
+			continue
+		}
+		select {
+		case sub.ch <- change:
+		default:
+			sub.dropped.Store(true)
+		}
+	}
+}
+
+// close ends every subscription; later subscriptions are closed immediately
+func (w *Watcher) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	for sub := range w.subs {
+		delete(w.subs, sub)
+		sub.closeOne.Do(func() { close(sub.ch) })
+	}
+}
+
+// Start listens for notifications until ctx is done, reconnecting with
+// backoff when the connection is lost. After a reconnect subscribers receive
+// a resync change because notifications may have been missed meanwhile.
+func (w *Watcher) Start(ctx context.Context) {
+	go func() {
+		defer w.close()
+
+		delay := time.Second
+		reconnecting := false
+		for {
+			err := w.listen(ctx, func() {
+				delay = time.Second
+				if reconnecting {
+					w.publish(Change{Op: OpResync})
+				}
+			})
+			if ctx.Err() != nil {
+				return
+			}
+			logging.ErrorContext(ctx, "Key-value watch connection lost",
+				"error", err,
+				"retry_in", delay.String(),
+				"error_code", errs.ErrKVWatchConnectionFailed)
+			reconnecting = true
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, maxReconnectDelay)
+		}
+	}()
+}
+
+// listen runs LISTEN on a connection taken out of the pool and publishes
+// notifications until an error occurs. onListening is called once LISTEN succeeded.
+func (w *Watcher) listen(ctx context.Context, onListening func()) error {
+	pooled, err := w.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The connection is kept for the lifetime of the listener, so it leaves the pool
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{ChangeChannel}.Sanitize()); err != nil {
+		return err
+	}
+	onListening()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		change, err := parseChange(notification.Payload)
+		if err != nil {
+			logging.WarnContext(ctx, "Ignoring malformed key-value notification", "error", err)
+			continue
+		}
+		w.publish(change)
+	}
+}
+
+// watchOptions are the query parameters of a watch request
+type watchOptions struct {
+	// index is the version the caller has seen, nil to wait for the next change
+	index *int64
+	wait  time.Duration
+}
+
+// parseWatchOptions validates the index and wait query parameters
+func parseWatchOptions(index, wait string) (watchOptions, error) {
+	opts := watchOptions{wait: defaultWatchWait}
+
+	if index != "" {
+		n, err := strconv.ParseInt(index, 10, 64)
+		if err != nil || n < 0 {
+			return watchOptions{}, errors.New("Query parameter \"index\" must be a version number")
+		}
+		opts.index = &n
+	}
+
+	if wait != "" {
+		d, err := time.ParseDuration(wait)
+		if err != nil || d <= 0 || d > maxWatchWait {
+			return watchOptions{}, errors.New("Query parameter \"wait\" must be a duration up to 5m")
+		}
+		opts.wait = d
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,185 @@
+package key_value
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	db "person-service/internal/db/generated"
+	"person-service/internal/testdb"
+)
+
+func TestParseChange(t *testing.T) {
+	change, err := parseChange(`{"namespace":"team-a","key":"feature/a","version":3,"op":"set"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, Change{Namespace: "team-a", Key: "feature/a", Version: 3, Op: OpSet}, change)
+
+	_, err = parseChange("not json")
+	assert.Error(t, err)
+}
+
+func TestWatcher_PublishMatchesSubscriptions(t *testing.T) {
+	watcher := NewWatcher(nil)
+	exact := watcher.Subscribe("team-a", "feature/a", false)
+	prefix := watcher.Subscribe("team-a", "feature/", true)
+	other := watcher.Subscribe("team-a", "config/", true)
+	otherNamespace := watcher.Subscribe("team-b", "feature/", true)
+	defer exact.Close()
+	defer prefix.Close()
+	defer other.Close()
+	defer otherNamespace.Close()
+
+	watcher.publish(Change{Namespace: "team-a", Key: "feature/a", Version: 2, Op: OpSet})
+	watcher.publish(Change{Namespace: "team-a", Key: "feature/b", Version: 1, Op: OpDelete})
+
+	assert.Equal(t, "feature/a", (<-exact.C()).Key)
+	assert.Equal(t, "feature/a", (<-prefix.C()).Key)
+	assert.Equal(t, "feature/b", (<-prefix.C()).Key)
+	assert.Empty(t, exact.C())
+	assert.Empty(t, other.C())
+	assert.Empty(t, otherNamespace.C())
+
+	// A resync reaches every subscription
+	watcher.publish(Change{Op: OpResync})
+	assert.Equal(t, OpResync, (<-other.C()).Op)
+}
+
+func TestWatcher_DropsWhenSubscriberIsSlow(t *testing.T) {
+	watcher := NewWatcher(nil)
+	sub := watcher.Subscribe(DefaultNamespace, "k", false)
+	defer sub.Close()
+
+	for i := 0; i < subscriptionBuffer+1; i++ {
+		watcher.publish(Change{Namespace: DefaultNamespace, Key: "k", Op: OpSet})
+	}
+
+	assert.Len(t, sub.C(), subscriptionBuffer)
+	assert.True(t, sub.Dropped())
+	assert.False(t, sub.Dropped())
+}
+
+func TestWatcher_CloseEndsSubscriptions(t *testing.T) {
+	watcher := NewWatcher(nil)
+	sub := watcher.Subscribe(DefaultNamespace, "k", false)
+
+	watcher.close()
+	_, ok := <-sub.C()
+	assert.False(t, ok)
+
+	// Closing a subscription twice or after the watcher is safe
+	sub.Close()
+	late := watcher.Subscribe(DefaultNamespace, "k", false)
+	_, ok = <-late.C()
+	assert.False(t, ok)
+}
+
+func TestParseWatchOptions(t *testing.T) {
+	opts, err := parseWatchOptions("", "")
+	assert.NoError(t, err)
+	assert.Nil(t, opts.index)
+	assert.Equal(t, defaultWatchWait, opts.wait)
+
+	opts, err = parseWatchOptions("4", "2s")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), *opts.index)
+	assert.Equal(t, 2*time.Second, opts.wait)
+
+	for _, params := range [][2]string{{"-1", ""}, {"x", ""}, {"", "10m"}, {"", "0s"}} {
+		_, err = parseWatchOptions(params[0], params[1])
+		assert.Error(t, err)
+	}
+}
+
+func TestWriteEvent(t *testing.T) {
+	var buf bytes.Buffer
+
+	assert.NoError(t, writeEvent(&buf, Change{Key: "k", Version: 1, Op: OpSet}))
+	assert.Equal(t, "event: set\ndata: {\"key\":\"k\",\"version\":1,\"op\":\"set\"}\n\n", buf.String())
+}
+
+func newWatchContext(key, query string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/key-value/"+key+"?watch=true&"+query, nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("key")
+	c.SetParamValues(key)
+	return c, rec
+}
+
+func TestGetValue_WatchUnavailable(t *testing.T) {
+	handler := NewKeyValueHandler(db.New(pool))
+	c, rec := newWatchContext("k", "")
+
+	assert.NoError(t, handler.GetValue(c))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), "KV_209_WATCH_UNAVAILABLE")
+}
+
+func TestGetValue_WatchReturnsWhenIndexIsStale(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	assert.NoError(t, testdb.InsertKeyValueDirect(ctx, pool, "watched", "v1"))
+
+	handler := NewKeyValueHandler(db.New(pool)).WithWatcher(NewWatcher(pool))
+	c, rec := newWatchContext("watched", "index=0&wait=5s")
+
+	start := time.Now()
+	assert.NoError(t, handler.GetValue(c))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("X-KV-Index"))
+}
+
+func TestGetValue_WatchTimesOut(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+
+	handler := NewKeyValueHandler(db.New(pool)).WithWatcher(NewWatcher(pool))
+	c, rec := newWatchContext("missing", "index=0&wait=100ms")
+
+	assert.NoError(t, handler.GetValue(c))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get("X-KV-Index"))
+}
+
+func TestGetValue_WatchWakesOnChange(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	assert.NoError(t, testdb.InsertKeyValueDirect(ctx, pool, "watched", "v1"))
+
+	watcher := NewWatcher(pool)
+	watcher.Start(ctx)
+	handler := NewKeyValueHandler(db.New(pool)).WithWatcher(watcher)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		c, rec := newWatchContext("watched", "index=1&wait=10s")
+		handler.GetValue(c)
+		done <- rec
+	}()
+
+	// Give the watcher time to LISTEN before writing
+	time.Sleep(500 * time.Millisecond)
+	c, _ := newSetValueContext(`{"key":"watched","value":"v2"}`)
+	assert.NoError(t, handler.SetValue(c))
+
+	select {
+	case rec := <-done:
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "2", rec.Header().Get("X-KV-Index"))
+		var response map[string]interface{}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, "v2", response["value"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not return after the key changed")
+	}
+}
@@ -0,0 +1,218 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Formats of LOG_FORMAT
+const (
+	// FormatJSON writes one JSON object per line, as GCP Cloud Logging expects
+	FormatJSON = "json"
+	// FormatText writes key=value lines for local development
+	FormatText = "text"
+)
+
+// Outputs of LOG_OUTPUT besides file paths
+const (
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+)
+
+// Config configures the logger
+type Config struct {
+	// Level is the minimum level logged until SetLevel changes it
+	Level slog.Level
+	// Format is FormatJSON or FormatText
+	Format string
+	// Outputs are OutputStdout, OutputStderr or paths of files appended to
+	Outputs []string
+	// RedactKeys are attribute keys whose values are replaced, on top of the defaults
+	RedactKeys []string
+	// Secrets are values replaced wherever they appear in a logged string
+	Secrets []string
+}
+
+// DefaultConfig logs JSON at the info level to stdout
+func DefaultConfig() Config {
+	return Config{Level: slog.LevelInfo, Format: FormatJSON, Outputs: []string{OutputStdout}}
+}
+
+// LoadConfig reads the logger configuration from environment variables:
+//   - LOG_LEVEL: debug, info, warn or error (default info)
+//   - LOG_FORMAT: json or text (default json)
+//   - LOG_OUTPUT: comma separated stdout, stderr or file paths (default stdout)
+//   - LOG_REDACT_KEYS: comma separated attribute keys to redact besides the defaults
+//
+// The encryption keys (ENCRYPTION_KEY_*), the environment API keys
+// (PERSON_API_KEY_BLUE, PERSON_API_KEY_GREEN), the secrets of SIGNING_KEYS_FILE
+// and the password of DATABASE_URL are redacted from every logged string.
+func LoadConfig() (Config, error) {
+	cfg := DefaultConfig()
+
+	if raw := os.Getenv("LOG_LEVEL"); raw != "" {
+		if err := cfg.Level.UnmarshalText([]byte(raw)); err != nil {
+			return Config{}, fmt.Errorf("invalid LOG_LEVEL %q: must be debug, info, warn or error", raw)
+		}
+	}
+
+	switch format := strings.ToLower(strings.TrimSpace(os.Getenv("LOG_FORMAT"))); format {
+	case "":
+	case FormatJSON, FormatText:
+		cfg.Format = format
+	default:
+		return Config{}, fmt.Errorf("invalid LOG_FORMAT %q: must be %s or %s", format, FormatJSON, FormatText)
+	}
+
+	if raw := os.Getenv("LOG_OUTPUT"); raw != "" {
+		cfg.Outputs = nil
+		for _, output := range strings.Split(raw, ",") {
+			output = strings.TrimSpace(output)
+			if output == "" {
+				return Config{}, fmt.Errorf("invalid LOG_OUTPUT %q: empty output", raw)
+			}
+			cfg.Outputs = append(cfg.Outputs, output)
+		}
+	}
+
+	for _, key := range strings.Split(os.Getenv("LOG_REDACT_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			cfg.RedactKeys = append(cfg.RedactKeys, key)
+		}
+	}
+
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if strings.HasPrefix(name, "ENCRYPTION_KEY_") && value != "" {
+			cfg.Secrets = append(cfg.Secrets, value)
+		}
+	}
+	for _, name := range []string{"PERSON_API_KEY_BLUE", "PERSON_API_KEY_GREEN"} {
+		if value := os.Getenv(name); value != "" {
+			cfg.Secrets = append(cfg.Secrets, value)
+		}
+	}
+	cfg.Secrets = append(cfg.Secrets, signingSecrets(os.Getenv("SIGNING_KEYS_FILE"))...)
+	if u, err := url.Parse(os.Getenv("DATABASE_URL")); err == nil && u.User != nil {
+		if password, ok := u.User.Password(); ok && password != "" {
+			cfg.Secrets = append(cfg.Secrets, password)
+		}
+	}
+
+	return cfg, nil
+}
+
+// signingSecrets returns the secrets of the signing keys file at path. A file
+// that cannot be read is skipped, as loading the signing keys reports it.
+func signingSecrets(path string) []string {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var keys []struct {
+		Secret string `json:"secret"`
+	}
+	if json.Unmarshal(data, &keys) != nil {
+		return nil
+	}
+	var secrets []string
+	for _, key := range keys {
+		if key.Secret != "" {
+			secrets = append(secrets, key.Secret)
+		}
+	}
+	return secrets
+}
+
+var (
+	// mu guards the settings below against concurrent Configure and ToggleDebug calls
+	mu sync.Mutex
+	// configuredLevel is the level of the last Configure, restored by ToggleDebug
+	configuredLevel = slog.LevelInfo
+	// files are the log files opened by the last Configure
+	files []*os.File
+)
+
+// Configure replaces the default logger with one built from cfg. Log files are
+// opened for appending and the files of the previous configuration are closed.
+func Configure(cfg Config) error {
+	var writers []io.Writer
+	var opened []*os.File
+	for _, output := range cfg.Outputs {
+		switch output {
+		case OutputStdout:
+			writers = append(writers, os.Stdout)
+		case OutputStderr:
+			writers = append(writers, os.Stderr)
+		default:
+			f, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+			if err != nil {
+				for _, f := range opened {
+					f.Close()
+				}
+				return fmt.Errorf("failed to open log output %s: %w", output, err)
+			}
+			opened = append(opened, f)
+			writers = append(writers, f)
+		}
+	}
+	if len(writers) == 0 {
+		writers = append(writers, os.Stdout)
+	}
+
+	options := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: newRedactor(cfg.RedactKeys, cfg.Secrets).replaceAttr,
+	}
+	w := io.MultiWriter(writers...)
+	var handler slog.Handler = slog.NewJSONHandler(w, options)
+	if cfg.Format == FormatText {
+		handler = slog.NewTextHandler(w, options)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	level.Set(cfg.Level)
+	configuredLevel = cfg.Level
+	SetLogger(slog.New(handler))
+	for _, f := range files {
+		f.Close()
+	}
+	files = opened
+	return nil
+}
+
+// Level returns the minimum level logged
+func Level() slog.Level {
+	return level.Level()
+}
+
+// SetLevel changes the minimum level logged at runtime
+func SetLevel(l slog.Level) {
+	level.Set(l)
+}
+
+// ToggleDebug switches between the debug level and the configured level, or the
+// info level when debug is configured, and returns the new level
+func ToggleDebug() slog.Level {
+	mu.Lock()
+	defer mu.Unlock()
+	next := slog.LevelDebug
+	if level.Level() == slog.LevelDebug {
+		next = configuredLevel
+		if next == slog.LevelDebug {
+			next = slog.LevelInfo
+		}
+	}
+	level.Set(next)
+	return next
+}
@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+
+	errs "person-service/errors"
+
+	"github.com/labstack/echo/v4"
+)
+
+// LevelRequest represents the request body for changing the log level
+type LevelRequest struct {
+	Level string `json:"level"`
+}
+
+// LevelResponse represents the log level returned by the admin API
+type LevelResponse struct {
+	Level string `json:"level"`
+}
+
+// LevelHandler handles the admin API that reads and changes the log level at runtime
+type LevelHandler struct{}
+
+// NewLevelHandler creates a new instance of LevelHandler
+func NewLevelHandler() *LevelHandler {
+	return &LevelHandler{}
+}
+
+// GetLevel handles GET /admin/log-level - returns the minimum level logged
+func (h *LevelHandler) GetLevel(c echo.Context) error {
+	return c.JSON(http.StatusOK, LevelResponse{Level: Level().String()})
+}
+
+// SetLevel handles PUT /admin/log-level - changes the minimum level logged until
+// the next change or restart
+func (h *LevelHandler) SetLevel(c echo.Context) error {
+	var req LevelRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Invalid request body",
+			ErrorCode: errs.ErrInvalidLogLevel,
+		})
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(req.Level)); err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "level must be debug, info, warn or error",
+			ErrorCode: errs.ErrInvalidLogLevel,
+		})
+	}
+
+	// Use request context for trace propagation
+	ctx := c.Request().Context()
+	previous := Level()
+	SetLevel(level)
+	// Logged at warn so the change shows whatever the new level
+	WarnContext(ctx, "Log level changed", "from", previous.String(), "to", level.String())
+
+	return c.JSON(http.StatusOK, LevelResponse{Level: level.String()})
+}
@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	errs "person-service/errors"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func serveLevel(method, body string) *httptest.ResponseRecorder {
+	e := echo.New()
+	h := NewLevelHandler()
+	e.GET("/admin/log-level", h.GetLevel)
+	e.PUT("/admin/log-level", h.SetLevel)
+
+	req := httptest.NewRequest(method, "/admin/log-level", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLevelHandler(t *testing.T) {
+	defer Init()
+	assert.NoError(t, Configure(DefaultConfig()))
+
+	rec := serveLevel(http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"level":"INFO"}`, rec.Body.String())
+
+	rec = serveLevel(http.MethodPut, `{"level":"debug"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"level":"DEBUG"}`, rec.Body.String())
+	assert.Equal(t, slog.LevelDebug, Level())
+
+	for _, body := range []string{`{"level":"verbose"}`, `{"level":""}`, `not json`} {
+		rec = serveLevel(http.MethodPut, body)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+		assert.Contains(t, rec.Body.String(), errs.ErrInvalidLogLevel)
+	}
+	assert.Equal(t, slog.LevelDebug, Level())
+}
@@ -11,28 +11,30 @@ import (
 const (
 	// GCPTraceField is the field name GCP Cloud Logging uses for trace correlation
 	GCPTraceField = "logging.googleapis.com/trace"
+
+	// GCPSpanIDField is the field name GCP Cloud Logging uses for span correlation
+	GCPSpanIDField = "logging.googleapis.com/spanId"
 )
 
 var (
 	// defaultLogger is the package-level logger instance
 	defaultLogger *slog.Logger
 
+	// level is the minimum level logged, changed at runtime by SetLevel
+	level = new(slog.LevelVar)
+
 	// gcpProjectID is the GCP project ID for trace correlation
 	gcpProjectID string
 )
 
-// Init initializes the global structured logger with JSON output.
-// Should be called once at application startup.
+// Init initializes the global structured logger with JSON output to stdout at
+// the info level. Should be called once at application startup, before
+// Configure applies the LOG_* settings.
 func Init() {
 	gcpProjectID = os.Getenv("GCP_PROJECT_ID")
 
 	// Create JSON handler for GCP Cloud Logging compatibility
-	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	})
-
-	defaultLogger = slog.New(handler)
-	slog.SetDefault(defaultLogger)
+	_ = Configure(DefaultConfig())
 }
 
 // Logger returns the default logger instance.
@@ -43,7 +45,14 @@ func Logger() *slog.Logger {
 	return defaultLogger
 }
 
-// LoggerFromContext returns a logger with the trace ID from context attached.
+// SetLogger replaces the default logger, e.g. to capture log lines in tests.
+func SetLogger(logger *slog.Logger) {
+	defaultLogger = logger
+	slog.SetDefault(logger)
+}
+
+// LoggerFromContext returns a logger with the trace ID from context attached,
+// and the span ID when the context has a span.
 // The trace ID is formatted for GCP Cloud Logging correlation.
 func LoggerFromContext(ctx context.Context) *slog.Logger {
 	logger := Logger()
@@ -62,6 +71,9 @@ func LoggerFromContext(ctx context.Context) *slog.Logger {
 		traceValue = traceID
 	}
 
+	if spanID := tracing.SpanIDFromContext(ctx); spanID != "" {
+		return logger.With(GCPTraceField, traceValue, GCPSpanIDField, spanID)
+	}
 	return logger.With(GCPTraceField, traceValue)
 }
 
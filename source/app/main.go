@@ -11,15 +11,26 @@ import (
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
 
+	api_keys "person-service/api_keys"
 	errs "person-service/errors"
 	health "person-service/healthcheck"
 	dbpkg "person-service/internal/db"
 	db "person-service/internal/db/generated"
 	key_value "person-service/key_value"
 	"person-service/logging"
+	"person-service/metrics"
 	"person-service/middleware"
 	person_attributes "person-service/person_attributes"
+	person_erasure "person-service/person_erasure"
+	person_export "person-service/person_export"
+	person_identifiers "person-service/person_identifiers"
+	person_merge "person-service/person_merge"
+	"person-service/ratelimit"
+	"person-service/retention"
+	"person-service/tlsconfig"
+	"person-service/tracing"
 )
 
 // ============================================================================
@@ -59,6 +70,8 @@ func setupDb(port string) (*db.Queries, *pgxpool.Pool) {
 	config.MaxConnLifetime = 5 * time.Minute
 	config.MaxConnIdleTime = 1 * time.Minute
 	config.HealthCheckPeriod = 1 * time.Minute
+	// Trace statements and count the values encrypted and decrypted by them
+	config.ConnConfig.Tracer = dbpkg.QueryTracers{tracing.QueryTracer{}, metrics.QueryTracer{}}
 
 	// Create connection pool with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -93,11 +106,14 @@ func setupDb(port string) (*db.Queries, *pgxpool.Pool) {
 		migrateURL = "pgx5://" + migrateURL[13:]
 	}
 
-	if err := dbpkg.RunMigrations(ctx, pool, migrateURL); err != nil {
+	version, dirty, err := dbpkg.RunMigrations(ctx, pool, migrateURL)
+	if err != nil {
 		logging.Error("Database migration failed",
 			"error", err)
 		os.Exit(1)
 	}
+	metrics.SetMigrationVersion(version, dirty)
+	metrics.RegisterPool(pool)
 
 	queries := db.New(pool)
 	return queries, pool
@@ -106,16 +122,53 @@ func setupDb(port string) (*db.Queries, *pgxpool.Pool) {
 func main() {
 	// Initialize structured logging
 	logging.Init()
+	logConfig, err := logging.LoadConfig()
+	if err != nil {
+		logging.Error("Invalid logging configuration",
+			"error", err,
+			"error_code", errs.ErrInvalidLogConfig)
+		os.Exit(1)
+	}
+	if err := logging.Configure(logConfig); err != nil {
+		logging.Error("Failed to open log output",
+			"error", err,
+			"error_code", errs.ErrFailedOpenLogOutput)
+		os.Exit(1)
+	}
 
 	logging.Info("Application starting")
 
+	// Export spans when OTEL_TRACES_EXPORTER is set
+	tracingConfig, err := tracing.LoadConfig()
+	if err != nil {
+		logging.Error("Invalid tracing configuration",
+			"error", err,
+			"error_code", errs.ErrInvalidTracingConfig)
+		os.Exit(1)
+	}
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logging.Error("Failed to export spans",
+			"error", err,
+			"error_code", errs.ErrTraceExportFailed)
+	}))
+	shutdownTracing, err := tracing.Init(context.Background(), tracingConfig)
+	if err != nil {
+		logging.Error("Failed to create trace exporter",
+			"error", err,
+			"error_code", errs.ErrFailedCreateTraceExporter)
+		os.Exit(1)
+	}
+	if tracingConfig.Enabled() {
+		logging.Info("Tracing enabled", "exporter", tracingConfig.Exporter)
+	}
+
 	// Load configuration from environment variables
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "3000"
 	}
 
-	queries, _ := setupDb(port)
+	queries, pool := setupDb(port)
 
 	logging.Info("Database connection successful")
 
@@ -127,26 +180,240 @@ func main() {
 	// Apply trace middleware globally (must be first to capture all requests)
 	e.Use(middleware.TraceMiddleware())
 
+	// Count requests by route and status, and error responses by error code
+	e.Use(metrics.Middleware())
+	e.JSONSerializer = metrics.JSONSerializer{JSONSerializer: e.JSONSerializer}
+
+	// Log one line per request, sampling successful requests per route
+	accessLogConfig, err := middleware.LoadAccessLogConfig()
+	if err != nil {
+		logging.Error("Invalid access log configuration",
+			"error", err,
+			"error_code", errs.ErrInvalidAccessLogConfig)
+		os.Exit(1)
+	}
+	e.Use(middleware.AccessLog(accessLogConfig))
+
 	healthHandler := health.NewHealthCheckHandler(queries)
-	keyValueHandler := key_value.NewKeyValueHandler(queries)
-	personAttributesHandler := person_attributes.NewPersonAttributesHandler(queries)
+	keyValueWatcher := key_value.NewWatcher(pool)
+	encryptedNamespaces, err := key_value.LoadEncryptedNamespaces()
+	if err != nil {
+		logging.Error("Invalid key-value encrypted namespaces",
+			"error", err,
+			"error_code", errs.ErrKVInvalidEncryptedNamespaces)
+		os.Exit(1)
+	}
+	valueLimits, err := key_value.LoadValueLimits()
+	if err != nil {
+		logging.Error("Invalid key-value value limits",
+			"error", err,
+			"error_code", errs.ErrKVInvalidValueLimits)
+		os.Exit(1)
+	}
+	keyValueHandler := key_value.NewKeyValueHandler(queries).
+		WithWatcher(keyValueWatcher).
+		WithPool(pool).
+		WithEncryptedNamespaces(encryptedNamespaces).
+		WithValueLimits(valueLimits)
+	strictCaller, err := person_attributes.LoadStrictCaller()
+	if err != nil {
+		logging.Error("Invalid caller identity policy",
+			"error", err,
+			"error_code", errs.ErrInvalidCallerPolicy)
+		os.Exit(1)
+	}
+	// Attribute keys callers may read and write, on top of the route scopes
+	attributePolicy, err := person_attributes.LoadPolicy()
+	if err != nil {
+		logging.Error("Invalid attribute policy",
+			"error", err,
+			"error_code", errs.ErrInvalidAttributePolicy)
+		os.Exit(1)
+	}
+	personAttributesHandler := person_attributes.NewPersonAttributesHandler(queries).
+		WithStrictCaller(strictCaller).
+		WithPolicy(attributePolicy)
+	personExportHandler := person_export.NewPersonExportHandler(queries).
+		WithPolicy(attributePolicy)
+	personErasureHandler := person_erasure.NewPersonErasureHandler(pool).
+		WithStrictCaller(strictCaller)
+	personMergeHandler := person_merge.NewPersonMergeHandler(pool).
+		WithStrictCaller(strictCaller).
+		WithPolicy(attributePolicy)
+	personIdentifiersHandler := person_identifiers.NewPersonIdentifiersHandler(queries).
+		WithStrictCaller(strictCaller)
+	apiKeysHandler := api_keys.NewAPIKeysHandler(queries)
+	logLevelHandler := logging.NewLevelHandler()
+
+	// Bearer tokens are accepted alongside API keys when JWT_JWKS is set
+	jwtConfig, err := middleware.LoadJWTConfig()
+	if err != nil {
+		logging.Error("Invalid JWT configuration",
+			"error", err,
+			"error_code", errs.ErrInvalidJWTConfig)
+		os.Exit(1)
+	}
+	var jwtVerifier *middleware.JWTVerifier
+	if jwtConfig != nil {
+		jwtVerifier, err = middleware.NewJWTVerifier(context.Background(), *jwtConfig)
+		if err != nil {
+			logging.Error("Failed to load JWKS",
+				"error", err,
+				"error_code", errs.ErrFailedLoadJWKS)
+			os.Exit(1)
+		}
+	}
+
+	// Signed requests are accepted alongside API keys when SIGNING_KEYS_FILE is set
+	signatureVerifier, err := middleware.LoadSignatureVerifier()
+	if err != nil {
+		logging.Error("Invalid request signing configuration",
+			"error", err,
+			"error_code", errs.ErrInvalidSigningConfig)
+		os.Exit(1)
+	}
+
+	// Mutual TLS clients are authenticated by their certificate when TLS_CLIENT_CA_FILE is set
+	clientCertAuthenticator, err := middleware.LoadClientCertAuthenticator()
+	if err != nil {
+		logging.Error("Invalid client certificate configuration",
+			"error", err,
+			"error_code", errs.ErrInvalidClientCertConfig)
+		os.Exit(1)
+	}
+	auth := middleware.AuthMiddleware(middleware.Authenticators{
+		APIKeys:     queries,
+		JWT:         jwtVerifier,
+		Signatures:  signatureVerifier,
+		ClientCerts: clientCertAuthenticator,
+	})
+
+	// Authenticated callers are rate limited when RATE_LIMITS is set
+	rateLimitConfig, err := ratelimit.LoadConfig()
+	if err != nil {
+		logging.Error("Invalid rate limit configuration",
+			"error", err,
+			"error_code", errs.ErrInvalidRateLimitConfig)
+		os.Exit(1)
+	}
+	var rateLimiter *ratelimit.Limiter
+	if rateLimitConfig.Enabled() {
+		var store ratelimit.Store = ratelimit.NewMemoryStore()
+		if rateLimitConfig.Store == ratelimit.StorePostgres {
+			store = ratelimit.NewPostgresStore(queries)
+		}
+		rateLimiter = ratelimit.NewLimiter(rateLimitConfig, store)
+	}
+	rateLimit := ratelimit.Middleware(rateLimiter)
 
 	// Setup routes
 	e.GET("/health", healthHandler.Check)
+	e.GET("/metrics", metrics.Handler())
 
-	// Key-value API routes
-	e.POST("/api/key-value", keyValueHandler.SetValue)
-	e.GET("/api/key-value/:key", keyValueHandler.GetValue)
-	e.DELETE("/api/key-value/:key", keyValueHandler.DeleteValue)
-
-	// Person attributes API routes - protected with API key middleware
-	personAttributesGroup := e.Group("/persons", middleware.APIKeyMiddleware())
+	// Key-value API routes - protected with AuthMiddleware (API key, bearer token or signed
+	// request), need the kv scope and each identity reads or writes the namespaces granted
+	// in KV_NAMESPACE_GRANTS
+	namespaceGrants, err := key_value.LoadGrants()
+	if err != nil {
+		logging.Error("Invalid key-value namespace grants",
+			"error", err,
+			"error_code", errs.ErrKVInvalidNamespaceGrants)
+		os.Exit(1)
+	}
+	keyValueGroup := e.Group("/api/key-value",
+		auth,
+		rateLimit,
+		middleware.RequireScope(middleware.ScopeKV),
+		key_value.NamespaceMiddleware(namespaceGrants))
+	keyValueGroup.GET("", keyValueHandler.ListValues)
+	keyValueGroup.GET("/_count", keyValueHandler.CountValues)
+	keyValueGroup.GET("/_watch", keyValueHandler.WatchValues)
+	keyValueGroup.GET("/_export", keyValueHandler.Export)
+	keyValueGroup.POST("", keyValueHandler.SetValue)
+	keyValueGroup.POST("/_incr", keyValueHandler.IncrementValue)
+	keyValueGroup.POST("/_txn", keyValueHandler.Txn)
+	keyValueGroup.POST("/_import", keyValueHandler.Import)
+	keyValueGroup.GET("/:key", keyValueHandler.GetValue)
+	keyValueGroup.PUT("/:key", keyValueHandler.PutValue)
+	keyValueGroup.DELETE("/:key", keyValueHandler.DeleteValue)
+
+	// Person attributes API routes - protected with AuthMiddleware, reads need the
+	// attributes:read scope and writes the attributes:write scope
+	personAttributesGroup := e.Group("/persons",
+		auth,
+		rateLimit,
+		middleware.RequireMethodScope(middleware.ScopeAttributesRead, middleware.ScopeAttributesWrite))
+	// Reads of a merged person are redirected to the surviving person
+	redirectMerged := person_merge.RedirectMerged(queries)
 	personAttributesGroup.POST("/:personId/attributes", personAttributesHandler.CreateAttribute)
 	personAttributesGroup.PUT("/:personId/attributes", personAttributesHandler.CreateAttribute)
-	personAttributesGroup.GET("/:personId/attributes", personAttributesHandler.GetAllAttributes)
-	personAttributesGroup.GET("/:personId/attributes/:attributeId", personAttributesHandler.GetAttribute)
+	personAttributesGroup.GET("/:personId/attributes", personAttributesHandler.GetAllAttributes, redirectMerged)
+	personAttributesGroup.GET("/:personId/attributes/:attributeId", personAttributesHandler.GetAttribute, redirectMerged)
 	personAttributesGroup.PUT("/:personId/attributes/:attributeId", personAttributesHandler.UpdateAttribute)
 	personAttributesGroup.DELETE("/:personId/attributes/:attributeId", personAttributesHandler.DeleteAttribute)
+	personAttributesGroup.GET("/:personId/export", personExportHandler.Export, redirectMerged)
+	// Erasure and merge destroy data, so they also need the persons:erase scope
+	requireErase := middleware.RequireScope(middleware.ScopePersonsErase)
+	personAttributesGroup.POST("/:personId/erasure", personErasureHandler.ErasePerson, requireErase)
+	personAttributesGroup.GET("/:personId/erasure", personErasureHandler.GetErasure)
+	personAttributesGroup.POST("/:personId/merge", personMergeHandler.MergePerson, requireErase)
+	personAttributesGroup.POST("/:personId/identifiers", personIdentifiersHandler.AttachIdentifier)
+	personAttributesGroup.GET("/:personId/identifiers", personIdentifiersHandler.ListIdentifiers, redirectMerged)
+	personAttributesGroup.DELETE("/:personId/identifiers/:identifierId", personIdentifiersHandler.DetachIdentifier)
+	personAttributesGroup.GET("/resolve", personIdentifiersHandler.ResolveIdentifier)
+
+	// API key management routes - need the admin scope
+	adminGroup := e.Group("/admin/api-keys", auth, rateLimit, middleware.RequireScope(middleware.ScopeAdmin))
+	adminGroup.POST("", apiKeysHandler.IssueKey)
+	adminGroup.GET("", apiKeysHandler.ListKeys)
+	adminGroup.DELETE("/:id", apiKeysHandler.RevokeKey)
+
+	// Log level routes - need the admin scope
+	logLevelGroup := e.Group("/admin/log-level", auth, rateLimit, middleware.RequireScope(middleware.ScopeAdmin))
+	logLevelGroup.GET("", logLevelHandler.GetLevel)
+	logLevelGroup.PUT("", logLevelHandler.SetLevel)
+
+	// Background jobs run until the server shuts down
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	// Delete idle rate limit buckets
+	if rateLimiter != nil {
+		rateLimiter.Start(backgroundCtx)
+		logging.Info("Rate limiting enabled", "store", rateLimitConfig.Store)
+	}
+
+	// Start the retention scheduler when at least one rule is configured
+	retentionConfig, err := retention.LoadConfig()
+	if err != nil {
+		logging.Error("Invalid retention configuration",
+			"error", err,
+			"error_code", errs.ErrInvalidRetentionConfig)
+		os.Exit(1)
+	}
+	if retentionConfig.Enabled() {
+		retentionEngine := retention.NewEngine(retention.NewQueriesStore(queries), retentionConfig)
+		metrics.RegisterRetention(retentionEngine)
+		retentionEngine.Start(backgroundCtx)
+		logging.Info("Retention scheduler started",
+			"person_retention", retentionConfig.PersonRetention.String(),
+			"audit_log_retention", retentionConfig.AuditLogRetention.String(),
+			"interval", retentionConfig.Interval.String(),
+			"dry_run", retentionConfig.DryRun)
+	}
+
+	// Start the reaper that deletes expired key-value entries
+	reaperConfig, err := key_value.LoadReaperConfig()
+	if err != nil {
+		logging.Error("Invalid key-value reaper configuration",
+			"error", err,
+			"error_code", errs.ErrKVInvalidReaperConfig)
+		os.Exit(1)
+	}
+	key_value.NewReaper(queries, reaperConfig).Start(backgroundCtx)
+
+	// Listen for key-value changes to answer watch requests
+	keyValueWatcher.Start(backgroundCtx)
 
 	// Configure server
 	e.Server = &http.Server{
@@ -156,11 +423,34 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	logging.Info("Server starting", "port", port)
+	// Serve TLS when TLS_CERT_FILE is set; certificates are reloaded when their files change
+	tlsConfig, err := tlsconfig.LoadConfig()
+	if err != nil {
+		logging.Error("Invalid TLS configuration",
+			"error", err,
+			"error_code", errs.ErrInvalidTLSConfig)
+		os.Exit(1)
+	}
+	if tlsConfig.Enabled() {
+		reloader, err := tlsconfig.NewReloader(tlsConfig)
+		if err != nil {
+			logging.Error("Failed to load TLS certificate",
+				"error", err,
+				"error_code", errs.ErrFailedLoadCertificate)
+			os.Exit(1)
+		}
+		reloader.Start(backgroundCtx)
+		e.Server.TLSConfig = reloader.TLSConfig()
+	}
+
+	logging.Info("Server starting",
+		"port", port,
+		"tls", tlsConfig.Enabled(),
+		"mutual_tls", tlsConfig.MutualTLS())
 
 	// Start server in goroutine
 	go func() {
-		if err := e.Start(e.Server.Addr); err != nil && err != http.ErrServerClosed {
+		if err := e.StartServer(e.Server); err != nil && err != http.ErrServerClosed {
 			logging.Error("Server error",
 				"error", err,
 				"error_code", errs.ErrFailedStartServer)
@@ -172,6 +462,15 @@ func main() {
 
 	logging.Info("Server ready and listening", "port", port)
 
+	// SIGHUP toggles debug logging without a restart
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			logging.Warn("Log level changed", "to", logging.ToggleDebug().String(), "signal", "SIGHUP")
+		}
+	}()
+
 	// Wait for interrupt signal to gracefully shutdown the server with
 	// a timeout of 10 seconds.
 	quit := make(chan os.Signal, 1)
@@ -179,6 +478,7 @@ func main() {
 	<-quit
 
 	logging.Info("Shutting down server")
+	stopBackground()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	if err := e.Shutdown(ctx); err != nil {
@@ -187,5 +487,11 @@ func main() {
 			"error_code", errs.ErrFailedShutdownServer)
 		os.Exit(1)
 	}
+	// Flush the spans of the last requests
+	if err := shutdownTracing(ctx); err != nil {
+		logging.Error("Failed to flush spans",
+			"error", err,
+			"error_code", errs.ErrTraceExportFailed)
+	}
 	logging.Info("Server gracefully stopped")
 }
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Operations of the crypto_operations_total metric
+const (
+	OperationEncrypt = "encrypt"
+	OperationDecrypt = "decrypt"
+)
+
+// poolCollector reads the statistics of a connection pool on every scrape
+type poolCollector struct {
+	pool *pgxpool.Pool
+
+	acquired    *prometheus.Desc
+	idle        *prometheus.Desc
+	total       *prometheus.Desc
+	max         *prometheus.Desc
+	acquires    *prometheus.Desc
+	waits       *prometheus.Desc
+	waitSeconds *prometheus.Desc
+}
+
+// RegisterPool exposes the statistics of pool
+func RegisterPool(pool *pgxpool.Pool) {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+	Registry.MustRegister(&poolCollector{
+		pool:        pool,
+		acquired:    desc("acquired_connections", "Connections currently acquired from the pool."),
+		idle:        desc("idle_connections", "Idle connections in the pool."),
+		total:       desc("total_connections", "Open connections in the pool."),
+		max:         desc("max_connections", "Maximum size of the pool."),
+		acquires:    desc("acquires_total", "Successful acquires from the pool."),
+		waits:       desc("empty_acquires_total", "Acquires that waited because the pool had no idle connection."),
+		waitSeconds: desc("acquire_wait_seconds_total", "Time spent waiting for successful acquires from the pool."),
+	})
+}
+
+// Describe sends the descriptors of the pool metrics
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquired
+	ch <- c.idle
+	ch <- c.total
+	ch <- c.max
+	ch <- c.acquires
+	ch <- c.waits
+	ch <- c.waitSeconds
+}
+
+// Collect sends the current pool statistics
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquired, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.max, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquires, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.waits, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.waitSeconds, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+}
+
+// cryptoStatementKey is the context key of the crypto operations of a running statement
+type cryptoStatementKey struct{}
+
+// QueryTracer counts encryption and decryption from the statements run on a
+// connection. Values are encrypted and decrypted by pgcrypto inside the statements,
+// so every row written by a statement calling pgp_sym_encrypt counts as one
+// encryption and every row read by a statement calling pgp_sym_decrypt as one decryption.
+// Key-value statements are skipped: only some of their rows are stored encrypted,
+// so the key-value handlers count those with CountCryptoOperations.
+type QueryTracer struct{}
+
+// CountCryptoOperations counts n values encrypted or decrypted outside of QueryTracer
+func CountCryptoOperations(operation string, n int) {
+	if n > 0 {
+		cryptoOperations.WithLabelValues(operation).Add(float64(n))
+	}
+}
+
+// cryptoOperationsOf returns the crypto operations of sql; a statement that
+// re-encrypts values both decrypts and encrypts
+func cryptoOperationsOf(sql string) []string {
+	if strings.Contains(sql, "key_value") {
+		return nil
+	}
+	var operations []string
+	if strings.Contains(sql, "pgp_sym_decrypt") {
+		operations = append(operations, OperationDecrypt)
+	}
+	if strings.Contains(sql, "pgp_sym_encrypt") {
+		operations = append(operations, OperationEncrypt)
+	}
+	return operations
+}
+
+// TraceQueryStart remembers the crypto operations of the statement
+func (QueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if operations := cryptoOperationsOf(data.SQL); len(operations) > 0 {
+		return context.WithValue(ctx, cryptoStatementKey{}, operations)
+	}
+	return ctx
+}
+
+// TraceQueryEnd counts the rows of a successful crypto statement
+func (QueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	operations, ok := ctx.Value(cryptoStatementKey{}).([]string)
+	if !ok || data.Err != nil {
+		return
+	}
+	rows := data.CommandTag.RowsAffected()
+	if rows <= 0 {
+		return
+	}
+	for _, operation := range operations {
+		cryptoOperations.WithLabelValues(operation).Add(float64(rows))
+	}
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	errs "person-service/errors"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes every metric of the service
+const namespace = "person_service"
+
+// unmatchedRoute is the route label of requests no route matched
+const unmatchedRoute = "unmatched"
+
+// Registry holds every metric exposed on /metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	errorResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "errors_total",
+		Help:      "Error responses by error_code.",
+	}, []string{"error_code"})
+
+	migrationVersion = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "db_migration_version",
+		Help:      "Version of the database schema; dirty is true when the last migration failed halfway.",
+	}, []string{"dirty"})
+
+	cryptoOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "crypto_operations_total",
+		Help:      "Values encrypted and decrypted at rest.",
+	}, []string{"operation"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpRequestDuration,
+		errorResponses,
+		migrationVersion,
+		cryptoOperations,
+	)
+}
+
+// Handler serves the metrics of Registry in the Prometheus text format
+func Handler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+}
+
+// Middleware creates a middleware that counts requests and observes their latency
+// by method, route and status. The route is the path the handler was registered
+// with, e.g. /persons/:personId/attributes, so person IDs do not become labels.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			status := c.Response().Status
+			if err != nil {
+				// The error handler writes the response after the middleware returns
+				status = http.StatusInternalServerError
+				if he, ok := err.(*echo.HTTPError); ok {
+					status = he.Code
+				}
+			}
+			route := c.Path()
+			if route == "" {
+				route = unmatchedRoute
+			}
+
+			labels := prometheus.Labels{
+				"method": c.Request().Method,
+				"route":  route,
+				"status": strconv.Itoa(status),
+			}
+			httpRequests.With(labels).Inc()
+			httpRequestDuration.With(labels).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+// JSONSerializer counts the errs.ErrorResponse bodies it serializes by error code
+// and serializes everything with the wrapped serializer
+type JSONSerializer struct {
+	echo.JSONSerializer
+}
+
+// Serialize counts error responses and serializes i
+func (s JSONSerializer) Serialize(c echo.Context, i interface{}, indent string) error {
+	switch resp := i.(type) {
+	case errs.ErrorResponse:
+		errorResponses.WithLabelValues(resp.ErrorCode).Inc()
+	case *errs.ErrorResponse:
+		errorResponses.WithLabelValues(resp.ErrorCode).Inc()
+	}
+	return s.JSONSerializer.Serialize(c, i, indent)
+}
+
+// SetMigrationVersion records the version of the database schema
+func SetMigrationVersion(version uint, dirty bool) {
+	migrationVersion.Reset()
+	migrationVersion.WithLabelValues(strconv.FormatBool(dirty)).Set(float64(version))
+}
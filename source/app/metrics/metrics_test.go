@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	errs "person-service/errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEcho() *echo.Echo {
+	e := echo.New()
+	e.Use(Middleware())
+	e.JSONSerializer = JSONSerializer{JSONSerializer: e.JSONSerializer}
+	e.GET("/persons/:personId/attributes", func(c echo.Context) error {
+		return c.JSON(http.StatusNotFound, errs.ErrorResponse{Message: "Person not found", ErrorCode: errs.ErrPersonNotFound})
+	})
+	e.GET("/fail", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusServiceUnavailable)
+	})
+	e.GET("/metrics", Handler())
+	return e
+}
+
+func serve(e *echo.Echo, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestMiddleware(t *testing.T) {
+	e := newTestEcho()
+	notFound := httpRequests.WithLabelValues(http.MethodGet, "/persons/:personId/attributes", "404")
+	failed := httpRequests.WithLabelValues(http.MethodGet, "/fail", "503")
+	unmatched := httpRequests.WithLabelValues(http.MethodGet, unmatchedRoute, "404")
+	before := []float64{testutil.ToFloat64(notFound), testutil.ToFloat64(failed), testutil.ToFloat64(unmatched)}
+
+	serve(e, "/persons/p-1/attributes")
+	serve(e, "/persons/p-2/attributes")
+	serve(e, "/fail")
+	serve(e, "/no/such/route")
+
+	assert.Equal(t, before[0]+2, testutil.ToFloat64(notFound))
+	assert.Equal(t, before[1]+1, testutil.ToFloat64(failed))
+	assert.Equal(t, before[2]+1, testutil.ToFloat64(unmatched))
+}
+
+func TestJSONSerializer_CountsErrorCodes(t *testing.T) {
+	e := newTestEcho()
+	counter := errorResponses.WithLabelValues(errs.ErrPersonNotFound)
+	before := testutil.ToFloat64(counter)
+
+	rec := serve(e, "/persons/p-1/attributes")
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), errs.ErrPersonNotFound)
+	assert.Equal(t, before+1, testutil.ToFloat64(counter))
+}
+
+func TestSetMigrationVersion(t *testing.T) {
+	SetMigrationVersion(14, false)
+	SetMigrationVersion(15, false)
+
+	assert.Equal(t, 1, testutil.CollectAndCount(migrationVersion))
+	assert.Equal(t, 15.0, testutil.ToFloat64(migrationVersion.WithLabelValues("false")))
+}
+
+func TestQueryTracer(t *testing.T) {
+	tracer := QueryTracer{}
+	encrypt := cryptoOperations.WithLabelValues(OperationEncrypt)
+	decrypt := cryptoOperations.WithLabelValues(OperationDecrypt)
+	beforeEncrypt, beforeDecrypt := testutil.ToFloat64(encrypt), testutil.ToFloat64(decrypt)
+
+	run := func(sql, tag string, err error) {
+		ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: sql})
+		tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag(tag), Err: err})
+	}
+	run("SELECT pgp_sym_decrypt(encrypted_value, $1) FROM person_attributes", "SELECT 3", nil)
+	run("INSERT INTO person_attributes VALUES (pgp_sym_encrypt($1, $2))", "INSERT 0 1", nil)
+	run("UPDATE person_attributes SET encrypted_value = pgp_sym_encrypt(pgp_sym_decrypt(encrypted_value, $1), $2)", "UPDATE 2", nil)
+	run("SELECT id FROM person", "SELECT 5", nil)
+	run("SELECT pgp_sym_decrypt(encrypted_value, $1) FROM key_value", "SELECT 4", nil)
+	run("INSERT INTO person_attributes VALUES (pgp_sym_encrypt($1, $2))", "", errors.New("unique violation"))
+
+	assert.Equal(t, beforeEncrypt+3, testutil.ToFloat64(encrypt))
+	assert.Equal(t, beforeDecrypt+5, testutil.ToFloat64(decrypt))
+
+	CountCryptoOperations(OperationDecrypt, 2)
+	CountCryptoOperations(OperationEncrypt, 0)
+	assert.Equal(t, beforeEncrypt+3, testutil.ToFloat64(encrypt))
+	assert.Equal(t, beforeDecrypt+7, testutil.ToFloat64(decrypt))
+}
+
+func TestHandler(t *testing.T) {
+	e := newTestEcho()
+	serve(e, "/persons/p-1/attributes")
+
+	rec := serve(e, "/metrics")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.True(t, strings.Contains(body, `person_service_http_requests_total{method="GET",route="/persons/:personId/attributes",status="404"}`))
+	assert.True(t, strings.Contains(body, `person_service_errors_total{error_code="PA_101_PERSON_NOT_FOUND"}`))
+	assert.True(t, strings.Contains(body, "go_goroutines"))
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"person-service/retention"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// retentionCollector reads the counters of a retention engine on every scrape
+type retentionCollector struct {
+	engine *retention.Engine
+
+	runs                 *prometheus.Desc
+	failedRuns           *prometheus.Desc
+	personsPurged        *prometheus.Desc
+	auditLogsPurged      *prometheus.Desc
+	auditEntriesRedacted *prometheus.Desc
+}
+
+// RegisterRetention exposes the counters of the retention engine
+func RegisterRetention(engine *retention.Engine) {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "retention", name), help, nil, nil)
+	}
+	Registry.MustRegister(&retentionCollector{
+		engine:               engine,
+		runs:                 desc("runs_total", "Retention runs."),
+		failedRuns:           desc("failed_runs_total", "Retention runs in which a rule failed."),
+		personsPurged:        desc("persons_purged_total", "Soft-deleted persons hard deleted by retention."),
+		auditLogsPurged:      desc("audit_logs_purged_total", "Audit log entries deleted by retention."),
+		auditEntriesRedacted: desc("audit_entries_redacted_total", "Audit log entries of purged persons redacted by retention."),
+	})
+}
+
+// Describe sends the descriptors of the retention metrics
+func (c *retentionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.runs
+	ch <- c.failedRuns
+	ch <- c.personsPurged
+	ch <- c.auditLogsPurged
+	ch <- c.auditEntriesRedacted
+}
+
+// Collect sends the current retention counters
+func (c *retentionCollector) Collect(ch chan<- prometheus.Metric) {
+	m := c.engine.Metrics()
+	ch <- prometheus.MustNewConstMetric(c.runs, prometheus.CounterValue, float64(m.Runs))
+	ch <- prometheus.MustNewConstMetric(c.failedRuns, prometheus.CounterValue, float64(m.FailedRuns))
+	ch <- prometheus.MustNewConstMetric(c.personsPurged, prometheus.CounterValue, float64(m.PersonsPurged))
+	ch <- prometheus.MustNewConstMetric(c.auditLogsPurged, prometheus.CounterValue, float64(m.AuditLogsPurged))
+	ch <- prometheus.MustNewConstMetric(c.auditEntriesRedacted, prometheus.CounterValue, float64(m.AuditEntriesRedacted))
+}
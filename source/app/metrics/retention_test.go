@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"person-service/retention"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// purgingStore purges two persons with three audit entries on the first batch
+type purgingStore struct {
+	purged bool
+}
+
+func (s *purgingStore) CountPurgeablePersons(context.Context, time.Time) (int64, error) {
+	return 2, nil
+}
+
+func (s *purgingStore) PurgePersons(context.Context, time.Time, int32) (int64, int64, error) {
+	if s.purged {
+		return 0, 0, nil
+	}
+	s.purged = true
+	return 2, 3, nil
+}
+
+func (s *purgingStore) CountPurgeableAuditLogs(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (s *purgingStore) PurgeAuditLogs(context.Context, time.Time, int32) (int64, error) {
+	return 0, nil
+}
+
+func TestRegisterRetention(t *testing.T) {
+	engine := retention.NewEngine(&purgingStore{}, retention.Config{PersonRetention: time.Hour, BatchSize: 100})
+	RegisterRetention(engine)
+	engine.Run(context.Background(), time.Now())
+
+	expected := `
+# HELP person_service_retention_persons_purged_total Soft-deleted persons hard deleted by retention.
+# TYPE person_service_retention_persons_purged_total counter
+person_service_retention_persons_purged_total 2
+# HELP person_service_retention_runs_total Retention runs.
+# TYPE person_service_retention_runs_total counter
+person_service_retention_runs_total 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(Registry, strings.NewReader(expected),
+		"person_service_retention_runs_total", "person_service_retention_persons_purged_total"))
+}
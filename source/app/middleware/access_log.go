@@ -0,0 +1,217 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	errs "person-service/errors"
+	"person-service/logging"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// DefaultSampleRule is the sample rate of routes without their own rule
+	DefaultSampleRule = "default"
+
+	// unmatchedRoute is the route logged for requests no route matched
+	unmatchedRoute = "unmatched"
+
+	// maxErrorBodyBytes caps the error response body kept to read its error code
+	maxErrorBodyBytes = 4096
+)
+
+// sampleRandom returns the random number in [0, 1) a request is sampled with
+var sampleRandom = rand.Float64
+
+// AccessLogConfig configures the access log
+type AccessLogConfig struct {
+	// Enabled turns the access log on
+	Enabled bool
+	// Default is the share of successful requests logged on routes without a rule
+	Default float64
+	// Routes are sample rates per route ("METHOD /path" as registered)
+	Routes map[string]float64
+}
+
+// ParseSampleRates reads sample rates separated by ";", each "route=rate" with
+// route "default" or "METHOD /path" as registered, and rate between 0 and 1.
+// Routes without a rule are logged at the default rate, 1 unless set:
+//
+//	default=1; GET /health=0; GET /persons/:personId/attributes=0.1
+func ParseSampleRates(raw string) (AccessLogConfig, error) {
+	cfg := AccessLogConfig{Enabled: true, Default: 1, Routes: make(map[string]float64)}
+	for _, entry := range strings.Split(raw, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		route, rawRate, ok := strings.Cut(entry, "=")
+		if !ok {
+			return AccessLogConfig{}, fmt.Errorf("sample rule %q must be \"route=rate\"", entry)
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(rawRate), 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return AccessLogConfig{}, fmt.Errorf("rate of sample rule %q must be between 0 and 1", entry)
+		}
+
+		route = strings.TrimSpace(route)
+		if route == DefaultSampleRule {
+			cfg.Default = rate
+			continue
+		}
+		method, path, ok := strings.Cut(route, " ")
+		if !ok || method == "" || !strings.HasPrefix(path, "/") {
+			return AccessLogConfig{}, fmt.Errorf("route of sample rule %q must be \"METHOD /path\"", entry)
+		}
+		cfg.Routes[strings.ToUpper(method)+" "+path] = rate
+	}
+	return cfg, nil
+}
+
+// LoadAccessLogConfig reads the access log configuration from environment variables:
+//   - ACCESS_LOG: false turns the access log off (default true)
+//   - ACCESS_LOG_SAMPLE: sample rates of successful requests (see ParseSampleRates);
+//     requests answered with a 4xx or 5xx status are always logged
+func LoadAccessLogConfig() (AccessLogConfig, error) {
+	if raw := os.Getenv("ACCESS_LOG"); raw != "" {
+		enabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			return AccessLogConfig{}, fmt.Errorf("invalid ACCESS_LOG %q: must be true or false", raw)
+		}
+		if !enabled {
+			return AccessLogConfig{}, nil
+		}
+	}
+
+	cfg, err := ParseSampleRates(os.Getenv("ACCESS_LOG_SAMPLE"))
+	if err != nil {
+		return AccessLogConfig{}, fmt.Errorf("invalid ACCESS_LOG_SAMPLE: %w", err)
+	}
+	return cfg, nil
+}
+
+// sampled reports whether a successful request on route is logged
+func (cfg AccessLogConfig) sampled(route string) bool {
+	rate, ok := cfg.Routes[route]
+	if !ok {
+		rate = cfg.Default
+	}
+	return rate >= 1 || (rate > 0 && sampleRandom() < rate)
+}
+
+// accessLogWriter keeps the start of error response bodies to read their error code
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader remembers the status of the response
+func (w *accessLogWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write keeps the start of error response bodies
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	if w.status >= http.StatusBadRequest && w.body.Len() < maxErrorBodyBytes {
+		w.body.Write(b[:min(len(b), maxErrorBodyBytes-w.body.Len())])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends buffered data of streamed responses, such as the key-value watch
+// and export, to the client
+func (w *accessLogWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack lets handlers take over the connection
+func (w *accessLogWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// errorCode returns the error code of an errs.ErrorResponse body, or ""
+func (w *accessLogWriter) errorCode() string {
+	var resp errs.ErrorResponse
+	if w.body.Len() == 0 || json.Unmarshal(w.body.Bytes(), &resp) != nil {
+		return ""
+	}
+	return resp.ErrorCode
+}
+
+// AccessLog creates a middleware that logs one line per request with the method,
+// route, status, latency, response bytes, error code, caller identity and trace
+// ID. The route is the path the handler was registered with, so person IDs are
+// not logged, and neither are query strings nor bodies, which hold attribute values.
+// Successful requests are sampled per route; 4xx and 5xx responses are always logged.
+func AccessLog(cfg AccessLogConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if !cfg.Enabled {
+			return next
+		}
+		return func(c echo.Context) error {
+			start := time.Now()
+			writer := &accessLogWriter{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = writer
+			err := next(c)
+			c.Response().Writer = writer.ResponseWriter
+
+			status := c.Response().Status
+			if err != nil {
+				// The error handler writes the response after the middleware returns
+				status = http.StatusInternalServerError
+				if he, ok := err.(*echo.HTTPError); ok {
+					status = he.Code
+				}
+			}
+			route := c.Path()
+			if route == "" {
+				route = unmatchedRoute
+			}
+			method := c.Request().Method
+			if status < http.StatusBadRequest && !cfg.sampled(method+" "+route) {
+				return err
+			}
+
+			level := slog.LevelInfo
+			switch {
+			case status >= http.StatusInternalServerError:
+				level = slog.LevelError
+			case status >= http.StatusBadRequest:
+				level = slog.LevelWarn
+			}
+			traceID, _ := c.Get(EchoTraceIDKey).(string)
+			// Use request context for trace propagation
+			ctx := c.Request().Context()
+			logging.LoggerFromContext(ctx).Log(ctx, level, "HTTP request",
+				"method", method,
+				"route", route,
+				"status", status,
+				"latency_ms", float64(time.Since(start).Microseconds())/1000,
+				"bytes", c.Response().Size,
+				"error_code", writer.errorCode(),
+				"caller", APIKeyIdentity(c),
+				"trace_id", traceID,
+			)
+			return err
+		}
+	}
+}
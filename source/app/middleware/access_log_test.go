@@ -0,0 +1,200 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	errs "person-service/errors"
+	"person-service/logging"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSampleRates(t *testing.T) {
+	cfg, err := ParseSampleRates("default=0.5; get /health=0; POST /persons/:personId/attributes=1")
+	assert.NoError(t, err)
+	assert.Equal(t, AccessLogConfig{
+		Enabled: true,
+		Default: 0.5,
+		Routes: map[string]float64{
+			"GET /health":                        0,
+			"POST /persons/:personId/attributes": 1,
+		},
+	}, cfg)
+
+	cfg, err = ParseSampleRates("")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, cfg.Default)
+
+	for _, raw := range []string{"GET /health", "GET /health=2", "GET /health=-0.1", "GET=0.5", "health=0.5", "default=often"} {
+		_, err := ParseSampleRates(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestLoadAccessLogConfig(t *testing.T) {
+	defer os.Unsetenv("ACCESS_LOG")
+	defer os.Unsetenv("ACCESS_LOG_SAMPLE")
+
+	os.Unsetenv("ACCESS_LOG")
+	os.Unsetenv("ACCESS_LOG_SAMPLE")
+	cfg, err := LoadAccessLogConfig()
+	assert.NoError(t, err)
+	assert.True(t, cfg.Enabled)
+
+	os.Setenv("ACCESS_LOG", "false")
+	cfg, err = LoadAccessLogConfig()
+	assert.NoError(t, err)
+	assert.False(t, cfg.Enabled)
+
+	os.Setenv("ACCESS_LOG", "maybe")
+	_, err = LoadAccessLogConfig()
+	assert.ErrorContains(t, err, "ACCESS_LOG")
+
+	os.Setenv("ACCESS_LOG", "true")
+	os.Setenv("ACCESS_LOG_SAMPLE", "GET /health=often")
+	_, err = LoadAccessLogConfig()
+	assert.ErrorContains(t, err, "ACCESS_LOG_SAMPLE")
+}
+
+// captureLogs sends log lines to the returned buffer until the test ends
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	previous := logging.Logger()
+	logging.SetLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { logging.SetLogger(previous) })
+	return &buf
+}
+
+// logLines decodes the JSON log lines of buf
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var fields map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(line), &fields))
+		lines = append(lines, fields)
+	}
+	return lines
+}
+
+func newAccessLogEcho(cfg AccessLogConfig) *echo.Echo {
+	e := echo.New()
+	e.Use(TraceMiddleware())
+	e.Use(AccessLog(cfg))
+	e.GET("/health", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{"status": "healthy"})
+	})
+	e.GET("/persons/:personId/attributes/:attributeId", func(c echo.Context) error {
+		c.Set(EchoAPIKeyIdentityKey, "orders")
+		return c.JSON(http.StatusNotFound, errs.ErrorResponse{Message: "Attribute not found", ErrorCode: errs.ErrAttributeNotFound})
+	})
+	e.POST("/persons/:personId/attributes", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusServiceUnavailable)
+	})
+	return e
+}
+
+func TestAccessLog(t *testing.T) {
+	buf := captureLogs(t)
+	e := newAccessLogEcho(AccessLogConfig{Enabled: true, Default: 1})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/persons/3f2a9c1e-person/attributes/42?value=secret-value", nil)
+	e.ServeHTTP(rec, req)
+
+	lines := logLines(t, buf)
+	assert.Len(t, lines, 1)
+	line := lines[0]
+	assert.Equal(t, "HTTP request", line["msg"])
+	assert.Equal(t, "WARN", line["level"])
+	assert.Equal(t, "GET", line["method"])
+	assert.Equal(t, "/persons/:personId/attributes/:attributeId", line["route"])
+	assert.Equal(t, 404.0, line["status"])
+	assert.Equal(t, float64(rec.Body.Len()), line["bytes"])
+	assert.Equal(t, errs.ErrAttributeNotFound, line["error_code"])
+	assert.Equal(t, "orders", line["caller"])
+	assert.Equal(t, rec.Header().Get(TraceIDResponseHeader), line["trace_id"])
+	assert.Contains(t, line, "latency_ms")
+
+	// Person IDs and values never reach the log
+	assert.NotContains(t, buf.String(), "3f2a9c1e-person")
+	assert.NotContains(t, buf.String(), "secret-value")
+}
+
+func TestAccessLog_ReturnedErrorAndUnmatchedRoute(t *testing.T) {
+	buf := captureLogs(t)
+	e := newAccessLogEcho(AccessLogConfig{Enabled: true, Default: 1})
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/persons/p-1/attributes", nil))
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/persons-p-1", nil))
+
+	lines := logLines(t, buf)
+	assert.Len(t, lines, 2)
+	assert.Equal(t, "ERROR", lines[0]["level"])
+	assert.Equal(t, 503.0, lines[0]["status"])
+	assert.Equal(t, unmatchedRoute, lines[1]["route"])
+	assert.Equal(t, 404.0, lines[1]["status"])
+	assert.NotContains(t, buf.String(), "p-1")
+}
+
+func TestAccessLog_Sampling(t *testing.T) {
+	buf := captureLogs(t)
+	defer func(random func() float64) { sampleRandom = random }(sampleRandom)
+	sampleRandom = func() float64 { return 0.5 }
+
+	serve := func(cfg AccessLogConfig, method, path string) int {
+		buf.Reset()
+		e := newAccessLogEcho(cfg)
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, path, nil))
+		return len(logLines(t, buf))
+	}
+
+	muted := AccessLogConfig{Enabled: true, Default: 1, Routes: map[string]float64{"GET /health": 0}}
+	assert.Equal(t, 0, serve(muted, http.MethodGet, "/health"))
+	// Errors are logged whatever the sample rate
+	assert.Equal(t, 1, serve(AccessLogConfig{Enabled: true, Default: 0}, http.MethodGet, "/persons/p-1/attributes/1"))
+
+	sampled := AccessLogConfig{Enabled: true, Default: 1, Routes: map[string]float64{"GET /health": 0.6}}
+	assert.Equal(t, 1, serve(sampled, http.MethodGet, "/health"))
+	sampled.Routes["GET /health"] = 0.4
+	assert.Equal(t, 0, serve(sampled, http.MethodGet, "/health"))
+
+	assert.Equal(t, 0, serve(AccessLogConfig{}, http.MethodGet, "/persons/p-1/attributes/1"))
+}
+
+func TestAccessLog_Streaming(t *testing.T) {
+	buf := captureLogs(t)
+	e := echo.New()
+	e.Use(AccessLog(AccessLogConfig{Enabled: true, Default: 1}))
+	e.GET("/api/key-value/_watch", func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderContentType, "text/event-stream")
+		c.Response().WriteHeader(http.StatusOK)
+		for _, event := range []string{"data: one\n\n", "data: two\n\n"} {
+			if _, err := c.Response().Write([]byte(event)); err != nil {
+				return err
+			}
+			c.Response().Flush()
+		}
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/key-value/_watch", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, "data: one\n\ndata: two\n\n", rec.Body.String())
+	lines := logLines(t, buf)
+	assert.Len(t, lines, 1)
+	assert.Equal(t, float64(rec.Body.Len()), lines[0]["bytes"])
+}
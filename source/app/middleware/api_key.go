@@ -1,12 +1,21 @@
 package middleware
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"net/http"
 	"os"
 	"regexp"
+	"slices"
+	"time"
 
 	errs "person-service/errors"
+	db "person-service/internal/db/generated"
+	"person-service/logging"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/labstack/echo/v4"
 )
 
@@ -14,10 +23,60 @@ import (
 // UUID format: 8-4-4-4-12 hexadecimal characters
 var apiKeyPattern = regexp.MustCompile(`^person-service-key-[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
 
+const (
+	// EchoAPIKeyIdentityKey is the key used to store the caller's API key identity in Echo context
+	EchoAPIKeyIdentityKey = "api-key-identity"
+
+	// EchoAPIKeyScopesKey is the key used to store the scopes of the caller's API key in Echo context
+	EchoAPIKeyScopesKey = "api-key-scopes"
+
+	// APIKeyIdentityBlue identifies callers authenticated with PERSON_API_KEY_BLUE
+	APIKeyIdentityBlue = "blue"
+	// APIKeyIdentityGreen identifies callers authenticated with PERSON_API_KEY_GREEN
+	APIKeyIdentityGreen = "green"
+)
+
+// Scopes an API key can be issued with
+const (
+	// ScopeAttributesRead allows reading persons, attributes, identifiers and exports
+	ScopeAttributesRead = "attributes:read"
+	// ScopeAttributesWrite allows changing persons, attributes and identifiers
+	ScopeAttributesWrite = "attributes:write"
+	// ScopePersonsErase allows erasing persons and merging them into other persons
+	ScopePersonsErase = "persons:erase"
+	// ScopeImages allows reading image binaries, e.g. in exports
+	ScopeImages = "images"
+	// ScopeKV allows using the key-value API (within the namespaces granted to the key)
+	ScopeKV = "kv"
+	// ScopeAdmin allows managing API keys and implies every other scope
+	ScopeAdmin = "admin"
+)
+
+// Scopes lists every scope an API key can be issued with
+var Scopes = []string{ScopeAttributesRead, ScopeAttributesWrite, ScopePersonsErase, ScopeImages, ScopeKV, ScopeAdmin}
+
+// APIKeyStore looks up API keys issued through the admin API (implemented by db.Queries)
+type APIKeyStore interface {
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (db.ApiKey, error)
+	TouchAPIKey(ctx context.Context, id int64) error
+}
+
+// HashAPIKey returns the hex encoded SHA-256 of an API key, as stored in api_keys
+func HashAPIKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
 // APIKeyMiddleware creates a middleware that validates the x-api-key header
-// against PERSON_API_KEY_BLUE and PERSON_API_KEY_GREEN environment variables.
+// against PERSON_API_KEY_BLUE and PERSON_API_KEY_GREEN environment variables,
+// which have every scope, and then against the keys of store (when not nil),
+// which have the scopes they were issued with.
 // The API key must follow the format: person-service-key-<UUID>
-func APIKeyMiddleware() echo.MiddlewareFunc {
+// The identity and scopes of the matching key are stored in the Echo context
+// (see APIKeyIdentity and APIKeyScopes); the identity of an issued key is its name.
+// The identity and owner are also attached to the request context as the
+// authenticated Principal (see PrincipalFromContext).
+func APIKeyMiddleware(store APIKeyStore) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			apiKey := c.Request().Header.Get("x-api-key")
@@ -47,8 +106,9 @@ func APIKeyMiddleware() echo.MiddlewareFunc {
 			// Check if green key is active (valid format)
 			greenActive := apiKeyPattern.MatchString(apiKeyGreen)
 
-			// If neither key is active (properly configured), reject the request
-			if !blueActive && !greenActive {
+			// If neither key is active (properly configured) and keys cannot be
+			// issued, reject the request
+			if !blueActive && !greenActive && store == nil {
 				return c.JSON(http.StatusServiceUnavailable, errs.ErrorResponse{
 					Message:   "API keys are not properly configured",
 					ErrorCode: errs.ErrAPIKeysNotConfigured,
@@ -56,22 +116,110 @@ func APIKeyMiddleware() echo.MiddlewareFunc {
 			}
 
 			// Validate the provided key against active keys
-			keyValid := false
+			identity := ""
 			if blueActive && apiKey == apiKeyBlue {
-				keyValid = true
+				identity = APIKeyIdentityBlue
 			}
 			if greenActive && apiKey == apiKeyGreen {
-				keyValid = true
+				identity = APIKeyIdentityGreen
+			}
+			scopes := Scopes
+			owner := ""
+
+			if identity == "" && store != nil {
+				// Use request context for trace propagation
+				ctx := c.Request().Context()
+
+				key, err := store.GetAPIKeyByHash(ctx, HashAPIKey(apiKey))
+				if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+					logging.ErrorContext(ctx, "Failed to verify API key", "error", err)
+					return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+						Message:   "Failed to verify API key",
+						ErrorCode: errs.ErrFailedVerifyAPIKey,
+					})
+				}
+				if err == nil {
+					if key.ExpiresAt.Valid && !key.ExpiresAt.Time.After(time.Now()) {
+						return c.JSON(http.StatusUnauthorized, errs.ErrorResponse{
+							Message:   "API key has expired",
+							ErrorCode: errs.ErrAPIKeyExpired,
+						})
+					}
+					// A failed last-used update must not fail the request
+					if err := store.TouchAPIKey(ctx, key.ID); err != nil {
+						logging.WarnContext(ctx, "Failed to record API key use", "error", err, "api_key", key.Name)
+					}
+					identity = key.Name
+					owner = key.Owner
+					scopes = key.Scopes
+				}
 			}
 
-			if !keyValid {
+			if identity == "" {
 				return c.JSON(http.StatusUnauthorized, errs.ErrorResponse{
 					Message:   "Invalid API key",
 					ErrorCode: errs.ErrInvalidAPIKey,
 				})
 			}
 
+			c.Set(EchoAPIKeyIdentityKey, identity)
+			c.Set(EchoAPIKeyScopesKey, scopes)
+
+			// Attach the principal to the request context for audit records
+			ctx := ContextWithPrincipal(c.Request().Context(), Principal{Name: identity, Owner: owner})
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}
+}
+
+// APIKeyIdentity returns the identity of the API key that authenticated the
+// request, or "" when the request did not pass through APIKeyMiddleware
+func APIKeyIdentity(c echo.Context) string {
+	identity, _ := c.Get(EchoAPIKeyIdentityKey).(string)
+	return identity
+}
+
+// APIKeyScopes returns the scopes of the API key that authenticated the
+// request, or nil when the request did not pass through APIKeyMiddleware
+func APIKeyScopes(c echo.Context) []string {
+	scopes, _ := c.Get(EchoAPIKeyScopesKey).([]string)
+	return scopes
+}
+
+// HasScope reports whether the API key of the request has scope, directly or through admin
+func HasScope(c echo.Context, scope string) bool {
+	scopes := APIKeyScopes(c)
+	return slices.Contains(scopes, scope) || slices.Contains(scopes, ScopeAdmin)
+}
+
+// RequireScope creates a middleware that rejects requests whose API key lacks scope.
+// It must run after AuthMiddleware.
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return RequireMethodScope(scope, scope)
+}
+
+// RequireMethodScope creates a middleware that requires readScope for GET and HEAD
+// requests and writeScope for every other method. It must run after AuthMiddleware.
+func RequireMethodScope(readScope, writeScope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			scope := writeScope
+			if method := c.Request().Method; method == http.MethodGet || method == http.MethodHead {
+				scope = readScope
+			}
+			if !HasScope(c, scope) {
+				return InsufficientScope(c, scope)
+			}
 			return next(c)
 		}
 	}
 }
+
+// InsufficientScope responds to a request whose API key lacks scope
+func InsufficientScope(c echo.Context, scope string) error {
+	return c.JSON(http.StatusForbidden, errs.ErrorResponse{
+		Message:   "API key is missing scope \"" + scope + "\"",
+		ErrorCode: errs.ErrInsufficientScope,
+	})
+}
@@ -1,13 +1,20 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
+
+	db "person-service/internal/db/generated"
 )
 
 const (
@@ -21,7 +28,7 @@ func TestAPIKeyMiddleware_MissingKey(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
-	middleware := APIKeyMiddleware()
+	middleware := APIKeyMiddleware(nil)
 	handler := middleware(func(c echo.Context) error {
 		return c.String(http.StatusOK, "OK")
 	})
@@ -40,7 +47,7 @@ func TestAPIKeyMiddleware_InvalidFormat(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
-	middleware := APIKeyMiddleware()
+	middleware := APIKeyMiddleware(nil)
 	handler := middleware(func(c echo.Context) error {
 		return c.String(http.StatusOK, "OK")
 	})
@@ -63,7 +70,7 @@ func TestAPIKeyMiddleware_NoConfiguredKeys(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
-	middleware := APIKeyMiddleware()
+	middleware := APIKeyMiddleware(nil)
 	handler := middleware(func(c echo.Context) error {
 		return c.String(http.StatusOK, "OK")
 	})
@@ -85,7 +92,7 @@ func TestAPIKeyMiddleware_InvalidKey(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
-	middleware := APIKeyMiddleware()
+	middleware := APIKeyMiddleware(nil)
 	handler := middleware(func(c echo.Context) error {
 		return c.String(http.StatusOK, "OK")
 	})
@@ -107,7 +114,7 @@ func TestAPIKeyMiddleware_ValidBlueKey(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
-	middleware := APIKeyMiddleware()
+	middleware := APIKeyMiddleware(nil)
 	handler := middleware(func(c echo.Context) error {
 		return c.String(http.StatusOK, "OK")
 	})
@@ -129,7 +136,7 @@ func TestAPIKeyMiddleware_ValidGreenKey(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
-	middleware := APIKeyMiddleware()
+	middleware := APIKeyMiddleware(nil)
 	handler := middleware(func(c echo.Context) error {
 		return c.String(http.StatusOK, "OK")
 	})
@@ -154,7 +161,7 @@ func TestAPIKeyMiddleware_BothKeysConfigured(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
-	middleware := APIKeyMiddleware()
+	middleware := APIKeyMiddleware(nil)
 	handler := middleware(func(c echo.Context) error {
 		return c.String(http.StatusOK, "OK")
 	})
@@ -188,7 +195,7 @@ func TestAPIKeyMiddleware_BlueKeyActiveGreenInvalidFormat(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
-	middleware := APIKeyMiddleware()
+	middleware := APIKeyMiddleware(nil)
 	handler := middleware(func(c echo.Context) error {
 		return c.String(http.StatusOK, "OK")
 	})
@@ -198,3 +205,250 @@ func TestAPIKeyMiddleware_BlueKeyActiveGreenInvalidFormat(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, rec.Code)
 }
+
+func TestAPIKeyMiddleware_SetsIdentity(t *testing.T) {
+	os.Setenv("PERSON_API_KEY_BLUE", validAPIKeyBlue)
+	os.Setenv("PERSON_API_KEY_GREEN", validAPIKeyGreen)
+	defer os.Unsetenv("PERSON_API_KEY_BLUE")
+	defer os.Unsetenv("PERSON_API_KEY_GREEN")
+
+	e := echo.New()
+	middleware := APIKeyMiddleware(nil)
+	handler := middleware(func(c echo.Context) error {
+		return c.String(http.StatusOK, APIKeyIdentity(c))
+	})
+
+	for apiKey, identity := range map[string]string{
+		validAPIKeyBlue:  APIKeyIdentityBlue,
+		validAPIKeyGreen: APIKeyIdentityGreen,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("x-api-key", apiKey)
+		rec := httptest.NewRecorder()
+
+		err := handler(e.NewContext(req, rec))
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, identity, rec.Body.String())
+	}
+}
+
+func TestAPIKeyIdentity_NotAuthenticated(t *testing.T) {
+	e := echo.New()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+	assert.Equal(t, "", APIKeyIdentity(c))
+}
+
+// fakeAPIKeyStore serves issued keys from memory, keyed by hash
+type fakeAPIKeyStore struct {
+	keys    map[string]db.ApiKey
+	err     error
+	touched []int64
+}
+
+func (s *fakeAPIKeyStore) GetAPIKeyByHash(_ context.Context, keyHash string) (db.ApiKey, error) {
+	if s.err != nil {
+		return db.ApiKey{}, s.err
+	}
+	key, ok := s.keys[keyHash]
+	if !ok {
+		return db.ApiKey{}, pgx.ErrNoRows
+	}
+	return key, nil
+}
+
+func (s *fakeAPIKeyStore) TouchAPIKey(_ context.Context, id int64) error {
+	s.touched = append(s.touched, id)
+	return nil
+}
+
+const issuedAPIKey = "person-service-key-12345678-90ab-cdef-1234-567890abcdef"
+
+func TestAPIKeyMiddleware_IssuedKey(t *testing.T) {
+	os.Unsetenv("PERSON_API_KEY_BLUE")
+	os.Unsetenv("PERSON_API_KEY_GREEN")
+
+	store := &fakeAPIKeyStore{keys: map[string]db.ApiKey{
+		HashAPIKey(issuedAPIKey): {ID: 7, Name: "billing", Scopes: []string{ScopeKV}},
+	}}
+	e := echo.New()
+	handler := APIKeyMiddleware(store)(func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]interface{}{"identity": APIKeyIdentity(c), "scopes": APIKeyScopes(c)})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("x-api-key", issuedAPIKey)
+	rec := httptest.NewRecorder()
+
+	err := handler(e.NewContext(req, rec))
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"identity":"billing","scopes":["kv"]}`, rec.Body.String())
+	assert.Equal(t, []int64{7}, store.touched)
+}
+
+func TestAPIKeyMiddleware_SetsPrincipal(t *testing.T) {
+	os.Setenv("PERSON_API_KEY_BLUE", validAPIKeyBlue)
+	defer os.Unsetenv("PERSON_API_KEY_BLUE")
+	os.Unsetenv("PERSON_API_KEY_GREEN")
+
+	store := &fakeAPIKeyStore{keys: map[string]db.ApiKey{
+		HashAPIKey(issuedAPIKey): {ID: 7, Name: "billing", Owner: "team-billing", Scopes: []string{ScopeKV}},
+	}}
+	e := echo.New()
+	var principal Principal
+	var ok bool
+	handler := APIKeyMiddleware(store)(func(c echo.Context) error {
+		principal, ok = PrincipalFromContext(c.Request().Context())
+		return c.NoContent(http.StatusOK)
+	})
+
+	for apiKey, expected := range map[string]Principal{
+		validAPIKeyBlue: {Name: APIKeyIdentityBlue},
+		issuedAPIKey:    {Name: "billing", Owner: "team-billing"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("x-api-key", apiKey)
+		rec := httptest.NewRecorder()
+
+		err := handler(e.NewContext(req, rec))
+
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, expected, principal)
+	}
+}
+
+func TestPrincipalFromContext_NotAuthenticated(t *testing.T) {
+	_, ok := PrincipalFromContext(context.Background())
+
+	assert.False(t, ok)
+}
+
+func TestAPIKeyMiddleware_IssuedKeyRejected(t *testing.T) {
+	os.Setenv("PERSON_API_KEY_BLUE", validAPIKeyBlue)
+	defer os.Unsetenv("PERSON_API_KEY_BLUE")
+
+	expired := db.ApiKey{
+		ID:        1,
+		Name:      "old",
+		Scopes:    []string{ScopeKV},
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(-time.Minute), Valid: true},
+	}
+
+	tests := []struct {
+		name      string
+		store     *fakeAPIKeyStore
+		status    int
+		errorCode string
+	}{
+		{"unknown or revoked key", &fakeAPIKeyStore{}, http.StatusUnauthorized, "API_004_INVALID_API_KEY"},
+		{"expired key", &fakeAPIKeyStore{keys: map[string]db.ApiKey{HashAPIKey(issuedAPIKey): expired}}, http.StatusUnauthorized, "API_005_API_KEY_EXPIRED"},
+		{"store failure", &fakeAPIKeyStore{err: errors.New("connection refused")}, http.StatusInternalServerError, "API_201_FAILED_VERIFY_API_KEY"},
+	}
+
+	e := echo.New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := APIKeyMiddleware(tt.store)(func(c echo.Context) error {
+				return c.String(http.StatusOK, "OK")
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("x-api-key", issuedAPIKey)
+			rec := httptest.NewRecorder()
+
+			err := handler(e.NewContext(req, rec))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.errorCode)
+			assert.Empty(t, tt.store.touched)
+		})
+	}
+}
+
+func TestAPIKeyMiddleware_EnvKeysHaveEveryScope(t *testing.T) {
+	os.Setenv("PERSON_API_KEY_BLUE", validAPIKeyBlue)
+	defer os.Unsetenv("PERSON_API_KEY_BLUE")
+
+	e := echo.New()
+	handler := APIKeyMiddleware(&fakeAPIKeyStore{})(func(c echo.Context) error {
+		assert.Equal(t, Scopes, APIKeyScopes(c))
+		return c.String(http.StatusOK, APIKeyIdentity(c))
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("x-api-key", validAPIKeyBlue)
+	rec := httptest.NewRecorder()
+
+	assert.NoError(t, handler(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, APIKeyIdentityBlue, rec.Body.String())
+}
+
+func TestRequireScope_PersonsErase(t *testing.T) {
+	handler := RequireScope(ScopePersonsErase)(func(c echo.Context) error {
+		return c.String(http.StatusOK, "OK")
+	})
+
+	tests := []struct {
+		name   string
+		scopes []string
+		status int
+	}{
+		{"write scope is not enough", []string{ScopeAttributesRead, ScopeAttributesWrite}, http.StatusForbidden},
+		{"erase scope", []string{ScopePersonsErase}, http.StatusOK},
+		{"admin implies erase", []string{ScopeAdmin}, http.StatusOK},
+	}
+
+	e := echo.New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+			c.Set(EchoAPIKeyScopesKey, tt.scopes)
+
+			assert.NoError(t, handler(c))
+			assert.Equal(t, tt.status, rec.Code)
+		})
+	}
+}
+
+func TestRequireMethodScope(t *testing.T) {
+	handler := RequireMethodScope(ScopeAttributesRead, ScopeAttributesWrite)(func(c echo.Context) error {
+		return c.String(http.StatusOK, "OK")
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		scopes []string
+		status int
+	}{
+		{"read with read scope", http.MethodGet, []string{ScopeAttributesRead}, http.StatusOK},
+		{"write with read scope", http.MethodPost, []string{ScopeAttributesRead}, http.StatusForbidden},
+		{"write with write scope", http.MethodDelete, []string{ScopeAttributesWrite}, http.StatusOK},
+		{"read with unrelated scope", http.MethodGet, []string{ScopeKV}, http.StatusForbidden},
+		{"admin implies every scope", http.MethodPut, []string{ScopeAdmin}, http.StatusOK},
+		{"not authenticated", http.MethodGet, nil, http.StatusForbidden},
+	}
+
+	e := echo.New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(tt.method, "/", nil), rec)
+			if tt.scopes != nil {
+				c.Set(EchoAPIKeyScopesKey, tt.scopes)
+			}
+
+			assert.NoError(t, handler(c))
+			assert.Equal(t, tt.status, rec.Code)
+			if tt.status == http.StatusForbidden {
+				assert.Contains(t, rec.Body.String(), "API_301_INSUFFICIENT_SCOPE")
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import "github.com/labstack/echo/v4"
+
+// Authenticators are the authentication schemes AuthMiddleware accepts besides
+// the environment API keys. A nil field disables its scheme.
+type Authenticators struct {
+	// APIKeys looks up issued API keys
+	APIKeys APIKeyStore
+	// JWT verifies "Authorization: Bearer" tokens
+	JWT *JWTVerifier
+	// Signatures verifies signed requests
+	Signatures *SignatureVerifier
+	// ClientCerts maps mutual TLS client certificates to identities
+	ClientCerts *ClientCertAuthenticator
+}
+
+// AuthMiddleware creates a middleware that authenticates each request with the
+// scheme it uses:
+//   - signed requests (X-Signature header) through SignatureMiddleware
+//   - "Authorization: Bearer" requests through JWTMiddleware
+//   - requests with an x-api-key header through APIKeyMiddleware
+//   - other requests with a verified client certificate through ClientCertMiddleware
+//   - every other request through APIKeyMiddleware, which rejects it
+//
+// Schemes whose authenticator is nil are skipped.
+func AuthMiddleware(auth Authenticators) echo.MiddlewareFunc {
+	apiKey := APIKeyMiddleware(auth.APIKeys)
+	if auth.JWT == nil && auth.Signatures == nil && auth.ClientCerts == nil {
+		return apiKey
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withAPIKey := apiKey(next)
+		var withBearer, withSignature, withClientCert echo.HandlerFunc
+		if auth.JWT != nil {
+			withBearer = JWTMiddleware(auth.JWT)(next)
+		}
+		if auth.Signatures != nil {
+			withSignature = SignatureMiddleware(auth.Signatures)(next)
+		}
+		if auth.ClientCerts != nil {
+			withClientCert = ClientCertMiddleware(auth.ClientCerts)(next)
+		}
+
+		return func(c echo.Context) error {
+			if withSignature != nil && hasSignature(c) {
+				return withSignature(c)
+			}
+			if _, ok := bearerToken(c); ok && withBearer != nil {
+				return withBearer(c)
+			}
+			if c.Request().Header.Get("x-api-key") != "" {
+				return withAPIKey(c)
+			}
+			if _, ok := clientCertificate(c); ok && withClientCert != nil {
+				return withClientCert(c)
+			}
+			return withAPIKey(c)
+		}
+	}
+}
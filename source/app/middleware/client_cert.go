@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	errs "person-service/errors"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Parts of a client certificate the caller identity can be read from
+const (
+	// ClientIdentityCN reads the identity from the subject common name
+	ClientIdentityCN = "cn"
+	// ClientIdentityDNS reads the identity from the first DNS subject alternative name
+	ClientIdentityDNS = "san-dns"
+	// ClientIdentityURI reads the identity from the first URI subject alternative name (e.g. SPIFFE IDs)
+	ClientIdentityURI = "san-uri"
+	// ClientIdentityEmail reads the identity from the first email subject alternative name
+	ClientIdentityEmail = "san-email"
+)
+
+// ClientCertIdentityPrefix prefixes the identity of client certificates. Issued
+// key names cannot contain ':', so a certificate can never act as an issued or
+// environment key.
+const ClientCertIdentityPrefix = "cert:"
+
+// ClientCertAuthenticator maps verified client certificates of mutual TLS
+// connections to caller identities and their scopes
+type ClientCertAuthenticator struct {
+	source string
+	scopes map[string][]string
+}
+
+// NewClientCertAuthenticator creates an authenticator that reads identities from
+// source (one of the ClientIdentity* constants) and grants them scopes
+func NewClientCertAuthenticator(source string, scopes map[string][]string) (*ClientCertAuthenticator, error) {
+	switch source {
+	case ClientIdentityCN, ClientIdentityDNS, ClientIdentityURI, ClientIdentityEmail:
+	default:
+		return nil, fmt.Errorf("unknown client identity source %q, expected %s, %s, %s or %s",
+			source, ClientIdentityCN, ClientIdentityDNS, ClientIdentityURI, ClientIdentityEmail)
+	}
+	return &ClientCertAuthenticator{source: source, scopes: scopes}, nil
+}
+
+// LoadClientCertAuthenticator reads client certificate authentication from
+// environment variables. It returns nil when TLS_CLIENT_CA_FILE is unset:
+//   - TLS_CLIENT_IDENTITY: part of the certificate holding the identity (default "cn")
+//   - TLS_CLIENT_SCOPES: scopes per identity (see ParseClientScopes); identities
+//     not listed are authenticated without scopes
+func LoadClientCertAuthenticator() (*ClientCertAuthenticator, error) {
+	if os.Getenv("TLS_CLIENT_CA_FILE") == "" {
+		return nil, nil
+	}
+
+	source := os.Getenv("TLS_CLIENT_IDENTITY")
+	if source == "" {
+		source = ClientIdentityCN
+	}
+	scopes, err := ParseClientScopes(os.Getenv("TLS_CLIENT_SCOPES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS_CLIENT_SCOPES: %w", err)
+	}
+
+	authenticator, err := NewClientCertAuthenticator(source, scopes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS_CLIENT_IDENTITY: %w", err)
+	}
+	return authenticator, nil
+}
+
+// ParseClientScopes reads client certificate scopes in the form
+//
+//	identity=scope,scope;identity=scope
+func ParseClientScopes(raw string) (map[string][]string, error) {
+	scopes := map[string][]string{}
+	for _, entry := range strings.Split(raw, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		identity, list, ok := strings.Cut(entry, "=")
+		identity = strings.TrimSpace(identity)
+		if !ok || identity == "" {
+			return nil, fmt.Errorf("entry %q must be identity=scope,scope", entry)
+		}
+		if identity == APIKeyIdentityBlue || identity == APIKeyIdentityGreen {
+			return nil, fmt.Errorf("identity %q is reserved for the environment API keys", identity)
+		}
+		if _, exists := scopes[identity]; exists {
+			return nil, fmt.Errorf("identity %q is listed more than once", identity)
+		}
+
+		granted := []string{}
+		for _, scope := range strings.Split(list, ",") {
+			scope = strings.TrimSpace(scope)
+			if !slices.Contains(Scopes, scope) {
+				return nil, fmt.Errorf("unknown scope %q for identity %q", scope, identity)
+			}
+			granted = append(granted, scope)
+		}
+		scopes[identity] = granted
+	}
+	return scopes, nil
+}
+
+// Identity returns the caller identity of cert, "" when the certificate has no
+// value in the configured part
+func (a *ClientCertAuthenticator) Identity(cert *x509.Certificate) string {
+	switch a.source {
+	case ClientIdentityDNS:
+		if len(cert.DNSNames) > 0 {
+			return cert.DNSNames[0]
+		}
+	case ClientIdentityURI:
+		if len(cert.URIs) > 0 {
+			return cert.URIs[0].String()
+		}
+	case ClientIdentityEmail:
+		if len(cert.EmailAddresses) > 0 {
+			return cert.EmailAddresses[0]
+		}
+	default:
+		return cert.Subject.CommonName
+	}
+	return ""
+}
+
+// Scopes returns the scopes granted to identity
+func (a *ClientCertAuthenticator) Scopes(identity string) []string {
+	if scopes, ok := a.scopes[identity]; ok {
+		return scopes
+	}
+	return []string{}
+}
+
+// clientCertificate returns the verified leaf certificate of a mutual TLS request
+func clientCertificate(c echo.Context) (*x509.Certificate, bool) {
+	state := c.Request().TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	return state.VerifiedChains[0][0], true
+}
+
+// ClientCertMiddleware creates a middleware that authenticates mutual TLS requests
+// by their verified client certificate. The identity of the certificate, prefixed
+// with ClientCertIdentityPrefix, is stored like the identity of an API key, so
+// KV_NAMESPACE_GRANTS and audit records treat it like the name of an issued key,
+// and its scopes like the scopes of an API key.
+func ClientCertMiddleware(authenticator *ClientCertAuthenticator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			cert, ok := clientCertificate(c)
+			if !ok {
+				return c.JSON(http.StatusUnauthorized, errs.ErrorResponse{
+					Message:   "Missing verified client certificate",
+					ErrorCode: errs.ErrInvalidClientCert,
+				})
+			}
+
+			identity := authenticator.Identity(cert)
+			if identity == "" {
+				return c.JSON(http.StatusUnauthorized, errs.ErrorResponse{
+					Message:   "Client certificate has no " + authenticator.source + " identity",
+					ErrorCode: errs.ErrInvalidClientCert,
+				})
+			}
+
+			c.Set(EchoAPIKeyIdentityKey, ClientCertIdentityPrefix+identity)
+			c.Set(EchoAPIKeyScopesKey, authenticator.Scopes(identity))
+
+			// Attach the principal to the request context for audit records
+			ctx := ContextWithPrincipal(c.Request().Context(), Principal{Name: ClientCertIdentityPrefix + identity})
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}
+}
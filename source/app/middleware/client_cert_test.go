@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func testClientCert() *x509.Certificate {
+	spiffe, _ := url.Parse("spiffe://cluster.local/ns/orders/sa/orders")
+	return &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "orders"},
+		DNSNames:       []string{"orders.internal"},
+		URIs:           []*url.URL{spiffe},
+		EmailAddresses: []string{"orders@example.com"},
+	}
+}
+
+// newMutualTLSRequest builds a request whose connection presented a verified cert
+func newMutualTLSRequest(cert *x509.Certificate) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if cert != nil {
+		req.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+			VerifiedChains:   [][]*x509.Certificate{{cert}},
+		}
+	}
+	return req
+}
+
+func TestParseClientScopes(t *testing.T) {
+	scopes, err := ParseClientScopes("orders=attributes:read,kv; billing=admin")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"orders":  {ScopeAttributesRead, ScopeKV},
+		"billing": {ScopeAdmin},
+	}, scopes)
+
+	for _, raw := range []string{"orders", "orders=kv:write", "orders=kv;orders=admin", "blue=kv"} {
+		_, err := ParseClientScopes(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestLoadClientCertAuthenticator(t *testing.T) {
+	defer os.Unsetenv("TLS_CLIENT_CA_FILE")
+	defer os.Unsetenv("TLS_CLIENT_IDENTITY")
+
+	os.Unsetenv("TLS_CLIENT_CA_FILE")
+	authenticator, err := LoadClientCertAuthenticator()
+	assert.NoError(t, err)
+	assert.Nil(t, authenticator)
+
+	os.Setenv("TLS_CLIENT_CA_FILE", "/etc/tls/clients.pem")
+	authenticator, err = LoadClientCertAuthenticator()
+	assert.NoError(t, err)
+	assert.Equal(t, ClientIdentityCN, authenticator.source)
+
+	os.Setenv("TLS_CLIENT_IDENTITY", "serial")
+	_, err = LoadClientCertAuthenticator()
+	assert.ErrorContains(t, err, "TLS_CLIENT_IDENTITY")
+}
+
+func TestClientCertAuthenticator_Identity(t *testing.T) {
+	cert := testClientCert()
+	expected := map[string]string{
+		ClientIdentityCN:    "orders",
+		ClientIdentityDNS:   "orders.internal",
+		ClientIdentityURI:   "spiffe://cluster.local/ns/orders/sa/orders",
+		ClientIdentityEmail: "orders@example.com",
+	}
+
+	for source, identity := range expected {
+		authenticator, err := NewClientCertAuthenticator(source, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, identity, authenticator.Identity(cert))
+		assert.Equal(t, "", authenticator.Identity(&x509.Certificate{}))
+	}
+}
+
+func TestClientCertMiddleware(t *testing.T) {
+	authenticator, err := NewClientCertAuthenticator(ClientIdentityDNS, map[string][]string{"orders.internal": {ScopeKV}})
+	assert.NoError(t, err)
+	e := echo.New()
+	var principal Principal
+	handler := AuthMiddleware(Authenticators{ClientCerts: authenticator})(func(c echo.Context) error {
+		principal, _ = PrincipalFromContext(c.Request().Context())
+		return c.JSON(http.StatusOK, map[string]interface{}{"identity": APIKeyIdentity(c), "scopes": APIKeyScopes(c)})
+	})
+
+	tests := []struct {
+		name   string
+		cert   *x509.Certificate
+		status int
+		body   string
+	}{
+		{"mapped identity", testClientCert(), http.StatusOK, `{"identity":"cert:orders.internal","scopes":["kv"]}`},
+		{"unmapped identity has no scopes", &x509.Certificate{DNSNames: []string{"reports.internal"}}, http.StatusOK, `{"identity":"cert:reports.internal","scopes":[]}`},
+		{"certificate without identity", &x509.Certificate{Subject: pkix.Name{CommonName: "orders"}}, http.StatusUnauthorized, "API_015_INVALID_CLIENT_CERTIFICATE"},
+		{"no certificate falls back to x-api-key", nil, http.StatusUnauthorized, "API_001_MISSING_API_KEY"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+
+			err := handler(e.NewContext(newMutualTLSRequest(tt.cert), rec))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, rec.Code)
+			if tt.status == http.StatusOK {
+				assert.JSONEq(t, tt.body, rec.Body.String())
+				assert.Equal(t, ClientCertIdentityPrefix+tt.cert.DNSNames[0], principal.Name)
+			} else {
+				assert.Contains(t, rec.Body.String(), tt.body)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_APIKeyTakesPrecedenceOverClientCert(t *testing.T) {
+	os.Setenv("PERSON_API_KEY_BLUE", validAPIKeyBlue)
+	defer os.Unsetenv("PERSON_API_KEY_BLUE")
+
+	authenticator, err := NewClientCertAuthenticator(ClientIdentityCN, nil)
+	assert.NoError(t, err)
+	e := echo.New()
+	handler := AuthMiddleware(Authenticators{ClientCerts: authenticator})(func(c echo.Context) error {
+		return c.String(http.StatusOK, APIKeyIdentity(c))
+	})
+
+	req := newMutualTLSRequest(testClientCert())
+	req.Header.Set("x-api-key", validAPIKeyBlue)
+	rec := httptest.NewRecorder()
+
+	err = handler(e.NewContext(req, rec))
+
+	assert.NoError(t, err)
+	assert.Equal(t, APIKeyIdentityBlue, rec.Body.String())
+}
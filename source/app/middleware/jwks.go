@@ -0,0 +1,276 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"person-service/logging"
+)
+
+const (
+	// maxJWKSBytes bounds the size of a JWKS document
+	maxJWKSBytes = 1 << 20
+
+	// minJWKSRefetchInterval bounds how often a JWKS URL is fetched again, so tokens
+	// naming unknown key IDs cannot make every request fetch it
+	minJWKSRefetchInterval = time.Minute
+
+	// jwksFetchTimeout bounds a fetch of a JWKS URL
+	jwksFetchTimeout = 5 * time.Second
+)
+
+// jwk is a JSON Web Key of a JWKS document (RFC 7517)
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA keys
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC keys
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// signingKey is a public key of a JWKS with the algorithm it is restricted to ("" for any)
+type signingKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// JWKS holds the public keys that sign bearer tokens, loaded from a file or an
+// http(s) URL. Keys loaded from a URL are fetched again when a token names an
+// unknown key ID or the keys are older than the refresh interval, at most once
+// per minute; when that fetch fails the previous keys are kept. A single fetch
+// runs at a time, in the background, so requests never hold the lock during it.
+type JWKS struct {
+	source  string
+	refresh time.Duration
+	client  *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]signingKey
+	fetchedAt time.Time
+	// refreshing is closed when the running fetch ends, nil when none runs
+	refreshing chan struct{}
+}
+
+// LoadJWKS loads the JWKS at source, a file path or an http(s) URL
+func LoadJWKS(ctx context.Context, source string, refresh time.Duration) (*JWKS, error) {
+	j := &JWKS{
+		source:  source,
+		refresh: refresh,
+		client:  &http.Client{Timeout: jwksFetchTimeout},
+	}
+
+	keys, err := j.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	j.keys = keys
+	j.fetchedAt = time.Now()
+	return j, nil
+}
+
+// isURL reports whether the JWKS is fetched over HTTP rather than read from a file
+func (j *JWKS) isURL() bool {
+	return strings.HasPrefix(j.source, "https://") || strings.HasPrefix(j.source, "http://")
+}
+
+// fetch reads and parses the JWKS document
+func (j *JWKS) fetch(ctx context.Context) (map[string]signingKey, error) {
+	if !j.isURL() {
+		data, err := os.ReadFile(j.source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWKS: %w", err)
+		}
+		return parseJWKS(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: unexpected status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	return parseJWKS(data)
+}
+
+// key returns the signing key with key ID kid. A token without a key ID can only
+// be verified by a JWKS holding a single key. An unknown key ID waits for the
+// keys to be fetched again, at most until ctx is done; stale keys are still used
+// while they are refreshed.
+func (j *JWKS) key(ctx context.Context, kid string) (signingKey, bool) {
+	j.mu.Lock()
+	key, ok := lookupKey(j.keys, kid)
+	stale := j.refresh > 0 && time.Since(j.fetchedAt) > j.refresh
+	done := j.refreshing
+	if done == nil && !(ok && !stale) && j.isURL() && time.Since(j.fetchedAt) >= minJWKSRefetchInterval {
+		j.fetchedAt = time.Now()
+		done = make(chan struct{})
+		j.refreshing = done
+		go j.refreshKeys(done)
+	}
+	j.mu.Unlock()
+
+	if ok || done == nil {
+		return key, ok
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return key, ok
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return lookupKey(j.keys, kid)
+}
+
+// refreshKeys fetches the keys again and closes done. The fetch does not use the
+// context of the request that started it, so that request ending cannot abort it.
+func (j *JWKS) refreshKeys(done chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+	defer cancel()
+
+	keys, err := j.fetch(ctx)
+	if err != nil {
+		logging.WarnContext(ctx, "Failed to refresh JWKS", "error", err, "jwks", j.source)
+	}
+
+	j.mu.Lock()
+	if err == nil {
+		j.keys = keys
+	}
+	j.refreshing = nil
+	j.mu.Unlock()
+	close(done)
+}
+
+func lookupKey(keys map[string]signingKey, kid string) (signingKey, bool) {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	key, ok := keys[kid]
+	return key, ok
+}
+
+// parseJWKS parses a JWKS document into its signature keys by key ID.
+// Encryption keys and key types other than RSA and EC are skipped.
+func parseJWKS(data []byte) (map[string]signingKey, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]signingKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var key crypto.PublicKey
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = k.rsaPublicKey()
+		case "EC":
+			key, err = k.ecPublicKey()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWKS key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = signingKey{alg: k.Alg, key: key}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("invalid JWKS: no RSA or EC signature keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("modulus: %w", err)
+	}
+	e, err := decodeBigInt(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("exponent: %w", err)
+	}
+	if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+		return nil, errors.New("exponent out of range")
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func (k jwk) ecPublicKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+
+	x, err := decodeBigInt(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("x: %w", err)
+	}
+	y, err := decodeBigInt(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("y: %w", err)
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, errors.New("point is not on the curve")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, errors.New("missing")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
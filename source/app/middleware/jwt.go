@@ -0,0 +1,367 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256" // registers crypto.SHA256
+	_ "crypto/sha512" // registers crypto.SHA384 and crypto.SHA512
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	errs "person-service/errors"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultJWTScopeClaim    = "scope"
+	defaultJWTIdentityClaim = "sub"
+	defaultJWTClockSkew     = time.Minute
+	defaultJWKSRefresh      = time.Hour
+)
+
+// JWTIdentityPrefix prefixes the identity of bearer tokens. Issued key names
+// cannot contain ':', so a token can never act as an issued or environment key.
+const JWTIdentityPrefix = "jwt:"
+
+// errTokenExpired is returned by JWTVerifier.Verify for tokens past their exp claim
+var errTokenExpired = errors.New("token has expired")
+
+// JWTConfig configures bearer token authentication
+type JWTConfig struct {
+	// JWKS is the file path or http(s) URL of the keys that sign tokens
+	JWKS string
+	// Issuer is the required iss claim
+	Issuer string
+	// Audience must be the aud claim or one of its values
+	Audience string
+	// ScopeClaim holds the scopes of a token, space separated or as an array
+	ScopeClaim string
+	// IdentityClaim holds the identity of a token, used like the name of an API key
+	IdentityClaim string
+	// ClockSkew is the leeway applied to the exp and nbf claims
+	ClockSkew time.Duration
+	// JWKSRefresh is how long keys fetched from a URL are used before fetching them again
+	JWKSRefresh time.Duration
+}
+
+// LoadJWTConfig reads bearer token authentication from environment variables.
+// It returns nil when JWT_JWKS is unset, which disables bearer tokens:
+//   - JWT_JWKS: JWKS file path or http(s) URL
+//   - JWT_ISSUER: required iss claim
+//   - JWT_AUDIENCE: required aud claim
+//   - JWT_SCOPE_CLAIM: claim holding the scopes (default "scope")
+//   - JWT_IDENTITY_CLAIM: claim holding the identity (default "sub")
+//   - JWT_CLOCK_SKEW: Go duration of leeway on exp and nbf (default 1m)
+//   - JWT_JWKS_REFRESH: Go duration between fetches of a JWKS URL (default 1h)
+func LoadJWTConfig() (*JWTConfig, error) {
+	source := os.Getenv("JWT_JWKS")
+	if source == "" {
+		return nil, nil
+	}
+
+	cfg := &JWTConfig{
+		JWKS:          source,
+		Issuer:        os.Getenv("JWT_ISSUER"),
+		Audience:      os.Getenv("JWT_AUDIENCE"),
+		ScopeClaim:    defaultJWTScopeClaim,
+		IdentityClaim: defaultJWTIdentityClaim,
+		ClockSkew:     defaultJWTClockSkew,
+		JWKSRefresh:   defaultJWKSRefresh,
+	}
+	if cfg.Issuer == "" {
+		return nil, errors.New("JWT_ISSUER is required when JWT_JWKS is set")
+	}
+	if cfg.Audience == "" {
+		return nil, errors.New("JWT_AUDIENCE is required when JWT_JWKS is set")
+	}
+	if raw := os.Getenv("JWT_SCOPE_CLAIM"); raw != "" {
+		cfg.ScopeClaim = raw
+	}
+	if raw := os.Getenv("JWT_IDENTITY_CLAIM"); raw != "" {
+		cfg.IdentityClaim = raw
+	}
+
+	if raw := os.Getenv("JWT_CLOCK_SKEW"); raw != "" {
+		skew, err := time.ParseDuration(raw)
+		if err != nil || skew < 0 {
+			return nil, fmt.Errorf("invalid JWT_CLOCK_SKEW %q", raw)
+		}
+		cfg.ClockSkew = skew
+	}
+	if raw := os.Getenv("JWT_JWKS_REFRESH"); raw != "" {
+		refresh, err := time.ParseDuration(raw)
+		if err != nil || refresh <= 0 {
+			return nil, fmt.Errorf("invalid JWT_JWKS_REFRESH %q", raw)
+		}
+		cfg.JWKSRefresh = refresh
+	}
+
+	return cfg, nil
+}
+
+// JWTVerifier verifies bearer tokens against a JWKS and the configured claims
+type JWTVerifier struct {
+	cfg  JWTConfig
+	jwks *JWKS
+	now  func() time.Time
+}
+
+// NewJWTVerifier loads the JWKS of cfg and creates a verifier for its tokens
+func NewJWTVerifier(ctx context.Context, cfg JWTConfig) (*JWTVerifier, error) {
+	jwks, err := LoadJWKS(ctx, cfg.JWKS, cfg.JWKSRefresh)
+	if err != nil {
+		return nil, err
+	}
+	return &JWTVerifier{cfg: cfg, jwks: jwks, now: time.Now}, nil
+}
+
+// Verify checks the signature, issuer, audience, expiry and not-before time of a
+// token and returns its identity and its scopes, keeping only known Scopes
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (identity string, scopes []string, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", nil, errors.New("token is not a signed JWT")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", nil, fmt.Errorf("invalid token header: %w", err)
+	}
+
+	key, ok := v.jwks.key(ctx, header.Kid)
+	if !ok {
+		return "", nil, fmt.Errorf("unknown signing key %q", header.Kid)
+	}
+	if key.alg != "" && key.alg != header.Alg {
+		return "", nil, fmt.Errorf("signing key %q does not allow algorithm %q", header.Kid, header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid token signature: %w", err)
+	}
+	if err := verifySignature(header.Alg, key.key, parts[0]+"."+parts[1], signature); err != nil {
+		return "", nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return "", nil, err
+	}
+
+	identity, _ = claims[v.cfg.IdentityClaim].(string)
+	if identity == "" {
+		return "", nil, fmt.Errorf("token has no %q claim", v.cfg.IdentityClaim)
+	}
+	return identity, tokenScopes(claims[v.cfg.ScopeClaim]), nil
+}
+
+// checkClaims checks the iss, aud, exp and nbf claims
+func (v *JWTVerifier) checkClaims(claims map[string]interface{}) error {
+	if iss, _ := claims["iss"].(string); iss != v.cfg.Issuer {
+		return fmt.Errorf("unexpected issuer %q", iss)
+	}
+
+	switch aud := claims["aud"].(type) {
+	case string:
+		if aud != v.cfg.Audience {
+			return fmt.Errorf("unexpected audience %q", aud)
+		}
+	case []interface{}:
+		if !slices.Contains(aud, interface{}(v.cfg.Audience)) {
+			return errors.New("token is not intended for this audience")
+		}
+	default:
+		return errors.New("token has no audience")
+	}
+
+	now := v.now()
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return errors.New("token has no expiry")
+	}
+	if now.After(exp.Add(v.cfg.ClockSkew)) {
+		return errTokenExpired
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(v.cfg.ClockSkew).Before(nbf) {
+		return errors.New("token is not valid yet")
+	}
+	return nil
+}
+
+// verifySignature verifies an RS*, PS* or ES* signature of signingInput.
+// Every other algorithm, including "none" and the HMAC ones, is rejected.
+func verifySignature(alg string, key crypto.PublicKey, signingInput string, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signingInput))
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %q needs an RSA key", alg)
+		}
+		var err error
+		if alg[:2] == "RS" {
+			err = rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+		} else {
+			err = rsa.VerifyPSS(pub, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		if err != nil {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %q needs an EC key", alg)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+}
+
+// decodeSegment decodes a base64url JSON segment of a token
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// numericDate converts a NumericDate claim (seconds since the epoch) to a time
+func numericDate(claim interface{}) (time.Time, bool) {
+	n, ok := claim.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	whole := int64(seconds)
+	return time.Unix(whole, int64((seconds-float64(whole))*float64(time.Second))), true
+}
+
+// tokenScopes returns the known scopes of a scope claim, either a space separated
+// string (as in OAuth 2.0) or an array of strings
+func tokenScopes(claim interface{}) []string {
+	var values []string
+	switch claim := claim.(type) {
+	case string:
+		values = strings.Fields(claim)
+	case []interface{}:
+		for _, value := range claim {
+			if s, ok := value.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	scopes := []string{}
+	for _, scope := range values {
+		if slices.Contains(Scopes, scope) && !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header
+func bearerToken(c echo.Context) (string, bool) {
+	auth := c.Request().Header.Get(echo.HeaderAuthorization)
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(auth[7:]), true
+}
+
+// JWTMiddleware creates a middleware that authenticates requests with an
+// "Authorization: Bearer <JWT>" header verified by verifier. The identity of the
+// token, prefixed with JWTIdentityPrefix, is stored like the identity of an API
+// key, so KV_NAMESPACE_GRANTS and audit records treat it like the name of an
+// issued key, and its scopes like the scopes of an API key.
+func JWTMiddleware(verifier *JWTVerifier) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token, ok := bearerToken(c)
+			if !ok || token == "" {
+				return c.JSON(http.StatusUnauthorized, errs.ErrorResponse{
+					Message:   "Missing bearer token",
+					ErrorCode: errs.ErrInvalidBearerToken,
+				})
+			}
+
+			// Use request context for trace propagation
+			ctx := c.Request().Context()
+
+			identity, scopes, err := verifier.Verify(ctx, token)
+			if errors.Is(err, errTokenExpired) {
+				return c.JSON(http.StatusUnauthorized, errs.ErrorResponse{
+					Message:   "Bearer token has expired",
+					ErrorCode: errs.ErrBearerTokenExpired,
+				})
+			}
+			if err != nil {
+				return c.JSON(http.StatusUnauthorized, errs.ErrorResponse{
+					Message:   "Invalid bearer token: " + err.Error(),
+					ErrorCode: errs.ErrInvalidBearerToken,
+				})
+			}
+
+			identity = JWTIdentityPrefix + identity
+			c.Set(EchoAPIKeyIdentityKey, identity)
+			c.Set(EchoAPIKeyScopesKey, scopes)
+
+			// Attach the principal to the request context for audit records
+			c.SetRequest(c.Request().WithContext(ContextWithPrincipal(ctx, Principal{Name: identity})))
+			return next(c)
+		}
+	}
+}
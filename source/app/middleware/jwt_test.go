@@ -0,0 +1,333 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testIssuer   = "https://gateway.internal"
+	testAudience = "person-service"
+)
+
+var (
+	testRSAKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	testECKey, _  = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// testJWKS builds a JWKS document with the RSA test key as "rsa-1" and the EC test key as "ec-1"
+func testJWKS() []byte {
+	doc := map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "alg": "RS256",
+			"n": b64(testRSAKey.N.Bytes()), "e": b64(big.NewInt(int64(testRSAKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256",
+			"x": b64(testECKey.X.FillBytes(make([]byte, 32))), "y": b64(testECKey.Y.FillBytes(make([]byte, 32)))},
+	}}
+	data, _ := json.Marshal(doc)
+	return data
+}
+
+// signToken signs claims with the RSA test key (RS256) or the EC test key (ES256)
+func signToken(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch alg {
+	case "RS256":
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, testRSAKey, crypto.SHA256, digest[:])
+		assert.NoError(t, err)
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, testECKey, digest[:])
+		assert.NoError(t, err)
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signingInput + "." + b64(signature)
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"sub":   "orders-service",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "attributes:read kv unknown:scope",
+	}
+}
+
+func newTestVerifier(t *testing.T) *JWTVerifier {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(path, testJWKS(), 0o600))
+
+	verifier, err := NewJWTVerifier(context.Background(), JWTConfig{
+		JWKS:          path,
+		Issuer:        testIssuer,
+		Audience:      testAudience,
+		ScopeClaim:    defaultJWTScopeClaim,
+		IdentityClaim: defaultJWTIdentityClaim,
+		ClockSkew:     defaultJWTClockSkew,
+	})
+	assert.NoError(t, err)
+	return verifier
+}
+
+func TestLoadJWTConfig(t *testing.T) {
+	for _, name := range []string{"JWT_JWKS", "JWT_ISSUER", "JWT_AUDIENCE", "JWT_SCOPE_CLAIM", "JWT_CLOCK_SKEW"} {
+		defer os.Unsetenv(name)
+	}
+
+	os.Unsetenv("JWT_JWKS")
+	cfg, err := LoadJWTConfig()
+	assert.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	os.Setenv("JWT_JWKS", "https://gateway.internal/.well-known/jwks.json")
+	_, err = LoadJWTConfig()
+	assert.ErrorContains(t, err, "JWT_ISSUER")
+
+	os.Setenv("JWT_ISSUER", testIssuer)
+	os.Setenv("JWT_AUDIENCE", testAudience)
+	os.Setenv("JWT_SCOPE_CLAIM", "scp")
+	cfg, err = LoadJWTConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "scp", cfg.ScopeClaim)
+	assert.Equal(t, "sub", cfg.IdentityClaim)
+	assert.Equal(t, time.Minute, cfg.ClockSkew)
+
+	os.Setenv("JWT_CLOCK_SKEW", "soon")
+	_, err = LoadJWTConfig()
+	assert.ErrorContains(t, err, "JWT_CLOCK_SKEW")
+}
+
+func TestJWTVerifier_Verify(t *testing.T) {
+	verifier := newTestVerifier(t)
+
+	identity, scopes, err := verifier.Verify(context.Background(), signToken(t, "RS256", "rsa-1", validClaims()))
+	assert.NoError(t, err)
+	assert.Equal(t, "orders-service", identity)
+	assert.Equal(t, []string{ScopeAttributesRead, ScopeKV}, scopes)
+
+	claims := validClaims()
+	claims["aud"] = []interface{}{"another-service", testAudience}
+	claims["scope"] = []interface{}{"images"}
+	identity, scopes, err = verifier.Verify(context.Background(), signToken(t, "ES256", "ec-1", claims))
+	assert.NoError(t, err)
+	assert.Equal(t, "orders-service", identity)
+	assert.Equal(t, []string{ScopeImages}, scopes)
+}
+
+func TestJWTVerifier_VerifyRejected(t *testing.T) {
+	verifier := newTestVerifier(t)
+	withClaim := func(name string, value interface{}) string {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return signToken(t, "RS256", "rsa-1", claims)
+	}
+	valid := signToken(t, "RS256", "rsa-1", validClaims())
+	unsigned := func(kid string) string {
+		return b64([]byte(`{"alg":"none","kid":"`+kid+`"}`)) + "." + b64([]byte(`{"sub":"x"}`)) + "."
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"not a JWT", "abc", "not a signed JWT"},
+		{"alg none", unsigned("ec-1"), "unsupported algorithm"},
+		{"alg none with a restricted key", unsigned("rsa-1"), "does not allow algorithm"},
+		{"tampered payload", valid[:len(valid)-10] + "AAAAAAAAAA", "invalid token signature"},
+		{"unknown key", signToken(t, "RS256", "rsa-2", validClaims()), "unknown signing key"},
+		{"key used with another algorithm", signToken(t, "ES256", "rsa-1", validClaims()), "does not allow algorithm"},
+		{"wrong issuer", withClaim("iss", "https://elsewhere"), "unexpected issuer"},
+		{"wrong audience", withClaim("aud", "billing"), "unexpected audience"},
+		{"missing audience", withClaim("aud", nil), "no audience"},
+		{"missing expiry", withClaim("exp", nil), "no expiry"},
+		{"expired", withClaim("exp", time.Now().Add(-2*time.Minute).Unix()), "token has expired"},
+		{"not valid yet", withClaim("nbf", time.Now().Add(2*time.Minute).Unix()), "not valid yet"},
+		{"missing identity", withClaim("sub", nil), "no \"sub\" claim"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := verifier.Verify(context.Background(), tt.token)
+			assert.ErrorContains(t, err, tt.want)
+		})
+	}
+}
+
+func TestJWTVerifier_ClockSkew(t *testing.T) {
+	verifier := newTestVerifier(t)
+	claims := validClaims()
+	claims["exp"] = time.Now().Add(-30 * time.Second).Unix()
+
+	_, _, err := verifier.Verify(context.Background(), signToken(t, "RS256", "rsa-1", claims))
+
+	assert.NoError(t, err)
+}
+
+func TestJWKS_RefetchesUnknownKeyFromURL(t *testing.T) {
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) == 1 {
+			w.Write([]byte(`{"keys":[{"kty":"EC","kid":"old","crv":"P-256","x":"` +
+				b64(testECKey.X.FillBytes(make([]byte, 32))) + `","y":"` + b64(testECKey.Y.FillBytes(make([]byte, 32))) + `"}]}`))
+			return
+		}
+		w.Write(testJWKS())
+	}))
+	defer server.Close()
+
+	jwks, err := LoadJWKS(context.Background(), server.URL, time.Hour)
+	assert.NoError(t, err)
+
+	// A recent fetch is not repeated
+	_, ok := jwks.key(context.Background(), "rsa-1")
+	assert.False(t, ok)
+	assert.Equal(t, int32(1), fetches.Load())
+
+	jwks.fetchedAt = time.Now().Add(-2 * minJWKSRefetchInterval)
+	_, ok = jwks.key(context.Background(), "rsa-1")
+	assert.True(t, ok)
+	assert.Equal(t, int32(2), fetches.Load())
+}
+
+func TestJWKS_ConcurrentRefetchesShareOneFetch(t *testing.T) {
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) > 1 {
+			<-release
+		}
+		w.Write(testJWKS())
+	}))
+	defer server.Close()
+
+	jwks, err := LoadJWKS(context.Background(), server.URL, time.Hour)
+	assert.NoError(t, err)
+	jwks.fetchedAt = time.Now().Add(-2 * minJWKSRefetchInterval)
+
+	// A request that gives up does not abort the fetch, and known keys do not wait for it
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, ok := jwks.key(ctx, "rotated")
+	assert.False(t, ok)
+	_, ok = jwks.key(context.Background(), "rsa-1")
+	assert.True(t, ok)
+
+	results := make(chan bool, 5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			_, ok := jwks.key(context.Background(), "rotated")
+			results <- ok
+		}()
+	}
+	close(release)
+	for i := 0; i < 5; i++ {
+		assert.False(t, <-results)
+	}
+	assert.Equal(t, int32(2), fetches.Load())
+}
+
+func TestParseJWKS_Invalid(t *testing.T) {
+	_, err := parseJWKS([]byte(`{"keys":[{"kty":"oct","k":"c2VjcmV0"}]}`))
+	assert.ErrorContains(t, err, "no RSA or EC signature keys")
+
+	_, err = parseJWKS([]byte(`{"keys":[{"kty":"EC","kid":"bad","crv":"P-256","x":"AQ","y":"AQ"}]}`))
+	assert.ErrorContains(t, err, "not on the curve")
+}
+
+func TestJWTMiddleware(t *testing.T) {
+	verifier := newTestVerifier(t)
+	e := echo.New()
+	var principal Principal
+	handler := AuthMiddleware(Authenticators{JWT: verifier})(func(c echo.Context) error {
+		principal, _ = PrincipalFromContext(c.Request().Context())
+		return c.JSON(http.StatusOK, map[string]interface{}{"identity": APIKeyIdentity(c), "scopes": APIKeyScopes(c)})
+	})
+
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+
+	tests := []struct {
+		name   string
+		header string
+		status int
+		body   string
+	}{
+		{"valid token", "Bearer " + signToken(t, "RS256", "rsa-1", validClaims()), http.StatusOK, `{"identity":"jwt:orders-service","scopes":["attributes:read","kv"]}`},
+		{"expired token", "Bearer " + signToken(t, "RS256", "rsa-1", expired), http.StatusUnauthorized, "API_008_BEARER_TOKEN_EXPIRED"},
+		{"invalid token", "bearer abc", http.StatusUnauthorized, "API_007_INVALID_BEARER_TOKEN"},
+		{"empty token", "Bearer ", http.StatusUnauthorized, "API_007_INVALID_BEARER_TOKEN"},
+		{"no bearer token falls back to x-api-key", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, "API_001_MISSING_API_KEY"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(echo.HeaderAuthorization, tt.header)
+			rec := httptest.NewRecorder()
+
+			err := handler(e.NewContext(req, rec))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, rec.Code)
+			if tt.status == http.StatusOK {
+				assert.JSONEq(t, tt.body, rec.Body.String())
+				assert.Equal(t, Principal{Name: "jwt:orders-service"}, principal)
+			} else {
+				assert.Contains(t, rec.Body.String(), tt.body)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_WithoutVerifierIgnoresBearer(t *testing.T) {
+	os.Setenv("PERSON_API_KEY_BLUE", validAPIKeyBlue)
+	defer os.Unsetenv("PERSON_API_KEY_BLUE")
+
+	e := echo.New()
+	handler := AuthMiddleware(Authenticators{})(func(c echo.Context) error {
+		return c.String(http.StatusOK, APIKeyIdentity(c))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer abc")
+	req.Header.Set("x-api-key", validAPIKeyBlue)
+	rec := httptest.NewRecorder()
+
+	err := handler(e.NewContext(req, rec))
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, APIKeyIdentityBlue, rec.Body.String())
+}
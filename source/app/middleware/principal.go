@@ -0,0 +1,33 @@
+package middleware
+
+import "context"
+
+// principalContextKey is the context key for storing the authenticated principal
+type principalContextKey struct{}
+
+// Principal is the authenticated caller of a request: the API key or bearer token
+// that authenticated it, as opposed to the caller a request body claims to be
+type Principal struct {
+	// Name is the identity of the API key: "blue", "green", the name of an issued key
+	// or the identity claim of a bearer token
+	Name string
+	// Owner is the owner of an issued key, empty for the environment keys and bearer tokens
+	Owner string
+}
+
+// ContextWithPrincipal creates a new context with the authenticated principal stored.
+func ContextWithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+// PrincipalFromContext retrieves the authenticated principal from the context.
+// ok is false when the request was not authenticated by APIKeyMiddleware, JWTMiddleware,
+// SignatureMiddleware or ClientCertMiddleware.
+func PrincipalFromContext(ctx context.Context) (principal Principal, ok bool) {
+	if ctx == nil {
+		return Principal{}, false
+	}
+
+	principal, ok = ctx.Value(principalContextKey{}).(Principal)
+	return principal, ok
+}
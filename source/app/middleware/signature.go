@@ -0,0 +1,354 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	errs "person-service/errors"
+	"person-service/logging"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// SignatureKeyIDHeader names the signing key of a signed request
+	SignatureKeyIDHeader = "X-Signature-Key-Id"
+	// SignatureTimestampHeader holds the Unix time (seconds) a request was signed at
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	// SignatureNonceHeader holds a value unique to each signed request
+	SignatureNonceHeader = "X-Signature-Nonce"
+	// SignatureHeader holds the hex encoded HMAC-SHA256 of the request (see RequestSignature)
+	SignatureHeader = "X-Signature"
+
+	defaultSignatureClockSkew = 5 * time.Minute
+	// defaultSignatureMaxBodyBytes bounds the body read to check a signature
+	defaultSignatureMaxBodyBytes = 10 << 20
+	minSigningSecretLength       = 32
+	maxNonceLength               = 128
+)
+
+// SignatureIdentityPrefix prefixes the key ID of signed requests. Issued key
+// names cannot contain ':', so a signing key can never act as an issued or
+// environment key.
+const SignatureIdentityPrefix = "sig:"
+
+var (
+	// errSignatureExpired is returned by SignatureVerifier.Verify for timestamps outside the clock skew
+	errSignatureExpired = errors.New("signature timestamp is outside the allowed clock skew")
+	// errReplayedNonce is returned by SignatureVerifier.Verify for nonces already used
+	errReplayedNonce = errors.New("nonce has already been used")
+)
+
+// SigningKey is a shared secret that signs requests, with the identity and scopes
+// its requests are authorized with
+type SigningKey struct {
+	// ID is sent in X-Signature-Key-Id and used like the name of an API key
+	ID     string   `json:"id"`
+	Secret string   `json:"secret"`
+	Owner  string   `json:"owner"`
+	Scopes []string `json:"scopes"`
+}
+
+// NonceStore remembers the nonces of signed requests until they expire
+type NonceStore interface {
+	// Remember records nonce for keyID until expiresAt. It returns false when
+	// the nonce is already recorded.
+	Remember(ctx context.Context, keyID, nonce string, expiresAt time.Time) (bool, error)
+}
+
+// MemoryNonceStore is a NonceStore local to the process. With several instances a
+// nonce can be replayed once against each other instance within the clock skew.
+type MemoryNonceStore struct {
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryNonceStore creates a new, empty MemoryNonceStore
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{nonces: make(map[string]time.Time), now: time.Now}
+}
+
+// Remember implements NonceStore. Expired nonces are dropped at most once a second.
+func (s *MemoryNonceStore) Remember(_ context.Context, keyID, nonce string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) >= time.Second {
+		for key, expiry := range s.nonces {
+			if !expiry.After(now) {
+				delete(s.nonces, key)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	key := keyID + "\x00" + nonce
+	if expiry, ok := s.nonces[key]; ok && expiry.After(now) {
+		return false, nil
+	}
+	s.nonces[key] = expiresAt
+	return true, nil
+}
+
+// SignatureVerifier verifies signed requests against a set of signing keys
+type SignatureVerifier struct {
+	keys         map[string]SigningKey
+	clockSkew    time.Duration
+	maxBodyBytes int64
+	nonces       NonceStore
+	now          func() time.Time
+}
+
+// NewSignatureVerifier creates a verifier for keys that accepts timestamps within
+// clockSkew of the current time and remembers nonces in nonces
+func NewSignatureVerifier(keys []SigningKey, clockSkew time.Duration, nonces NonceStore) (*SignatureVerifier, error) {
+	byID := make(map[string]SigningKey, len(keys))
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, errors.New("signing key without id")
+		}
+		if _, ok := byID[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate signing key %q", key.ID)
+		}
+		if key.ID == APIKeyIdentityBlue || key.ID == APIKeyIdentityGreen {
+			return nil, fmt.Errorf("signing key id %q is reserved for the environment API keys", key.ID)
+		}
+		if len(key.Secret) < minSigningSecretLength {
+			return nil, fmt.Errorf("secret of signing key %q must be at least %d characters", key.ID, minSigningSecretLength)
+		}
+		for _, scope := range key.Scopes {
+			if !slices.Contains(Scopes, scope) {
+				return nil, fmt.Errorf("unknown scope %q for signing key %q", scope, key.ID)
+			}
+		}
+		byID[key.ID] = key
+	}
+	if len(byID) == 0 {
+		return nil, errors.New("no signing keys")
+	}
+
+	return &SignatureVerifier{
+		keys:         byID,
+		clockSkew:    clockSkew,
+		maxBodyBytes: defaultSignatureMaxBodyBytes,
+		nonces:       nonces,
+		now:          time.Now,
+	}, nil
+}
+
+// WithMaxBodyBytes sets the largest body of a signed request; larger requests are
+// rejected before the body is read past the limit
+func (v *SignatureVerifier) WithMaxBodyBytes(maxBodyBytes int64) *SignatureVerifier {
+	v.maxBodyBytes = maxBodyBytes
+	return v
+}
+
+// LoadSignatureVerifier reads signed request authentication from environment
+// variables. It returns nil when SIGNING_KEYS_FILE is unset, which disables it:
+//   - SIGNING_KEYS_FILE: JSON array of signing keys ({"id", "secret", "owner", "scopes"})
+//   - SIGNING_CLOCK_SKEW: Go duration a timestamp may differ from the server time (default 5m)
+//   - SIGNING_MAX_BODY_BYTES: largest body of a signed request (default 10485760)
+//
+// Nonces are remembered in a MemoryNonceStore.
+func LoadSignatureVerifier() (*SignatureVerifier, error) {
+	path := os.Getenv("SIGNING_KEYS_FILE")
+	if path == "" {
+		return nil, nil
+	}
+
+	clockSkew := defaultSignatureClockSkew
+	if raw := os.Getenv("SIGNING_CLOCK_SKEW"); raw != "" {
+		var err error
+		clockSkew, err = time.ParseDuration(raw)
+		if err != nil || clockSkew <= 0 {
+			return nil, fmt.Errorf("invalid SIGNING_CLOCK_SKEW %q", raw)
+		}
+	}
+
+	maxBodyBytes := int64(defaultSignatureMaxBodyBytes)
+	if raw := os.Getenv("SIGNING_MAX_BODY_BYTES"); raw != "" {
+		var err error
+		maxBodyBytes, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || maxBodyBytes <= 0 {
+			return nil, fmt.Errorf("invalid SIGNING_MAX_BODY_BYTES %q", raw)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SIGNING_KEYS_FILE: %w", err)
+	}
+	var keys []SigningKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("invalid SIGNING_KEYS_FILE: %w", err)
+	}
+
+	verifier, err := NewSignatureVerifier(keys, clockSkew, NewMemoryNonceStore())
+	if err != nil {
+		return nil, fmt.Errorf("invalid SIGNING_KEYS_FILE: %w", err)
+	}
+	return verifier.WithMaxBodyBytes(maxBodyBytes), nil
+}
+
+// RequestSignature returns the hex encoded HMAC-SHA256, keyed with secret, of
+//
+//	METHOD \n REQUEST-URI \n TIMESTAMP \n NONCE \n hex(SHA-256(body))
+//
+// where REQUEST-URI is the path and query of the request
+func RequestSignature(secret, method, requestURI, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join([]string{method, requestURI, timestamp, nonce, hex.EncodeToString(bodyHash[:])}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signingKey checks the headers and the timestamp of req, which need no body,
+// and returns the key req claims to be signed with and the time it was signed at
+func (v *SignatureVerifier) signingKey(req *http.Request) (SigningKey, time.Time, error) {
+	keyID := req.Header.Get(SignatureKeyIDHeader)
+	timestamp := req.Header.Get(SignatureTimestampHeader)
+	nonce := req.Header.Get(SignatureNonceHeader)
+	signature := req.Header.Get(SignatureHeader)
+	if keyID == "" || timestamp == "" || nonce == "" || signature == "" {
+		return SigningKey{}, time.Time{}, fmt.Errorf("signed requests need the %s, %s, %s and %s headers",
+			SignatureKeyIDHeader, SignatureTimestampHeader, SignatureNonceHeader, SignatureHeader)
+	}
+	if len(nonce) > maxNonceLength {
+		return SigningKey{}, time.Time{}, fmt.Errorf("nonce must be at most %d characters", maxNonceLength)
+	}
+
+	key, ok := v.keys[keyID]
+	if !ok {
+		return SigningKey{}, time.Time{}, fmt.Errorf("unknown signing key %q", keyID)
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return SigningKey{}, time.Time{}, fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+	signedAt := time.Unix(seconds, 0)
+	now := v.now()
+	if signedAt.Before(now.Add(-v.clockSkew)) || signedAt.After(now.Add(v.clockSkew)) {
+		return SigningKey{}, time.Time{}, errSignatureExpired
+	}
+	return key, signedAt, nil
+}
+
+// Verify checks the headers and timestamp of req, whose body is body, then its
+// signature and nonce, and returns the key that signed it
+func (v *SignatureVerifier) Verify(ctx context.Context, req *http.Request, body []byte) (SigningKey, error) {
+	key, signedAt, err := v.signingKey(req)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	timestamp := req.Header.Get(SignatureTimestampHeader)
+	nonce := req.Header.Get(SignatureNonceHeader)
+	expected := RequestSignature(key.Secret, req.Method, req.URL.RequestURI(), timestamp, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(req.Header.Get(SignatureHeader)))) {
+		return SigningKey{}, errors.New("signature does not match the request")
+	}
+
+	// The nonce only needs remembering while its timestamp is accepted
+	fresh, err := v.nonces.Remember(ctx, key.ID, nonce, signedAt.Add(v.clockSkew))
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("failed to check nonce: %w", err)
+	}
+	if !fresh {
+		return SigningKey{}, errReplayedNonce
+	}
+	return key, nil
+}
+
+// hasSignature reports whether a request is signed rather than carrying an API key
+func hasSignature(c echo.Context) bool {
+	return c.Request().Header.Get(SignatureHeader) != ""
+}
+
+// SignatureMiddleware creates a middleware that authenticates signed requests (see
+// RequestSignature) with verifier. The ID of the signing key, prefixed with
+// SignatureIdentityPrefix, is stored like the identity of an API key, so
+// KV_NAMESPACE_GRANTS and audit records treat it like the name of an issued key,
+// and its scopes like the scopes of an API key.
+func SignatureMiddleware(verifier *SignatureVerifier) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			// Use request context for trace propagation
+			ctx := c.Request().Context()
+
+			// Check what needs no body first, so unknown keys and stale requests
+			// cannot make the server buffer a body
+			req := c.Request()
+			_, _, err := verifier.signingKey(req)
+
+			// The body is part of the signature; put it back for the handler
+			var body []byte
+			if err == nil && req.Body != nil {
+				body, err = io.ReadAll(http.MaxBytesReader(c.Response(), req.Body, verifier.maxBodyBytes))
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					return c.JSON(http.StatusRequestEntityTooLarge, errs.ErrorResponse{
+						Message:   fmt.Sprintf("Signed request body exceeds %d bytes", verifier.maxBodyBytes),
+						ErrorCode: errs.ErrSignedBodyTooLarge,
+					})
+				}
+				if err != nil {
+					return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+						Message:   "Failed to read request body",
+						ErrorCode: errs.ErrInvalidSignature,
+					})
+				}
+				req.Body = io.NopCloser(bytes.NewReader(body))
+			}
+
+			var key SigningKey
+			if err == nil {
+				key, err = verifier.Verify(ctx, req, body)
+			}
+			switch {
+			case errors.Is(err, errSignatureExpired):
+				return c.JSON(http.StatusUnauthorized, errs.ErrorResponse{
+					Message:   "Request signature has expired",
+					ErrorCode: errs.ErrSignatureExpired,
+				})
+			case errors.Is(err, errReplayedNonce):
+				logging.WarnContext(ctx, "Replayed signed request rejected",
+					"signing_key", req.Header.Get(SignatureKeyIDHeader))
+				return c.JSON(http.StatusUnauthorized, errs.ErrorResponse{
+					Message:   "Request nonce has already been used",
+					ErrorCode: errs.ErrReplayedNonce,
+				})
+			case err != nil:
+				return c.JSON(http.StatusUnauthorized, errs.ErrorResponse{
+					Message:   "Invalid request signature: " + err.Error(),
+					ErrorCode: errs.ErrInvalidSignature,
+				})
+			}
+
+			identity := SignatureIdentityPrefix + key.ID
+			c.Set(EchoAPIKeyIdentityKey, identity)
+			c.Set(EchoAPIKeyScopesKey, key.Scopes)
+
+			// Attach the principal to the request context for audit records
+			c.SetRequest(req.WithContext(ContextWithPrincipal(ctx, Principal{Name: identity, Owner: key.Owner})))
+			return next(c)
+		}
+	}
+}
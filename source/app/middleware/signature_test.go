@@ -0,0 +1,258 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSigningSecret = "0123456789abcdef0123456789abcdef"
+
+func newTestSignatureVerifier(t *testing.T) *SignatureVerifier {
+	verifier, err := NewSignatureVerifier([]SigningKey{
+		{ID: "orders", Secret: testSigningSecret, Owner: "team-orders", Scopes: []string{ScopeKV}},
+	}, time.Minute, NewMemoryNonceStore())
+	assert.NoError(t, err)
+	return verifier
+}
+
+// newSignedRequest builds a request signed with the test secret at signedAt
+func newSignedRequest(method, target, body, nonce string, signedAt time.Time) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	req.Header.Set(SignatureKeyIDHeader, "orders")
+	req.Header.Set(SignatureTimestampHeader, timestamp)
+	req.Header.Set(SignatureNonceHeader, nonce)
+	req.Header.Set(SignatureHeader, RequestSignature(testSigningSecret, method, req.URL.RequestURI(), timestamp, nonce, []byte(body)))
+	return req
+}
+
+func TestNewSignatureVerifier_InvalidKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []SigningKey
+		want string
+	}{
+		{"no keys", nil, "no signing keys"},
+		{"missing id", []SigningKey{{Secret: testSigningSecret}}, "without id"},
+		{"short secret", []SigningKey{{ID: "orders", Secret: "short"}}, "at least 32 characters"},
+		{"reserved id", []SigningKey{{ID: APIKeyIdentityBlue, Secret: testSigningSecret}}, "reserved"},
+		{"unknown scope", []SigningKey{{ID: "orders", Secret: testSigningSecret, Scopes: []string{"kv:write"}}}, "unknown scope"},
+		{"duplicate id", []SigningKey{{ID: "orders", Secret: testSigningSecret}, {ID: "orders", Secret: testSigningSecret}}, "duplicate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSignatureVerifier(tt.keys, time.Minute, NewMemoryNonceStore())
+			assert.ErrorContains(t, err, tt.want)
+		})
+	}
+}
+
+func TestLoadSignatureVerifier(t *testing.T) {
+	defer os.Unsetenv("SIGNING_KEYS_FILE")
+	defer os.Unsetenv("SIGNING_CLOCK_SKEW")
+	defer os.Unsetenv("SIGNING_MAX_BODY_BYTES")
+
+	os.Unsetenv("SIGNING_KEYS_FILE")
+	verifier, err := LoadSignatureVerifier()
+	assert.NoError(t, err)
+	assert.Nil(t, verifier)
+
+	path := filepath.Join(t.TempDir(), "signing-keys.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`[{"id":"orders","secret":"`+testSigningSecret+`","scopes":["kv"]}]`), 0o600))
+	os.Setenv("SIGNING_KEYS_FILE", path)
+	verifier, err = LoadSignatureVerifier()
+	assert.NoError(t, err)
+	assert.Equal(t, defaultSignatureClockSkew, verifier.clockSkew)
+	assert.Equal(t, int64(defaultSignatureMaxBodyBytes), verifier.maxBodyBytes)
+
+	os.Setenv("SIGNING_MAX_BODY_BYTES", "1024")
+	verifier, err = LoadSignatureVerifier()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1024), verifier.maxBodyBytes)
+
+	os.Setenv("SIGNING_MAX_BODY_BYTES", "lots")
+	_, err = LoadSignatureVerifier()
+	assert.ErrorContains(t, err, "SIGNING_MAX_BODY_BYTES")
+	os.Unsetenv("SIGNING_MAX_BODY_BYTES")
+
+	os.Setenv("SIGNING_CLOCK_SKEW", "-1m")
+	_, err = LoadSignatureVerifier()
+	assert.ErrorContains(t, err, "SIGNING_CLOCK_SKEW")
+}
+
+func TestSignatureVerifier_Verify(t *testing.T) {
+	verifier := newTestSignatureVerifier(t)
+	now := time.Now()
+
+	req := newSignedRequest(http.MethodPost, "/api/key-value?x=1", `{"key":"a"}`, "nonce-1", now)
+	key, err := verifier.Verify(context.Background(), req, []byte(`{"key":"a"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "orders", key.ID)
+
+	// The same nonce cannot be used twice
+	req = newSignedRequest(http.MethodPost, "/api/key-value?x=1", `{"key":"a"}`, "nonce-1", now)
+	_, err = verifier.Verify(context.Background(), req, []byte(`{"key":"a"}`))
+	assert.ErrorIs(t, err, errReplayedNonce)
+}
+
+func TestSignatureVerifier_VerifyRejected(t *testing.T) {
+	verifier := newTestSignatureVerifier(t)
+	now := time.Now()
+
+	missingHeader := newSignedRequest(http.MethodGet, "/persons", "", "n1", now)
+	missingHeader.Header.Del(SignatureNonceHeader)
+	unknownKey := newSignedRequest(http.MethodGet, "/persons", "", "n2", now)
+	unknownKey.Header.Set(SignatureKeyIDHeader, "billing")
+	otherPath := newSignedRequest(http.MethodGet, "/persons", "", "n3", now)
+	otherPath.URL.Path = "/admin/api-keys"
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		body string
+		want string
+	}{
+		{"missing header", missingHeader, "", "need the"},
+		{"unknown key", unknownKey, "", "unknown signing key"},
+		{"tampered body", newSignedRequest(http.MethodPost, "/persons", `{"a":1}`, "n4", now), `{"a":2}`, "does not match"},
+		{"tampered path", otherPath, "", "does not match"},
+		{"too old", newSignedRequest(http.MethodGet, "/persons", "", "n5", now.Add(-2*time.Minute)), "", errSignatureExpired.Error()},
+		{"too far ahead", newSignedRequest(http.MethodGet, "/persons", "", "n6", now.Add(2*time.Minute)), "", errSignatureExpired.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifier.Verify(context.Background(), tt.req, []byte(tt.body))
+			assert.ErrorContains(t, err, tt.want)
+		})
+	}
+}
+
+func TestMemoryNonceStore_Expiry(t *testing.T) {
+	store := NewMemoryNonceStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	fresh, err := store.Remember(context.Background(), "orders", "n1", now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, fresh)
+
+	fresh, _ = store.Remember(context.Background(), "orders", "n1", now.Add(time.Minute))
+	assert.False(t, fresh)
+
+	// Nonces are per key
+	fresh, _ = store.Remember(context.Background(), "billing", "n1", now.Add(time.Minute))
+	assert.True(t, fresh)
+
+	now = now.Add(2 * time.Minute)
+	fresh, _ = store.Remember(context.Background(), "orders", "n1", now.Add(time.Minute))
+	assert.True(t, fresh)
+	assert.Len(t, store.nonces, 1)
+}
+
+func TestSignatureMiddleware(t *testing.T) {
+	verifier := newTestSignatureVerifier(t)
+	e := echo.New()
+	var principal Principal
+	var body string
+	handler := AuthMiddleware(Authenticators{Signatures: verifier})(func(c echo.Context) error {
+		principal, _ = PrincipalFromContext(c.Request().Context())
+		data, _ := io.ReadAll(c.Request().Body)
+		body = string(data)
+		return c.JSON(http.StatusOK, map[string]interface{}{"identity": APIKeyIdentity(c), "scopes": APIKeyScopes(c)})
+	})
+	now := time.Now()
+
+	replayed := newSignedRequest(http.MethodPost, "/api/key-value", `{"key":"a"}`, "replayed", now)
+	_ = handler(e.NewContext(newSignedRequest(http.MethodPost, "/api/key-value", `{"key":"a"}`, "replayed", now), httptest.NewRecorder()))
+	invalid := newSignedRequest(http.MethodPost, "/api/key-value", `{"key":"a"}`, "invalid", now)
+	invalid.Header.Set(SignatureHeader, "00")
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		status int
+		want   string
+	}{
+		{"signed request", newSignedRequest(http.MethodPost, "/api/key-value", `{"key":"a"}`, "first", now), http.StatusOK, `"identity":"sig:orders"`},
+		{"invalid signature", invalid, http.StatusUnauthorized, "API_011_INVALID_SIGNATURE"},
+		{"expired signature", newSignedRequest(http.MethodGet, "/", "", "old", now.Add(-time.Hour)), http.StatusUnauthorized, "API_012_SIGNATURE_EXPIRED"},
+		{"replayed nonce", replayed, http.StatusUnauthorized, "API_013_REPLAYED_NONCE"},
+		{"unsigned request falls back to x-api-key", httptest.NewRequest(http.MethodGet, "/", nil), http.StatusUnauthorized, "API_001_MISSING_API_KEY"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+
+			err := handler(e.NewContext(tt.req, rec))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.want)
+			if tt.status == http.StatusOK {
+				assert.Equal(t, Principal{Name: "sig:orders", Owner: "team-orders"}, principal)
+				// The handler still reads the body the signature covered
+				assert.Equal(t, `{"key":"a"}`, body)
+			}
+		})
+	}
+}
+
+// countingReader counts the bytes read from it
+type countingReader struct {
+	io.Reader
+	read int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.read += n
+	return n, err
+}
+
+func TestSignatureMiddleware_BodyLimit(t *testing.T) {
+	verifier := newTestSignatureVerifier(t).WithMaxBodyBytes(16)
+	e := echo.New()
+	handler := AuthMiddleware(Authenticators{Signatures: verifier})(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	now := time.Now()
+
+	rec := httptest.NewRecorder()
+	assert.NoError(t, handler(e.NewContext(newSignedRequest(http.MethodPost, "/api/key-value", `{"key":"a","value":"too long"}`, "large", now), rec)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Contains(t, rec.Body.String(), "API_017_SIGNED_BODY_TOO_LARGE")
+
+	rec = httptest.NewRecorder()
+	assert.NoError(t, handler(e.NewContext(newSignedRequest(http.MethodPost, "/api/key-value", `{"key":"a"}`, "small", now), rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Requests with an unknown key or a stale timestamp are rejected unread
+	for _, req := range []*http.Request{
+		newSignedRequest(http.MethodPost, "/api/key-value", "", "stale", now.Add(-time.Hour)),
+		newSignedRequest(http.MethodPost, "/api/key-value", "", "unknown", now),
+	} {
+		if req.Header.Get(SignatureNonceHeader) == "unknown" {
+			req.Header.Set(SignatureKeyIDHeader, "billing")
+		}
+		body := &countingReader{Reader: strings.NewReader(strings.Repeat("x", 1024))}
+		req.Body = io.NopCloser(body)
+		rec = httptest.NewRecorder()
+		assert.NoError(t, handler(e.NewContext(req, rec)))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, 0, body.read)
+	}
+}
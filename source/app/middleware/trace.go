@@ -1,10 +1,16 @@
 package middleware
 
 import (
+	"net/http"
+
 	"person-service/tracing"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -18,15 +24,47 @@ const (
 	EchoTraceIDKey = "trace-id"
 )
 
-// TraceMiddleware extracts the trace ID from GCP Load Balancer headers
-// and propagates it through the request context.
-// If no trace header is present, generates a UUID as fallback (for local dev).
+// TraceMiddleware continues the trace of the caller and propagates the trace ID
+// through the request context. The trace is read from the W3C traceparent and
+// tracestate headers, or else from the GCP Load Balancer header. A server span is
+// started for the request and returned to the client in traceparent.
+// If no trace header is present and tracing is disabled, generates a UUID as
+// fallback (for local dev).
 func TraceMiddleware() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := tracing.Propagator.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
 			// Extract trace ID from GCP header
-			gcpTraceHeader := c.Request().Header.Get(GCPTraceHeader)
+			gcpTraceHeader := req.Header.Get(GCPTraceHeader)
 			traceID := tracing.ParseGCPTraceHeader(gcpTraceHeader)
+			if !trace.SpanContextFromContext(ctx).IsValid() {
+				if remote := tracing.SpanContextFromGCPHeader(gcpTraceHeader); remote.IsValid() {
+					ctx = trace.ContextWithRemoteSpanContext(ctx, remote)
+				}
+			}
+
+			route := c.Path()
+			name := req.Method
+			if route != "" {
+				name += " " + route
+			}
+			ctx, span := tracing.Tracer().Start(ctx, name,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(req.Method),
+					semconv.HTTPRoute(route),
+					semconv.URLPath(req.URL.Path),
+				),
+			)
+			defer span.End()
+
+			// The span carries the trace ID of the caller or of the trace it started
+			if spanContext := span.SpanContext(); spanContext.HasTraceID() {
+				traceID = spanContext.TraceID().String()
+				tracing.Propagator.Inject(ctx, propagation.HeaderCarrier(c.Response().Header()))
+			}
 
 			// Generate fallback UUID if no trace header present (local dev)
 			if traceID == "" {
@@ -40,10 +78,24 @@ func TraceMiddleware() echo.MiddlewareFunc {
 			c.Response().Header().Set(TraceIDResponseHeader, traceID)
 
 			// Create new Go context with trace ID for downstream propagation
-			ctx := tracing.ContextWithTraceID(c.Request().Context(), traceID)
-			c.SetRequest(c.Request().WithContext(ctx))
+			ctx = tracing.ContextWithTraceID(ctx, traceID)
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
 
-			return next(c)
+			status := c.Response().Status
+			if err != nil {
+				// The error handler writes the response after the middleware returns
+				status = http.StatusInternalServerError
+				if he, ok := err.(*echo.HTTPError); ok {
+					status = he.Code
+				}
+			}
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+			return err
 		}
 	}
 }
@@ -8,6 +8,13 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 func TestTraceMiddleware_WithGCPHeader(t *testing.T) {
@@ -101,3 +108,98 @@ func TestTraceMiddleware_PropagatesNextError(t *testing.T) {
 	err := handler(c)
 	assert.Equal(t, expectedErr, err)
 }
+
+func TestTraceMiddleware_WithTraceparent(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(GCPTraceHeader, "105445aa7843bc8bf206b12000100000/1;o=1")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	middleware := TraceMiddleware()
+	handler := middleware(func(c echo.Context) error {
+		// traceparent takes precedence over the GCP header
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", c.Get(EchoTraceIDKey))
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", tracing.TraceIDFromContext(c.Request().Context()))
+		return c.String(http.StatusOK, "OK")
+	})
+
+	err := handler(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", rec.Header().Get(TraceIDResponseHeader))
+	assert.Contains(t, rec.Header().Get("traceparent"), "4bf92f3577b34da6a3ce929d0e0e4736")
+}
+
+// recordSpans installs a tracer provider recording the spans of the test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	return recorder
+}
+
+func TestTraceMiddleware_CreatesServerSpan(t *testing.T) {
+	recorder := recordSpans(t)
+	e := echo.New()
+	e.Use(TraceMiddleware())
+	e.GET("/persons/:personId", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusServiceUnavailable)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/persons/p-1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "GET /persons/:personId", span.Name())
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+	assert.Equal(t, codes.Error, span.Status().Code)
+	assert.Contains(t, span.Attributes(), semconv.HTTPResponseStatusCode(http.StatusServiceUnavailable))
+
+	// The response carries the server span so the caller can link to it
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+span.SpanContext().SpanID().String()+"-01", rec.Header().Get("traceparent"))
+}
+
+func TestTraceMiddleware_GCPHeaderParentsServerSpan(t *testing.T) {
+	recorder := recordSpans(t)
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(GCPTraceHeader, "105445aa7843bc8bf206b12000100000/1;o=1")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	handler := TraceMiddleware()(func(c echo.Context) error {
+		return c.String(http.StatusOK, "OK")
+	})
+
+	assert.NoError(t, handler(c))
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "105445aa7843bc8bf206b12000100000", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "0000000000000001", spans[0].Parent().SpanID().String())
+	assert.Equal(t, "105445aa7843bc8bf206b12000100000", rec.Header().Get(TraceIDResponseHeader))
+}
+
+func TestTraceMiddleware_TracingEnabledWithoutHeader(t *testing.T) {
+	recordSpans(t)
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	handler := TraceMiddleware()(func(c echo.Context) error {
+		// The trace ID of the new trace replaces the UUID fallback
+		assert.Len(t, c.Get(EchoTraceIDKey), 32)
+		assert.Equal(t, trace.SpanContextFromContext(c.Request().Context()).TraceID().String(), c.Get(EchoTraceIDKey))
+		return c.String(http.StatusOK, "OK")
+	})
+
+	assert.NoError(t, handler(c))
+}
@@ -0,0 +1,59 @@
+package person_attributes
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"person-service/middleware"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// LoadStrictCaller reads STRICT_CALLER_IDENTITY (default false). When true,
+// meta.caller must be the name of the API key that authenticated the request.
+func LoadStrictCaller() (bool, error) {
+	raw := os.Getenv("STRICT_CALLER_IDENTITY")
+	if raw == "" {
+		return false, nil
+	}
+
+	strict, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid STRICT_CALLER_IDENTITY %q", raw)
+	}
+	return strict, nil
+}
+
+// CheckCaller returns an error when strict and the self-reported caller is not
+// the authenticated principal of ctx, or when strict and ctx has no principal
+func (m *Meta) CheckCaller(ctx context.Context, strict bool) error {
+	if !strict {
+		return nil
+	}
+
+	principal, ok := middleware.PrincipalFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("Caller %q cannot be verified without an authenticated API key", m.Caller)
+	}
+	if m.Caller != principal.Name {
+		return fmt.Errorf("Caller %q does not match the API key %q", m.Caller, principal.Name)
+	}
+	return nil
+}
+
+// AuditPrincipal returns the principal_name and principal_owner of a request_log
+// entry for ctx: NULL when the request was not authenticated
+func AuditPrincipal(ctx context.Context) (name, owner pgtype.Text) {
+	principal, ok := middleware.PrincipalFromContext(ctx)
+	if !ok {
+		return pgtype.Text{}, pgtype.Text{}
+	}
+
+	name = pgtype.Text{String: principal.Name, Valid: true}
+	if principal.Owner != "" {
+		owner = pgtype.Text{String: principal.Owner, Valid: true}
+	}
+	return name, owner
+}
@@ -0,0 +1,75 @@
+package person_attributes
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+
+	"person-service/middleware"
+)
+
+func TestLoadStrictCaller(t *testing.T) {
+	defer os.Unsetenv("STRICT_CALLER_IDENTITY")
+
+	os.Unsetenv("STRICT_CALLER_IDENTITY")
+	strict, err := LoadStrictCaller()
+	assert.NoError(t, err)
+	assert.False(t, strict)
+
+	os.Setenv("STRICT_CALLER_IDENTITY", "true")
+	strict, err = LoadStrictCaller()
+	assert.NoError(t, err)
+	assert.True(t, strict)
+
+	os.Setenv("STRICT_CALLER_IDENTITY", "sometimes")
+	_, err = LoadStrictCaller()
+	assert.Error(t, err)
+}
+
+func TestCheckCaller(t *testing.T) {
+	authenticated := middleware.ContextWithPrincipal(context.Background(), middleware.Principal{Name: "billing", Owner: "team-billing"})
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		caller  string
+		strict  bool
+		wantErr bool
+	}{
+		{"not strict accepts any caller", authenticated, "someone-else", false, false},
+		{"strict accepts the principal", authenticated, "billing", true, false},
+		{"strict rejects another caller", authenticated, "someone-else", true, true},
+		{"strict rejects an unauthenticated request", context.Background(), "billing", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta := &Meta{Caller: tt.caller, Reason: "testing"}
+			err := meta.CheckCaller(tt.ctx, tt.strict)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestAuditPrincipal(t *testing.T) {
+	name, owner := AuditPrincipal(context.Background())
+	assert.False(t, name.Valid)
+	assert.False(t, owner.Valid)
+
+	ctx := middleware.ContextWithPrincipal(context.Background(), middleware.Principal{Name: "blue"})
+	name, owner = AuditPrincipal(ctx)
+	assert.Equal(t, pgtype.Text{String: "blue", Valid: true}, name)
+	assert.False(t, owner.Valid)
+
+	ctx = middleware.ContextWithPrincipal(context.Background(), middleware.Principal{Name: "billing", Owner: "team-billing"})
+	name, owner = AuditPrincipal(ctx)
+	assert.Equal(t, pgtype.Text{String: "billing", Valid: true}, name)
+	assert.Equal(t, pgtype.Text{String: "team-billing", Valid: true}, owner)
+}
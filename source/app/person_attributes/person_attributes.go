@@ -43,6 +43,10 @@ type PersonAttributesHandler struct {
 	queries       *db.Queries
 	encryptionKey string
 	keyVersion    int64
+	// strictCaller requires meta.caller to match the authenticated API key
+	strictCaller bool
+	// policy limits which attribute keys callers may read and write
+	policy *Policy
 }
 
 // NewPersonAttributesHandler creates a new instance of PersonAttributesHandler
@@ -59,6 +63,28 @@ func NewPersonAttributesHandler(queries *db.Queries) *PersonAttributesHandler {
 	}
 }
 
+// WithStrictCaller rejects requests whose meta.caller is not the name of the
+// authenticated API key (see LoadStrictCaller)
+func (h *PersonAttributesHandler) WithStrictCaller(strict bool) *PersonAttributesHandler {
+	h.strictCaller = strict
+	return h
+}
+
+// WithPolicy applies an attribute policy to reads and writes (see LoadPolicy).
+// Attributes a caller may not read are left out of list responses.
+func (h *PersonAttributesHandler) WithPolicy(policy *Policy) *PersonAttributesHandler {
+	h.policy = policy
+	return h
+}
+
+// denied returns the response for a caller the policy does not allow action on key
+func (h *PersonAttributesHandler) denied(c echo.Context, action, key string) error {
+	return c.JSON(http.StatusForbidden, errs.ErrorResponse{
+		Message:   fmt.Sprintf("Caller may not %s attribute %q", action, key),
+		ErrorCode: errs.ErrAttributeDenied,
+	})
+}
+
 // CreateAttribute handles POST/PUT /persons/:personId/attributes - creates or updates an attribute
 func (h *PersonAttributesHandler) CreateAttribute(c echo.Context) error {
 	// Parse person ID from path
@@ -109,6 +135,17 @@ func (h *PersonAttributesHandler) CreateAttribute(c echo.Context) error {
 	// Use request context for trace propagation
 	ctx := c.Request().Context()
 
+	if err := req.Meta.CheckCaller(ctx, h.strictCaller); err != nil {
+		return c.JSON(http.StatusForbidden, errs.ErrorResponse{
+			Message:   err.Error(),
+			ErrorCode: errs.ErrCallerMismatch,
+		})
+	}
+
+	if !h.policy.Allowed(PolicyCaller(ctx), ActionWrite, req.Key) {
+		return h.denied(c, ActionWrite, req.Key)
+	}
+
 	// Check if person exists
 	_, err = h.queries.GetPersonById(ctx, personID)
 	if err != nil {
@@ -146,11 +183,15 @@ func (h *PersonAttributesHandler) CreateAttribute(c echo.Context) error {
 		// Serialize request body and response for audit
 		requestBody := fmt.Sprintf(`{"key":"%s","value":"%s"}`, req.Key, req.Value)
 		responseBody := "" // Will be populated after getting the attribute
+		principalName, principalOwner := AuditPrincipal(ctx)
 
 		_, logErr := h.queries.InsertRequestLog(ctx, db.InsertRequestLogParams{
 			TraceID:               req.Meta.TraceID,
-			CallerInfo:                req.Meta.Caller,
+			CallerInfo:            req.Meta.Caller,
 			Reason:                req.Meta.Reason,
+			PersonID:              personID,
+			PrincipalName:         principalName,
+			PrincipalOwner:        principalOwner,
 			EncryptedRequestBody:  requestBody,
 			EncryptedResponseBody: responseBody,
 			EncKey:                h.encryptionKey,
@@ -241,9 +282,13 @@ func (h *PersonAttributesHandler) GetAllAttributes(c echo.Context) error {
 		})
 	}
 
-	// Build response array
+	// Build response array, leaving out attributes the caller may not read
+	caller := PolicyCaller(ctx)
 	response := make([]map[string]interface{}, 0, len(attributes))
 	for _, attr := range attributes {
+		if !h.policy.Allowed(caller, ActionRead, attr.AttributeKey) {
+			continue
+		}
 		item := map[string]interface{}{
 			"id":      attr.ID,
 			"key":     attr.AttributeKey,
@@ -332,6 +377,10 @@ func (h *PersonAttributesHandler) GetAttribute(c echo.Context) error {
 		})
 	}
 
+	if !h.policy.Allowed(PolicyCaller(ctx), ActionRead, foundAttr.AttributeKey) {
+		return h.denied(c, ActionRead, foundAttr.AttributeKey)
+	}
+
 	// Build response
 	response := map[string]interface{}{
 		"id":      foundAttr.ID,
@@ -392,6 +441,15 @@ func (h *PersonAttributesHandler) UpdateAttribute(c echo.Context) error {
 	// Use request context for trace propagation
 	ctx := c.Request().Context()
 
+	if req.Meta != nil {
+		if err := req.Meta.CheckCaller(ctx, h.strictCaller); err != nil {
+			return c.JSON(http.StatusForbidden, errs.ErrorResponse{
+				Message:   err.Error(),
+				ErrorCode: errs.ErrCallerMismatch,
+			})
+		}
+	}
+
 	// Check if person exists
 	_, err = h.queries.GetPersonById(ctx, personID)
 	if err != nil {
@@ -442,6 +500,14 @@ func (h *PersonAttributesHandler) UpdateAttribute(c echo.Context) error {
 		keyToUse = req.Key
 	}
 
+	// Renaming writes both the old and the new key
+	caller := PolicyCaller(ctx)
+	for _, key := range []string{existingAttr.AttributeKey, keyToUse} {
+		if !h.policy.Allowed(caller, ActionWrite, key) {
+			return h.denied(c, ActionWrite, key)
+		}
+	}
+
 	// If the key changed, we need to delete the old one first
 	if req.Key != "" && req.Key != existingAttr.AttributeKey {
 		err = h.queries.DeletePersonAttribute(ctx, db.DeletePersonAttributeParams{
@@ -600,6 +666,10 @@ func (h *PersonAttributesHandler) DeleteAttribute(c echo.Context) error {
 		})
 	}
 
+	if !h.policy.Allowed(PolicyCaller(ctx), ActionWrite, keyToDelete) {
+		return h.denied(c, ActionWrite, keyToDelete)
+	}
+
 	// Delete the attribute
 	err = h.queries.DeletePersonAttribute(ctx, db.DeletePersonAttributeParams{
 		PersonID:     personID,
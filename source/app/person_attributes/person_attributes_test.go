@@ -18,6 +18,7 @@ import (
 
 	db "person-service/internal/db/generated"
 	"person-service/internal/testdb"
+	"person-service/middleware"
 )
 
 var pool *pgxpool.Pool
@@ -178,6 +179,50 @@ func TestCreateAttribute_MissingMeta(t *testing.T) {
 	assert.Contains(t, rec.Body.String(), "Missing required field")
 }
 
+func TestCreateAttribute_StrictCallerMismatch(t *testing.T) {
+	queries := db.New(pool)
+	handler := NewPersonAttributesHandler(queries).WithStrictCaller(true)
+
+	e := echo.New()
+	jsonBody := `{"key":"email","value":"test@example.com","meta":{"caller":"someone-else","reason":"testing","traceId":"123"}}`
+	req := httptest.NewRequest(http.MethodPut, "/persons/123e4567-e89b-12d3-a456-426614174000/attributes", strings.NewReader(jsonBody))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req = req.WithContext(middleware.ContextWithPrincipal(req.Context(), middleware.Principal{Name: "blue"}))
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("personId")
+	c.SetParamValues("123e4567-e89b-12d3-a456-426614174000")
+
+	err := handler.CreateAttribute(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_302_CALLER_MISMATCH")
+}
+
+func TestCreateAttribute_PolicyDenied(t *testing.T) {
+	policy, err := ParsePolicy("deny orders write national_id")
+	assert.NoError(t, err)
+	queries := db.New(pool)
+	handler := NewPersonAttributesHandler(queries).WithPolicy(policy)
+
+	e := echo.New()
+	jsonBody := `{"key":"national_id","value":"123","meta":{"caller":"orders","reason":"testing"}}`
+	req := httptest.NewRequest(http.MethodPut, "/persons/123e4567-e89b-12d3-a456-426614174000/attributes", strings.NewReader(jsonBody))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req = req.WithContext(middleware.ContextWithPrincipal(req.Context(), middleware.Principal{Name: "orders"}))
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("personId")
+	c.SetParamValues("123e4567-e89b-12d3-a456-426614174000")
+
+	err = handler.CreateAttribute(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_303_ATTRIBUTE_DENIED")
+}
+
 func TestGetAllAttributes_InvalidUUID(t *testing.T) {
 	queries := db.New(pool)
 	handler := NewPersonAttributesHandler(queries)
@@ -490,6 +535,105 @@ func TestGetAllAttributes_Success(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rec.Code)
 }
 
+func TestGetAllAttributes_PolicyFiltersDenied(t *testing.T) {
+	ctx := context.Background()
+	err := testdb.TruncateTables(ctx, pool)
+	assert.NoError(t, err)
+
+	personID, err := createTestPerson(ctx, "test-client-policy")
+	assert.NoError(t, err)
+	_, err = createTestAttribute(ctx, personID, "email", "test@example.com")
+	assert.NoError(t, err)
+	_, err = createTestAttribute(ctx, personID, "national_id", "123")
+	assert.NoError(t, err)
+
+	policy, err := ParsePolicy("allow orders read email; deny orders read *")
+	assert.NoError(t, err)
+	queries := db.New(pool)
+	handler := NewPersonAttributesHandler(queries).WithPolicy(policy)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/persons/"+personID+"/attributes", nil)
+	req = req.WithContext(middleware.ContextWithPrincipal(req.Context(), middleware.Principal{Name: "orders"}))
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("personId")
+	c.SetParamValues(personID)
+
+	err = handler.GetAllAttributes(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var attributes []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &attributes))
+	assert.Len(t, attributes, 1)
+	assert.Equal(t, "email", attributes[0]["key"])
+}
+
+func TestGetAttribute_PolicyDenied(t *testing.T) {
+	ctx := context.Background()
+	err := testdb.TruncateTables(ctx, pool)
+	assert.NoError(t, err)
+
+	personID, err := createTestPerson(ctx, "test-client-policy")
+	assert.NoError(t, err)
+	attrID, err := createTestAttribute(ctx, personID, "national_id", "123")
+	assert.NoError(t, err)
+
+	policy, err := ParsePolicy("deny orders read national_id")
+	assert.NoError(t, err)
+	queries := db.New(pool)
+	handler := NewPersonAttributesHandler(queries).WithPolicy(policy)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/persons/%s/attributes/%d", personID, attrID), nil)
+	req = req.WithContext(middleware.ContextWithPrincipal(req.Context(), middleware.Principal{Name: "orders"}))
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("personId", "attributeId")
+	c.SetParamValues(personID, fmt.Sprintf("%d", attrID))
+
+	err = handler.GetAttribute(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_303_ATTRIBUTE_DENIED")
+}
+
+func TestUpdateAttribute_PolicyDeniesRenameToProtectedKey(t *testing.T) {
+	ctx := context.Background()
+	err := testdb.TruncateTables(ctx, pool)
+	assert.NoError(t, err)
+
+	personID, err := createTestPerson(ctx, "test-client-policy")
+	assert.NoError(t, err)
+	attrID, err := createTestAttribute(ctx, personID, "nickname", "bob")
+	assert.NoError(t, err)
+
+	policy, err := ParsePolicy("deny * write national_*")
+	assert.NoError(t, err)
+	queries := db.New(pool)
+	handler := NewPersonAttributesHandler(queries).WithPolicy(policy)
+
+	e := echo.New()
+	jsonBody := `{"key":"national_id","value":"123"}`
+	req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/persons/%s/attributes/%d", personID, attrID), strings.NewReader(jsonBody))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("personId", "attributeId")
+	c.SetParamValues(personID, fmt.Sprintf("%d", attrID))
+
+	err = handler.UpdateAttribute(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_303_ATTRIBUTE_DENIED")
+	value, err := getTestAttribute(ctx, personID, "nickname")
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", value)
+}
+
 func TestGetAttribute_NotFound(t *testing.T) {
 	ctx := context.Background()
 	err := testdb.TruncateTables(ctx, pool)
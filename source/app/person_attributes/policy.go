@@ -0,0 +1,152 @@
+package person_attributes
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"person-service/middleware"
+)
+
+// Actions an attribute policy rule applies to
+const (
+	// ActionRead covers reading attribute values
+	ActionRead = "read"
+	// ActionWrite covers creating, updating, renaming and deleting attributes
+	ActionWrite = "write"
+)
+
+// anyMatch matches every caller or action in a policy rule
+const anyMatch = "*"
+
+// PolicyRule allows or denies callers an action on attribute keys matching a glob
+type PolicyRule struct {
+	Allow bool
+	// Caller is the authenticated identity or "*"
+	Caller string
+	// Action is ActionRead, ActionWrite or "*"
+	Action string
+	// Keys are globs of attribute keys (see keyMatch)
+	Keys []string
+}
+
+// keyMatch reports whether key matches the glob pattern, with the syntax of
+// path.Match except that * and ? also match '/', as attribute keys are not paths
+func keyMatch(pattern, key string) (bool, error) {
+	// path.Match stops * and ? at '/', so swap it for NUL, which PostgreSQL text cannot hold
+	const slash = "\x00"
+	return path.Match(strings.ReplaceAll(pattern, "/", slash), strings.ReplaceAll(key, "/", slash))
+}
+
+// matches reports whether the rule applies to caller doing action on key
+func (r PolicyRule) matches(caller, action, key string) bool {
+	if r.Caller != anyMatch && r.Caller != caller {
+		return false
+	}
+	if r.Action != anyMatch && r.Action != action {
+		return false
+	}
+	for _, pattern := range r.Keys {
+		if ok, _ := keyMatch(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy decides per attribute key what callers may read and write, on top of the
+// route scopes. Rules are evaluated in order and the first matching rule wins; a
+// key no rule matches is allowed. A nil Policy allows everything.
+type Policy struct {
+	rules []PolicyRule
+}
+
+// ParsePolicy reads policy rules separated by ";". Each rule is
+//
+//	effect caller action key,key
+//
+// where effect is allow or deny, caller an identity or *, action read, write or *
+// and each key a glob (*, ? and [...], where * and ? also match /). To let orders
+// read only two attributes:
+//
+//	allow orders read email,display_name; deny orders read *
+func ParsePolicy(raw string) (*Policy, error) {
+	policy := &Policy{}
+	for _, entry := range strings.Split(raw, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		fields := strings.Fields(entry)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("rule %q must be \"effect caller action key,key\"", entry)
+		}
+
+		var rule PolicyRule
+		switch fields[0] {
+		case "allow":
+			rule.Allow = true
+		case "deny":
+		default:
+			return nil, fmt.Errorf("effect of rule %q must be allow or deny", entry)
+		}
+
+		rule.Caller = fields[1]
+		rule.Action = fields[2]
+		switch rule.Action {
+		case ActionRead, ActionWrite, anyMatch:
+		default:
+			return nil, fmt.Errorf("action of rule %q must be %s, %s or %s", entry, ActionRead, ActionWrite, anyMatch)
+		}
+
+		for _, pattern := range strings.Split(fields[3], ",") {
+			if pattern == "" {
+				return nil, fmt.Errorf("rule %q has an empty key pattern", entry)
+			}
+			if _, err := keyMatch(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid key pattern %q in rule %q", pattern, entry)
+			}
+			rule.Keys = append(rule.Keys, pattern)
+		}
+		policy.rules = append(policy.rules, rule)
+	}
+	return policy, nil
+}
+
+// LoadPolicy reads the attribute policy from ATTRIBUTE_POLICIES (see ParsePolicy).
+// It returns nil when the variable is unset.
+func LoadPolicy() (*Policy, error) {
+	raw := os.Getenv("ATTRIBUTE_POLICIES")
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	policy, err := ParsePolicy(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ATTRIBUTE_POLICIES: %w", err)
+	}
+	return policy, nil
+}
+
+// Allowed reports whether caller may do action on the attribute key
+func (p *Policy) Allowed(caller, action, key string) bool {
+	if p == nil {
+		return true
+	}
+	for _, rule := range p.rules {
+		if rule.matches(caller, action, key) {
+			return rule.Allow
+		}
+	}
+	return true
+}
+
+// PolicyCaller returns the identity policies are evaluated for: the authenticated
+// principal of ctx, "" when the request was not authenticated, which only * rules match
+func PolicyCaller(ctx context.Context) string {
+	principal, _ := middleware.PrincipalFromContext(ctx)
+	return principal.Name
+}
@@ -0,0 +1,98 @@
+package person_attributes
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"person-service/middleware"
+)
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy("allow orders read email,display_name; deny orders * *; deny * write national_*")
+	assert.NoError(t, err)
+	assert.Equal(t, []PolicyRule{
+		{Allow: true, Caller: "orders", Action: ActionRead, Keys: []string{"email", "display_name"}},
+		{Allow: false, Caller: "orders", Action: "*", Keys: []string{"*"}},
+		{Allow: false, Caller: "*", Action: ActionWrite, Keys: []string{"national_*"}},
+	}, policy.rules)
+
+	for _, raw := range []string{
+		"allow orders read",
+		"permit orders read email",
+		"allow orders list email",
+		"allow orders read email,",
+		"allow orders read [email",
+	} {
+		_, err := ParsePolicy(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	defer os.Unsetenv("ATTRIBUTE_POLICIES")
+
+	os.Unsetenv("ATTRIBUTE_POLICIES")
+	policy, err := LoadPolicy()
+	assert.NoError(t, err)
+	assert.Nil(t, policy)
+
+	os.Setenv("ATTRIBUTE_POLICIES", "deny * read national_id")
+	policy, err = LoadPolicy()
+	assert.NoError(t, err)
+	assert.False(t, policy.Allowed("blue", ActionRead, "national_id"))
+
+	os.Setenv("ATTRIBUTE_POLICIES", "deny everyone")
+	_, err = LoadPolicy()
+	assert.ErrorContains(t, err, "ATTRIBUTE_POLICIES")
+}
+
+func TestPolicy_Allowed(t *testing.T) {
+	policy, err := ParsePolicy("allow orders read email,display_name; deny orders * *; deny * write national_*; deny * read secret_?")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		caller string
+		action string
+		key    string
+		want   bool
+	}{
+		{"orders", ActionRead, "email", true},
+		{"orders", ActionRead, "display_name", true},
+		{"orders", ActionRead, "national_id", false},
+		{"orders", ActionWrite, "email", false},
+		{"billing", ActionRead, "national_id", true},
+		{"billing", ActionWrite, "national_id", false},
+		{"billing", ActionWrite, "email", true},
+		{"billing", ActionRead, "secret_1", false},
+		{"billing", ActionRead, "secret_10", true},
+		{"", ActionWrite, "national_id", false},
+		// * and ? also match '/' in keys
+		{"orders", ActionRead, "pii/national_id", false},
+		{"billing", ActionWrite, "national_/id", false},
+		{"billing", ActionRead, "secret_/", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, policy.Allowed(tt.caller, tt.action, tt.key), "%s %s %s", tt.caller, tt.action, tt.key)
+	}
+
+	var none *Policy
+	assert.True(t, none.Allowed("orders", ActionWrite, "national_id"))
+}
+
+func TestPolicyCaller(t *testing.T) {
+	assert.Equal(t, "", PolicyCaller(context.Background()))
+	ctx := middleware.ContextWithPrincipal(context.Background(), middleware.Principal{Name: "orders"})
+	assert.Equal(t, "orders", PolicyCaller(ctx))
+}
+
+func TestPolicy_DenyAllMatchesKeysWithSlash(t *testing.T) {
+	policy, err := ParsePolicy("allow orders read public/*; deny orders read *")
+	assert.NoError(t, err)
+
+	assert.True(t, policy.Allowed("orders", ActionRead, "public/display_name"))
+	assert.False(t, policy.Allowed("orders", ActionRead, "pii/national_id"))
+	assert.False(t, policy.Allowed("orders", ActionRead, "a/b/c"))
+}
@@ -0,0 +1,247 @@
+package person_erasure
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	errs "person-service/errors"
+	db "person-service/internal/db/generated"
+	"person-service/logging"
+	person_attributes "person-service/person_attributes"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+)
+
+// errPersonNotFound aborts the erasure transaction when the person does not exist
+var errPersonNotFound = errors.New("person not found")
+
+// ErasureRequest represents the request body for erasing a person
+type ErasureRequest struct {
+	Meta *person_attributes.Meta `json:"meta"`
+}
+
+// PersonErasureHandler handles right-to-erasure requests.
+//
+// Erasure deletes all attributes and images of a person, removes the encrypted
+// payloads of every audit entry that references the person, deletes the person
+// row and records a tombstone in person_erasure proving that the erasure happened.
+// Attribute and image values are encrypted with the service-wide key rather than
+// per-person keys, so the ciphertext is deleted instead of being crypto-shredded.
+//
+// Audit entries written before request_log.person_id existed do not reference a
+// person and are not redacted; RETENTION_AUDIT_LOG_DAYS bounds how long they are kept.
+type PersonErasureHandler struct {
+	pool    *pgxpool.Pool
+	queries *db.Queries
+	// strictCaller requires meta.caller to match the authenticated API key
+	strictCaller bool
+}
+
+// NewPersonErasureHandler creates a new instance of PersonErasureHandler.
+// The pool is required because an erasure runs in a single transaction.
+func NewPersonErasureHandler(pool *pgxpool.Pool) *PersonErasureHandler {
+	return &PersonErasureHandler{
+		pool:    pool,
+		queries: db.New(pool),
+	}
+}
+
+// WithStrictCaller rejects requests whose meta.caller is not the name of the
+// authenticated API key (see person_attributes.LoadStrictCaller)
+func (h *PersonErasureHandler) WithStrictCaller(strict bool) *PersonErasureHandler {
+	h.strictCaller = strict
+	return h
+}
+
+// ErasePerson handles POST /persons/:personId/erasure - erases all data held about a person
+func (h *PersonErasureHandler) ErasePerson(c echo.Context) error {
+	// Parse person ID from path
+	personIDStr := c.Param("personId")
+	var personID pgtype.UUID
+	err := personID.Scan(personIDStr)
+	if err != nil {
+		// Return 404 for invalid UUID (treat as person not found)
+		return c.JSON(http.StatusNotFound, errs.ErrorResponse{
+			Message:   "Person not found",
+			ErrorCode: errs.ErrInvalidPersonID,
+		})
+	}
+
+	// Parse request body
+	var req ErasureRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Invalid request body",
+			ErrorCode: errs.ErrInvalidRequestBody,
+		})
+	}
+
+	// Validate meta is present with the fields recorded on the tombstone
+	if req.Meta == nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Missing required field \"meta\"",
+			ErrorCode: errs.ErrMissingRequiredFieldMeta,
+		})
+	}
+	if req.Meta.Caller == "" || req.Meta.Reason == "" {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Meta fields (caller, reason) are required",
+			ErrorCode: errs.ErrMissingRequiredFieldMeta,
+		})
+	}
+
+	// Use request context for trace propagation
+	ctx := c.Request().Context()
+
+	if err := req.Meta.CheckCaller(ctx, h.strictCaller); err != nil {
+		return c.JSON(http.StatusForbidden, errs.ErrorResponse{
+			Message:   err.Error(),
+			ErrorCode: errs.ErrCallerMismatch,
+		})
+	}
+
+	var tombstone db.PersonErasure
+	err = pgx.BeginFunc(ctx, h.pool, func(tx pgx.Tx) error {
+		var txErr error
+		tombstone, txErr = erasePerson(ctx, h.queries.WithTx(tx), personID, req.Meta)
+		return txErr
+	})
+
+	if errors.Is(err, errPersonNotFound) {
+		// Erasure is idempotent: a retried request returns the existing tombstone
+		existing, lookupErr := h.queries.GetPersonErasure(ctx, personID)
+		if lookupErr == nil {
+			return c.JSON(http.StatusOK, erasureResponse(existing))
+		}
+		if !errors.Is(lookupErr, pgx.ErrNoRows) {
+			return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+				Message:   "Failed to retrieve erasure record",
+				ErrorCode: errs.ErrFailedRetrieveErasure,
+			})
+		}
+		return c.JSON(http.StatusNotFound, errs.ErrorResponse{
+			Message:   "Person not found",
+			ErrorCode: errs.ErrPersonNotFound,
+		})
+	}
+	if err != nil {
+		logging.ErrorContext(ctx, "Failed to erase person", "error", err)
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to erase person",
+			ErrorCode: errs.ErrFailedErasePerson,
+		})
+	}
+
+	logging.InfoContext(ctx, "Person erased",
+		"erasure_id", tombstone.ID,
+		"attributes_removed", tombstone.AttributesRemoved,
+		"images_removed", tombstone.ImagesRemoved,
+		"audit_entries_redacted", tombstone.AuditEntriesRedacted,
+	)
+
+	return c.JSON(http.StatusOK, erasureResponse(tombstone))
+}
+
+// GetErasure handles GET /persons/:personId/erasure - returns the erasure tombstone of a person
+func (h *PersonErasureHandler) GetErasure(c echo.Context) error {
+	// Parse person ID from path
+	personIDStr := c.Param("personId")
+	var personID pgtype.UUID
+	err := personID.Scan(personIDStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Invalid person ID format",
+			ErrorCode: errs.ErrInvalidPersonID,
+		})
+	}
+
+	// Use request context for trace propagation
+	ctx := c.Request().Context()
+
+	tombstone, err := h.queries.GetPersonErasure(ctx, personID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, errs.ErrorResponse{
+				Message:   "Erasure record not found",
+				ErrorCode: errs.ErrErasureNotFound,
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to retrieve erasure record",
+			ErrorCode: errs.ErrFailedRetrieveErasure,
+		})
+	}
+
+	return c.JSON(http.StatusOK, erasureResponse(tombstone))
+}
+
+// erasePerson removes everything stored about a person and records the tombstone.
+// Must be called with transaction-bound queries.
+func erasePerson(ctx context.Context, qtx *db.Queries, personID pgtype.UUID, meta *person_attributes.Meta) (db.PersonErasure, error) {
+	// Lock the person row so concurrent writes cannot add data mid-erasure
+	_, err := qtx.GetPersonByIdForUpdate(ctx, personID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.PersonErasure{}, errPersonNotFound
+	}
+	if err != nil {
+		return db.PersonErasure{}, err
+	}
+
+	attributeCount, err := qtx.CountPersonAttributes(ctx, personID)
+	if err != nil {
+		return db.PersonErasure{}, err
+	}
+	imageCount, err := qtx.CountPersonImages(ctx, personID)
+	if err != nil {
+		return db.PersonErasure{}, err
+	}
+
+	if err := qtx.DeleteAllPersonAttributes(ctx, personID); err != nil {
+		return db.PersonErasure{}, err
+	}
+	if err := qtx.DeleteAllPersonImages(ctx, personID); err != nil {
+		return db.PersonErasure{}, err
+	}
+
+	redacted, err := qtx.RedactRequestLogsByPersonId(ctx, personID)
+	if err != nil {
+		return db.PersonErasure{}, err
+	}
+
+	if err := qtx.HardDeletePerson(ctx, personID); err != nil {
+		return db.PersonErasure{}, err
+	}
+
+	return qtx.InsertPersonErasure(ctx, db.InsertPersonErasureParams{
+		PersonID:             personID,
+		RequestedBy:          meta.Caller,
+		Reason:               meta.Reason,
+		TraceID:              pgtype.Text{String: meta.TraceID, Valid: meta.TraceID != ""},
+		AttributesRemoved:    attributeCount,
+		ImagesRemoved:        imageCount,
+		AuditEntriesRedacted: redacted,
+	})
+}
+
+// erasureResponse builds the JSON response for an erasure tombstone
+func erasureResponse(tombstone db.PersonErasure) map[string]interface{} {
+	response := map[string]interface{}{
+		"id":                   tombstone.ID,
+		"personId":             tombstone.PersonID,
+		"requestedBy":          tombstone.RequestedBy,
+		"reason":               tombstone.Reason,
+		"attributesRemoved":    tombstone.AttributesRemoved,
+		"imagesRemoved":        tombstone.ImagesRemoved,
+		"auditEntriesRedacted": tombstone.AuditEntriesRedacted,
+	}
+	if tombstone.TraceID.Valid {
+		response["traceId"] = tombstone.TraceID.String
+	}
+	if tombstone.ErasedAt.Valid {
+		response["erasedAt"] = tombstone.ErasedAt.Time
+	}
+	return response
+}
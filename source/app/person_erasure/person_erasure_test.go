@@ -0,0 +1,203 @@
+package person_erasure
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	db "person-service/internal/db/generated"
+	"person-service/internal/testdb"
+)
+
+var pool *pgxpool.Pool
+
+const testEncryptionKey = "test-encryption-key-32bytes!!"
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+	var err error
+	pool, err = testdb.GetPool(ctx)
+	if err != nil {
+		log.Fatalf("Failed to get pool: %v", err)
+	}
+	if err := testdb.RunMigrations(ctx, pool); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// Helper function to seed a person with an attribute, an image and an audit entry
+func seedPerson(ctx context.Context, t *testing.T, clientID string) string {
+	personID, err := testdb.CreatePerson(ctx, pool, "", clientID)
+	assert.NoError(t, err)
+
+	_, err = pool.Exec(ctx, `
+		INSERT INTO person_attributes (person_id, attribute_key, encrypted_value, key_version)
+		VALUES ($1::uuid, 'email', pgp_sym_encrypt('person@example.com', $2), 1)
+	`, personID, testEncryptionKey)
+	assert.NoError(t, err)
+
+	_, err = pool.Exec(ctx, `
+		INSERT INTO person_images (person_id, attribute_key, image_type, encrypted_image_data)
+		VALUES ($1::uuid, 'avatar', 'profile', pgp_sym_encrypt('png-bytes', $2))
+	`, personID, testEncryptionKey)
+	assert.NoError(t, err)
+
+	_, err = pool.Exec(ctx, `
+		INSERT INTO request_log (trace_id, caller_info, reason, person_id, encrypted_request_body, encrypted_response_body, key_version)
+		VALUES ($1, 'test-caller', 'testing', $2::uuid, pgp_sym_encrypt('{"key":"email","value":"person@example.com"}', $3), pgp_sym_encrypt('', $3), 1)
+	`, "trace-"+clientID, personID, testEncryptionKey)
+	assert.NoError(t, err)
+
+	return personID
+}
+
+func newEraseContext(personID, body string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/persons/"+personID+"/erasure", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("personId")
+	c.SetParamValues(personID)
+	return c, rec
+}
+
+const validEraseBody = `{"meta":{"caller":"dpo","reason":"gdpr article 17","traceId":"erase-trace-1"}}`
+
+func TestNewPersonErasureHandler(t *testing.T) {
+	handler := NewPersonErasureHandler(pool)
+	assert.NotNil(t, handler)
+	assert.Equal(t, pool, handler.pool)
+	assert.NotNil(t, handler.queries)
+}
+
+func TestErasePerson_InvalidUUID(t *testing.T) {
+	handler := NewPersonErasureHandler(pool)
+	c, rec := newEraseContext("invalid-uuid", validEraseBody)
+
+	err := handler.ErasePerson(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_001_INVALID_PERSON_ID")
+}
+
+func TestErasePerson_MissingMeta(t *testing.T) {
+	handler := NewPersonErasureHandler(pool)
+	c, rec := newEraseContext("123e4567-e89b-12d3-a456-426614174000", `{}`)
+
+	err := handler.ErasePerson(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_005_MISSING_META")
+}
+
+func TestErasePerson_PersonNotFound(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+
+	handler := NewPersonErasureHandler(pool)
+	c, rec := newEraseContext("123e4567-e89b-12d3-a456-426614174000", validEraseBody)
+
+	err := handler.ErasePerson(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_101_PERSON_NOT_FOUND")
+}
+
+func TestErasePerson_Success(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	personID := seedPerson(ctx, t, "erase-client-1")
+
+	handler := NewPersonErasureHandler(pool)
+	c, rec := newEraseContext(personID, validEraseBody)
+
+	err := handler.ErasePerson(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, personID, response["personId"])
+	assert.Equal(t, "dpo", response["requestedBy"])
+	assert.Equal(t, float64(1), response["attributesRemoved"])
+	assert.Equal(t, float64(1), response["imagesRemoved"])
+	assert.Equal(t, float64(1), response["auditEntriesRedacted"])
+
+	// Person, attributes and images are gone
+	var count int
+	assert.NoError(t, pool.QueryRow(ctx, `SELECT COUNT(*) FROM person WHERE id = $1::uuid`, personID).Scan(&count))
+	assert.Equal(t, 0, count)
+	assert.NoError(t, pool.QueryRow(ctx, `SELECT COUNT(*) FROM person_attributes WHERE person_id = $1::uuid`, personID).Scan(&count))
+	assert.Equal(t, 0, count)
+	assert.NoError(t, pool.QueryRow(ctx, `SELECT COUNT(*) FROM person_images WHERE person_id = $1::uuid`, personID).Scan(&count))
+	assert.Equal(t, 0, count)
+
+	// Audit entries are kept but their payloads are redacted
+	assert.NoError(t, pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM request_log
+		WHERE person_id = $1::uuid AND encrypted_request_body IS NULL AND encrypted_response_body IS NULL AND redacted_at IS NOT NULL
+	`, personID).Scan(&count))
+	assert.Equal(t, 1, count)
+}
+
+func TestErasePerson_Idempotent(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	personID := seedPerson(ctx, t, "erase-client-2")
+
+	handler := NewPersonErasureHandler(pool)
+	c, rec := newEraseContext(personID, validEraseBody)
+	assert.NoError(t, handler.ErasePerson(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// A retried erasure returns the existing tombstone
+	c, rec = newEraseContext(personID, validEraseBody)
+	assert.NoError(t, handler.ErasePerson(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"attributesRemoved":1`)
+}
+
+func TestGetErasure_NotFound(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+
+	handler := NewPersonErasureHandler(pool)
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/persons/123e4567-e89b-12d3-a456-426614174000/erasure", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("personId")
+	c.SetParamValues("123e4567-e89b-12d3-a456-426614174000")
+
+	err := handler.GetErasure(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_103_ERASURE_NOT_FOUND")
+}
+
+func TestErasureResponse_OptionalFields(t *testing.T) {
+	response := erasureResponse(db.PersonErasure{ID: 1, RequestedBy: "dpo", Reason: "request"})
+	assert.NotContains(t, response, "traceId")
+	assert.NotContains(t, response, "erasedAt")
+
+	response = erasureResponse(db.PersonErasure{ID: 1, TraceID: pgtype.Text{String: "t-1", Valid: true}})
+	assert.Equal(t, "t-1", response["traceId"])
+}
@@ -0,0 +1,369 @@
+package person_export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	db "person-service/internal/db/generated"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// unsafeFileChars matches characters that are not allowed in archive file names
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// Supported export formats
+const (
+	FormatJSON = "json"
+	FormatZIP  = "zip"
+)
+
+// PersonRecord is the person section of a subject-access export
+type PersonRecord struct {
+	ID          pgtype.UUID        `json:"id"`
+	ClientID    string             `json:"clientId"`
+	Identifiers []IdentifierRecord `json:"identifiers"`
+	CreatedAt   *time.Time         `json:"createdAt,omitempty"`
+	UpdatedAt   *time.Time         `json:"updatedAt,omitempty"`
+}
+
+// IdentifierRecord is an identifier of the person in another client system
+type IdentifierRecord struct {
+	System     string     `json:"system"`
+	ExternalID string     `json:"externalId"`
+	CreatedAt  *time.Time `json:"createdAt,omitempty"`
+}
+
+// AttributeRecord is a decrypted person attribute in an export
+type AttributeRecord struct {
+	ID         int64      `json:"id"`
+	Key        string     `json:"key"`
+	Value      string     `json:"value"`
+	Version    int64      `json:"version"`
+	KeyVersion int64      `json:"keyVersion"`
+	CreatedAt  *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt  *time.Time `json:"updatedAt,omitempty"`
+}
+
+// ImageRecord is the metadata of a person image in an export.
+// Data is only set for JSON exports that include image binaries,
+// File is only set for ZIP exports and points at the archive entry.
+type ImageRecord struct {
+	ID        int64      `json:"id"`
+	Key       string     `json:"key"`
+	ImageType string     `json:"imageType"`
+	MimeType  string     `json:"mimeType,omitempty"`
+	FileSize  *int64     `json:"fileSize,omitempty"`
+	Width     *int64     `json:"width,omitempty"`
+	Height    *int64     `json:"height,omitempty"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+	Data      []byte     `json:"data,omitempty"`
+	File      string     `json:"file,omitempty"`
+}
+
+// AuditRecord is a decrypted request_log entry that references the person.
+// Attribute writes are audited here, so these entries double as the attribute history.
+// Caller is self-reported; Principal is the API key that authenticated the request.
+type AuditRecord struct {
+	ID           int64      `json:"id"`
+	TraceID      string     `json:"traceId"`
+	Caller       string     `json:"caller"`
+	Principal    string     `json:"principal,omitempty"`
+	Owner        string     `json:"principalOwner,omitempty"`
+	Reason       string     `json:"reason"`
+	RequestBody  string     `json:"requestBody"`
+	ResponseBody string     `json:"responseBody"`
+	CreatedAt    *time.Time `json:"createdAt,omitempty"`
+}
+
+// Bundle holds everything exported for a single person.
+// Image binaries are not part of the bundle; they are loaded one at a time while streaming.
+type Bundle struct {
+	ExportedAt time.Time         `json:"exportedAt"`
+	Person     PersonRecord      `json:"person"`
+	Attributes []AttributeRecord `json:"attributes"`
+	Images     []ImageRecord     `json:"images"`
+	AuditLog   []AuditRecord     `json:"auditLog"`
+}
+
+// ImageLoader returns the decrypted binary of the image stored under the given attribute key
+type ImageLoader func(key string) ([]byte, error)
+
+// NewBundle converts database rows into an export bundle
+func NewBundle(
+	exportedAt time.Time,
+	person db.Person,
+	identifiers []db.PersonIdentifier,
+	attributes []db.GetAllPersonAttributesRow,
+	images []db.ListPersonImagesRow,
+	logs []db.ListRequestLogsByPersonIdRow,
+) *Bundle {
+	bundle := &Bundle{
+		ExportedAt: exportedAt.UTC(),
+		Person: PersonRecord{
+			ID:          person.ID,
+			ClientID:    person.ClientID,
+			Identifiers: make([]IdentifierRecord, 0, len(identifiers)),
+			CreatedAt:   timePtr(person.CreatedAt),
+			UpdatedAt:   timePtr(person.UpdatedAt),
+		},
+		Attributes: make([]AttributeRecord, 0, len(attributes)),
+		Images:     make([]ImageRecord, 0, len(images)),
+		AuditLog:   make([]AuditRecord, 0, len(logs)),
+	}
+
+	for _, identifier := range identifiers {
+		bundle.Person.Identifiers = append(bundle.Person.Identifiers, IdentifierRecord{
+			System:     identifier.System,
+			ExternalID: identifier.ExternalID,
+			CreatedAt:  timePtr(identifier.CreatedAt),
+		})
+	}
+
+	for _, attr := range attributes {
+		bundle.Attributes = append(bundle.Attributes, AttributeRecord{
+			ID:         attr.ID,
+			Key:        attr.AttributeKey,
+			Value:      attr.AttributeValue,
+			Version:    attr.Version,
+			KeyVersion: attr.KeyVersion,
+			CreatedAt:  timePtr(attr.CreatedAt),
+			UpdatedAt:  timePtr(attr.UpdatedAt),
+		})
+	}
+
+	for _, img := range images {
+		record := ImageRecord{
+			ID:        img.ID,
+			Key:       img.AttributeKey,
+			ImageType: img.ImageType,
+			FileSize:  int8Ptr(img.FileSize),
+			Width:     int8Ptr(img.Width),
+			Height:    int8Ptr(img.Height),
+			CreatedAt: timePtr(img.CreatedAt),
+			UpdatedAt: timePtr(img.UpdatedAt),
+		}
+		if img.MimeType.Valid {
+			record.MimeType = img.MimeType.String
+		}
+		bundle.Images = append(bundle.Images, record)
+	}
+
+	for _, entry := range logs {
+		bundle.AuditLog = append(bundle.AuditLog, AuditRecord{
+			ID:           entry.ID,
+			TraceID:      entry.TraceID,
+			Caller:       entry.CallerInfo,
+			Principal:    entry.PrincipalName.String,
+			Owner:        entry.PrincipalOwner.String,
+			Reason:       entry.Reason,
+			RequestBody:  entry.RequestBody,
+			ResponseBody: entry.ResponseBody,
+			CreatedAt:    timePtr(entry.CreatedAt),
+		})
+	}
+
+	return bundle
+}
+
+// Redacted replaces audit request and response bodies of attributes the caller may not read
+const Redacted = "[REDACTED]"
+
+// Filter removes the attributes and images whose key readable rejects and
+// redacts the audit entries that recorded a write of such a key, or of a key
+// that cannot be read back from the entry
+func (b *Bundle) Filter(readable func(key string) bool) {
+	attributes := b.Attributes[:0]
+	for _, attr := range b.Attributes {
+		if readable(attr.Key) {
+			attributes = append(attributes, attr)
+		}
+	}
+	b.Attributes = attributes
+
+	images := b.Images[:0]
+	for _, img := range b.Images {
+		if readable(img.Key) {
+			images = append(images, img)
+		}
+	}
+	b.Images = images
+
+	for i, entry := range b.AuditLog {
+		if key, ok := auditKey(entry.RequestBody); ok && (key == "" || !readable(key)) {
+			b.AuditLog[i].RequestBody = Redacted
+			b.AuditLog[i].ResponseBody = Redacted
+		}
+	}
+}
+
+// auditKey returns the attribute key of an audited attribute write, whose body
+// is {"key":"...","value":"..."}. Values are not escaped when audited, so bodies
+// that are not valid JSON are cut at the value. The key is "" when a body starts
+// like an attribute write but has no value to cut at.
+func auditKey(body string) (string, bool) {
+	var attr struct {
+		Key *string `json:"key"`
+	}
+	if err := json.Unmarshal([]byte(body), &attr); err == nil {
+		if attr.Key == nil {
+			return "", false
+		}
+		return *attr.Key, true
+	}
+
+	rest, ok := strings.CutPrefix(body, `{"key":"`)
+	if !ok {
+		return "", false
+	}
+	key, _, found := strings.Cut(rest, `","value":"`)
+	if !found {
+		return "", true
+	}
+	return key, true
+}
+
+// WriteJSON streams the bundle as a single JSON document.
+// When loadImage is non-nil each image's binary is fetched and embedded (base64) as it is written.
+func WriteJSON(w io.Writer, bundle *Bundle, loadImage ImageLoader) error {
+	enc := json.NewEncoder(w)
+
+	if _, err := io.WriteString(w, `{"exportedAt":`); err != nil {
+		return err
+	}
+	if err := enc.Encode(bundle.ExportedAt); err != nil {
+		return err
+	}
+	if err := writeField(w, enc, "person", bundle.Person); err != nil {
+		return err
+	}
+	if err := writeField(w, enc, "attributes", bundle.Attributes); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, `,"images":[`); err != nil {
+		return err
+	}
+	for i, img := range bundle.Images {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if loadImage != nil {
+			data, err := loadImage(img.Key)
+			if err != nil {
+				return fmt.Errorf("load image %q: %w", img.Key, err)
+			}
+			img.Data = data
+		}
+		if err := enc.Encode(img); err != nil {
+			return err
+		}
+	}
+	if _, err := io.WriteString(w, "]"); err != nil {
+		return err
+	}
+
+	if err := writeField(w, enc, "auditLog", bundle.AuditLog); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "}\n")
+	return err
+}
+
+// WriteZIP streams the bundle as a ZIP archive with one JSON file per section.
+// When loadImage is non-nil each image's binary is added under images/.
+func WriteZIP(w io.Writer, bundle *Bundle, loadImage ImageLoader) error {
+	zw := zip.NewWriter(w)
+
+	images := make([]ImageRecord, len(bundle.Images))
+	copy(images, bundle.Images)
+	if loadImage != nil {
+		for i := range images {
+			images[i].File = imageFileName(images[i])
+		}
+	}
+
+	manifest := map[string]interface{}{
+		"exportedAt": bundle.ExportedAt,
+		"person":     bundle.Person,
+	}
+	if err := writeZIPEntry(zw, "person.json", manifest); err != nil {
+		return err
+	}
+	if err := writeZIPEntry(zw, "attributes.json", bundle.Attributes); err != nil {
+		return err
+	}
+	if err := writeZIPEntry(zw, "images.json", images); err != nil {
+		return err
+	}
+	if err := writeZIPEntry(zw, "audit_log.json", bundle.AuditLog); err != nil {
+		return err
+	}
+
+	if loadImage != nil {
+		for _, img := range images {
+			data, err := loadImage(img.Key)
+			if err != nil {
+				return fmt.Errorf("load image %q: %w", img.Key, err)
+			}
+			f, err := zw.Create(img.File)
+			if err != nil {
+				return err
+			}
+			if _, err := f.Write(data); err != nil {
+				return err
+			}
+		}
+	}
+
+	return zw.Close()
+}
+
+// writeField writes `,"name":<value>` to the stream
+func writeField(w io.Writer, enc *json.Encoder, name string, value interface{}) error {
+	if _, err := fmt.Fprintf(w, `,%q:`, name); err != nil {
+		return err
+	}
+	return enc.Encode(value)
+}
+
+// writeZIPEntry adds a pretty-printed JSON file to the archive
+func writeZIPEntry(zw *zip.Writer, name string, value interface{}) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(value)
+}
+
+// imageFileName returns the archive path for an image binary.
+// The attribute key is sanitized so it cannot escape the images/ directory.
+func imageFileName(img ImageRecord) string {
+	return fmt.Sprintf("images/%d-%s", img.ID, unsafeFileChars.ReplaceAllString(img.Key, "_"))
+}
+
+func timePtr(ts pgtype.Timestamptz) *time.Time {
+	if !ts.Valid {
+		return nil
+	}
+	t := ts.Time
+	return &t
+}
+
+func int8Ptr(v pgtype.Int8) *int64 {
+	if !v.Valid {
+		return nil
+	}
+	n := v.Int64
+	return &n
+}
@@ -0,0 +1,196 @@
+package person_export
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	errs "person-service/errors"
+	db "person-service/internal/db/generated"
+	"person-service/logging"
+	"person-service/middleware"
+	person_attributes "person-service/person_attributes"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+// PersonExportHandler handles data subject access (DSAR) exports
+type PersonExportHandler struct {
+	queries       *db.Queries
+	encryptionKey string
+	// policy leaves out attributes the caller may not read; nil exports everything
+	policy *person_attributes.Policy
+}
+
+// NewPersonExportHandler creates a new instance of PersonExportHandler
+func NewPersonExportHandler(queries *db.Queries) *PersonExportHandler {
+	encryptionKey := os.Getenv("ENCRYPTION_KEY_1")
+	if encryptionKey == "" {
+		encryptionKey = "default-key-for-dev"
+	}
+
+	return &PersonExportHandler{
+		queries:       queries,
+		encryptionKey: encryptionKey,
+	}
+}
+
+// WithPolicy leaves out of exports the attributes and images the caller may not
+// read under policy, and redacts their audit entries (see person_attributes.LoadPolicy)
+func (h *PersonExportHandler) WithPolicy(policy *person_attributes.Policy) *PersonExportHandler {
+	h.policy = policy
+	return h
+}
+
+// Export handles GET /persons/:personId/export - streams everything stored about a person.
+// Query parameters:
+//   - format: "json" (default) or "zip"
+//   - include_images: "true" to include decrypted image binaries (needs the images scope)
+func (h *PersonExportHandler) Export(c echo.Context) error {
+	// Parse person ID from path
+	personIDStr := c.Param("personId")
+	var personID pgtype.UUID
+	err := personID.Scan(personIDStr)
+	if err != nil {
+		// Return 404 for invalid UUID (treat as person not found)
+		return c.JSON(http.StatusNotFound, errs.ErrorResponse{
+			Message:   "Person not found",
+			ErrorCode: errs.ErrInvalidPersonID,
+		})
+	}
+
+	// Parse export options
+	format := c.QueryParam("format")
+	if format == "" {
+		format = FormatJSON
+	}
+	if format != FormatJSON && format != FormatZIP {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Invalid export format, expected \"json\" or \"zip\"",
+			ErrorCode: errs.ErrInvalidExportOptions,
+		})
+	}
+
+	includeImages := false
+	if raw := c.QueryParam("include_images"); raw != "" {
+		includeImages, err = strconv.ParseBool(raw)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+				Message:   "Invalid include_images value, expected a boolean",
+				ErrorCode: errs.ErrInvalidExportOptions,
+			})
+		}
+	}
+	if includeImages && !middleware.HasScope(c, middleware.ScopeImages) {
+		return middleware.InsufficientScope(c, middleware.ScopeImages)
+	}
+
+	// Use request context for trace propagation
+	ctx := c.Request().Context()
+
+	// Check if person exists
+	person, err := h.queries.GetPersonById(ctx, personID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, errs.ErrorResponse{
+				Message:   "Person not found",
+				ErrorCode: errs.ErrPersonNotFound,
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to verify person",
+			ErrorCode: errs.ErrFailedVerifyPerson,
+		})
+	}
+
+	// Load everything except image binaries before the response is committed,
+	// so failures can still be reported as a proper error response
+	attributes, err := h.queries.GetAllPersonAttributes(ctx, db.GetAllPersonAttributesParams{
+		PersonID: personID,
+		EncKey:   h.encryptionKey,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to retrieve attributes",
+			ErrorCode: errs.ErrFailedRetrieveAttributes,
+		})
+	}
+
+	identifiers, err := h.queries.ListPersonIdentifiers(ctx, personID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to retrieve identifiers",
+			ErrorCode: errs.ErrFailedRetrieveIdentifiers,
+		})
+	}
+
+	images, err := h.queries.ListPersonImages(ctx, personID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to retrieve images",
+			ErrorCode: errs.ErrFailedRetrieveImages,
+		})
+	}
+
+	auditLog, err := h.queries.ListRequestLogsByPersonId(ctx, db.ListRequestLogsByPersonIdParams{
+		PersonID: personID,
+		EncKey:   h.encryptionKey,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to retrieve audit log",
+			ErrorCode: errs.ErrFailedRetrieveAuditLog,
+		})
+	}
+
+	bundle := NewBundle(time.Now(), person, identifiers, attributes, images, auditLog)
+	if h.policy != nil {
+		caller := person_attributes.PolicyCaller(ctx)
+		bundle.Filter(func(key string) bool {
+			return h.policy.Allowed(caller, person_attributes.ActionRead, key)
+		})
+	}
+
+	var loadImage ImageLoader
+	if includeImages {
+		loadImage = func(key string) ([]byte, error) {
+			image, err := h.queries.GetPersonImage(ctx, db.GetPersonImageParams{
+				PersonID:     personID,
+				AttributeKey: key,
+				EncKey:       h.encryptionKey,
+			})
+			if err != nil {
+				return nil, err
+			}
+			return []byte(image.ImageData), nil
+		}
+	}
+
+	// Stream the export
+	fileName := fmt.Sprintf("person-%s-export.%s", uuid.UUID(personID.Bytes).String(), format)
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", fileName))
+	res.Header().Set("Cache-Control", "no-store")
+
+	if format == FormatZIP {
+		res.Header().Set(echo.HeaderContentType, "application/zip")
+		res.WriteHeader(http.StatusOK)
+		err = WriteZIP(res, bundle, loadImage)
+	} else {
+		res.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+		res.WriteHeader(http.StatusOK)
+		err = WriteJSON(res, bundle, loadImage)
+	}
+
+	// The status line is already sent, so a failure can only be logged
+	if err != nil {
+		logging.ErrorContext(ctx, "Failed to stream person export", "error", err, "format", format)
+	}
+
+	return nil
+}
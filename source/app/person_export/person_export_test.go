@@ -0,0 +1,365 @@
+package person_export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	db "person-service/internal/db/generated"
+	"person-service/internal/testdb"
+	"person-service/middleware"
+	person_attributes "person-service/person_attributes"
+)
+
+var pool *pgxpool.Pool
+
+const testEncryptionKey = "test-encryption-key-32bytes!!"
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+	var err error
+	pool, err = testdb.GetPool(ctx)
+	if err != nil {
+		log.Fatalf("Failed to get pool: %v", err)
+	}
+	if err := testdb.RunMigrations(ctx, pool); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	// Set up environment variable for encryption key
+	os.Setenv("ENCRYPTION_KEY_1", testEncryptionKey)
+
+	os.Exit(m.Run())
+}
+
+// Helper function to create a test attribute for a person
+func createTestAttribute(ctx context.Context, personID, key, value string) error {
+	_, err := pool.Exec(ctx, `
+		INSERT INTO person_attributes (person_id, attribute_key, encrypted_value, key_version)
+		VALUES ($1::uuid, $2, pgp_sym_encrypt($3, $4), 1)
+	`, personID, key, value, testEncryptionKey)
+	return err
+}
+
+// Helper function to create a test image for a person
+func createTestImage(ctx context.Context, personID, key, data string) error {
+	_, err := pool.Exec(ctx, `
+		INSERT INTO person_images (person_id, attribute_key, image_type, encrypted_image_data, mime_type, file_size)
+		VALUES ($1::uuid, $2, 'profile', pgp_sym_encrypt($3, $4), 'image/png', $5)
+	`, personID, key, data, testEncryptionKey, len(data))
+	return err
+}
+
+// Helper function to create an audit log entry that references a person
+func createTestRequestLog(ctx context.Context, personID, traceID string) error {
+	_, err := pool.Exec(ctx, `
+		INSERT INTO request_log (trace_id, caller_info, reason, person_id, encrypted_request_body, encrypted_response_body, key_version)
+		VALUES ($1, 'test-caller', 'testing', $2::uuid, pgp_sym_encrypt('{"key":"email"}', $3), pgp_sym_encrypt('', $3), 1)
+	`, traceID, personID, testEncryptionKey)
+	return err
+}
+
+func newExportContext(personID, query string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/persons/"+personID+"/export"+query, nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("personId")
+	c.SetParamValues(personID)
+	return c, rec
+}
+
+func TestNewPersonExportHandler(t *testing.T) {
+	queries := db.New(pool)
+	handler := NewPersonExportHandler(queries)
+	assert.NotNil(t, handler)
+	assert.Equal(t, queries, handler.queries)
+	assert.Equal(t, testEncryptionKey, handler.encryptionKey)
+}
+
+func TestExport_InvalidUUID(t *testing.T) {
+	handler := NewPersonExportHandler(db.New(pool))
+	c, rec := newExportContext("invalid-uuid", "")
+
+	err := handler.Export(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_001_INVALID_PERSON_ID")
+}
+
+func TestExport_InvalidFormat(t *testing.T) {
+	handler := NewPersonExportHandler(db.New(pool))
+	c, rec := newExportContext("123e4567-e89b-12d3-a456-426614174000", "?format=xml")
+
+	err := handler.Export(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_008_INVALID_EXPORT_OPTIONS")
+}
+
+func TestExport_InvalidIncludeImages(t *testing.T) {
+	handler := NewPersonExportHandler(db.New(pool))
+	c, rec := newExportContext("123e4567-e89b-12d3-a456-426614174000", "?include_images=maybe")
+
+	err := handler.Export(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_008_INVALID_EXPORT_OPTIONS")
+}
+
+func TestExport_ImagesScopeRequired(t *testing.T) {
+	handler := NewPersonExportHandler(db.New(pool))
+	c, rec := newExportContext("123e4567-e89b-12d3-a456-426614174000", "?include_images=true")
+	c.Set(middleware.EchoAPIKeyScopesKey, []string{middleware.ScopeAttributesRead})
+
+	err := handler.Export(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "API_301_INSUFFICIENT_SCOPE")
+}
+
+func TestExport_PersonNotFound(t *testing.T) {
+	ctx := context.Background()
+	err := testdb.TruncateTables(ctx, pool)
+	assert.NoError(t, err)
+
+	handler := NewPersonExportHandler(db.New(pool))
+	c, rec := newExportContext("123e4567-e89b-12d3-a456-426614174000", "")
+
+	err = handler.Export(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_101_PERSON_NOT_FOUND")
+}
+
+func TestExport_JSONSuccess(t *testing.T) {
+	ctx := context.Background()
+	err := testdb.TruncateTables(ctx, pool)
+	assert.NoError(t, err)
+
+	personID, err := testdb.CreatePerson(ctx, pool, "", "export-client-1")
+	assert.NoError(t, err)
+	assert.NoError(t, createTestAttribute(ctx, personID, "email", "person@example.com"))
+	assert.NoError(t, createTestImage(ctx, personID, "avatar", "png-bytes"))
+	assert.NoError(t, createTestRequestLog(ctx, personID, "export-trace-1"))
+
+	handler := NewPersonExportHandler(db.New(pool))
+	c, rec := newExportContext(personID, "?include_images=true")
+	c.Set(middleware.EchoAPIKeyScopesKey, []string{middleware.ScopeAttributesRead, middleware.ScopeImages})
+
+	err = handler.Export(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get(echo.HeaderContentDisposition), "person-"+personID+"-export.json")
+
+	var bundle Bundle
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &bundle))
+	assert.Equal(t, "export-client-1", bundle.Person.ClientID)
+	assert.Len(t, bundle.Attributes, 1)
+	assert.Equal(t, "person@example.com", bundle.Attributes[0].Value)
+	assert.Len(t, bundle.Images, 1)
+	assert.Equal(t, []byte("png-bytes"), bundle.Images[0].Data)
+	assert.Len(t, bundle.AuditLog, 1)
+	assert.Equal(t, "export-trace-1", bundle.AuditLog[0].TraceID)
+}
+
+func TestExport_ZIPSuccess(t *testing.T) {
+	ctx := context.Background()
+	err := testdb.TruncateTables(ctx, pool)
+	assert.NoError(t, err)
+
+	personID, err := testdb.CreatePerson(ctx, pool, "", "export-client-2")
+	assert.NoError(t, err)
+	assert.NoError(t, createTestAttribute(ctx, personID, "email", "person@example.com"))
+
+	handler := NewPersonExportHandler(db.New(pool))
+	c, rec := newExportContext(personID, "?format=zip")
+
+	err = handler.Export(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/zip", rec.Header().Get(echo.HeaderContentType))
+
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	assert.NoError(t, err)
+	names := make([]string, 0, len(zr.File))
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	assert.ElementsMatch(t, []string{"person.json", "attributes.json", "images.json", "audit_log.json"}, names)
+}
+
+func TestExport_AttributePolicy(t *testing.T) {
+	ctx := context.Background()
+	err := testdb.TruncateTables(ctx, pool)
+	assert.NoError(t, err)
+
+	personID, err := testdb.CreatePerson(ctx, pool, "", "export-client-3")
+	assert.NoError(t, err)
+	assert.NoError(t, createTestAttribute(ctx, personID, "email", "person@example.com"))
+	assert.NoError(t, createTestAttribute(ctx, personID, "city", "Jakarta"))
+	assert.NoError(t, createTestRequestLog(ctx, personID, "export-trace-3"))
+
+	policy, err := person_attributes.ParsePolicy("deny * read email")
+	assert.NoError(t, err)
+	handler := NewPersonExportHandler(db.New(pool)).WithPolicy(policy)
+	c, rec := newExportContext(personID, "")
+
+	err = handler.Export(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "person@example.com")
+
+	var bundle Bundle
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &bundle))
+	assert.Len(t, bundle.Attributes, 1)
+	assert.Equal(t, "city", bundle.Attributes[0].Key)
+	assert.Len(t, bundle.AuditLog, 1)
+	assert.Equal(t, Redacted, bundle.AuditLog[0].RequestBody)
+}
+
+// ============================================================================
+// BUNDLE TESTS
+// ============================================================================
+
+func testBundle() *Bundle {
+	var personID pgtype.UUID
+	_ = personID.Scan("123e4567-e89b-12d3-a456-426614174000")
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	return NewBundle(now,
+		db.Person{ID: personID, ClientID: "client-1", CreatedAt: pgtype.Timestamptz{Time: now, Valid: true}},
+		[]db.PersonIdentifier{{ID: 9, PersonID: personID, System: "crm", ExternalID: "CRM-42"}},
+		[]db.GetAllPersonAttributesRow{{ID: 1, AttributeKey: "email", AttributeValue: "a@example.com", Version: 2, KeyVersion: 1}},
+		[]db.ListPersonImagesRow{{ID: 7, AttributeKey: "../avatar", ImageType: "profile", MimeType: pgtype.Text{String: "image/png", Valid: true}}},
+		[]db.ListRequestLogsByPersonIdRow{{ID: 3, TraceID: "trace-1", CallerInfo: "svc", Reason: "sync"}},
+	)
+}
+
+func TestNewBundle_ConvertsRows(t *testing.T) {
+	bundle := testBundle()
+
+	assert.Equal(t, "client-1", bundle.Person.ClientID)
+	assert.NotNil(t, bundle.Person.CreatedAt)
+	assert.Nil(t, bundle.Person.UpdatedAt)
+	assert.Equal(t, []IdentifierRecord{{System: "crm", ExternalID: "CRM-42"}}, bundle.Person.Identifiers)
+	assert.Equal(t, "a@example.com", bundle.Attributes[0].Value)
+	assert.Equal(t, "image/png", bundle.Images[0].MimeType)
+	assert.Nil(t, bundle.Images[0].FileSize)
+	assert.Equal(t, "svc", bundle.AuditLog[0].Caller)
+}
+
+func TestWriteJSON_WithoutImages(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteJSON(&buf, testBundle(), nil)
+	assert.NoError(t, err)
+
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, "123e4567-e89b-12d3-a456-426614174000", decoded["person"].(map[string]interface{})["id"])
+	images := decoded["images"].([]interface{})
+	assert.Len(t, images, 1)
+	assert.NotContains(t, images[0], "data")
+}
+
+func TestWriteJSON_ImageLoaderError(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteJSON(&buf, testBundle(), func(key string) ([]byte, error) {
+		return nil, errors.New("boom")
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "boom")
+}
+
+func TestWriteZIP_WithImages(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteZIP(&buf, testBundle(), func(key string) ([]byte, error) {
+		return []byte("binary-" + key), nil
+	})
+	assert.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	// Attribute key is sanitized so the entry stays inside images/
+	imageFile, ok := files["images/7-.._avatar"]
+	assert.True(t, ok)
+
+	rc, err := imageFile.Open()
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	assert.Equal(t, "binary-../avatar", string(data))
+
+	rc, err = files["images.json"].Open()
+	assert.NoError(t, err)
+	var images []ImageRecord
+	assert.NoError(t, json.NewDecoder(rc).Decode(&images))
+	rc.Close()
+	assert.Equal(t, "images/7-.._avatar", images[0].File)
+}
+
+func TestBundle_Filter(t *testing.T) {
+	bundle := testBundle()
+	bundle.AuditLog = append(bundle.AuditLog,
+		AuditRecord{ID: 4, RequestBody: `{"key":"email","value":"a@example.com"}`, ResponseBody: "ok"},
+		AuditRecord{ID: 5, RequestBody: `{"key":"email","value":"say "hi""}`},
+		AuditRecord{ID: 6, RequestBody: `{"key":"city","value":"Jakarta"}`},
+		AuditRecord{ID: 7, RequestBody: `{"system":"crm","externalId":"CRM-42"}`},
+	)
+
+	bundle.Filter(func(key string) bool { return key != "email" })
+
+	assert.Empty(t, bundle.Attributes)
+	assert.Len(t, bundle.Images, 1)
+	assert.Equal(t, Redacted, bundle.AuditLog[1].RequestBody)
+	assert.Equal(t, Redacted, bundle.AuditLog[1].ResponseBody)
+	assert.Equal(t, Redacted, bundle.AuditLog[2].RequestBody)
+	assert.Equal(t, `{"key":"city","value":"Jakarta"}`, bundle.AuditLog[3].RequestBody)
+	assert.Equal(t, `{"system":"crm","externalId":"CRM-42"}`, bundle.AuditLog[4].RequestBody)
+}
+
+func TestAuditKey(t *testing.T) {
+	tests := []struct {
+		body      string
+		key       string
+		attribute bool
+	}{
+		{`{"key":"email","value":"a@example.com"}`, "email", true},
+		{`{"key":"email","value":"say "hi""}`, "email", true},
+		{`{"key":"broken`, "", true},
+		{`{"system":"crm","externalId":"CRM-42"}`, "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		key, attribute := auditKey(tt.body)
+		assert.Equal(t, tt.key, key, tt.body)
+		assert.Equal(t, tt.attribute, attribute, tt.body)
+	}
+}
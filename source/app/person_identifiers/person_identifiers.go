@@ -0,0 +1,405 @@
+package person_identifiers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	errs "person-service/errors"
+	db "person-service/internal/db/generated"
+	"person-service/logging"
+	person_attributes "person-service/person_attributes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+// maxExternalIDLength bounds the size of an identifier from a client system
+const maxExternalIDLength = 255
+
+// systemPattern restricts system names to short slugs such as "crm" or "billing-v2"
+var systemPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// AttachIdentifierRequest represents the request body for attaching an identifier
+type AttachIdentifierRequest struct {
+	System     string                  `json:"system"`
+	ExternalID string                  `json:"externalId"`
+	Meta       *person_attributes.Meta `json:"meta"`
+}
+
+// DetachIdentifierRequest represents the request body for detaching an identifier
+type DetachIdentifierRequest struct {
+	Meta *person_attributes.Meta `json:"meta"`
+}
+
+// PersonIdentifiersHandler handles identifiers of persons in other client systems
+type PersonIdentifiersHandler struct {
+	queries       *db.Queries
+	encryptionKey string
+	keyVersion    int64
+	// strictCaller requires meta.caller to match the authenticated API key
+	strictCaller bool
+}
+
+// NewPersonIdentifiersHandler creates a new instance of PersonIdentifiersHandler
+func NewPersonIdentifiersHandler(queries *db.Queries) *PersonIdentifiersHandler {
+	encryptionKey := os.Getenv("ENCRYPTION_KEY_1")
+	if encryptionKey == "" {
+		encryptionKey = "default-key-for-dev"
+	}
+
+	return &PersonIdentifiersHandler{
+		queries:       queries,
+		encryptionKey: encryptionKey,
+		keyVersion:    1,
+	}
+}
+
+// WithStrictCaller rejects requests whose meta.caller is not the name of the
+// authenticated API key (see person_attributes.LoadStrictCaller)
+func (h *PersonIdentifiersHandler) WithStrictCaller(strict bool) *PersonIdentifiersHandler {
+	h.strictCaller = strict
+	return h
+}
+
+// AttachIdentifier handles POST /persons/:personId/identifiers - attaches an identifier from another system
+func (h *PersonIdentifiersHandler) AttachIdentifier(c echo.Context) error {
+	// Parse person ID from path
+	personIDStr := c.Param("personId")
+	var personID pgtype.UUID
+	err := personID.Scan(personIDStr)
+	if err != nil {
+		// Return 404 for invalid UUID (treat as person not found)
+		return c.JSON(http.StatusNotFound, errs.ErrorResponse{
+			Message:   "Person not found",
+			ErrorCode: errs.ErrInvalidPersonID,
+		})
+	}
+
+	// Parse request body
+	var req AttachIdentifierRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Invalid request body",
+			ErrorCode: errs.ErrInvalidRequestBody,
+		})
+	}
+
+	if err := validateIdentifier(req.System, req.ExternalID); err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   err.Error(),
+			ErrorCode: errs.ErrInvalidIdentifier,
+		})
+	}
+
+	// Validate meta is present
+	if req.Meta == nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Missing required field \"meta\"",
+			ErrorCode: errs.ErrMissingRequiredFieldMeta,
+		})
+	}
+	if req.Meta.Caller == "" || req.Meta.Reason == "" {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Meta fields (caller, reason) are required",
+			ErrorCode: errs.ErrMissingRequiredFieldMeta,
+		})
+	}
+
+	// Use request context for trace propagation
+	ctx := c.Request().Context()
+
+	if err := req.Meta.CheckCaller(ctx, h.strictCaller); err != nil {
+		return c.JSON(http.StatusForbidden, errs.ErrorResponse{
+			Message:   err.Error(),
+			ErrorCode: errs.ErrCallerMismatch,
+		})
+	}
+
+	// Check if person exists
+	_, err = h.queries.GetPersonById(ctx, personID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, errs.ErrorResponse{
+				Message:   "Person not found",
+				ErrorCode: errs.ErrPersonNotFound,
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to verify person",
+			ErrorCode: errs.ErrFailedVerifyPerson,
+		})
+	}
+
+	identifier, err := h.queries.AttachPersonIdentifier(ctx, db.AttachPersonIdentifierParams{
+		PersonID:   personID,
+		System:     req.System,
+		ExternalID: req.ExternalID,
+	})
+	status := http.StatusCreated
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The identifier is already taken: attaching it again to the same person is a no-op
+		identifier, err = h.queries.GetPersonIdentifier(ctx, db.GetPersonIdentifierParams{
+			System:     req.System,
+			ExternalID: req.ExternalID,
+		})
+		if err == nil && identifier.PersonID != personID {
+			return c.JSON(http.StatusConflict, errs.ErrorResponse{
+				Message:   "Identifier is already attached to another person",
+				ErrorCode: errs.ErrIdentifierConflict,
+			})
+		}
+		status = http.StatusOK
+	}
+	if err != nil {
+		logging.ErrorContext(ctx, "Failed to attach identifier", "error", err)
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to attach identifier",
+			ErrorCode: errs.ErrFailedAttachIdentifier,
+		})
+	}
+
+	h.audit(ctx, req.Meta, personID, map[string]string{"system": req.System, "externalId": req.ExternalID})
+
+	return c.JSON(status, identifierResponse(identifier))
+}
+
+// audit logs a change of the identifiers of a person to the audit log (request_log table)
+func (h *PersonIdentifiersHandler) audit(ctx context.Context, meta *person_attributes.Meta, personID pgtype.UUID, body map[string]string) {
+	if meta.TraceID == "" {
+		return
+	}
+	requestBody, _ := json.Marshal(body)
+	principalName, principalOwner := person_attributes.AuditPrincipal(ctx)
+
+	_, logErr := h.queries.InsertRequestLog(ctx, db.InsertRequestLogParams{
+		TraceID:               meta.TraceID,
+		CallerInfo:            meta.Caller,
+		Reason:                meta.Reason,
+		PersonID:              personID,
+		PrincipalName:         principalName,
+		PrincipalOwner:        principalOwner,
+		EncryptedRequestBody:  string(requestBody),
+		EncryptedResponseBody: "",
+		EncKey:                h.encryptionKey,
+		KeyVersion:            h.keyVersion,
+	})
+
+	// Audit logging should not block the main operation
+	if logErr != nil {
+		logging.WarnContext(ctx, "Failed to write audit log", "error", logErr, "error_code", errs.ErrFailedAuditLog)
+	}
+}
+
+// ListIdentifiers handles GET /persons/:personId/identifiers - lists the identifiers of a person
+func (h *PersonIdentifiersHandler) ListIdentifiers(c echo.Context) error {
+	// Parse person ID from path
+	personIDStr := c.Param("personId")
+	var personID pgtype.UUID
+	err := personID.Scan(personIDStr)
+	if err != nil {
+		// Return 404 for invalid UUID (treat as person not found)
+		return c.JSON(http.StatusNotFound, errs.ErrorResponse{
+			Message:   "Person not found",
+			ErrorCode: errs.ErrInvalidPersonID,
+		})
+	}
+
+	// Use request context for trace propagation
+	ctx := c.Request().Context()
+
+	// Check if person exists
+	_, err = h.queries.GetPersonById(ctx, personID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, errs.ErrorResponse{
+				Message:   "Person not found",
+				ErrorCode: errs.ErrPersonNotFound,
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to verify person",
+			ErrorCode: errs.ErrFailedVerifyPerson,
+		})
+	}
+
+	identifiers, err := h.queries.ListPersonIdentifiers(ctx, personID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to retrieve identifiers",
+			ErrorCode: errs.ErrFailedRetrieveIdentifiers,
+		})
+	}
+
+	response := make([]map[string]interface{}, 0, len(identifiers))
+	for _, identifier := range identifiers {
+		response = append(response, identifierResponse(identifier))
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// DetachIdentifier handles DELETE /persons/:personId/identifiers/:identifierId - detaches an identifier.
+// Like attaching, it requires meta and is recorded in the audit log.
+func (h *PersonIdentifiersHandler) DetachIdentifier(c echo.Context) error {
+	// Parse person ID from path
+	personIDStr := c.Param("personId")
+	var personID pgtype.UUID
+	err := personID.Scan(personIDStr)
+	if err != nil {
+		// Return 404 for invalid UUID (treat as person not found)
+		return c.JSON(http.StatusNotFound, errs.ErrorResponse{
+			Message:   "Person not found",
+			ErrorCode: errs.ErrInvalidPersonID,
+		})
+	}
+
+	// Parse identifier ID from path
+	identifierID, err := strconv.ParseInt(c.Param("identifierId"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Invalid identifier ID format",
+			ErrorCode: errs.ErrInvalidIdentifier,
+		})
+	}
+
+	// Parse request body
+	var req DetachIdentifierRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Invalid request body",
+			ErrorCode: errs.ErrInvalidRequestBody,
+		})
+	}
+
+	// Validate meta is present
+	if req.Meta == nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Missing required field \"meta\"",
+			ErrorCode: errs.ErrMissingRequiredFieldMeta,
+		})
+	}
+	if req.Meta.Caller == "" || req.Meta.Reason == "" {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Meta fields (caller, reason) are required",
+			ErrorCode: errs.ErrMissingRequiredFieldMeta,
+		})
+	}
+
+	// Use request context for trace propagation
+	ctx := c.Request().Context()
+
+	if err := req.Meta.CheckCaller(ctx, h.strictCaller); err != nil {
+		return c.JSON(http.StatusForbidden, errs.ErrorResponse{
+			Message:   err.Error(),
+			ErrorCode: errs.ErrCallerMismatch,
+		})
+	}
+
+	identifier, err := h.queries.DeletePersonIdentifier(ctx, db.DeletePersonIdentifierParams{
+		ID:       identifierID,
+		PersonID: personID,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, errs.ErrorResponse{
+				Message:   "Identifier not found",
+				ErrorCode: errs.ErrIdentifierNotFound,
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to detach identifier",
+			ErrorCode: errs.ErrFailedDetachIdentifier,
+		})
+	}
+
+	h.audit(ctx, req.Meta, personID, map[string]string{
+		"identifierId": strconv.FormatInt(identifier.ID, 10),
+		"system":       identifier.System,
+		"externalId":   identifier.ExternalID,
+	})
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Identifier detached successfully",
+	})
+}
+
+// ResolveIdentifier handles GET /persons/resolve?system=&id= - finds the person holding an identifier
+func (h *PersonIdentifiersHandler) ResolveIdentifier(c echo.Context) error {
+	system := c.QueryParam("system")
+	externalID := c.QueryParam("id")
+	if err := validateIdentifier(system, externalID); err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   err.Error(),
+			ErrorCode: errs.ErrInvalidIdentifier,
+		})
+	}
+
+	// Use request context for trace propagation
+	ctx := c.Request().Context()
+
+	person, err := h.queries.ResolvePersonIdentifier(ctx, db.ResolvePersonIdentifierParams{
+		System:     system,
+		ExternalID: externalID,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, errs.ErrorResponse{
+				Message:   "No person found for identifier",
+				ErrorCode: errs.ErrIdentifierNotFound,
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to retrieve identifiers",
+			ErrorCode: errs.ErrFailedRetrieveIdentifiers,
+		})
+	}
+
+	response := map[string]interface{}{
+		"personId":   person.ID,
+		"clientId":   person.ClientID,
+		"system":     person.System,
+		"externalId": person.ExternalID,
+	}
+	if person.CreatedAt.Valid {
+		response["createdAt"] = person.CreatedAt.Time
+	}
+	if person.UpdatedAt.Valid {
+		response["updatedAt"] = person.UpdatedAt.Time
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// validateIdentifier checks the system name and external ID of an identifier
+func validateIdentifier(system, externalID string) error {
+	if !systemPattern.MatchString(system) {
+		return errors.New("Field \"system\" must be 1-64 letters, digits, '.', '_' or '-'")
+	}
+	if strings.TrimSpace(externalID) == "" {
+		return errors.New("Field \"externalId\" is required")
+	}
+	if len(externalID) > maxExternalIDLength {
+		return errors.New("Field \"externalId\" must be at most 255 characters")
+	}
+	return nil
+}
+
+// identifierResponse builds the JSON response for an identifier
+func identifierResponse(identifier db.PersonIdentifier) map[string]interface{} {
+	response := map[string]interface{}{
+		"id":         identifier.ID,
+		"personId":   identifier.PersonID,
+		"system":     identifier.System,
+		"externalId": identifier.ExternalID,
+	}
+	if identifier.CreatedAt.Valid {
+		response["createdAt"] = identifier.CreatedAt.Time
+	}
+	return response
+}
@@ -0,0 +1,256 @@
+package person_identifiers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	db "person-service/internal/db/generated"
+	"person-service/internal/testdb"
+	"person-service/middleware"
+)
+
+var pool *pgxpool.Pool
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+	var err error
+	pool, err = testdb.GetPool(ctx)
+	if err != nil {
+		log.Fatalf("Failed to get pool: %v", err)
+	}
+	if err := testdb.RunMigrations(ctx, pool); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	os.Exit(m.Run())
+}
+
+func newAttachContext(personID, body string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/persons/"+personID+"/identifiers", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("personId")
+	c.SetParamValues(personID)
+	return c, rec
+}
+
+func attachBody(system, externalID string) string {
+	return `{"system":"` + system + `","externalId":"` + externalID + `","meta":{"caller":"crm-sync","reason":"link account","traceId":""}}`
+}
+
+func TestNewPersonIdentifiersHandler(t *testing.T) {
+	queries := db.New(pool)
+	handler := NewPersonIdentifiersHandler(queries)
+	assert.NotNil(t, handler)
+	assert.Equal(t, queries, handler.queries)
+}
+
+func TestAttachIdentifier_InvalidUUID(t *testing.T) {
+	handler := NewPersonIdentifiersHandler(db.New(pool))
+	c, rec := newAttachContext("invalid-uuid", attachBody("crm", "CRM-1"))
+
+	err := handler.AttachIdentifier(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_001_INVALID_PERSON_ID")
+}
+
+func TestAttachIdentifier_InvalidIdentifier(t *testing.T) {
+	handler := NewPersonIdentifiersHandler(db.New(pool))
+	c, rec := newAttachContext("123e4567-e89b-12d3-a456-426614174000", attachBody("crm system", "CRM-1"))
+
+	err := handler.AttachIdentifier(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_010_INVALID_IDENTIFIER")
+}
+
+func TestAttachIdentifier_PersonNotFound(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+
+	handler := NewPersonIdentifiersHandler(db.New(pool))
+	c, rec := newAttachContext("123e4567-e89b-12d3-a456-426614174000", attachBody("crm", "CRM-1"))
+
+	err := handler.AttachIdentifier(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_101_PERSON_NOT_FOUND")
+}
+
+func TestAttachIdentifier_SuccessAndIdempotent(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	personID, err := testdb.CreatePerson(ctx, pool, "", "identifier-client-1")
+	assert.NoError(t, err)
+
+	handler := NewPersonIdentifiersHandler(db.New(pool))
+	c, rec := newAttachContext(personID, attachBody("crm", "CRM-1"))
+	assert.NoError(t, handler.AttachIdentifier(c))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var response map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, personID, response["personId"])
+	assert.Equal(t, "crm", response["system"])
+	assert.Equal(t, "CRM-1", response["externalId"])
+
+	// Attaching the same identifier again to the same person is a no-op
+	c, rec = newAttachContext(personID, attachBody("CRM", "CRM-1"))
+	assert.NoError(t, handler.AttachIdentifier(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestAttachIdentifier_Conflict(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	firstID, err := testdb.CreatePerson(ctx, pool, "", "identifier-client-2")
+	assert.NoError(t, err)
+	secondID, err := testdb.CreatePerson(ctx, pool, "", "identifier-client-3")
+	assert.NoError(t, err)
+
+	handler := NewPersonIdentifiersHandler(db.New(pool))
+	c, rec := newAttachContext(firstID, attachBody("billing", "B-7"))
+	assert.NoError(t, handler.AttachIdentifier(c))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	c, rec = newAttachContext(secondID, attachBody("billing", "B-7"))
+	assert.NoError(t, handler.AttachIdentifier(c))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_215_IDENTIFIER_CONFLICT")
+
+	// The same external ID in another system belongs to a different identifier
+	c, rec = newAttachContext(secondID, attachBody("crm", "B-7"))
+	assert.NoError(t, handler.AttachIdentifier(c))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+}
+
+func TestListAndDetachIdentifiers(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	personID, err := testdb.CreatePerson(ctx, pool, "", "identifier-client-4")
+	assert.NoError(t, err)
+
+	handler := NewPersonIdentifiersHandler(db.New(pool))
+	c, rec := newAttachContext(personID, attachBody("crm", "CRM-4"))
+	assert.NoError(t, handler.AttachIdentifier(c))
+	var attached map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &attached))
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/persons/"+personID+"/identifiers", nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetParamNames("personId")
+	c.SetParamValues(personID)
+	assert.NoError(t, handler.ListIdentifiers(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var list []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	assert.Len(t, list, 1)
+
+	identifierID := strconv.FormatInt(int64(attached["id"].(float64)), 10)
+	detach := func(personID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req = req.WithContext(middleware.ContextWithPrincipal(req.Context(), middleware.Principal{Name: "crm-sync"}))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("personId", "identifierId")
+		c.SetParamValues(personID, identifierID)
+		assert.NoError(t, handler.DetachIdentifier(c))
+		return rec
+	}
+	meta := `{"meta":{"caller":"crm-sync","reason":"unlink account","traceId":"detach-trace-1"}}`
+
+	rec = detach("invalid-uuid", meta)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_001_INVALID_PERSON_ID")
+
+	rec = detach(personID, `{}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_005_MISSING_META")
+
+	strict := NewPersonIdentifiersHandler(db.New(pool)).WithStrictCaller(true)
+	req = httptest.NewRequest(http.MethodDelete, "/", strings.NewReader(`{"meta":{"caller":"someone-else","reason":"unlink account"}}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req = req.WithContext(middleware.ContextWithPrincipal(req.Context(), middleware.Principal{Name: "crm-sync"}))
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetParamNames("personId", "identifierId")
+	c.SetParamValues(personID, identifierID)
+	assert.NoError(t, strict.DetachIdentifier(c))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	assert.Equal(t, http.StatusOK, detach(personID, meta).Code)
+	rec = detach(personID, meta)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_105_IDENTIFIER_NOT_FOUND")
+
+	// The detach is recorded in the audit log of the person
+	var audited int
+	err = pool.QueryRow(ctx, `
+		SELECT count(*) FROM request_log WHERE trace_id = 'detach-trace-1' AND person_id = $1 AND reason = 'unlink account'
+	`, personID).Scan(&audited)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, audited)
+}
+
+func TestResolveIdentifier(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	personID, err := testdb.CreatePerson(ctx, pool, "", "identifier-client-5")
+	assert.NoError(t, err)
+
+	handler := NewPersonIdentifiersHandler(db.New(pool))
+	c, _ := newAttachContext(personID, attachBody("identity", "auth0|123"))
+	assert.NoError(t, handler.AttachIdentifier(c))
+
+	resolve := func(query string) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/persons/resolve?"+query, nil)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, handler.ResolveIdentifier(e.NewContext(req, rec)))
+		return rec
+	}
+
+	rec := resolve("system=Identity&id=auth0%7C123")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, personID, response["personId"])
+	assert.Equal(t, "identifier-client-5", response["clientId"])
+
+	rec = resolve("system=identity&id=unknown")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_105_IDENTIFIER_NOT_FOUND")
+
+	rec = resolve("system=identity")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_010_INVALID_IDENTIFIER")
+}
+
+func TestValidateIdentifier(t *testing.T) {
+	assert.NoError(t, validateIdentifier("crm", "CRM-1"))
+	assert.NoError(t, validateIdentifier("billing-v2.eu", "x"))
+	assert.Error(t, validateIdentifier("", "CRM-1"))
+	assert.Error(t, validateIdentifier("-crm", "CRM-1"))
+	assert.Error(t, validateIdentifier("crm", "  "))
+	assert.Error(t, validateIdentifier("crm", strings.Repeat("a", maxExternalIDLength+1)))
+}
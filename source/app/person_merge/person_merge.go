@@ -0,0 +1,426 @@
+package person_merge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	errs "person-service/errors"
+	db "person-service/internal/db/generated"
+	"person-service/logging"
+	person_attributes "person-service/person_attributes"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	// errTargetNotFound aborts the merge when the surviving person does not exist
+	errTargetNotFound = errors.New("target person not found")
+	// errSourceNotFound aborts the merge when the duplicate person does not exist
+	errSourceNotFound = errors.New("source person not found")
+)
+
+// writeDeniedError aborts the merge when the caller may not write a key it would move or drop
+type writeDeniedError struct {
+	key string
+}
+
+func (e *writeDeniedError) Error() string {
+	return fmt.Sprintf("caller may not write attribute %q", e.key)
+}
+
+// MergeRequest represents the request body for merging a duplicate person into another
+type MergeRequest struct {
+	SourcePersonID string                  `json:"sourcePersonId"`
+	Strategy       string                  `json:"strategy"`
+	KeyStrategies  map[string]string       `json:"keyStrategies"`
+	Meta           *person_attributes.Meta `json:"meta"`
+}
+
+// PersonMergeHandler handles merging of duplicate persons.
+//
+// A merge moves the attributes, images, identifiers and audit entries of a source
+// person to a target person, resolves keys held by both with the requested strategy,
+// soft-deletes the source and records the merge in person_merge. Reads of the
+// source ID are then redirected to the target by RedirectMerged.
+type PersonMergeHandler struct {
+	pool    *pgxpool.Pool
+	queries *db.Queries
+	// strictCaller requires meta.caller to match the authenticated API key
+	strictCaller bool
+	// policy rejects merges that move or drop keys the caller may not write
+	policy *person_attributes.Policy
+}
+
+// NewPersonMergeHandler creates a new instance of PersonMergeHandler.
+// The pool is required because a merge runs in a single transaction.
+func NewPersonMergeHandler(pool *pgxpool.Pool) *PersonMergeHandler {
+	return &PersonMergeHandler{
+		pool:    pool,
+		queries: db.New(pool),
+	}
+}
+
+// WithStrictCaller rejects requests whose meta.caller is not the name of the
+// authenticated API key (see person_attributes.LoadStrictCaller)
+func (h *PersonMergeHandler) WithStrictCaller(strict bool) *PersonMergeHandler {
+	h.strictCaller = strict
+	return h
+}
+
+// WithPolicy rejects merges of a source person holding attributes or images the
+// caller may not write under policy (see person_attributes.LoadPolicy)
+func (h *PersonMergeHandler) WithPolicy(policy *person_attributes.Policy) *PersonMergeHandler {
+	h.policy = policy
+	return h
+}
+
+// MergePerson handles POST /persons/:personId/merge - merges the source person into :personId
+func (h *PersonMergeHandler) MergePerson(c echo.Context) error {
+	// Parse target person ID from path
+	personIDStr := c.Param("personId")
+	var targetID pgtype.UUID
+	err := targetID.Scan(personIDStr)
+	if err != nil {
+		// Return 404 for invalid UUID (treat as person not found)
+		return c.JSON(http.StatusNotFound, errs.ErrorResponse{
+			Message:   "Person not found",
+			ErrorCode: errs.ErrInvalidPersonID,
+		})
+	}
+
+	// Parse request body
+	var req MergeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Invalid request body",
+			ErrorCode: errs.ErrInvalidRequestBody,
+		})
+	}
+
+	// Validate meta is present with the fields recorded on the merge
+	if req.Meta == nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Missing required field \"meta\"",
+			ErrorCode: errs.ErrMissingRequiredFieldMeta,
+		})
+	}
+	if req.Meta.Caller == "" || req.Meta.Reason == "" {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Meta fields (caller, reason) are required",
+			ErrorCode: errs.ErrMissingRequiredFieldMeta,
+		})
+	}
+
+	var sourceID pgtype.UUID
+	if err := sourceID.Scan(req.SourcePersonID); err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Field \"sourcePersonId\" must be a valid person ID",
+			ErrorCode: errs.ErrInvalidMergeRequest,
+		})
+	}
+	if sourceID == targetID {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "A person cannot be merged into itself",
+			ErrorCode: errs.ErrInvalidMergeRequest,
+		})
+	}
+
+	strategies, err := ParseStrategies(req.Strategy, req.KeyStrategies)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{
+			Message:   "Invalid merge strategy: " + err.Error(),
+			ErrorCode: errs.ErrInvalidMergeRequest,
+		})
+	}
+
+	// Use request context for trace propagation
+	ctx := c.Request().Context()
+
+	if err := req.Meta.CheckCaller(ctx, h.strictCaller); err != nil {
+		return c.JSON(http.StatusForbidden, errs.ErrorResponse{
+			Message:   err.Error(),
+			ErrorCode: errs.ErrCallerMismatch,
+		})
+	}
+
+	caller := person_attributes.PolicyCaller(ctx)
+	writable := func(key string) bool {
+		return h.policy.Allowed(caller, person_attributes.ActionWrite, key)
+	}
+
+	var merge db.PersonMerge
+	err = pgx.BeginFunc(ctx, h.pool, func(tx pgx.Tx) error {
+		var txErr error
+		merge, txErr = mergePersons(ctx, h.queries.WithTx(tx), targetID, sourceID, strategies, req.Meta, writable)
+		return txErr
+	})
+
+	var denied *writeDeniedError
+	if errors.As(err, &denied) {
+		return c.JSON(http.StatusForbidden, errs.ErrorResponse{
+			Message:   fmt.Sprintf("Caller may not %s attribute %q", person_attributes.ActionWrite, denied.key),
+			ErrorCode: errs.ErrAttributeDenied,
+		})
+	}
+
+	if errors.Is(err, errTargetNotFound) {
+		return c.JSON(http.StatusNotFound, errs.ErrorResponse{
+			Message:   "Person not found",
+			ErrorCode: errs.ErrPersonNotFound,
+		})
+	}
+	if errors.Is(err, errSourceNotFound) {
+		// Merging is idempotent: a retried request returns the existing merge record
+		existing, lookupErr := h.queries.GetPersonMergeBySourceId(ctx, sourceID)
+		if lookupErr == nil && existing.TargetPersonID == targetID {
+			return c.JSON(http.StatusOK, mergeResponse(existing))
+		}
+		return c.JSON(http.StatusNotFound, errs.ErrorResponse{
+			Message:   "Source person not found",
+			ErrorCode: errs.ErrSourcePersonNotFound,
+		})
+	}
+	if err != nil {
+		logging.ErrorContext(ctx, "Failed to merge persons", "error", err)
+		return c.JSON(http.StatusInternalServerError, errs.ErrorResponse{
+			Message:   "Failed to merge persons",
+			ErrorCode: errs.ErrFailedMergePersons,
+		})
+	}
+
+	logging.InfoContext(ctx, "Persons merged",
+		"merge_id", merge.ID,
+		"attributes_moved", merge.AttributesMoved,
+		"attributes_dropped", merge.AttributesDropped,
+		"images_moved", merge.ImagesMoved,
+		"images_dropped", merge.ImagesDropped,
+	)
+
+	return c.JSON(http.StatusOK, mergeResponse(merge))
+}
+
+// RedirectMerged redirects reads of a merged person to the surviving person with
+// 308 Permanent Redirect. Requests for persons that were not merged pass through.
+func RedirectMerged(queries *db.Queries) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			personIDStr := c.Param("personId")
+			var personID pgtype.UUID
+			if err := personID.Scan(personIDStr); err != nil {
+				return next(c)
+			}
+
+			ctx := c.Request().Context()
+			merge, err := queries.GetPersonMergeBySourceId(ctx, personID)
+			if err != nil {
+				if !errors.Is(err, pgx.ErrNoRows) {
+					logging.WarnContext(ctx, "Failed to look up person merge", "error", err)
+				}
+				return next(c)
+			}
+
+			target := uuid.UUID(merge.TargetPersonID.Bytes).String()
+			return c.Redirect(http.StatusPermanentRedirect, mergedLocation(c.Request().URL, personIDStr, target))
+		}
+	}
+}
+
+// mergedLocation replaces the merged person ID in the request path with the target ID
+func mergedLocation(u *url.URL, personID, targetID string) string {
+	location := *u
+	location.Path = strings.Replace(u.Path, "/"+personID, "/"+targetID, 1)
+	location.RawPath = ""
+	return location.RequestURI()
+}
+
+// mergePersons moves everything from the source person to the target person and
+// records the merge. Every source key ends up on the target or dropped, so the
+// merge fails with a writeDeniedError when writable rejects one of them.
+// Must be called with transaction-bound queries.
+func mergePersons(ctx context.Context, qtx *db.Queries, targetID, sourceID pgtype.UUID, strategies Strategies, meta *person_attributes.Meta, writable func(key string) bool) (db.PersonMerge, error) {
+	// Lock both persons in a stable order so concurrent merges cannot deadlock
+	first, second := targetID, sourceID
+	if bytes.Compare(sourceID.Bytes[:], targetID.Bytes[:]) < 0 {
+		first, second = sourceID, targetID
+	}
+	for _, id := range []pgtype.UUID{first, second} {
+		person, err := qtx.GetPersonByIdForUpdate(ctx, id)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && person.DeletedAt.Valid) {
+			if id == targetID {
+				return db.PersonMerge{}, errTargetNotFound
+			}
+			return db.PersonMerge{}, errSourceNotFound
+		}
+		if err != nil {
+			return db.PersonMerge{}, err
+		}
+	}
+
+	attributePlan, err := planAttributes(ctx, qtx, targetID, sourceID, strategies, writable)
+	if err != nil {
+		return db.PersonMerge{}, err
+	}
+	imagePlan, err := planImages(ctx, qtx, targetID, sourceID, strategies, writable)
+	if err != nil {
+		return db.PersonMerge{}, err
+	}
+
+	// Delete the losing rows first so the moves cannot violate the unique keys
+	if _, err := qtx.DeletePersonAttributesByIds(ctx, append(attributePlan.DropTarget, attributePlan.DropSource...)); err != nil {
+		return db.PersonMerge{}, err
+	}
+	if _, err := qtx.DeletePersonImagesByIds(ctx, append(imagePlan.DropTarget, imagePlan.DropSource...)); err != nil {
+		return db.PersonMerge{}, err
+	}
+
+	attributesMoved, err := qtx.MovePersonAttributes(ctx, db.MovePersonAttributesParams{
+		TargetPersonID: targetID,
+		SourcePersonID: sourceID,
+	})
+	if err != nil {
+		return db.PersonMerge{}, err
+	}
+	imagesMoved, err := qtx.MovePersonImages(ctx, db.MovePersonImagesParams{
+		TargetPersonID: targetID,
+		SourcePersonID: sourceID,
+	})
+	if err != nil {
+		return db.PersonMerge{}, err
+	}
+
+	// Identifiers are unique per system, so they can never conflict
+	if _, err := qtx.MovePersonIdentifiers(ctx, db.MovePersonIdentifiersParams{
+		TargetPersonID: targetID,
+		SourcePersonID: sourceID,
+	}); err != nil {
+		return db.PersonMerge{}, err
+	}
+
+	// The audit history follows too, so exports and erasures of the target include it
+	if _, err := qtx.MovePersonRequestLogs(ctx, db.MovePersonRequestLogsParams{
+		TargetPersonID: targetID,
+		SourcePersonID: sourceID,
+	}); err != nil {
+		return db.PersonMerge{}, err
+	}
+
+	if err := qtx.SoftDeletePerson(ctx, sourceID); err != nil {
+		return db.PersonMerge{}, err
+	}
+
+	// Persons previously merged into the source now resolve to the target directly
+	if err := qtx.RepointPersonMerges(ctx, db.RepointPersonMergesParams{
+		NewTargetPersonID: targetID,
+		OldTargetPersonID: sourceID,
+	}); err != nil {
+		return db.PersonMerge{}, err
+	}
+
+	return qtx.InsertPersonMerge(ctx, db.InsertPersonMergeParams{
+		SourcePersonID:    sourceID,
+		TargetPersonID:    targetID,
+		Strategy:          string(strategies.Default),
+		MergedBy:          meta.Caller,
+		Reason:            meta.Reason,
+		TraceID:           pgtype.Text{String: meta.TraceID, Valid: meta.TraceID != ""},
+		AttributesMoved:   attributesMoved,
+		AttributesDropped: attributePlan.Dropped(),
+		ImagesMoved:       imagesMoved,
+		ImagesDropped:     imagePlan.Dropped(),
+	})
+}
+
+func planAttributes(ctx context.Context, qtx *db.Queries, targetID, sourceID pgtype.UUID, strategies Strategies, writable func(key string) bool) (Plan, error) {
+	entries := func(id pgtype.UUID) ([]Entry, error) {
+		rows, err := qtx.ListPersonAttributeKeys(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		result := make([]Entry, 0, len(rows))
+		for _, row := range rows {
+			result = append(result, Entry{ID: row.ID, Key: row.AttributeKey, UpdatedAt: row.UpdatedAt.Time})
+		}
+		return result, nil
+	}
+
+	target, err := entries(targetID)
+	if err != nil {
+		return Plan{}, err
+	}
+	source, err := entries(sourceID)
+	if err != nil {
+		return Plan{}, err
+	}
+	if err := checkWritable(source, writable); err != nil {
+		return Plan{}, err
+	}
+	return Resolve(strategies, target, source), nil
+}
+
+func planImages(ctx context.Context, qtx *db.Queries, targetID, sourceID pgtype.UUID, strategies Strategies, writable func(key string) bool) (Plan, error) {
+	entries := func(id pgtype.UUID) ([]Entry, error) {
+		rows, err := qtx.ListPersonImages(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		result := make([]Entry, 0, len(rows))
+		for _, row := range rows {
+			result = append(result, Entry{ID: row.ID, Key: row.AttributeKey, UpdatedAt: row.UpdatedAt.Time})
+		}
+		return result, nil
+	}
+
+	target, err := entries(targetID)
+	if err != nil {
+		return Plan{}, err
+	}
+	source, err := entries(sourceID)
+	if err != nil {
+		return Plan{}, err
+	}
+	if err := checkWritable(source, writable); err != nil {
+		return Plan{}, err
+	}
+	return Resolve(strategies, target, source), nil
+}
+
+// checkWritable returns a writeDeniedError for the first entry whose key writable rejects
+func checkWritable(entries []Entry, writable func(key string) bool) error {
+	for _, entry := range entries {
+		if !writable(entry.Key) {
+			return &writeDeniedError{key: entry.Key}
+		}
+	}
+	return nil
+}
+
+// mergeResponse builds the JSON response for a merge record
+func mergeResponse(merge db.PersonMerge) map[string]interface{} {
+	response := map[string]interface{}{
+		"id":                merge.ID,
+		"sourcePersonId":    merge.SourcePersonID,
+		"targetPersonId":    merge.TargetPersonID,
+		"strategy":          merge.Strategy,
+		"mergedBy":          merge.MergedBy,
+		"reason":            merge.Reason,
+		"attributesMoved":   merge.AttributesMoved,
+		"attributesDropped": merge.AttributesDropped,
+		"imagesMoved":       merge.ImagesMoved,
+		"imagesDropped":     merge.ImagesDropped,
+	}
+	if merge.TraceID.Valid {
+		response["traceId"] = merge.TraceID.String
+	}
+	if merge.MergedAt.Valid {
+		response["mergedAt"] = merge.MergedAt.Time
+	}
+	return response
+}
@@ -0,0 +1,313 @@
+package person_merge
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	db "person-service/internal/db/generated"
+	"person-service/internal/testdb"
+	person_attributes "person-service/person_attributes"
+)
+
+var pool *pgxpool.Pool
+
+const testEncryptionKey = "test-encryption-key-32bytes!!"
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+	var err error
+	pool, err = testdb.GetPool(ctx)
+	if err != nil {
+		log.Fatalf("Failed to get pool: %v", err)
+	}
+	if err := testdb.RunMigrations(ctx, pool); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// Helper function to create a test attribute with a given update time
+func createTestAttribute(ctx context.Context, t *testing.T, personID, key, value string, updatedAt time.Time) {
+	_, err := pool.Exec(ctx, `
+		INSERT INTO person_attributes (person_id, attribute_key, encrypted_value, key_version, updated_at)
+		VALUES ($1::uuid, $2, pgp_sym_encrypt($3, $4), 1, $5)
+	`, personID, key, value, testEncryptionKey, updatedAt)
+	assert.NoError(t, err)
+}
+
+// Helper function to read the decrypted attributes of a person as key -> value
+func attributeValues(ctx context.Context, t *testing.T, personID string) map[string]string {
+	rows, err := pool.Query(ctx, `
+		SELECT attribute_key, pgp_sym_decrypt(encrypted_value, $2)
+		FROM person_attributes WHERE person_id = $1::uuid
+	`, personID, testEncryptionKey)
+	assert.NoError(t, err)
+	defer rows.Close()
+
+	values := map[string]string{}
+	for rows.Next() {
+		var key, value string
+		assert.NoError(t, rows.Scan(&key, &value))
+		values[key] = value
+	}
+	return values
+}
+
+func newMergeContext(personID, body string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/persons/"+personID+"/merge", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("personId")
+	c.SetParamValues(personID)
+	return c, rec
+}
+
+func mergeBody(sourceID, strategy string, keyStrategies map[string]string) string {
+	body, _ := json.Marshal(map[string]interface{}{
+		"sourcePersonId": sourceID,
+		"strategy":       strategy,
+		"keyStrategies":  keyStrategies,
+		"meta":           map[string]string{"caller": "dedup-job", "reason": "duplicate client ids", "traceId": "merge-trace-1"},
+	})
+	return string(body)
+}
+
+func TestNewPersonMergeHandler(t *testing.T) {
+	handler := NewPersonMergeHandler(pool)
+	assert.NotNil(t, handler)
+	assert.Equal(t, pool, handler.pool)
+	assert.NotNil(t, handler.queries)
+}
+
+func TestMergePerson_InvalidTargetUUID(t *testing.T) {
+	handler := NewPersonMergeHandler(pool)
+	c, rec := newMergeContext("invalid-uuid", mergeBody("123e4567-e89b-12d3-a456-426614174000", "", nil))
+
+	err := handler.MergePerson(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_001_INVALID_PERSON_ID")
+}
+
+func TestMergePerson_InvalidRequest(t *testing.T) {
+	target := "123e4567-e89b-12d3-a456-426614174000"
+	tests := map[string]string{
+		"invalid source":   mergeBody("not-a-uuid", "", nil),
+		"same person":      mergeBody(target, "", nil),
+		"unknown strategy": mergeBody("123e4567-e89b-12d3-a456-426614174001", "random", nil),
+		"unknown key rule": mergeBody("123e4567-e89b-12d3-a456-426614174001", "", map[string]string{"email": "oldest_wins"}),
+	}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler := NewPersonMergeHandler(pool)
+			c, rec := newMergeContext(target, body)
+
+			err := handler.MergePerson(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), "PA_009_INVALID_MERGE_REQUEST")
+		})
+	}
+}
+
+func TestMergePerson_MissingMeta(t *testing.T) {
+	handler := NewPersonMergeHandler(pool)
+	c, rec := newMergeContext("123e4567-e89b-12d3-a456-426614174000", `{"sourcePersonId":"123e4567-e89b-12d3-a456-426614174001"}`)
+
+	err := handler.MergePerson(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_005_MISSING_META")
+}
+
+func TestMergePerson_SourceNotFound(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	targetID, err := testdb.CreatePerson(ctx, pool, "", "merge-target-0")
+	assert.NoError(t, err)
+
+	handler := NewPersonMergeHandler(pool)
+	c, rec := newMergeContext(targetID, mergeBody("123e4567-e89b-12d3-a456-426614174001", "", nil))
+
+	err = handler.MergePerson(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_104_SOURCE_PERSON_NOT_FOUND")
+}
+
+func TestMergePerson_Success(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	targetID, err := testdb.CreatePerson(ctx, pool, "", "merge-target-1")
+	assert.NoError(t, err)
+	sourceID, err := testdb.CreatePerson(ctx, pool, "", "merge-source-1")
+	assert.NoError(t, err)
+
+	older := time.Now().Add(-time.Hour)
+	newer := time.Now()
+	createTestAttribute(ctx, t, targetID, "email", "target@example.com", older)
+	createTestAttribute(ctx, t, targetID, "phone", "111", newer)
+	createTestAttribute(ctx, t, targetID, "name", "Target", newer)
+	createTestAttribute(ctx, t, sourceID, "email", "source@example.com", newer)
+	createTestAttribute(ctx, t, sourceID, "phone", "222", older)
+	createTestAttribute(ctx, t, sourceID, "name", "Source", older)
+	createTestAttribute(ctx, t, sourceID, "city", "Jakarta", older)
+	_, err = pool.Exec(ctx, `INSERT INTO person_identifiers (person_id, system, external_id) VALUES ($1::uuid, 'crm', 'CRM-1')`, sourceID)
+	assert.NoError(t, err)
+	_, err = pool.Exec(ctx, `
+		INSERT INTO request_log (trace_id, caller_info, reason, person_id, encrypted_request_body, encrypted_response_body, key_version)
+		VALUES ('source-audit-1', 'crm', 'update', $1::uuid, pgp_sym_encrypt('{"key":"city"}', $2), pgp_sym_encrypt('', $2), 1)
+	`, sourceID, testEncryptionKey)
+	assert.NoError(t, err)
+
+	handler := NewPersonMergeHandler(pool)
+	c, rec := newMergeContext(targetID, mergeBody(sourceID, "newest_wins", map[string]string{"NAME": "keep_source"}))
+
+	err = handler.MergePerson(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, sourceID, response["sourcePersonId"])
+	assert.Equal(t, targetID, response["targetPersonId"])
+	assert.Equal(t, "newest_wins", response["strategy"])
+	// email (newer source), name (keep_source) and city (no conflict) move; phone is dropped
+	assert.Equal(t, float64(3), response["attributesMoved"])
+	assert.Equal(t, float64(3), response["attributesDropped"])
+
+	assert.Equal(t, map[string]string{
+		"email": "source@example.com",
+		"phone": "111",
+		"name":  "Source",
+		"city":  "Jakarta",
+	}, attributeValues(ctx, t, targetID))
+	assert.Empty(t, attributeValues(ctx, t, sourceID))
+
+	// Identifiers follow the surviving person
+	var owner string
+	assert.NoError(t, pool.QueryRow(ctx, `SELECT person_id::text FROM person_identifiers WHERE system = 'crm' AND external_id = 'CRM-1'`).Scan(&owner))
+	assert.Equal(t, targetID, owner)
+
+	// The audit history follows the surviving person, so its export and erasure cover it
+	var auditOwner string
+	assert.NoError(t, pool.QueryRow(ctx, `SELECT person_id::text FROM request_log WHERE trace_id = 'source-audit-1'`).Scan(&auditOwner))
+	assert.Equal(t, targetID, auditOwner)
+
+	// Source is soft-deleted
+	var deleted bool
+	assert.NoError(t, pool.QueryRow(ctx, `SELECT deleted_at IS NOT NULL FROM person WHERE id = $1::uuid`, sourceID).Scan(&deleted))
+	assert.True(t, deleted)
+
+	// A retried merge returns the existing record
+	c, rec = newMergeContext(targetID, mergeBody(sourceID, "newest_wins", nil))
+	assert.NoError(t, handler.MergePerson(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"attributesMoved":3`)
+}
+
+func TestMergePerson_AttributePolicyDenied(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	targetID, err := testdb.CreatePerson(ctx, pool, "", "merge-target-2")
+	assert.NoError(t, err)
+	sourceID, err := testdb.CreatePerson(ctx, pool, "", "merge-source-2")
+	assert.NoError(t, err)
+
+	createTestAttribute(ctx, t, targetID, "national_id", "target-id", time.Now())
+	createTestAttribute(ctx, t, sourceID, "national_id", "source-id", time.Now())
+
+	policy, err := person_attributes.ParsePolicy("deny * write national_id")
+	assert.NoError(t, err)
+	handler := NewPersonMergeHandler(pool).WithPolicy(policy)
+	c, rec := newMergeContext(targetID, mergeBody(sourceID, "keep_source", nil))
+
+	err = handler.MergePerson(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "PA_303_ATTRIBUTE_DENIED")
+	assert.Equal(t, map[string]string{"national_id": "target-id"}, attributeValues(ctx, t, targetID))
+	assert.Equal(t, map[string]string{"national_id": "source-id"}, attributeValues(ctx, t, sourceID))
+}
+
+func TestMergePerson_RepointsEarlierMerges(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	firstID, err := testdb.CreatePerson(ctx, pool, "", "merge-chain-1")
+	assert.NoError(t, err)
+	secondID, err := testdb.CreatePerson(ctx, pool, "", "merge-chain-2")
+	assert.NoError(t, err)
+	thirdID, err := testdb.CreatePerson(ctx, pool, "", "merge-chain-3")
+	assert.NoError(t, err)
+
+	handler := NewPersonMergeHandler(pool)
+	c, rec := newMergeContext(secondID, mergeBody(firstID, "", nil))
+	assert.NoError(t, handler.MergePerson(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	c, rec = newMergeContext(thirdID, mergeBody(secondID, "", nil))
+	assert.NoError(t, handler.MergePerson(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var target string
+	assert.NoError(t, pool.QueryRow(ctx, `SELECT target_person_id::text FROM person_merge WHERE source_person_id = $1::uuid`, firstID).Scan(&target))
+	assert.Equal(t, thirdID, target)
+}
+
+func TestRedirectMerged(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, testdb.TruncateTables(ctx, pool))
+	targetID, err := testdb.CreatePerson(ctx, pool, "", "redirect-target")
+	assert.NoError(t, err)
+	sourceID, err := testdb.CreatePerson(ctx, pool, "", "redirect-source")
+	assert.NoError(t, err)
+
+	handler := NewPersonMergeHandler(pool)
+	c, rec := newMergeContext(targetID, mergeBody(sourceID, "", nil))
+	assert.NoError(t, handler.MergePerson(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	e := echo.New()
+	e.GET("/persons/:personId/attributes", func(c echo.Context) error {
+		return c.String(http.StatusOK, "served")
+	}, RedirectMerged(db.New(pool)))
+
+	// Merged person is redirected
+	req := httptest.NewRequest(http.MethodGet, "/persons/"+sourceID+"/attributes?x=1", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusPermanentRedirect, rec.Code)
+	assert.Equal(t, "/persons/"+targetID+"/attributes?x=1", rec.Header().Get(echo.HeaderLocation))
+
+	// Surviving person is served
+	req = httptest.NewRequest(http.MethodGet, "/persons/"+targetID+"/attributes", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "served", rec.Body.String())
+}
+
+func TestMergedLocation(t *testing.T) {
+	u, _ := url.Parse("/persons/aaa/attributes/5?include=all")
+	assert.Equal(t, "/persons/bbb/attributes/5?include=all", mergedLocation(u, "aaa", "bbb"))
+}
@@ -0,0 +1,123 @@
+package person_merge
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Strategy decides which value survives when both persons hold the same key
+type Strategy string
+
+const (
+	// KeepTarget keeps the surviving person's value
+	KeepTarget Strategy = "keep_target"
+	// KeepSource replaces the surviving person's value with the duplicate's value
+	KeepSource Strategy = "keep_source"
+	// NewestWins keeps the most recently updated value, the target wins ties
+	NewestWins Strategy = "newest_wins"
+)
+
+// ParseStrategy validates a strategy name. An empty name defaults to KeepTarget.
+func ParseStrategy(name string) (Strategy, error) {
+	switch Strategy(name) {
+	case "":
+		return KeepTarget, nil
+	case KeepTarget, KeepSource, NewestWins:
+		return Strategy(name), nil
+	default:
+		return "", fmt.Errorf("unknown strategy %q", name)
+	}
+}
+
+// Strategies is the default strategy plus per-key overrides
+type Strategies struct {
+	Default Strategy
+	PerKey  map[string]Strategy
+}
+
+// ParseStrategies validates the default strategy and the per-key overrides.
+// Keys are case-insensitive like attribute keys.
+func ParseStrategies(defaultName string, perKey map[string]string) (Strategies, error) {
+	def, err := ParseStrategy(defaultName)
+	if err != nil {
+		return Strategies{}, err
+	}
+
+	strategies := Strategies{Default: def, PerKey: make(map[string]Strategy, len(perKey))}
+	for key, name := range perKey {
+		if name == "" {
+			return Strategies{}, fmt.Errorf("missing strategy for key %q", key)
+		}
+		strategy, err := ParseStrategy(name)
+		if err != nil {
+			return Strategies{}, fmt.Errorf("key %q: %w", key, err)
+		}
+		strategies.PerKey[strings.ToLower(key)] = strategy
+	}
+	return strategies, nil
+}
+
+// For returns the strategy that applies to a key
+func (s Strategies) For(key string) Strategy {
+	if strategy, ok := s.PerKey[strings.ToLower(key)]; ok {
+		return strategy
+	}
+	return s.Default
+}
+
+// Entry is a keyed row (attribute or image) taking part in a merge
+type Entry struct {
+	ID        int64
+	Key       string
+	UpdatedAt time.Time
+}
+
+// Plan lists the rows that lose a conflict. Every source row not in DropSource
+// is moved to the target person after the dropped rows are deleted.
+type Plan struct {
+	DropTarget []int64
+	DropSource []int64
+	Moved      int64
+}
+
+// Dropped returns the number of rows deleted by the plan
+func (p Plan) Dropped() int64 {
+	return int64(len(p.DropTarget) + len(p.DropSource))
+}
+
+// Resolve applies the strategies to every key held by both persons
+func Resolve(strategies Strategies, target, source []Entry) Plan {
+	targetByKey := make(map[string]Entry, len(target))
+	for _, entry := range target {
+		targetByKey[strings.ToLower(entry.Key)] = entry
+	}
+
+	plan := Plan{}
+	for _, src := range source {
+		tgt, conflict := targetByKey[strings.ToLower(src.Key)]
+		if !conflict {
+			plan.Moved++
+			continue
+		}
+
+		if sourceWins(strategies.For(src.Key), tgt, src) {
+			plan.DropTarget = append(plan.DropTarget, tgt.ID)
+			plan.Moved++
+		} else {
+			plan.DropSource = append(plan.DropSource, src.ID)
+		}
+	}
+	return plan
+}
+
+func sourceWins(strategy Strategy, target, source Entry) bool {
+	switch strategy {
+	case KeepSource:
+		return true
+	case NewestWins:
+		return source.UpdatedAt.After(target.UpdatedAt)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,84 @@
+package person_merge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStrategy(t *testing.T) {
+	strategy, err := ParseStrategy("")
+	assert.NoError(t, err)
+	assert.Equal(t, KeepTarget, strategy)
+
+	strategy, err = ParseStrategy("newest_wins")
+	assert.NoError(t, err)
+	assert.Equal(t, NewestWins, strategy)
+
+	_, err = ParseStrategy("KEEP_SOURCE")
+	assert.Error(t, err)
+}
+
+func TestParseStrategies_PerKeyIsCaseInsensitive(t *testing.T) {
+	strategies, err := ParseStrategies("keep_target", map[string]string{"Email": "keep_source"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, KeepSource, strategies.For("EMAIL"))
+	assert.Equal(t, KeepTarget, strategies.For("phone"))
+}
+
+func TestParseStrategies_Invalid(t *testing.T) {
+	_, err := ParseStrategies("keep_target", map[string]string{"email": ""})
+	assert.Error(t, err)
+
+	_, err = ParseStrategies("keep_target", map[string]string{"email": "oldest_wins"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "email")
+}
+
+func TestResolve(t *testing.T) {
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+
+	target := []Entry{
+		{ID: 1, Key: "email", UpdatedAt: older},
+		{ID: 2, Key: "phone", UpdatedAt: newer},
+		{ID: 3, Key: "name", UpdatedAt: older},
+		{ID: 4, Key: "nickname", UpdatedAt: older},
+	}
+	source := []Entry{
+		{ID: 11, Key: "EMAIL", UpdatedAt: newer},
+		{ID: 12, Key: "phone", UpdatedAt: older},
+		{ID: 13, Key: "name", UpdatedAt: older},
+		{ID: 14, Key: "nickname", UpdatedAt: older},
+		{ID: 15, Key: "city", UpdatedAt: older},
+	}
+	strategies := Strategies{
+		Default: NewestWins,
+		PerKey:  map[string]Strategy{"name": KeepSource, "nickname": KeepTarget},
+	}
+
+	plan := Resolve(strategies, target, source)
+
+	// email: source is newer; name: keep_source
+	assert.Equal(t, []int64{1, 3}, plan.DropTarget)
+	// phone: target is newer; nickname: keep_target
+	assert.Equal(t, []int64{12, 14}, plan.DropSource)
+	// email, name and city move to the target
+	assert.Equal(t, int64(3), plan.Moved)
+	assert.Equal(t, int64(4), plan.Dropped())
+}
+
+func TestResolve_NewestWinsTieKeepsTarget(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	plan := Resolve(Strategies{Default: NewestWins},
+		[]Entry{{ID: 1, Key: "email", UpdatedAt: at}},
+		[]Entry{{ID: 2, Key: "email", UpdatedAt: at}},
+	)
+
+	assert.Empty(t, plan.DropTarget)
+	assert.Equal(t, []int64{2}, plan.DropSource)
+	assert.Equal(t, int64(0), plan.Moved)
+}
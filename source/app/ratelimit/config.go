@@ -0,0 +1,211 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stores that can hold the token buckets
+const (
+	// StoreMemory keeps buckets in the memory of each instance
+	StoreMemory = "memory"
+	// StorePostgres keeps buckets in Postgres, shared by all instances
+	StorePostgres = "postgres"
+)
+
+// Rule keys with a special meaning in RATE_LIMITS
+const (
+	// DefaultRule is the limit of callers without their own rule
+	DefaultRule = "default"
+	// AnyCaller matches every caller in a route rule
+	AnyCaller = "*"
+)
+
+// Limit allows Requests requests per Period. A caller may spend the whole limit
+// at once, after which tokens are refilled evenly over the period.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// rate returns the tokens refilled per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// String formats the limit like RATE_LIMITS, e.g. "600/1m"
+func (l Limit) String() string {
+	period := l.Period.String()
+	if strings.HasSuffix(period, "m0s") {
+		period = strings.TrimSuffix(period, "0s")
+	}
+	if strings.HasSuffix(period, "h0m") {
+		period = strings.TrimSuffix(period, "0m")
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, period)
+}
+
+// Config holds the rate limits
+type Config struct {
+	// Default applies to callers without a caller rule; zero means unlimited
+	Default Limit
+	// Callers are limits per caller identity
+	Callers map[string]Limit
+	// Routes are limits per route ("METHOD /path") and caller identity or AnyCaller,
+	// applied on top of the caller limit
+	Routes map[string]map[string]Limit
+	// Store is StoreMemory or StorePostgres
+	Store string
+}
+
+// Enabled reports whether at least one limit is configured
+func (c Config) Enabled() bool {
+	return c.Default.Requests > 0 || len(c.Callers) > 0 || len(c.Routes) > 0
+}
+
+// LoadConfig reads the rate limits from environment variables:
+//   - RATE_LIMITS: limits in the form of ParseRules, unset disables rate limiting
+//   - RATE_LIMIT_STORE: "memory" (default) to limit each instance on its own,
+//     "postgres" to share the buckets between instances
+func LoadConfig() (Config, error) {
+	cfg, err := ParseRules(os.Getenv("RATE_LIMITS"))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid RATE_LIMITS: %w", err)
+	}
+
+	cfg.Store = os.Getenv("RATE_LIMIT_STORE")
+	switch cfg.Store {
+	case "":
+		cfg.Store = StoreMemory
+	case StoreMemory, StorePostgres:
+	default:
+		return Config{}, fmt.Errorf("invalid RATE_LIMIT_STORE %q, expected %s or %s", cfg.Store, StoreMemory, StorePostgres)
+	}
+	return cfg, nil
+}
+
+// ParseRules reads rate limit rules separated by ";". Each rule is
+//
+//	default=600/1m                                  limit of callers without a rule
+//	orders=1200/1m                                  limit of the caller "orders"
+//	*@POST /persons/:personId/attributes=60/1m      route limit of every caller
+//	orders@GET /persons/:personId/attributes=10/1s  route limit of the caller "orders"
+//
+// Routes use the paths the handlers are registered with. Each caller has its
+// own bucket for a route limit, and a caller rule for a route replaces the * rule.
+// Caller identities may contain "@", e.g. cert:ops@example.com, as only the text
+// after the last "@" can name a route.
+func ParseRules(raw string) (Config, error) {
+	cfg := Config{Callers: map[string]Limit{}, Routes: map[string]map[string]Limit{}}
+	for _, entry := range strings.Split(raw, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		// Split at the last "=" as the limit never contains one
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 {
+			return Config{}, fmt.Errorf("rule %q must be subject=requests/period", entry)
+		}
+		subject, rawLimit := strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+1:])
+		limit, err := parseLimit(rawLimit)
+		if err != nil {
+			return Config{}, fmt.Errorf("rule %q: %w", entry, err)
+		}
+
+		caller, route, isRoute := splitRouteRule(subject)
+		if !isRoute {
+			if subject == DefaultRule {
+				if cfg.Default.Requests > 0 {
+					return Config{}, fmt.Errorf("rule %q is listed more than once", subject)
+				}
+				cfg.Default = limit
+				continue
+			}
+			if subject == AnyCaller {
+				return Config{}, fmt.Errorf("rule %q: use %q for the limit of every caller", entry, DefaultRule)
+			}
+			if _, exists := cfg.Callers[subject]; exists {
+				return Config{}, fmt.Errorf("rule %q is listed more than once", subject)
+			}
+			cfg.Callers[subject] = limit
+			continue
+		}
+
+		route, err = parseRoute(route)
+		if err != nil {
+			return Config{}, fmt.Errorf("rule %q: %w", entry, err)
+		}
+		if caller == "" {
+			return Config{}, fmt.Errorf("rule %q must name a caller or %q before @", entry, AnyCaller)
+		}
+		if cfg.Routes[route] == nil {
+			cfg.Routes[route] = map[string]Limit{}
+		}
+		if _, exists := cfg.Routes[route][caller]; exists {
+			return Config{}, fmt.Errorf("rule %q is listed more than once", subject)
+		}
+		cfg.Routes[route][caller] = limit
+	}
+	return cfg, nil
+}
+
+// parseLimit reads a limit in the form requests/period, e.g. 100/1s
+func parseLimit(raw string) (Limit, error) {
+	rawRequests, rawPeriod, ok := strings.Cut(raw, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("limit %q must be requests/period", raw)
+	}
+	requests, err := strconv.Atoi(strings.TrimSpace(rawRequests))
+	if err != nil || requests <= 0 {
+		return Limit{}, fmt.Errorf("invalid request count %q", rawRequests)
+	}
+	period, err := time.ParseDuration(strings.TrimSpace(rawPeriod))
+	if err != nil || period <= 0 {
+		return Limit{}, fmt.Errorf("invalid period %q", rawPeriod)
+	}
+	return Limit{Requests: requests, Period: period}, nil
+}
+
+// splitRouteRule splits a rule subject at its last "@" into a caller and a route.
+// The subject is a caller rule when no "@" is followed by something that reads as
+// a route, a method and a path or a lone method, so identities may contain "@".
+func splitRouteRule(subject string) (string, string, bool) {
+	i := strings.LastIndex(subject, "@")
+	if i < 0 {
+		return subject, "", false
+	}
+	route := strings.TrimSpace(subject[i+1:])
+	if !strings.Contains(route, " ") && !isMethod(strings.ToUpper(route)) {
+		return subject, "", false
+	}
+	return strings.TrimSpace(subject[:i]), route, true
+}
+
+// parseRoute normalizes "METHOD /path" and rejects unknown methods
+func parseRoute(raw string) (string, error) {
+	method, path, ok := strings.Cut(strings.TrimSpace(raw), " ")
+	path = strings.TrimSpace(path)
+	if !ok || !strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("route %q must be METHOD /path", raw)
+	}
+	method = strings.ToUpper(method)
+	if !isMethod(method) {
+		return "", fmt.Errorf("unknown method %q in route %q", method, raw)
+	}
+	return method + " " + path, nil
+}
+
+// isMethod reports whether method is one a route limit can apply to
+func isMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	errs "person-service/errors"
+	"person-service/middleware"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Middleware creates a middleware that limits requests per authenticated caller
+// and route. It must run after the authentication middleware; requests without
+// a caller identity are not limited. A nil limiter limits nothing.
+//
+// Limited responses carry the RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset
+// and RateLimit-Policy headers of the limit closest to being exceeded. Requests
+// over a limit are rejected with 429 and a Retry-After header.
+func Middleware(limiter *Limiter) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			identity := middleware.APIKeyIdentity(c)
+			if limiter == nil || identity == "" {
+				return next(c)
+			}
+
+			// Use request context for trace propagation
+			ctx := c.Request().Context()
+			route := c.Request().Method + " " + c.Path()
+			decision := limiter.Allow(ctx, identity, route, time.Now())
+			if decision.Limit.Requests == 0 {
+				return next(c)
+			}
+
+			header := c.Response().Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(decision.Limit.Requests))
+			header.Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+			header.Set("RateLimit-Reset", strconv.FormatInt(seconds(decision.Reset), 10))
+			header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", decision.Limit.Requests, seconds(decision.Limit.Period)))
+
+			if !decision.Allowed {
+				header.Set("Retry-After", strconv.FormatInt(max(seconds(decision.RetryAfter), 1), 10))
+				return c.JSON(http.StatusTooManyRequests, errs.ErrorResponse{
+					Message:   "Rate limit of " + decision.Limit.String() + " exceeded",
+					ErrorCode: errs.ErrRateLimitExceeded,
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
+// seconds rounds d up to whole seconds as the headers require
+func seconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
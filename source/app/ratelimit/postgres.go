@@ -0,0 +1,48 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	db "person-service/internal/db/generated"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// PostgresStore keeps token buckets in the rate_limit_buckets table, so every
+// instance draws from the same buckets. Buckets are refilled by the database
+// clock, which keeps instances with drifting clocks consistent.
+type PostgresStore struct {
+	queries *db.Queries
+}
+
+// NewPostgresStore creates a Store backed by the database
+func NewPostgresStore(queries *db.Queries) *PostgresStore {
+	return &PostgresStore{queries: queries}
+}
+
+// Take takes a token from the bucket at key
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit, _ time.Time) (float64, bool, error) {
+	row, err := s.queries.TakeRateLimitToken(ctx, db.TakeRateLimitTokenParams{
+		Key:        key,
+		Capacity:   float64(limit.Requests),
+		RefillRate: limit.rate(),
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	return row.Tokens, row.Allowed, nil
+}
+
+// Refund gives back a token to the bucket at key
+func (s *PostgresStore) Refund(ctx context.Context, key string, limit Limit) error {
+	return s.queries.RefundRateLimitToken(ctx, db.RefundRateLimitTokenParams{
+		Key:      key,
+		Capacity: float64(limit.Requests),
+	})
+}
+
+// Sweep deletes buckets not used since cutoff
+func (s *PostgresStore) Sweep(ctx context.Context, cutoff time.Time) (int64, error) {
+	return s.queries.DeleteIdleRateLimitBuckets(ctx, pgtype.Timestamptz{Time: cutoff, Valid: true})
+}
@@ -0,0 +1,234 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	errs "person-service/errors"
+	"person-service/logging"
+)
+
+// sweepInterval is the time between two deletions of idle buckets
+const sweepInterval = time.Minute
+
+// Store holds token buckets
+type Store interface {
+	// Take refills the bucket at key for the time since it was last used, takes a
+	// token if a whole one is left and returns the tokens left and whether a token was taken.
+	// A bucket used for the first time starts full.
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (float64, bool, error)
+	// Refund gives back a token taken from the bucket at key, up to the limit
+	Refund(ctx context.Context, key string, limit Limit) error
+	// Sweep deletes buckets not used since cutoff and returns how many were deleted
+	Sweep(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// Decision is the outcome of a rate limited request
+type Decision struct {
+	// Allowed is false when the request exceeded a limit
+	Allowed bool
+	// Limit is the limit reported to the caller, the exceeded one or the one
+	// closest to being exceeded. It is zero when no limit applies.
+	Limit Limit
+	// Remaining is the number of requests left in Limit
+	Remaining int
+	// Reset is the time until the bucket of Limit is full again
+	Reset time.Duration
+	// RetryAfter is the time until a denied request can be retried
+	RetryAfter time.Duration
+}
+
+// Limiter applies the configured limits to callers
+type Limiter struct {
+	cfg   Config
+	store Store
+	// idle is the time after which every bucket is full again
+	idle time.Duration
+}
+
+// NewLimiter creates a limiter for cfg that keeps its buckets in store
+func NewLimiter(cfg Config, store Store) *Limiter {
+	idle := cfg.Default.Period
+	for _, limit := range cfg.Callers {
+		idle = max(idle, limit.Period)
+	}
+	for _, callers := range cfg.Routes {
+		for _, limit := range callers {
+			idle = max(idle, limit.Period)
+		}
+	}
+	return &Limiter{cfg: cfg, store: store, idle: idle}
+}
+
+// limits returns the bucket keys and limits that apply to a request of identity
+// to route, the caller limit first
+func (l *Limiter) limits(identity, route string) ([]string, []Limit) {
+	var keys []string
+	var limits []Limit
+	if limit, ok := l.cfg.Callers[identity]; ok {
+		keys, limits = append(keys, "caller:"+identity), append(limits, limit)
+	} else if l.cfg.Default.Requests > 0 {
+		keys, limits = append(keys, "caller:"+identity), append(limits, l.cfg.Default)
+	}
+
+	callers := l.cfg.Routes[route]
+	limit, ok := callers[identity]
+	if !ok {
+		limit, ok = callers[AnyCaller]
+	}
+	if ok {
+		keys, limits = append(keys, "route:"+identity+"@"+route), append(limits, limit)
+	}
+	return keys, limits
+}
+
+// Allow takes a token from every bucket that applies to a request of identity to
+// route ("METHOD /path"). A denied request takes nothing: the tokens taken from the
+// buckets before the one that denied it are refunded. A bucket whose store fails is
+// logged and skipped, so a store outage lets requests through instead of rejecting them.
+func (l *Limiter) Allow(ctx context.Context, identity, route string, now time.Time) Decision {
+	decision := Decision{Allowed: true}
+	keys, limits := l.limits(identity, route)
+	var taken []int
+	for i, key := range keys {
+		limit := limits[i]
+		tokens, allowed, err := l.store.Take(ctx, key, limit, now)
+		if err != nil {
+			logging.ErrorContext(ctx, "Failed to take rate limit token",
+				"error", err,
+				"error_code", errs.ErrRateLimitStoreFailed,
+				"identity", identity,
+				"limit", limit.String())
+			continue
+		}
+
+		remaining := int(math.Floor(tokens))
+		if !allowed {
+			l.refund(ctx, identity, keys, limits, taken)
+			return Decision{
+				Limit:      limit,
+				Remaining:  0,
+				Reset:      refillTime(limit, tokens, float64(limit.Requests)),
+				RetryAfter: refillTime(limit, tokens, 1),
+			}
+		}
+		taken = append(taken, i)
+		if decision.Limit.Requests == 0 || remaining < decision.Remaining {
+			decision.Limit = limit
+			decision.Remaining = remaining
+			decision.Reset = refillTime(limit, tokens, float64(limit.Requests))
+		}
+	}
+	return decision
+}
+
+// refund gives back the tokens taken from the buckets at the indexes taken of keys
+func (l *Limiter) refund(ctx context.Context, identity string, keys []string, limits []Limit, taken []int) {
+	for _, i := range taken {
+		if err := l.store.Refund(ctx, keys[i], limits[i]); err != nil {
+			logging.ErrorContext(ctx, "Failed to refund rate limit token",
+				"error", err,
+				"error_code", errs.ErrRateLimitStoreFailed,
+				"identity", identity,
+				"limit", limits[i].String())
+		}
+	}
+}
+
+// refillTime returns the time until a bucket of limit holding tokens holds target tokens
+func refillTime(limit Limit, tokens, target float64) time.Duration {
+	if tokens >= target {
+		return 0
+	}
+	return time.Duration((target - tokens) * float64(limit.Period) / float64(limit.Requests))
+}
+
+// Start deletes idle buckets every minute until ctx is done
+func (l *Limiter) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(sweepInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if _, err := l.store.Sweep(ctx, time.Now().Add(-l.idle)); err != nil {
+				logging.ErrorContext(ctx, "Failed to delete idle rate limit buckets",
+					"error", err,
+					"error_code", errs.ErrRateLimitStoreFailed)
+			}
+		}
+	}()
+}
+
+// bucket is a token bucket of a MemoryStore
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryStore keeps token buckets in memory, so each instance limits on its own
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+// Take takes a token from the bucket at key
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit, now time.Time) (float64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	capacity := float64(limit.Requests)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		s.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+elapsed.Seconds()*limit.rate())
+		b.updated = now
+	}
+
+	if b.tokens < 1 {
+		return b.tokens, false, nil
+	}
+	b.tokens--
+	return b.tokens, true, nil
+}
+
+// Refund gives back a token to the bucket at key
+func (s *MemoryStore) Refund(_ context.Context, key string, limit Limit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.buckets[key]; ok {
+		b.tokens = math.Min(float64(limit.Requests), b.tokens+1)
+	}
+	return nil
+}
+
+// Sweep deletes buckets not used since cutoff
+func (s *MemoryStore) Sweep(_ context.Context, cutoff time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for key, b := range s.buckets {
+		if b.updated.Before(cutoff) {
+			delete(s.buckets, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,272 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"person-service/middleware"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const attributesRoute = "POST /persons/:personId/attributes"
+
+func TestParseRules(t *testing.T) {
+	cfg, err := ParseRules("default=600/1m; orders=1200/1m; *@post /persons/:personId/attributes=60/1m; orders@POST /persons/:personId/attributes=10/1s")
+	assert.NoError(t, err)
+	assert.True(t, cfg.Enabled())
+	assert.Equal(t, Limit{Requests: 600, Period: time.Minute}, cfg.Default)
+	assert.Equal(t, map[string]Limit{"orders": {Requests: 1200, Period: time.Minute}}, cfg.Callers)
+	assert.Equal(t, map[string]map[string]Limit{
+		attributesRoute: {
+			AnyCaller: {Requests: 60, Period: time.Minute},
+			"orders":  {Requests: 10, Period: time.Second},
+		},
+	}, cfg.Routes)
+
+	// Identities may contain @, only the text after the last one can be a route
+	cfg, err = ParseRules("cert:ops@example.com=100/1m; jwt:ops@example.com@GET /persons=10/1s")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Limit{"cert:ops@example.com": {Requests: 100, Period: time.Minute}}, cfg.Callers)
+	assert.Equal(t, map[string]map[string]Limit{
+		"GET /persons": {"jwt:ops@example.com": {Requests: 10, Period: time.Second}},
+	}, cfg.Routes)
+
+	cfg, err = ParseRules("")
+	assert.NoError(t, err)
+	assert.False(t, cfg.Enabled())
+
+	for _, raw := range []string{
+		"default",
+		"=10/1s",
+		"default=10",
+		"default=0/1s",
+		"default=10/0s",
+		"default=10/1s;default=20/1s",
+		"orders=10/1s;orders=20/1s",
+		"*=10/1s",
+		"@GET /persons=10/1s",
+		"*@GET=10/1s",
+		"*@FETCH /persons=10/1s",
+		"cert:ops@example.com@GET=10/1s",
+	} {
+		_, err := ParseRules(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	defer os.Unsetenv("RATE_LIMITS")
+	defer os.Unsetenv("RATE_LIMIT_STORE")
+
+	os.Unsetenv("RATE_LIMITS")
+	os.Unsetenv("RATE_LIMIT_STORE")
+	cfg, err := LoadConfig()
+	assert.NoError(t, err)
+	assert.False(t, cfg.Enabled())
+	assert.Equal(t, StoreMemory, cfg.Store)
+
+	os.Setenv("RATE_LIMITS", "default=100/1s")
+	os.Setenv("RATE_LIMIT_STORE", "postgres")
+	cfg, err = LoadConfig()
+	assert.NoError(t, err)
+	assert.True(t, cfg.Enabled())
+	assert.Equal(t, StorePostgres, cfg.Store)
+
+	os.Setenv("RATE_LIMIT_STORE", "redis")
+	_, err = LoadConfig()
+	assert.ErrorContains(t, err, "RATE_LIMIT_STORE")
+
+	os.Setenv("RATE_LIMITS", "default=fast")
+	_, err = LoadConfig()
+	assert.ErrorContains(t, err, "RATE_LIMITS")
+}
+
+func TestLimit_String(t *testing.T) {
+	assert.Equal(t, "600/1m", Limit{Requests: 600, Period: time.Minute}.String())
+	assert.Equal(t, "10/1s", Limit{Requests: 10, Period: time.Second}.String())
+	assert.Equal(t, "5000/1h", Limit{Requests: 5000, Period: time.Hour}.String())
+	assert.Equal(t, "60/1m30s", Limit{Requests: 60, Period: 90 * time.Second}.String())
+}
+
+func TestMemoryStore_Take(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 2, Period: 2 * time.Second}
+	now := time.Now()
+
+	// A new bucket is full and allows a burst of the whole limit
+	tokens, allowed, _ := store.Take(context.Background(), "a", limit, now)
+	assert.True(t, allowed)
+	assert.Equal(t, 1.0, tokens)
+	_, allowed, _ = store.Take(context.Background(), "a", limit, now)
+	assert.True(t, allowed)
+	tokens, allowed, _ = store.Take(context.Background(), "a", limit, now)
+	assert.False(t, allowed)
+	assert.Equal(t, 0.0, tokens)
+
+	// Other keys have their own bucket
+	_, allowed, _ = store.Take(context.Background(), "b", limit, now)
+	assert.True(t, allowed)
+
+	// Half a token is not enough, a whole one is
+	tokens, allowed, _ = store.Take(context.Background(), "a", limit, now.Add(500*time.Millisecond))
+	assert.False(t, allowed)
+	assert.Equal(t, 0.5, tokens)
+	tokens, allowed, _ = store.Take(context.Background(), "a", limit, now.Add(time.Second))
+	assert.True(t, allowed)
+	assert.Equal(t, 0.0, tokens)
+
+	// Refills stop at the limit
+	tokens, allowed, _ = store.Take(context.Background(), "a", limit, now.Add(time.Hour))
+	assert.True(t, allowed)
+	assert.Equal(t, 1.0, tokens)
+}
+
+func TestMemoryStore_Sweep(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 1, Period: time.Minute}
+	now := time.Now()
+	store.Take(context.Background(), "old", limit, now.Add(-2*time.Minute))
+	store.Take(context.Background(), "new", limit, now)
+
+	deleted, err := store.Sweep(context.Background(), now.Add(-time.Minute))
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	assert.Contains(t, store.buckets, "new")
+	assert.NotContains(t, store.buckets, "old")
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	cfg, err := ParseRules("default=3/1m; orders=100/1m; *@" + attributesRoute + "=2/1m; orders@" + attributesRoute + "=1/1m")
+	assert.NoError(t, err)
+	limiter := NewLimiter(cfg, NewMemoryStore())
+	now := time.Now()
+
+	// The route limit is closer to being exceeded than the default limit
+	decision := limiter.Allow(context.Background(), "blue", attributesRoute, now)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, cfg.Routes[attributesRoute][AnyCaller], decision.Limit)
+	assert.Equal(t, 1, decision.Remaining)
+	assert.Equal(t, 30*time.Second, decision.Reset)
+
+	decision = limiter.Allow(context.Background(), "blue", attributesRoute, now)
+	assert.True(t, decision.Allowed)
+	decision = limiter.Allow(context.Background(), "blue", attributesRoute, now)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 0, decision.Remaining)
+	assert.Equal(t, 30*time.Second, decision.RetryAfter)
+	assert.Equal(t, time.Minute, decision.Reset)
+
+	// The denied request took no token from the default limit, so one is left
+	decision = limiter.Allow(context.Background(), "blue", "GET /persons/:personId/attributes", now)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, cfg.Default, decision.Limit)
+	assert.Equal(t, 0, decision.Remaining)
+
+	// Other routes only count against the default limit, which is now exhausted
+	decision = limiter.Allow(context.Background(), "blue", "GET /persons/:personId/attributes", now)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, cfg.Default, decision.Limit)
+	assert.Equal(t, 20*time.Second, decision.RetryAfter)
+
+	// Each caller has its own buckets, and a caller rule replaces the * rule
+	decision = limiter.Allow(context.Background(), "green", attributesRoute, now)
+	assert.True(t, decision.Allowed)
+	decision = limiter.Allow(context.Background(), "orders", attributesRoute, now)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, 0, decision.Remaining)
+	decision = limiter.Allow(context.Background(), "orders", attributesRoute, now)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, cfg.Routes[attributesRoute]["orders"], decision.Limit)
+
+	// Without a default limit only callers and routes with rules are limited
+	limiter = NewLimiter(Config{Callers: map[string]Limit{"orders": {Requests: 1, Period: time.Second}}}, NewMemoryStore())
+	decision = limiter.Allow(context.Background(), "blue", attributesRoute, now)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, Limit{}, decision.Limit)
+}
+
+// failingStore is a Store whose database is down
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, Limit, time.Time) (float64, bool, error) {
+	return 0, false, errors.New("connection refused")
+}
+
+func (failingStore) Refund(context.Context, string, Limit) error {
+	return errors.New("connection refused")
+}
+
+func (failingStore) Sweep(context.Context, time.Time) (int64, error) {
+	return 0, errors.New("connection refused")
+}
+
+func TestLimiter_AllowsWhenStoreFails(t *testing.T) {
+	cfg, err := ParseRules("default=1/1m")
+	assert.NoError(t, err)
+	limiter := NewLimiter(cfg, failingStore{})
+
+	decision := limiter.Allow(context.Background(), "blue", attributesRoute, time.Now())
+
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, Limit{}, decision.Limit)
+}
+
+func TestMiddleware(t *testing.T) {
+	cfg, err := ParseRules("default=3/1m; *@" + attributesRoute + "=1/10s")
+	assert.NoError(t, err)
+	limiter := NewLimiter(cfg, NewMemoryStore())
+	e := echo.New()
+
+	request := func(identity, method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(method, "/persons/p-1/attributes", nil), rec)
+		c.SetPath(path)
+		if identity != "" {
+			c.Set(middleware.EchoAPIKeyIdentityKey, identity)
+		}
+		err := Middleware(limiter)(func(c echo.Context) error {
+			return c.NoContent(http.StatusNoContent)
+		})(c)
+		assert.NoError(t, err)
+		return rec
+	}
+
+	rec := request("blue", http.MethodGet, "/persons/:personId/attributes")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "3", rec.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "2", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "20", rec.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "3;w=60", rec.Header().Get("RateLimit-Policy"))
+	assert.Empty(t, rec.Header().Get("Retry-After"))
+
+	rec = request("blue", http.MethodPost, "/persons/:personId/attributes")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "1;w=10", rec.Header().Get("RateLimit-Policy"))
+	assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+
+	rec = request("blue", http.MethodPost, "/persons/:personId/attributes")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Contains(t, rec.Body.String(), "RL_301_RATE_LIMIT_EXCEEDED")
+	assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "10", rec.Header().Get("Retry-After"))
+
+	// Requests without a caller identity and a nil limiter are not limited
+	rec = request("", http.MethodPost, "/persons/:personId/attributes")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Empty(t, rec.Header().Get("RateLimit-Limit"))
+
+	rec = httptest.NewRecorder()
+	err = Middleware(nil)(func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
@@ -0,0 +1,101 @@
+package retention
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultInterval  = 1 * time.Hour
+	defaultBatchSize = 500
+)
+
+// Config holds the retention rules.
+// A zero retention period disables the corresponding rule.
+type Config struct {
+	// PersonRetention is how long soft-deleted persons are kept after deleted_at
+	PersonRetention time.Duration
+	// AuditLogRetention is how long request_log entries are kept after created_at
+	AuditLogRetention time.Duration
+	// Interval is the time between two scheduled runs
+	Interval time.Duration
+	// BatchSize is the maximum number of rows deleted per statement
+	BatchSize int32
+	// DryRun only counts what would be purged
+	DryRun bool
+}
+
+// Enabled reports whether at least one retention rule is configured
+func (c Config) Enabled() bool {
+	return c.PersonRetention > 0 || c.AuditLogRetention > 0
+}
+
+// LoadConfig reads the retention rules from environment variables:
+//   - RETENTION_PERSON_DAYS: purge soft-deleted persons this many days after deleted_at
+//   - RETENTION_AUDIT_LOG_DAYS: purge request_log entries this many days after created_at
+//   - RETENTION_INTERVAL: Go duration between runs (default 1h)
+//   - RETENTION_BATCH_SIZE: rows deleted per statement (default 500)
+//   - RETENTION_DRY_RUN: "true" to only report what would be purged
+func LoadConfig() (Config, error) {
+	cfg := Config{
+		Interval:  defaultInterval,
+		BatchSize: defaultBatchSize,
+	}
+
+	personDays, err := envInt("RETENTION_PERSON_DAYS", 0)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.PersonRetention = days(personDays)
+
+	auditDays, err := envInt("RETENTION_AUDIT_LOG_DAYS", 0)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.AuditLogRetention = days(auditDays)
+
+	if raw := os.Getenv("RETENTION_INTERVAL"); raw != "" {
+		interval, err := time.ParseDuration(raw)
+		if err != nil || interval <= 0 {
+			return Config{}, fmt.Errorf("invalid RETENTION_INTERVAL %q", raw)
+		}
+		cfg.Interval = interval
+	}
+
+	batchSize, err := envInt("RETENTION_BATCH_SIZE", defaultBatchSize)
+	if err != nil {
+		return Config{}, err
+	}
+	if batchSize <= 0 || batchSize > math.MaxInt32 {
+		return Config{}, fmt.Errorf("invalid RETENTION_BATCH_SIZE %d", batchSize)
+	}
+	cfg.BatchSize = int32(batchSize)
+
+	if raw := os.Getenv("RETENTION_DRY_RUN"); raw != "" {
+		cfg.DryRun, err = strconv.ParseBool(raw)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid RETENTION_DRY_RUN %q", raw)
+		}
+	}
+
+	return cfg, nil
+}
+
+func envInt(name string, fallback int) (int, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, raw)
+	}
+	return value, nil
+}
+
+func days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
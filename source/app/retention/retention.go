@@ -0,0 +1,284 @@
+package retention
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	errs "person-service/errors"
+	db "person-service/internal/db/generated"
+	"person-service/logging"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Rule names used in reports
+const (
+	RulePersons  = "soft_deleted_persons"
+	RuleAuditLog = "audit_log"
+)
+
+// Store is the persistence needed by the retention engine
+type Store interface {
+	CountPurgeablePersons(ctx context.Context, cutoff time.Time) (int64, error)
+	// PurgePersons deletes up to batchSize persons and returns how many persons were
+	// deleted and how many of their audit entries were redacted
+	PurgePersons(ctx context.Context, cutoff time.Time, batchSize int32) (int64, int64, error)
+	CountPurgeableAuditLogs(ctx context.Context, cutoff time.Time) (int64, error)
+	PurgeAuditLogs(ctx context.Context, cutoff time.Time, batchSize int32) (int64, error)
+}
+
+// RuleReport summarizes what a single rule matched and purged
+type RuleReport struct {
+	Rule                 string    `json:"rule"`
+	Cutoff               time.Time `json:"cutoff"`
+	Matched              int64     `json:"matched"`
+	Purged               int64     `json:"purged"`
+	AuditEntriesRedacted int64     `json:"auditEntriesRedacted,omitempty"`
+	Error                string    `json:"error,omitempty"`
+}
+
+// Report summarizes a retention run
+type Report struct {
+	StartedAt  time.Time    `json:"startedAt"`
+	FinishedAt time.Time    `json:"finishedAt"`
+	DryRun     bool         `json:"dryRun"`
+	Rules      []RuleReport `json:"rules"`
+}
+
+// Failed reports whether any rule failed
+func (r *Report) Failed() bool {
+	for _, rule := range r.Rules {
+		if rule.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Metrics are cumulative counters since the process started
+type Metrics struct {
+	Runs                 int64 `json:"runs"`
+	FailedRuns           int64 `json:"failedRuns"`
+	PersonsPurged        int64 `json:"personsPurged"`
+	AuditLogsPurged      int64 `json:"auditLogsPurged"`
+	AuditEntriesRedacted int64 `json:"auditEntriesRedacted"`
+}
+
+// Engine applies the retention rules
+type Engine struct {
+	store Store
+	cfg   Config
+
+	mu         sync.Mutex
+	lastReport *Report
+
+	runs                 atomic.Int64
+	failedRuns           atomic.Int64
+	personsPurged        atomic.Int64
+	auditLogsPurged      atomic.Int64
+	auditEntriesRedacted atomic.Int64
+}
+
+// NewEngine creates a retention engine for the given store and rules
+func NewEngine(store Store, cfg Config) *Engine {
+	return &Engine{
+		store: store,
+		cfg:   cfg,
+	}
+}
+
+// Run applies every enabled rule once relative to now and returns the report.
+// In dry-run mode rows are only counted.
+func (e *Engine) Run(ctx context.Context, now time.Time) *Report {
+	report := &Report{
+		StartedAt: now,
+		DryRun:    e.cfg.DryRun,
+		Rules:     []RuleReport{},
+	}
+
+	if e.cfg.PersonRetention > 0 {
+		report.Rules = append(report.Rules, e.purgePersons(ctx, now.Add(-e.cfg.PersonRetention)))
+	}
+	if e.cfg.AuditLogRetention > 0 {
+		report.Rules = append(report.Rules, e.purgeAuditLogs(ctx, now.Add(-e.cfg.AuditLogRetention)))
+	}
+
+	report.FinishedAt = time.Now()
+	e.record(report)
+	return report
+}
+
+// LastReport returns the report of the most recent run, or nil before the first run
+func (e *Engine) LastReport() *Report {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.lastReport
+}
+
+// Metrics returns the cumulative counters
+func (e *Engine) Metrics() Metrics {
+	return Metrics{
+		Runs:                 e.runs.Load(),
+		FailedRuns:           e.failedRuns.Load(),
+		PersonsPurged:        e.personsPurged.Load(),
+		AuditLogsPurged:      e.auditLogsPurged.Load(),
+		AuditEntriesRedacted: e.auditEntriesRedacted.Load(),
+	}
+}
+
+func (e *Engine) purgePersons(ctx context.Context, cutoff time.Time) RuleReport {
+	rule := RuleReport{Rule: RulePersons, Cutoff: cutoff}
+
+	matched, err := e.store.CountPurgeablePersons(ctx, cutoff)
+	if err != nil {
+		rule.Error = err.Error()
+		return rule
+	}
+	rule.Matched = matched
+	if e.cfg.DryRun {
+		return rule
+	}
+
+	// Delete in batches so a large backlog does not hold long locks
+	for {
+		purged, redacted, err := e.store.PurgePersons(ctx, cutoff, e.cfg.BatchSize)
+		rule.Purged += purged
+		rule.AuditEntriesRedacted += redacted
+		if err != nil {
+			rule.Error = err.Error()
+			return rule
+		}
+		if purged < int64(e.cfg.BatchSize) || ctx.Err() != nil {
+			return rule
+		}
+	}
+}
+
+func (e *Engine) purgeAuditLogs(ctx context.Context, cutoff time.Time) RuleReport {
+	rule := RuleReport{Rule: RuleAuditLog, Cutoff: cutoff}
+
+	matched, err := e.store.CountPurgeableAuditLogs(ctx, cutoff)
+	if err != nil {
+		rule.Error = err.Error()
+		return rule
+	}
+	rule.Matched = matched
+	if e.cfg.DryRun {
+		return rule
+	}
+
+	for {
+		purged, err := e.store.PurgeAuditLogs(ctx, cutoff, e.cfg.BatchSize)
+		rule.Purged += purged
+		if err != nil {
+			rule.Error = err.Error()
+			return rule
+		}
+		if purged < int64(e.cfg.BatchSize) || ctx.Err() != nil {
+			return rule
+		}
+	}
+}
+
+// record updates the cumulative metrics and keeps the report
+func (e *Engine) record(report *Report) {
+	e.runs.Add(1)
+	if report.Failed() {
+		e.failedRuns.Add(1)
+	}
+	for _, rule := range report.Rules {
+		switch rule.Rule {
+		case RulePersons:
+			e.personsPurged.Add(rule.Purged)
+			e.auditEntriesRedacted.Add(rule.AuditEntriesRedacted)
+		case RuleAuditLog:
+			e.auditLogsPurged.Add(rule.Purged)
+		}
+	}
+
+	e.mu.Lock()
+	e.lastReport = report
+	e.mu.Unlock()
+}
+
+// Start runs the engine immediately and then every configured interval until ctx is done.
+// Each run's report is logged.
+func (e *Engine) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(e.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			report := e.Run(ctx, time.Now())
+			e.logReport(ctx, report)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (e *Engine) logReport(ctx context.Context, report *Report) {
+	logger := logging.LoggerFromContext(ctx)
+	msg := "Retention run completed"
+	if report.DryRun {
+		msg = "Retention dry run completed"
+	}
+	if report.Failed() {
+		logger.Error(msg,
+			"report", report,
+			"metrics", e.Metrics(),
+			"error_code", errs.ErrRetentionRunFailed)
+		return
+	}
+	logger.Info(msg, "report", report, "metrics", e.Metrics())
+}
+
+// QueriesStore implements Store on top of the generated queries
+type QueriesStore struct {
+	queries *db.Queries
+}
+
+// NewQueriesStore creates a Store backed by the database
+func NewQueriesStore(queries *db.Queries) *QueriesStore {
+	return &QueriesStore{queries: queries}
+}
+
+// CountPurgeablePersons counts soft-deleted persons older than the cutoff
+func (s *QueriesStore) CountPurgeablePersons(ctx context.Context, cutoff time.Time) (int64, error) {
+	return s.queries.CountPurgeablePersons(ctx, timestamptz(cutoff))
+}
+
+// PurgePersons hard deletes a batch of soft-deleted persons older than the cutoff
+func (s *QueriesStore) PurgePersons(ctx context.Context, cutoff time.Time, batchSize int32) (int64, int64, error) {
+	row, err := s.queries.PurgeSoftDeletedPersons(ctx, db.PurgeSoftDeletedPersonsParams{
+		Cutoff:    timestamptz(cutoff),
+		BatchSize: batchSize,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return row.PersonsPurged, row.AuditEntriesRedacted, nil
+}
+
+// CountPurgeableAuditLogs counts audit entries older than the cutoff
+func (s *QueriesStore) CountPurgeableAuditLogs(ctx context.Context, cutoff time.Time) (int64, error) {
+	return s.queries.CountPurgeableRequestLogs(ctx, timestamptz(cutoff))
+}
+
+// PurgeAuditLogs deletes a batch of audit entries older than the cutoff
+func (s *QueriesStore) PurgeAuditLogs(ctx context.Context, cutoff time.Time, batchSize int32) (int64, error) {
+	return s.queries.PurgeRequestLogs(ctx, db.PurgeRequestLogsParams{
+		Cutoff:    timestamptz(cutoff),
+		BatchSize: batchSize,
+	})
+}
+
+func timestamptz(t time.Time) pgtype.Timestamptz {
+	return pgtype.Timestamptz{Time: t, Valid: true}
+}
@@ -0,0 +1,178 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeStore serves purges from an in-memory backlog
+type fakeStore struct {
+	persons   int64
+	auditLogs int64
+	// redactedPerPerson audit entries are reported for every purged person
+	redactedPerPerson int64
+	err               error
+
+	personCutoff time.Time
+	auditCutoff  time.Time
+	purgeCalls   int
+}
+
+func (s *fakeStore) CountPurgeablePersons(ctx context.Context, cutoff time.Time) (int64, error) {
+	s.personCutoff = cutoff
+	return s.persons, nil
+}
+
+func (s *fakeStore) PurgePersons(ctx context.Context, cutoff time.Time, batchSize int32) (int64, int64, error) {
+	s.purgeCalls++
+	if s.err != nil {
+		return 0, 0, s.err
+	}
+	n := min(s.persons, int64(batchSize))
+	s.persons -= n
+	return n, n * s.redactedPerPerson, nil
+}
+
+func (s *fakeStore) CountPurgeableAuditLogs(ctx context.Context, cutoff time.Time) (int64, error) {
+	s.auditCutoff = cutoff
+	return s.auditLogs, nil
+}
+
+func (s *fakeStore) PurgeAuditLogs(ctx context.Context, cutoff time.Time, batchSize int32) (int64, error) {
+	s.purgeCalls++
+	n := min(s.auditLogs, int64(batchSize))
+	s.auditLogs -= n
+	return n, nil
+}
+
+var now = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func TestRun_PurgesInBatches(t *testing.T) {
+	store := &fakeStore{persons: 25, auditLogs: 7, redactedPerPerson: 2}
+	engine := NewEngine(store, Config{
+		PersonRetention:   days(30),
+		AuditLogRetention: days(365),
+		BatchSize:         10,
+	})
+
+	report := engine.Run(context.Background(), now)
+
+	assert.False(t, report.Failed())
+	assert.Len(t, report.Rules, 2)
+	assert.Equal(t, RulePersons, report.Rules[0].Rule)
+	assert.Equal(t, now.Add(-days(30)), report.Rules[0].Cutoff)
+	assert.Equal(t, int64(25), report.Rules[0].Matched)
+	assert.Equal(t, int64(25), report.Rules[0].Purged)
+	assert.Equal(t, int64(50), report.Rules[0].AuditEntriesRedacted)
+	assert.Equal(t, RuleAuditLog, report.Rules[1].Rule)
+	assert.Equal(t, now.Add(-days(365)), store.auditCutoff)
+	assert.Equal(t, int64(7), report.Rules[1].Purged)
+	// 3 person batches (10, 10, 5) and 1 audit log batch
+	assert.Equal(t, 4, store.purgeCalls)
+}
+
+func TestRun_DryRunOnlyCounts(t *testing.T) {
+	store := &fakeStore{persons: 5, auditLogs: 3}
+	engine := NewEngine(store, Config{
+		PersonRetention:   days(30),
+		AuditLogRetention: days(30),
+		BatchSize:         10,
+		DryRun:            true,
+	})
+
+	report := engine.Run(context.Background(), now)
+
+	assert.True(t, report.DryRun)
+	assert.Equal(t, int64(5), report.Rules[0].Matched)
+	assert.Equal(t, int64(0), report.Rules[0].Purged)
+	assert.Equal(t, int64(3), report.Rules[1].Matched)
+	assert.Equal(t, 0, store.purgeCalls)
+	assert.Equal(t, int64(5), store.persons)
+}
+
+func TestRun_SkipsDisabledRules(t *testing.T) {
+	store := &fakeStore{persons: 5, auditLogs: 3}
+	engine := NewEngine(store, Config{AuditLogRetention: days(1), BatchSize: 10})
+
+	report := engine.Run(context.Background(), now)
+
+	assert.Len(t, report.Rules, 1)
+	assert.Equal(t, RuleAuditLog, report.Rules[0].Rule)
+	assert.True(t, store.personCutoff.IsZero())
+}
+
+func TestRun_RecordsFailureAndMetrics(t *testing.T) {
+	store := &fakeStore{persons: 5, auditLogs: 4, err: errors.New("boom")}
+	engine := NewEngine(store, Config{
+		PersonRetention:   days(1),
+		AuditLogRetention: days(1),
+		BatchSize:         10,
+	})
+	assert.Nil(t, engine.LastReport())
+
+	report := engine.Run(context.Background(), now)
+
+	assert.True(t, report.Failed())
+	assert.Equal(t, "boom", report.Rules[0].Error)
+	// A failing rule does not stop the others
+	assert.Equal(t, int64(4), report.Rules[1].Purged)
+	assert.Same(t, report, engine.LastReport())
+
+	engine.Run(context.Background(), now)
+	metrics := engine.Metrics()
+	assert.Equal(t, int64(2), metrics.Runs)
+	assert.Equal(t, int64(2), metrics.FailedRuns)
+	assert.Equal(t, int64(4), metrics.AuditLogsPurged)
+	assert.Equal(t, int64(0), metrics.PersonsPurged)
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("RETENTION_PERSON_DAYS", "30")
+	t.Setenv("RETENTION_AUDIT_LOG_DAYS", "")
+	t.Setenv("RETENTION_INTERVAL", "15m")
+	t.Setenv("RETENTION_BATCH_SIZE", "")
+	t.Setenv("RETENTION_DRY_RUN", "true")
+
+	cfg, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.True(t, cfg.Enabled())
+	assert.Equal(t, 30*24*time.Hour, cfg.PersonRetention)
+	assert.Equal(t, time.Duration(0), cfg.AuditLogRetention)
+	assert.Equal(t, 15*time.Minute, cfg.Interval)
+	assert.Equal(t, int32(defaultBatchSize), cfg.BatchSize)
+	assert.True(t, cfg.DryRun)
+}
+
+func TestLoadConfig_Disabled(t *testing.T) {
+	t.Setenv("RETENTION_PERSON_DAYS", "")
+	t.Setenv("RETENTION_AUDIT_LOG_DAYS", "")
+
+	cfg, err := LoadConfig()
+
+	assert.NoError(t, err)
+	assert.False(t, cfg.Enabled())
+	assert.Equal(t, defaultInterval, cfg.Interval)
+}
+
+func TestLoadConfig_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"RETENTION_PERSON_DAYS":    "-1",
+		"RETENTION_AUDIT_LOG_DAYS": "ten",
+		"RETENTION_INTERVAL":       "0s",
+		"RETENTION_BATCH_SIZE":     "0",
+		"RETENTION_DRY_RUN":        "maybe",
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			_, err := LoadConfig()
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), name)
+		})
+	}
+}
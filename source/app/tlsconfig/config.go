@@ -0,0 +1,114 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	// CipherPolicyModern allows only ECDHE key exchange with AEAD ciphers on TLS 1.2
+	CipherPolicyModern = "modern"
+	// CipherPolicyCompatible allows Go's default cipher suites on TLS 1.2
+	CipherPolicyCompatible = "compatible"
+
+	defaultReloadInterval = 30 * time.Second
+)
+
+// modernCipherSuites are the TLS 1.2 suites of CipherPolicyModern.
+// TLS 1.3 suites are not configurable and always secure.
+var modernCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// Config holds the TLS settings of the server.
+// TLS is disabled when CertFile is empty.
+type Config struct {
+	// CertFile and KeyFile are the PEM server certificate (chain) and private key
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is a PEM bundle of CAs that sign client certificates. When set,
+	// every client must present a certificate signed by one of them (mutual TLS).
+	ClientCAFile string
+	// MinVersion is the lowest TLS version accepted
+	MinVersion uint16
+	// CipherPolicy is CipherPolicyModern or CipherPolicyCompatible
+	CipherPolicy string
+	// ReloadInterval is the time between two checks of the files for changes
+	ReloadInterval time.Duration
+}
+
+// Enabled reports whether the server should serve TLS
+func (c Config) Enabled() bool {
+	return c.CertFile != ""
+}
+
+// MutualTLS reports whether clients must present a certificate
+func (c Config) MutualTLS() bool {
+	return c.ClientCAFile != ""
+}
+
+// LoadConfig reads the TLS settings from environment variables:
+//   - TLS_CERT_FILE, TLS_KEY_FILE: server certificate and key (both or neither)
+//   - TLS_CLIENT_CA_FILE: CA bundle that enables mutual TLS
+//   - TLS_MIN_VERSION: "1.2" (default) or "1.3"
+//   - TLS_CIPHER_POLICY: "modern" (default) or "compatible"
+//   - TLS_RELOAD_INTERVAL: Go duration between checks for changed files (default 30s)
+func LoadConfig() (Config, error) {
+	cfg := Config{
+		CertFile:       os.Getenv("TLS_CERT_FILE"),
+		KeyFile:        os.Getenv("TLS_KEY_FILE"),
+		ClientCAFile:   os.Getenv("TLS_CLIENT_CA_FILE"),
+		MinVersion:     tls.VersionTLS12,
+		CipherPolicy:   CipherPolicyModern,
+		ReloadInterval: defaultReloadInterval,
+	}
+
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return Config{}, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if cfg.ClientCAFile != "" && cfg.CertFile == "" {
+		return Config{}, errors.New("TLS_CLIENT_CA_FILE needs TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+
+	switch raw := os.Getenv("TLS_MIN_VERSION"); raw {
+	case "", "1.2":
+	case "1.3":
+		cfg.MinVersion = tls.VersionTLS13
+	default:
+		return Config{}, fmt.Errorf("invalid TLS_MIN_VERSION %q, expected 1.2 or 1.3", raw)
+	}
+
+	switch raw := os.Getenv("TLS_CIPHER_POLICY"); raw {
+	case "", CipherPolicyModern:
+	case CipherPolicyCompatible:
+		cfg.CipherPolicy = CipherPolicyCompatible
+	default:
+		return Config{}, fmt.Errorf("invalid TLS_CIPHER_POLICY %q, expected %s or %s", raw, CipherPolicyModern, CipherPolicyCompatible)
+	}
+
+	if raw := os.Getenv("TLS_RELOAD_INTERVAL"); raw != "" {
+		interval, err := time.ParseDuration(raw)
+		if err != nil || interval <= 0 {
+			return Config{}, fmt.Errorf("invalid TLS_RELOAD_INTERVAL %q", raw)
+		}
+		cfg.ReloadInterval = interval
+	}
+
+	return cfg, nil
+}
+
+// cipherSuites returns the TLS 1.2 cipher suites of the policy, nil for Go's defaults
+func (c Config) cipherSuites() []uint16 {
+	if c.CipherPolicy == CipherPolicyCompatible {
+		return nil
+	}
+	return modernCipherSuites
+}
@@ -0,0 +1,188 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	errs "person-service/errors"
+	"person-service/logging"
+)
+
+// fileStamp identifies a version of a file
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Reloader serves the certificate and client CAs of a Config and loads them
+// again when their files change, so certificates can be rotated without a restart.
+// A failed reload is logged and the previous certificate stays in use.
+type Reloader struct {
+	cfg Config
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	stamps    map[string]fileStamp
+}
+
+// NewReloader loads the certificate and client CAs of cfg
+func NewReloader(cfg Config) (*Reloader, error) {
+	r := &Reloader{cfg: cfg}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// files returns the files the TLS settings are read from
+func (r *Reloader) files() []string {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.MutualTLS() {
+		files = append(files, r.cfg.ClientCAFile)
+	}
+	return files
+}
+
+// load reads the files and swaps in the new certificate and client CAs
+func (r *Reloader) load() error {
+	// Stamp before reading so a change during the read is picked up next time
+	stamps, err := r.stat()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load server certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.cfg.MutualTLS() {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return errors.New("client CA file contains no PEM certificates")
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.stamps = stamps
+	return nil
+}
+
+// stat returns the current stamp of every file
+func (r *Reloader) stat() (map[string]fileStamp, error) {
+	stamps := make(map[string]fileStamp)
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", file, err)
+		}
+		stamps[file] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return stamps, nil
+}
+
+// Reload loads the files again when one of them changed since the last successful
+// load. It reports whether a new certificate was loaded.
+func (r *Reloader) Reload() (bool, error) {
+	stamps, err := r.stat()
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	changed := false
+	for file, stamp := range stamps {
+		if r.stamps[file] != stamp {
+			changed = true
+		}
+	}
+	r.mu.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	if err := r.load(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Start checks the files for changes every ReloadInterval until ctx is done
+func (r *Reloader) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(r.cfg.ReloadInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			reloaded, err := r.Reload()
+			if err != nil {
+				logging.ErrorContext(ctx, "Failed to reload TLS certificate",
+					"error", err,
+					"error_code", errs.ErrFailedReloadCertificate)
+				continue
+			}
+			if reloaded {
+				logging.InfoContext(ctx, "TLS certificate reloaded", "cert_file", r.cfg.CertFile)
+			}
+		}
+	}()
+}
+
+// Certificate returns the server certificate currently in use
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// ClientCAs returns the client CAs currently in use, nil without mutual TLS
+func (r *Reloader) ClientCAs() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.clientCAs
+}
+
+// TLSConfig returns the server TLS configuration. Each handshake uses the
+// certificate and client CAs current at that time.
+func (r *Reloader) TLSConfig() *tls.Config {
+	base := &tls.Config{
+		MinVersion:   r.cfg.MinVersion,
+		CipherSuites: r.cfg.cipherSuites(),
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.Certificate(), nil
+		},
+	}
+	if !r.cfg.MutualTLS() {
+		return base
+	}
+
+	base.ClientAuth = tls.RequireAndVerifyClientCert
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cfg := base.Clone()
+		cfg.GetConfigForClient = nil
+		cfg.ClientCAs = r.ClientCAs()
+		return cfg, nil
+	}
+	return base
+}
@@ -0,0 +1,235 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testCA is a certificate authority that issues test certificates
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns the PEM certificate and key of a leaf certificate for commonName
+func (ca *testCA) issue(t *testing.T, commonName string, serial int64, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFile writes data to name in dir and moves its modification time forward,
+// so a rewrite within the same second is still seen as a change
+func writeFile(t *testing.T, dir, name string, data []byte, modTime time.Time) string {
+	path := filepath.Join(dir, name)
+	assert.NoError(t, os.WriteFile(path, data, 0o600))
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	for _, name := range []string{"TLS_CERT_FILE", "TLS_KEY_FILE", "TLS_CLIENT_CA_FILE", "TLS_MIN_VERSION", "TLS_CIPHER_POLICY", "TLS_RELOAD_INTERVAL"} {
+		os.Unsetenv(name)
+		defer os.Unsetenv(name)
+	}
+
+	cfg, err := LoadConfig()
+	assert.NoError(t, err)
+	assert.False(t, cfg.Enabled())
+
+	os.Setenv("TLS_CERT_FILE", "/etc/tls/server.crt")
+	_, err = LoadConfig()
+	assert.ErrorContains(t, err, "must be set together")
+
+	os.Setenv("TLS_KEY_FILE", "/etc/tls/server.key")
+	os.Setenv("TLS_CLIENT_CA_FILE", "/etc/tls/clients.pem")
+	os.Setenv("TLS_MIN_VERSION", "1.3")
+	os.Setenv("TLS_CIPHER_POLICY", "compatible")
+	cfg, err = LoadConfig()
+	assert.NoError(t, err)
+	assert.True(t, cfg.Enabled())
+	assert.True(t, cfg.MutualTLS())
+	assert.Equal(t, uint16(tls.VersionTLS13), cfg.MinVersion)
+	assert.Nil(t, cfg.cipherSuites())
+	assert.Equal(t, defaultReloadInterval, cfg.ReloadInterval)
+
+	tests := map[string]string{
+		"TLS_MIN_VERSION":     "1.0",
+		"TLS_CIPHER_POLICY":   "legacy",
+		"TLS_RELOAD_INTERVAL": "0s",
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			previous := os.Getenv(name)
+			os.Setenv(name, value)
+			defer os.Setenv(name, previous)
+
+			_, err := LoadConfig()
+			assert.ErrorContains(t, err, name)
+		})
+	}
+}
+
+func TestReloader_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	serverCA := newTestCA(t, "server-ca")
+	clientCA := newTestCA(t, "client-ca")
+	otherCA := newTestCA(t, "other-ca")
+	start := time.Now().Add(-time.Minute)
+
+	certPEM, keyPEM := serverCA.issue(t, "server-1", 2, x509.ExtKeyUsageServerAuth)
+	cfg := Config{
+		CertFile:     writeFile(t, dir, "server.crt", certPEM, start),
+		KeyFile:      writeFile(t, dir, "server.key", keyPEM, start),
+		ClientCAFile: writeFile(t, dir, "clients.pem", clientCA.pem, start),
+		MinVersion:   tls.VersionTLS12,
+		CipherPolicy: CipherPolicyModern,
+	}
+	reloader, err := NewReloader(cfg)
+	assert.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = reloader.TLSConfig()
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCA.cert)
+	client := func(ca *testCA) (*http.Client, error) {
+		clientCert, clientKey := ca.issue(t, "orders", 3, x509.ExtKeyUsageClientAuth)
+		pair, err := tls.X509KeyPair(clientCert, clientKey)
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: []tls.Certificate{pair},
+		}}}, err
+	}
+
+	// A certificate signed by the client CA is accepted
+	trusted, err := client(clientCA)
+	assert.NoError(t, err)
+	resp, err := trusted.Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "server-1", resp.TLS.PeerCertificates[0].Subject.CommonName)
+	resp.Body.Close()
+
+	// Other certificates and no certificate are rejected during the handshake
+	untrusted, err := client(otherCA)
+	assert.NoError(t, err)
+	_, err = untrusted.Get(server.URL)
+	assert.Error(t, err)
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	_, err = anonymous.Get(server.URL)
+	assert.Error(t, err)
+
+	// Unchanged files are not loaded again
+	reloaded, err := reloader.Reload()
+	assert.NoError(t, err)
+	assert.False(t, reloaded)
+
+	// A rotated server certificate and client CA are served without a restart
+	certPEM, keyPEM = serverCA.issue(t, "server-2", 4, x509.ExtKeyUsageServerAuth)
+	writeFile(t, dir, "server.crt", certPEM, start.Add(time.Second))
+	writeFile(t, dir, "server.key", keyPEM, start.Add(time.Second))
+	writeFile(t, dir, "clients.pem", otherCA.pem, start.Add(time.Second))
+	reloaded, err = reloader.Reload()
+	assert.NoError(t, err)
+	assert.True(t, reloaded)
+
+	rotated, err := client(otherCA)
+	assert.NoError(t, err)
+	resp, err = rotated.Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "server-2", resp.TLS.PeerCertificates[0].Subject.CommonName)
+	resp.Body.Close()
+}
+
+func TestReloader_KeepsCertificateOnFailedReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "server-ca")
+	start := time.Now().Add(-time.Minute)
+	certPEM, keyPEM := ca.issue(t, "server-1", 2, x509.ExtKeyUsageServerAuth)
+	cfg := Config{
+		CertFile: writeFile(t, dir, "server.crt", certPEM, start),
+		KeyFile:  writeFile(t, dir, "server.key", keyPEM, start),
+	}
+	reloader, err := NewReloader(cfg)
+	assert.NoError(t, err)
+	before := reloader.Certificate()
+
+	// A certificate written before its key does not match the old key
+	certPEM, _ = ca.issue(t, "server-2", 3, x509.ExtKeyUsageServerAuth)
+	writeFile(t, dir, "server.crt", certPEM, start.Add(time.Second))
+
+	reloaded, err := reloader.Reload()
+	assert.Error(t, err)
+	assert.False(t, reloaded)
+	assert.Same(t, before, reloader.Certificate())
+}
+
+func TestNewReloader_InvalidClientCA(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "server-ca")
+	certPEM, keyPEM := ca.issue(t, "server-1", 2, x509.ExtKeyUsageServerAuth)
+	cfg := Config{
+		CertFile:     writeFile(t, dir, "server.crt", certPEM, time.Now()),
+		KeyFile:      writeFile(t, dir, "server.key", keyPEM, time.Now()),
+		ClientCAFile: writeFile(t, dir, "clients.pem", []byte("not a certificate"), time.Now()),
+	}
+
+	_, err := NewReloader(cfg)
+
+	assert.ErrorContains(t, err, "no PEM certificates")
+}
@@ -3,6 +3,8 @@ package tracing
 import (
 	"context"
 	"strings"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 // contextKey is a custom type for context keys to avoid collisions
@@ -35,7 +37,8 @@ func ContextWithTraceID(ctx context.Context, traceID string) context.Context {
 	return context.WithValue(ctx, TraceIDKey, traceID)
 }
 
-// TraceIDFromContext retrieves the trace ID from the context.
+// TraceIDFromContext retrieves the trace ID from the context, or else the trace ID
+// of the span in the context (for work started outside a request).
 // Returns empty string if no trace ID is found.
 func TraceIDFromContext(ctx context.Context) string {
 	if ctx == nil {
@@ -44,8 +47,26 @@ func TraceIDFromContext(ctx context.Context) string {
 
 	traceID, ok := ctx.Value(TraceIDKey).(string)
 	if !ok {
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+			return spanContext.TraceID().String()
+		}
 		return ""
 	}
 
 	return traceID
 }
+
+// SpanIDFromContext returns the hex ID of the span in the context.
+// Returns empty string if the context has no recording or remote span.
+func SpanIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasSpanID() {
+		return ""
+	}
+
+	return spanContext.SpanID().String()
+}
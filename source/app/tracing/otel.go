@@ -0,0 +1,169 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName names the tracer of the service's spans
+const InstrumentationName = "person-service"
+
+// Exporters of OTEL_TRACES_EXPORTER
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Protocols of OTEL_EXPORTER_OTLP_PROTOCOL
+const (
+	ProtocolHTTP = "http/protobuf"
+	ProtocolGRPC = "grpc"
+)
+
+// Config selects where spans are exported to
+type Config struct {
+	// Exporter is ExporterNone, ExporterOTLP or ExporterStdout
+	Exporter string
+	// Protocol is the OTLP protocol, ProtocolHTTP or ProtocolGRPC
+	Protocol string
+}
+
+// Enabled reports whether spans are recorded and exported
+func (c Config) Enabled() bool {
+	return c.Exporter != ExporterNone
+}
+
+// LoadConfig reads the tracing configuration from the standard OpenTelemetry
+// variables: OTEL_TRACES_EXPORTER (none, otlp or stdout; console is accepted for
+// stdout) and OTEL_EXPORTER_OTLP_TRACES_PROTOCOL or OTEL_EXPORTER_OTLP_PROTOCOL.
+// Tracing is disabled when OTEL_TRACES_EXPORTER is unset. The OTLP exporters read
+// their endpoint, headers and timeout from the OTEL_EXPORTER_OTLP_* variables, and
+// the sampler is read from OTEL_TRACES_SAMPLER.
+func LoadConfig() (Config, error) {
+	cfg := Config{Exporter: ExporterNone, Protocol: ProtocolHTTP}
+
+	switch exporter := strings.ToLower(strings.TrimSpace(os.Getenv("OTEL_TRACES_EXPORTER"))); exporter {
+	case "", ExporterNone:
+	case ExporterOTLP, ExporterStdout:
+		cfg.Exporter = exporter
+	case "console":
+		cfg.Exporter = ExporterStdout
+	default:
+		return Config{}, fmt.Errorf("invalid OTEL_TRACES_EXPORTER %q: must be %s, %s or %s", exporter, ExporterOTLP, ExporterStdout, ExporterNone)
+	}
+
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	switch protocol = strings.ToLower(strings.TrimSpace(protocol)); protocol {
+	case "":
+	case ProtocolHTTP, ProtocolGRPC:
+		cfg.Protocol = protocol
+	default:
+		return Config{}, fmt.Errorf("invalid OTLP protocol %q: must be %s or %s", protocol, ProtocolHTTP, ProtocolGRPC)
+	}
+
+	return cfg, nil
+}
+
+// Propagator reads and writes the W3C traceparent, tracestate and baggage headers
+var Propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Init installs the W3C propagator and, when cfg is enabled, a tracer provider
+// exporting spans in batches. The returned function flushes pending spans and
+// stops the exporter; call it on shutdown.
+func Init(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(Propagator)
+	if !cfg.Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults
+	res, err := resource.Merge(
+		resource.NewSchemaless(semconv.ServiceName(InstrumentationName)),
+		resource.Environment(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTEL_RESOURCE_ATTRIBUTES: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// newExporter creates the span exporter selected by cfg
+func newExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	if cfg.Exporter == ExporterStdout {
+		return stdouttrace.New()
+	}
+	if cfg.Protocol == ProtocolGRPC {
+		return otlptracegrpc.New(ctx)
+	}
+	return otlptracehttp.New(ctx)
+}
+
+// Tracer returns the tracer of the service's spans from the global provider,
+// which records nothing until Init installs an exporting provider
+func Tracer() trace.Tracer {
+	return otel.Tracer(InstrumentationName)
+}
+
+// SpanContextFromGCPHeader converts an X-Cloud-Trace-Context header into a remote
+// span context, so spans join traces started behind a GCP load balancer. The span
+// ID of the header is decimal. It returns an invalid span context when the header
+// does not carry a 32 hex digit trace ID and a span ID.
+func SpanContextFromGCPHeader(header string) trace.SpanContext {
+	traceIDPart, rest, ok := strings.Cut(header, "/")
+	if !ok {
+		return trace.SpanContext{}
+	}
+	traceID, err := trace.TraceIDFromHex(traceIDPart)
+	if err != nil {
+		return trace.SpanContext{}
+	}
+
+	spanIDPart, options, _ := strings.Cut(rest, ";")
+	decimal, err := strconv.ParseUint(spanIDPart, 10, 64)
+	if err != nil || decimal == 0 {
+		return trace.SpanContext{}
+	}
+	spanID, err := trace.SpanIDFromHex(fmt.Sprintf("%016x", decimal))
+	if err != nil {
+		return trace.SpanContext{}
+	}
+
+	var flags trace.TraceFlags
+	if options == "o=1" {
+		flags = trace.FlagsSampled
+	}
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: flags,
+		Remote:     true,
+	})
+}
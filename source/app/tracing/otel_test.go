@@ -0,0 +1,116 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestLoadConfig(t *testing.T) {
+	defer os.Unsetenv("OTEL_TRACES_EXPORTER")
+	defer os.Unsetenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+
+	os.Unsetenv("OTEL_TRACES_EXPORTER")
+	cfg, err := LoadConfig()
+	assert.NoError(t, err)
+	assert.False(t, cfg.Enabled())
+
+	os.Setenv("OTEL_TRACES_EXPORTER", "console")
+	cfg, err = LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, Config{Exporter: ExporterStdout, Protocol: ProtocolHTTP}, cfg)
+
+	os.Setenv("OTEL_TRACES_EXPORTER", "otlp")
+	os.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+	cfg, err = LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, Config{Exporter: ExporterOTLP, Protocol: ProtocolGRPC}, cfg)
+
+	os.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/json")
+	_, err = LoadConfig()
+	assert.ErrorContains(t, err, "OTLP protocol")
+
+	os.Setenv("OTEL_TRACES_EXPORTER", "zipkin")
+	_, err = LoadConfig()
+	assert.ErrorContains(t, err, "OTEL_TRACES_EXPORTER")
+}
+
+func TestSpanContextFromGCPHeader(t *testing.T) {
+	sc := SpanContextFromGCPHeader("105445aa7843bc8bf206b12000100000/255;o=1")
+	assert.True(t, sc.IsValid())
+	assert.True(t, sc.IsRemote())
+	assert.True(t, sc.IsSampled())
+	assert.Equal(t, "105445aa7843bc8bf206b12000100000", sc.TraceID().String())
+	assert.Equal(t, "00000000000000ff", sc.SpanID().String())
+
+	assert.False(t, SpanContextFromGCPHeader("105445aa7843bc8bf206b12000100000/1;o=0").IsSampled())
+
+	for _, header := range []string{
+		"",
+		"105445aa7843bc8bf206b12000100000",
+		"not-hex/1;o=1",
+		"105445aa7843bc8bf206b12000100000/abc;o=1",
+		"105445aa7843bc8bf206b12000100000/0;o=1",
+	} {
+		assert.False(t, SpanContextFromGCPHeader(header).IsValid(), header)
+	}
+}
+
+func TestTraceIDFromContext_Span(t *testing.T) {
+	sc := SpanContextFromGCPHeader("105445aa7843bc8bf206b12000100000/1;o=1")
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	assert.Equal(t, "105445aa7843bc8bf206b12000100000", TraceIDFromContext(ctx))
+	assert.Equal(t, "0000000000000001", SpanIDFromContext(ctx))
+	assert.Equal(t, "", SpanIDFromContext(context.Background()))
+
+	// A stored trace ID wins over the span
+	assert.Equal(t, "stored", TraceIDFromContext(ContextWithTraceID(ctx, "stored")))
+}
+
+func TestQueryName(t *testing.T) {
+	assert.Equal(t, "GetPerson", queryName("-- name: GetPerson :one\nSELECT id FROM person WHERE id = $1"))
+	assert.Equal(t, "SELECT", queryName("  select 1"))
+	assert.Equal(t, "query", queryName(""))
+}
+
+func TestQueryTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	ctx, parent := Tracer().Start(context.Background(), "GET /persons/:personId")
+	tracer := QueryTracer{}
+	run := func(sql, tag string, err error) {
+		queryCtx := tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: sql, Args: []any{"secret"}})
+		tracer.TraceQueryEnd(queryCtx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag(tag), Err: err})
+	}
+	run("-- name: GetPerson :one\nSELECT id FROM person WHERE id = $1", "SELECT 1", nil)
+	run("INSERT INTO person (id) VALUES ($1)", "", errors.New("unique violation"))
+	parent.End()
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 3)
+	assert.Equal(t, "GetPerson", spans[0].Name())
+	assert.Equal(t, trace.SpanKindClient, spans[0].SpanKind())
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, "INSERT", spans[1].Name())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	for _, span := range spans {
+		for _, attr := range span.Attributes() {
+			assert.NotEqual(t, "secret", attr.Value.Emit())
+		}
+	}
+}